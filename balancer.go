@@ -0,0 +1,146 @@
+package birpc
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// BalanceStrategy picks the endpoint of a call, returning its index in
+// pending, which holds the number of calls waiting for their reply on each
+// endpoint of the Balancer.
+type BalanceStrategy func(pending []int) int
+
+// RoundRobin returns the BalanceStrategy picking the endpoints in turn.
+func RoundRobin() BalanceStrategy {
+	var next uint32
+	return func(pending []int) int {
+		return int(atomic.AddUint32(&next, 1)-1) % len(pending)
+	}
+}
+
+// LeastPending returns the BalanceStrategy picking the endpoint with the
+// fewest calls waiting for their reply, the first of them on a tie.
+func LeastPending() BalanceStrategy {
+	return func(pending []int) int {
+		best := 0
+		for i, n := range pending {
+			if n < pending[best] {
+				best = i
+			}
+		}
+		return best
+	}
+}
+
+// Random returns the BalanceStrategy picking the endpoints at random.
+func Random() BalanceStrategy {
+	return func(pending []int) int {
+		return rand.Intn(len(pending))
+	}
+}
+
+// Balancer spreads the calls over the servers at a set of addresses,
+// picking the endpoint of each call with its BalanceStrategy. The
+// connections are dialed on their first use, and again once found shut
+// down.
+type Balancer struct {
+	dial      func(ctx *context.Context, address string) (*Client, error)
+	strategy  BalanceStrategy
+	endpoints []balancerEndpoint
+}
+
+type balancerEndpoint struct {
+	address string
+	mu      sync.Mutex
+	client  *Client
+}
+
+// NewBalancer returns a Balancer over addresses, connecting to them with
+// dial and picking the endpoints with strategy, RoundRobin if nil.
+func NewBalancer(addresses []string, dial func(ctx *context.Context, address string) (*Client, error), strategy BalanceStrategy) *Balancer {
+	if strategy == nil {
+		strategy = RoundRobin()
+	}
+	b := &Balancer{
+		dial:      dial,
+		strategy:  strategy,
+		endpoints: make([]balancerEndpoint, len(addresses)),
+	}
+	for i, address := range addresses {
+		b.endpoints[i].address = address
+	}
+	return b
+}
+
+// pick returns the endpoint chosen by the strategy.
+func (b *Balancer) pick() *balancerEndpoint {
+	pending := make([]int, len(b.endpoints))
+	for i := range b.endpoints {
+		e := &b.endpoints[i]
+		e.mu.Lock()
+		if e.client != nil {
+			pending[i] = e.client.pendingCalls()
+		}
+		e.mu.Unlock()
+	}
+	return &b.endpoints[b.strategy(pending)]
+}
+
+// get returns the client of e, dialing it again if needed.
+func (b *Balancer) get(ctx *context.Context, e *balancerEndpoint) (client *Client, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == nil || e.client.isShutdown() {
+		if e.client, err = b.dial(ctx, e.address); err != nil {
+			return
+		}
+	}
+	return e.client, nil
+}
+
+// Call invokes the named function on one of the endpoints.
+func (b *Balancer) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	if len(b.endpoints) == 0 {
+		return ErrShutdown
+	}
+	client, err := b.get(ctx, b.pick())
+	if err != nil {
+		return err
+	}
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Go is like Client.Go, invoking the function on one of the endpoints.
+// The failure to connect to it is reported by the Call returned.
+func (b *Balancer) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	err := ErrShutdown
+	if len(b.endpoints) != 0 {
+		var client *Client
+		if client, err = b.get(context.Background(), b.pick()); err == nil {
+			return client.Go(serviceMethod, args, reply, done)
+		}
+	}
+	if done == nil {
+		done = make(chan *Call, 1)
+	}
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done, Error: err}
+	call.done()
+	return call
+}
+
+// Close closes the connections to all the endpoints.
+func (b *Balancer) Close() error {
+	for i := range b.endpoints {
+		e := &b.endpoints[i]
+		e.mu.Lock()
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+		e.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// BalancedEndpoint replies with its address, or blocks until release is
+// closed.
+type BalancedEndpoint struct {
+	address string
+	release chan struct{}
+}
+
+func (e *BalancedEndpoint) Address(ctx *context.Context, args Args, reply *string) error {
+	*reply = e.address
+	return nil
+}
+
+func (e *BalancedEndpoint) Block(ctx *context.Context, args Args, reply *string) error {
+	<-e.release
+	return nil
+}
+
+func newTestBalancer(t *testing.T, strategy BalanceStrategy, release chan struct{}) *Balancer {
+	dial := func(ctx *context.Context, address string) (*Client, error) {
+		server := NewServer()
+		server.Register(&BalancedEndpoint{address: address, release: release})
+		c1, c2 := net.Pipe()
+		go server.ServeConn(c2)
+		return NewClient(c1), nil
+	}
+	b := NewBalancer([]string{"a", "b", "c"}, dial, strategy)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestBalancer(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBalancer(t, nil, nil)
+	var got string
+	for _, want := range []string{"a", "b", "c", "a"} {
+		if err := b.Call(ctx, "BalancedEndpoint.Address", Args{}, &got); err != nil || got != want {
+			t.Errorf("expected %q, got %q: %v", want, got, err)
+		}
+	}
+	call := <-b.Go("BalancedEndpoint.Address", Args{}, &got, nil).Done
+	if call.Error != nil || got != "b" {
+		t.Errorf("expected %q, got %q: %v", "b", got, call.Error)
+	}
+
+	b = newTestBalancer(t, Random(), nil)
+	for i := 0; i < 10; i++ {
+		if err := b.Call(ctx, "BalancedEndpoint.Address", Args{}, &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBalancerLeastPending(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	b := newTestBalancer(t, LeastPending(), release)
+	var got string
+	if err := b.Call(ctx, "BalancedEndpoint.Address", Args{}, &got); err != nil || got != "a" {
+		t.Fatalf("expected %q, got %q: %v", "a", got, err)
+	}
+	blocked := b.Go("BalancedEndpoint.Block", Args{}, nil, nil)
+	for _, want := range []string{"b", "b"} {
+		if err := b.Call(ctx, "BalancedEndpoint.Address", Args{}, &got); err != nil || got != want {
+			t.Errorf("expected %q, got %q: %v", want, got, err)
+		}
+	}
+	close(release)
+	if call := <-blocked.Done; call.Error != nil {
+		t.Error(call.Error)
+	}
+}
@@ -7,6 +7,8 @@ package birpc
 import (
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cgrates/birpc/context"
 	"github.com/cgrates/birpc/internal/svc"
@@ -19,11 +21,23 @@ type writeClientCodec interface {
 
 // NewClientWithCodec is like NewClient but uses the specified
 // codec to encode requests and decode responses.
-func newBasicClient(c writeClientCodec) *basicClient {
-	return &basicClient{
+func newBasicClient(c writeClientCodec, opts ...ClientOption) *basicClient {
+	client := &basicClient{
 		wc:      c,
+		id:      newConnID(),
 		pending: make(map[uint64]*Call),
 	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if len(client.interceptors) != 0 {
+		client.invoke = chainClientInterceptors(client.interceptors, client.call)
+	}
+	if client.sendq != nil {
+		client.quit = make(chan struct{})
+		go client.writeLoop()
+	}
+	return client
 }
 
 // basicClient represents an RPC Client.
@@ -32,20 +46,53 @@ func newBasicClient(c writeClientCodec) *basicClient {
 // multiple goroutines simultaneously.
 type basicClient struct {
 	wc       writeClientCodec
+	id       ConnID
 	reqMutex sync.Mutex // protects following
 	request  Request
+	idSent   bool // id was sent along with a request
 
 	mutex    sync.Mutex // protects following
 	seq      uint64
 	pending  map[uint64]*Call
 	closing  bool // user has called Close
 	shutdown bool // server has told us to stop
+
+	goingAway bool // the server sent a GoAway, protected by mutex
+
+	sendq      chan *Call // calls waiting for writeLoop, nil without SendQueue
+	quit       chan struct{}
+	quitOnce   sync.Once
+	writerDone bool // writeLoop no longer takes calls, protected by mutex
+
+	interceptors []ClientInterceptor // see CallInterceptors
+	invoke       Invoker             // their chain, nil without
+
+	clock  atomic.Value // ClockOffset, last estimate
+	blobs  clientBlobs  // the blobs cached by the server
+	deltas clientDeltas // the payloads acknowledged by the server
 }
 
 func (client *basicClient) send(call *Call) {
+	// keep the reading side from completing the call before the write is
+	// recorded; behind a pointer for Call to remain copyable
+	call.writing = new(sync.Mutex)
+	call.writing.Lock()
+	defer call.writing.Unlock()
 	client.reqMutex.Lock()
 	defer client.reqMutex.Unlock()
 
+	// the time left before the deadline of the call goes with the request
+	var timeout time.Duration
+	if call.ctx != nil {
+		if deadline, has := call.ctx.Deadline(); has {
+			if timeout = time.Until(deadline); timeout <= 0 {
+				call.Error = context.DeadlineExceeded
+				call.done()
+				return
+			}
+		}
+	}
+
 	// Register this call.
 	client.mutex.Lock()
 	if client.shutdown || client.closing {
@@ -54,6 +101,13 @@ func (client *basicClient) send(call *Call) {
 		call.done()
 		return
 	}
+	if client.goingAway {
+		client.mutex.Unlock()
+		call.Error = ErrGoAway
+		call.done()
+		client.retireIfIdle()
+		return
+	}
 	if call.seq != 0 {
 		// It has already been canceled, don't bother sending
 		call.Error = context.Canceled
@@ -64,13 +118,42 @@ func (client *basicClient) send(call *Call) {
 	client.seq++
 	seq := client.seq
 	call.seq = seq
+	call.Conn = client.id
 	client.pending[seq] = call
 	client.mutex.Unlock()
 
 	// Encode and send the request.
+	client.request.Timeout = timeout
+	client.request.Metadata = outgoingMetadata(call.ctx)
+	if !client.idSent {
+		// the identity of the connection goes with its first request
+		client.request.Metadata = withConnID(client.request.Metadata, client.id)
+	}
 	client.request.Seq = seq
 	client.request.ServiceMethod = call.ServiceMethod
+	client.request.Depth = call.depth
+	client.request.Fields = call.fields
+	_, raw := call.Reply.(*RawReply)
+	client.request.Raw = raw || call.standalone
+	start := bytesWritten(client.wc)
+	endGuard := client.guardWrite(call.ctx)
 	err := client.wc.WriteRequest(&client.request, call.Args)
+	if endGuard != nil {
+		endGuard()
+		if err != nil && writeInterrupted(call.ctx) {
+			// the request may be partially written, breaking the stream
+			debugln(logPrefix("rpc: closing the connection after an interrupted write", client.id)+":", err)
+			client.wc.Close()
+			if err = call.ctx.Err(); err == nil {
+				err = context.DeadlineExceeded
+			}
+		}
+	}
+	if err == nil {
+		client.idSent = true
+		call.Written = time.Now()
+		call.RequestSize = int(bytesWritten(client.wc) - start)
+	}
 	if err != nil {
 		client.mutex.Lock()
 		call = client.pending[seq]
@@ -96,6 +179,20 @@ func (client *basicClient) Close() error {
 	return client.wc.Close()
 }
 
+// isShutdown reports whether the client can no longer send calls.
+func (client *basicClient) isShutdown() bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.shutdown || client.closing || client.goingAway
+}
+
+// pendingCalls returns the number of calls waiting for their reply.
+func (client *basicClient) pendingCalls() int {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return len(client.pending)
+}
+
 // Go invokes the function asynchronously. It returns the Call structure representing
 // the invocation. The done channel will signal when the call is complete by returning
 // the same Call object. If done is nil, Go will allocate a new channel.
@@ -117,33 +214,72 @@ func (client *basicClient) Go(serviceMethod string, args interface{}, reply inte
 		}
 	}
 	call.Done = done
-	client.send(call)
+	if client.invoke != nil && !internalMethod(serviceMethod) {
+		client.goIntercepted(call)
+		return call
+	}
+	client.enqueue(call)
 	return call
 }
 
 // Call invokes the named function, waits for it to complete, and returns its error status.
 func (client *basicClient) Call(ctx *context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	if client.invoke != nil && !internalMethod(serviceMethod) {
+		return client.invoke(ctx, serviceMethod, args, reply)
+	}
+	return client.call(ctx, serviceMethod, args, reply)
+}
+
+// call is Call without the interceptors.
+func (client *basicClient) call(ctx *context.Context, serviceMethod string, args interface{}, reply interface{}) error {
 	ch := make(chan *Call, 2) // 2 for this call and cancel
-	call := client.Go(serviceMethod, args, reply, ch)
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          ch,
+		depth:         nextCallDepth(ctx),
+		fields:        fieldMask(ctx),
+		verify:        verifyChecksums(ctx),
+		standalone:    standaloneReply(ctx),
+		ctx:           ctx,
+	}
+	client.enqueue(call)
 	select {
 	case <-call.Done:
+		receiveMetadata(ctx, call)
+		interceptedCall(ctx, call)
+		if deadline, has := ctx.Deadline(); has && call.Error != nil && !time.Now().Before(deadline) {
+			// the server gave up on the call at the deadline it was sent,
+			// maybe before the context noticed
+			return context.DeadlineExceeded
+		}
 		return call.Error
 	case <-ctx.Done():
-		// Cancel the pending request on the client
-		client.mutex.Lock()
-		seq := call.seq
-		_, ok := client.pending[seq]
-		delete(client.pending, seq)
-		if seq == 0 {
-			// hasn't been sent yet, non-zero will prevent send
-			call.seq = 1
-		}
-		client.mutex.Unlock()
-
-		// Cancel running request on the server
-		if seq != 0 && ok {
-			client.Go("_goRPC_.Cancel", &svc.CancelArgs{Seq: seq}, nil, ch)
-		}
+		client.abandon(call)
 		return ctx.Err()
 	}
 }
+
+// abandon forgets call, canceling it on the server if it was sent. The
+// cancel call reports to the Done channel of call.
+func (client *basicClient) abandon(call *Call) {
+	// Cancel the pending request on the client
+	client.mutex.Lock()
+	seq := call.seq
+	_, ok := client.pending[seq]
+	delete(client.pending, seq)
+	if seq == 0 {
+		// hasn't been sent yet, non-zero will prevent send
+		call.seq = 1
+	}
+	client.mutex.Unlock()
+	if call.stream != nil {
+		call.stream.once.Do(func() { close(call.stream.quit) })
+	}
+
+	// Cancel running request on the server
+	if seq != 0 && ok {
+		client.Go("_goRPC_.Cancel", &svc.CancelArgs{Seq: seq}, nil, call.Done)
+	}
+}
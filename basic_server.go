@@ -5,9 +5,14 @@
 package birpc
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cgrates/birpc/internal/svc"
 )
@@ -16,19 +21,89 @@ type writeServerCodec interface {
 	WriteResponse(*Response, interface{}) error
 }
 
-func newBasicServer() (bs *basicServer) {
+func newBasicServer(opts ...ServerOption) (bs *basicServer) {
 	bs = new(basicServer)
+	bs.config.Store(new(ServerConfig))
+	bs.deadlines.remaining = NewHistogram()
+	bs.handoff.started = make(chan struct{})
+	bs.drained = make(chan struct{})
+	bs.stopped = make(chan struct{})
+	for _, opt := range opts {
+		opt(bs)
+	}
 	bs.RegisterName("_goRPC_", &svc.GoRPC{})
 	return
 }
 
 // Server represents an RPC Server.
 type basicServer struct {
+	// the counters updated atomically come first, the 64-bit atomic ops
+	// needing them aligned on the 32-bit platforms
+	conns     int64         // number of connections being served
+	inflight  int64         // number of calls being served
+	cost      int64         // total cost of the calls being served
+	pipeline  pipelineStats // of the Server, see PipelineStats
+	deadlines deadlineStats
+
 	serviceMap sync.Map   // map[string]*service
 	reqLock    sync.Mutex // protects freeReq
 	freeReq    *Request
 	respLock   sync.Mutex // protects freeResp
 	freeResp   *Response
+
+	config  atomic.Value // *ServerConfig
+	limiter tokenBucket
+	connSet sync.Map // *serverConn -> struct{}, for Diagnostics
+
+	methodLimiters    methodLimiters    // see MethodRateLimits
+	methodConcurrency methodConcurrency // see MethodConcurrency
+	slos              sloTrackers       // see MethodSLOs
+	debug             debugFilters      // see DebugFilter
+
+	foldNames bool // resolve the names case-insensitively
+	serial    bool // serve the calls of a connection in order
+
+	foldMu sync.Mutex // serializes the registrations checking the folded names
+
+	dedup *dedupWindow // nil unless DedupWindow is used
+
+	idempotency *idempotencyCache // nil unless IdempotencyCache is used
+	pool        *workerPool       // nil unless WorkerPool is used
+	edf         bool              // see EarliestDeadlineFirst
+	fair        bool              // see FairQueueing
+	watchdog    *watchdog         // nil unless StallWatchdog is used
+	writeRetry  *writeRetry       // nil unless WriteRetries is used
+	timings     *methodTimingsMap // nil unless RecordMethodTimings is used
+	fieldKeys   KeyProvider       // nil unless FieldEncryption is used
+	panics      *panicRecovery    // nil unless RecoverPanics is used
+	profiling   *methodProfiling  // nil unless ProfileMethods is used
+	tracing     *callTracing      // nil unless TraceProfiledCalls is used
+	handlers    *handlerLimit     // nil unless MaxHandlers is used
+
+	interceptors []ServerInterceptor // see ServerInterceptors
+
+	blobCacheSize int // bytes of blobs cached by connection, see BlobCache
+	deltaSize     int // bytes of payloads kept by connection, see DeltaEncoding
+
+	handoff handoffs // see Handoff
+
+	shuttingDown int32         // see Shutdown
+	stopped      chan struct{} // closed by Shutdown
+	stopOnce     sync.Once
+	listeners    sync.Map      // net.Listener -> struct{}, closed by Shutdown
+	maxConnAge   time.Duration // see MaxConnectionAge
+	connAgeGrace time.Duration // before closing the connections after their GoAway
+
+	maxConnCalls   int64         // see MaxConnectionCalls
+	connCallsGrace time.Duration // before closing the connections after their GoAway
+
+	draining  int32         // see Drain
+	drained   chan struct{} // closed once drained
+	drainOnce sync.Once
+
+	// the verification of the client certificates, see ServeTLS
+	clientCAs  *x509.CertPool
+	clientAuth tls.ClientAuthType
 }
 
 // Register publishes in the server the set of methods of the
@@ -41,21 +116,38 @@ type basicServer struct {
 // no suitable methods. It also logs the error using package log.
 // The client accesses each method using a string of the form "Type.Method",
 // where Type is the receiver's concrete type.
-func (server *basicServer) Register(rcvr interface{}) error {
-	return server.register(rcvr, "", false)
+func (server *basicServer) Register(rcvr interface{}, opts ...RegisterOption) error {
+	return server.register(rcvr, "", false, opts)
 }
 
 // RegisterName is like Register but uses the provided name for the type
 // instead of the receiver's concrete type.
-func (server *basicServer) RegisterName(name string, rcvr interface{}) error {
-	return server.register(rcvr, name, true)
+func (server *basicServer) RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	return server.register(rcvr, name, true, opts)
 }
 
-func (server *basicServer) register(rcvr interface{}, name string, useName bool) (err error) {
+// RegisterFuncs publishes in the server the handlers of a struct of
+// funcs under the given service name, see NewFuncService.
+func (server *basicServer) RegisterFuncs(name string, handlers interface{}, opts ...RegisterOption) error {
+	srv, err := NewFuncService(name, handlers, opts...)
+	if err != nil {
+		return err
+	}
+	return server.register(srv, name, true, nil)
+}
+
+func (server *basicServer) register(rcvr interface{}, name string, useName bool, opts []RegisterOption) (err error) {
 	var srv *Service
 	var isService bool
 	if srv, isService = rcvr.(*Service); !isService { // is already defined as a service
-		if srv, err = NewService(rcvr, name, useName); err != nil {
+		if srv, err = NewService(rcvr, name, useName, opts...); err != nil {
+			return
+		}
+	}
+	if server.foldNames {
+		server.foldMu.Lock()
+		defer server.foldMu.Unlock()
+		if err = server.checkFolded(srv); err != nil {
 			return
 		}
 	}
@@ -118,6 +210,13 @@ func (server *basicServer) freeResponse(resp *Response) {
 }
 
 func (server *basicServer) getService(req *Request) (svc *Service, mtype *MethodType, err error) {
+	if to, has := server.getConfig().MethodAliases[req.ServiceMethod]; has {
+		debugf("rpc: method %s called by its alias %s\n", to, req.ServiceMethod)
+		req.ServiceMethod = to
+	}
+	if server.foldNames {
+		return server.getServiceFold(req)
+	}
 	dot := strings.LastIndex(req.ServiceMethod, ".")
 	if dot < 0 {
 		err = errors.New("rpc: service/method request ill-formed: " + req.ServiceMethod)
@@ -140,24 +239,120 @@ func (server *basicServer) getService(req *Request) (svc *Service, mtype *Method
 	return
 }
 
+// getServiceFold is getService for servers with CaseInsensitiveMethods.
+// It rewrites the ServiceMethod of req to the registered name.
+func (server *basicServer) getServiceFold(req *Request) (svc *Service, mtype *MethodType, err error) {
+	serviceMethod := strings.TrimSpace(req.ServiceMethod)
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		err = errors.New("rpc: service/method request ill-formed: " + req.ServiceMethod)
+		return
+	}
+	serviceName := strings.TrimSpace(serviceMethod[:dot])
+	methodName := strings.TrimSpace(serviceMethod[dot+1:])
+
+	if svci, ok := server.serviceMap.Load(serviceName); ok {
+		svc = svci.(*Service)
+	} else {
+		server.serviceMap.Range(func(key, value interface{}) bool {
+			if strings.EqualFold(key.(string), serviceName) {
+				svc = value.(*Service)
+				return false
+			}
+			return true
+		})
+	}
+	if svc == nil {
+		err = errors.New("rpc: can't find service " + req.ServiceMethod)
+		return
+	}
+	if mtype = svc.Methods[methodName]; mtype == nil {
+		for name, mt := range svc.Methods {
+			if strings.EqualFold(name, methodName) {
+				methodName, mtype = name, mt
+				break
+			}
+		}
+	}
+	if mtype == nil {
+		err = errors.New("rpc: can't find method " + req.ServiceMethod)
+		return
+	}
+	req.ServiceMethod = svc.Name + "." + methodName
+	return
+}
+
+// checkFolded returns an error if the names of srv differ only by case from
+// the registered ones or from each other, getServiceFold being unable to
+// tell them apart.
+func (server *basicServer) checkFolded(srv *Service) (err error) {
+	server.serviceMap.Range(func(key, _ interface{}) bool {
+		if name := key.(string); name != srv.Name && strings.EqualFold(name, srv.Name) {
+			err = errors.New("rpc: service " + srv.Name + " differs only by case from " + name)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return
+	}
+	names := make([]string, 0, len(srv.Methods))
+	for name := range srv.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, a := range names {
+		for _, b := range names[i+1:] {
+			if strings.EqualFold(a, b) {
+				return errors.New("rpc: methods " + a + " and " + b + " of service " + srv.Name + " differ only by case")
+			}
+		}
+	}
+	return
+}
+
 // A value sent as a placeholder for the server's response value when the server
 // receives an invalid request. It is never decoded by the client since the Response
 // contains an error when it is used.
 var invalidRequest = struct{}{}
 
+// ackReply is sent as the response value of the methods without reply.
+// Clients calling them pass a nil reply, or a pointer to a struct which is
+// left untouched.
+var ackReply = struct{}{}
+
 func (server *basicServer) sendResponse(sending *sync.Mutex, req *Request, reply interface{}, codec writeServerCodec, errmsg string) {
+	server.sendChecksummedResponse(sending, req, reply, codec, errmsg, "")
+}
+
+// sendChecksummedResponse is sendResponse sending the checksum of reply
+// too, if not empty.
+func (server *basicServer) sendChecksummedResponse(sending *sync.Mutex, req *Request, reply interface{}, codec writeServerCodec, errmsg, checksum string) {
 	resp := server.getResponse()
+	resp.Checksum = checksum
 	// Encode the response header
 	if errmsg != "" {
 		resp.Error = errmsg
+		extras, _ := reply.(*errorExtras)
 		reply = invalidRequest
+		if extras != nil {
+			resp.Code = extras.code
+			if extras.detail != nil {
+				resp.Detail, reply = true, extras.detail
+				resp.DetailType = extras.detailType
+			}
+		}
 	}
 	resp.Seq = req.Seq
-	sending.Lock()
-	err := codec.WriteResponse(resp, reply)
-	if err != nil {
+	resp.Metadata = req.replyMetadata
+	if encoding, err := writeResponse(sending, codec, resp, reply); err != nil {
 		debugln("rpc: writing response:", err)
+	} else {
+		server.responseWritten()
+		server.observeEncode(req, encoding)
+		if req.debug != nil {
+			debugEnd(codec, req, reply, errmsg, encoding)
+		}
 	}
-	sending.Unlock()
 	server.freeResponse(resp)
 }
@@ -13,7 +13,9 @@ package birpc
 import (
 	"errors"
 	"io"
+	"reflect"
 	"sync"
+	"time"
 
 	"github.com/cgrates/birpc/context"
 	"github.com/cgrates/birpc/internal/svc"
@@ -38,16 +40,18 @@ type BirpcClient struct {
 // set of services at the other end of the connection.
 // It adds a buffer to the write side of the connection so
 // the header and payload are sent as a unit.
-func NewBirpcClient(conn io.ReadWriteCloser) *BirpcClient {
-	return NewBirpcClientWithCodec(NewGobBirpcCodec(conn))
+// The options configure how the requests coming from the other end are
+// served.
+func NewBirpcClient(conn io.ReadWriteCloser, opts ...ServerOption) *BirpcClient {
+	return NewBirpcClientWithCodec(NewGobBirpcCodec(conn), opts...)
 }
 
 // NewBirpcClientWithCodec is like NewBirpcClient but uses the specified
 // codec to encode requests and decode responses.
-func NewBirpcClientWithCodec(codec BirpcCodec) *BirpcClient {
+func NewBirpcClientWithCodec(codec BirpcCodec, opts ...ServerOption) *BirpcClient {
 	c := &BirpcClient{
 		codec:       codec,
-		basicServer: newBasicServer(),
+		basicServer: newBasicServer(opts...),
 		basicClient: newBasicClient(codec),
 
 		disconnect: make(chan struct{}),
@@ -75,25 +79,30 @@ func (c *BirpcClient) input() {
 	defer cancel()
 	pending := svc.NewPending(ctx)
 	wg := new(sync.WaitGroup)
+	conn := newServerConn(c.codec, sending, pending, wg)
+	defer c.trackConn(conn)()
 	for err == nil {
 		req := c.getRequest()
 		resp = Response{}
+		start := bytesRead(c.codec)
 		if err = c.codec.ReadHeader(req, &resp); err != nil {
 			break
 		}
+		conn.reads.wait()
 
 		if req.ServiceMethod != "" {
 			// request comes to server
-			if err := c.readRequest(req, sending, pending, wg); err != nil {
-				debugln("birpc: error reading request:", err.Error())
+			req.setDeadline()
+			if err := c.readRequest(req, conn); err != nil {
+				debugln(logPrefix("birpc: error reading request", conn.connID())+":", err.Error())
 				c.sendResponse(sending, req, invalidRequest, c.codec, err.Error())
 				c.freeRequest(req)
 			}
 		} else {
 			c.freeRequest(req)
 			// response comes to client
-			if err = c.readResponse(&resp); err != nil {
-				debugln("birpc: error reading response:", err.Error())
+			if err = c.readResponse(&resp, start); err != nil {
+				debugln(logPrefix("birpc: error reading response", c.id)+":", err.Error())
 			}
 		}
 	}
@@ -109,14 +118,17 @@ func (c *BirpcClient) input() {
 			err = io.ErrUnexpectedEOF
 		}
 	}
+	callErr := connError(c.id, err)
 	for _, call := range c.pending {
-		call.Error = err
+		call.Error = callErr
 		call.done()
 	}
 	c.mutex.Unlock()
 	sending.Unlock()
+	c.stopWriter()
+	close(conn.closed)
 	if err != io.EOF && !closing && !c.server {
-		debugln("birpc: client protocol error:", err)
+		debugln(logPrefix("birpc: client protocol error", c.id)+":", err)
 	}
 	wg.Wait()
 	close(c.disconnect)
@@ -125,29 +137,56 @@ func (c *BirpcClient) input() {
 	}
 }
 
-func (c *BirpcClient) readRequest(req *Request, sending *sync.Mutex, pending *svc.Pending, wg *sync.WaitGroup) error {
+func (c *BirpcClient) readRequest(req *Request, conn *serverConn) error {
+	conn.readConnID(req)
+	if req.Item || req.End {
+		conn.readUploadItem(c.codec, req)
+		c.freeRequest(req)
+		return nil
+	}
 	svc, mtype, err := c.getService(req)
 	if err != nil {
 		return errors.New("birpc: can't find method " + req.ServiceMethod)
 	}
+	if mtype.upload {
+		// the items follow the request
+		if err := c.codec.ReadRequestBody(nil); err != nil {
+			return err
+		}
+		conn.serve(c.basicServer, svc, mtype, req, reflect.ValueOf(conn.openUpload(req.Seq)), getReplyv(mtype))
+		return nil
+	}
 
 	// Decode the argument value.
 	argv, argIsValue := getArgv(mtype) // if true, need to indirect before calling.
 	// argv guaranteed to be a pointer now.
+	start := time.Now()
 	if err := c.codec.ReadRequestBody(argv.Interface()); err != nil {
 		return err
 	}
+	c.observeDecode(svc, req, start)
 	if argIsValue {
 		argv = argv.Elem()
 	}
 	replyv := getReplyv(mtype)
-	wg.Add(1)
-	go svc.call(c.basicServer, sending, pending, wg, mtype, req, argv, replyv, c.codec)
+	conn.serve(c.basicServer, svc, mtype, req, argv, replyv)
 
 	return nil
 }
 
-func (c *BirpcClient) readResponse(resp *Response) error {
+// readResponse reads the body of resp, whose header was read starting
+// at start bytes read by the codec.
+func (c *BirpcClient) readResponse(resp *Response, start int64) error {
+	if resp.More {
+		return c.readStreamItem(c.codec, resp)
+	}
+	if resp.GoAway {
+		err := c.codec.ReadResponseBody(nil)
+		if err == nil {
+			c.goAway()
+		}
+		return err
+	}
 	seq := resp.Seq
 	c.mutex.Lock()
 	call := c.pending[seq]
@@ -170,19 +209,25 @@ func (c *BirpcClient) readResponse(resp *Response) error {
 		// We've got an error response. Give this to the request;
 		// any subsequent requests will get the ReadResponseBody
 		// error if there is one.
-		call.Error = ServerError(resp.Error)
-		err = c.codec.ReadResponseBody(nil)
+		call.Metadata = resp.Metadata
+		call.Error, err = readErrorBody(c.codec, resp)
 		if err != nil {
 			err = errors.New("reading error body: " + err.Error())
 		}
+		call.received(c.codec, start)
 		call.done()
 	default:
-		err = c.codec.ReadResponseBody(call.Reply)
+		err = readCallReply(c.codec, call)
 		if err != nil {
 			call.Error = errors.New("reading body " + err.Error())
 		}
+		call.Checksum = resp.Checksum
+		call.Metadata = resp.Metadata
+		call.verifyReply()
+		call.received(c.codec, start)
 		call.done()
 	}
+	c.retireIfIdle()
 
 	return err
 }
@@ -12,9 +12,13 @@ package birpc
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/gob"
 	"io"
 	"log"
+	"net"
+	"sync/atomic"
+	"time"
 )
 
 // A Codec implements reading and writing of RPC requests and responses.
@@ -50,25 +54,66 @@ type gobCodec struct {
 	dec    *gob.Decoder
 	enc    *gob.Encoder
 	encBuf *bufio.Writer
+	cw     *countingWriter
+	cr     *countingReader
 }
 
 type message struct {
 	Seq           uint64
 	ServiceMethod string
 	Error         string
+	Depth         int
+	Fields        []string
+	Raw           bool
+	Checksum      string
+	More          bool
+	Item          bool
+	End           bool
+	Code          int
+	Detail        bool
+	DetailType    string
+	Timeout       time.Duration
+	Metadata      map[string]string
+	GoAway        bool
 }
 
 // NewGobCodec returns a new biCodec using gob encoding/decoding on conn.
 func NewGobBirpcCodec(conn io.ReadWriteCloser) BirpcCodec {
 	buf := bufio.NewWriter(conn)
+	cw := &countingWriter{w: conn}
+	cr := newCountingReader(conn)
 	return &gobCodec{
 		rwc:    conn,
-		dec:    gob.NewDecoder(conn),
-		enc:    gob.NewEncoder(conn),
+		dec:    gob.NewDecoder(cr),
+		enc:    gob.NewEncoder(cw),
 		encBuf: buf,
+		cw:     cw,
+		cr:     cr,
 	}
 }
 
+// BytesWritten implements MessageSizer.
+func (c *gobCodec) BytesWritten() int64 { return atomic.LoadInt64(&c.cw.n) }
+
+// BytesRead implements MessageSizer.
+func (c *gobCodec) BytesRead() int64 { return atomic.LoadInt64(&c.cr.n) }
+
+// ReadRawResponseBody reads a reply requested as RawReply.
+func (c *gobCodec) ReadRawResponseBody(raw *RawReply) error {
+	return gobReadRaw(c.dec, raw)
+}
+
+// EncodeRawReply encodes a reply requested as RawReply.
+func (c *gobCodec) EncodeRawReply(reply interface{}) ([]byte, error) {
+	return gobEncodeRaw(reply)
+}
+
+// SetWriteDeadline sets the write deadline of the connection, letting the
+// client bound the writes by the context of the calls.
+func (c *gobCodec) SetWriteDeadline(t time.Time) error {
+	return setWriteDeadline(c.rwc, t)
+}
+
 func (c *gobCodec) ReadHeader(req *Request, resp *Response) error {
 	var msg message
 	if err := c.dec.Decode(&msg); err != nil {
@@ -78,9 +123,23 @@ func (c *gobCodec) ReadHeader(req *Request, resp *Response) error {
 	if msg.ServiceMethod != "" {
 		req.Seq = msg.Seq
 		req.ServiceMethod = msg.ServiceMethod
+		req.Depth = msg.Depth
+		req.Fields = msg.Fields
+		req.Raw = msg.Raw
+		req.Item = msg.Item
+		req.End = msg.End
+		req.Timeout = msg.Timeout
+		req.Metadata = msg.Metadata
 	} else {
 		resp.Seq = msg.Seq
 		resp.Error = msg.Error
+		resp.Checksum = msg.Checksum
+		resp.More = msg.More
+		resp.Code = msg.Code
+		resp.Detail = msg.Detail
+		resp.DetailType = msg.DetailType
+		resp.Metadata = msg.Metadata
+		resp.GoAway = msg.GoAway
 	}
 	return nil
 }
@@ -128,3 +187,15 @@ func (c *gobCodec) WriteResponse(r *Response, body interface{}) (err error) {
 func (c *gobCodec) Close() error {
 	return c.rwc.Close()
 }
+
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *gobCodec) RemoteAddr() net.Addr {
+	return connRemoteAddr(c.rwc)
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *gobCodec) TLSConnectionState() *tls.ConnectionState {
+	return ConnTLSState(c.rwc)
+}
@@ -39,10 +39,10 @@ type disconnectionEvent struct {
 func (connectionEvent) Kind() hub.Kind    { return clientConnected }
 func (disconnectionEvent) Kind() hub.Kind { return clientDisconnected }
 
-// NewBirpcServer returns a new BirpcServer.
-func NewBirpcServer() *BirpcServer {
+// NewBirpcServer returns a new BirpcServer configured with the given options.
+func NewBirpcServer(opts ...ServerOption) *BirpcServer {
 	return &BirpcServer{
-		basicServer: newBasicServer(),
+		basicServer: newBasicServer(opts...),
 		eventHub:    &hub.Hub{},
 	}
 }
@@ -62,13 +62,15 @@ func (s *BirpcServer) OnDisconnect(f func(ClientConnector)) {
 }
 
 // Accept accepts connections on the listener and serves requests
-// for each incoming connection.  Accept blocks; the caller typically
-// invokes it in a go statement.
+// for each incoming connection.  Accept blocks until the listener returns
+// a non-nil error, ErrServerClosed once shut down, see Shutdown; the caller
+// typically invokes it in a go statement.
 func (s *BirpcServer) Accept(lis net.Listener) error {
+	defer s.trackListener(lis)()
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
-			return err
+			return s.acceptError(err)
 		}
 		go s.ServeConn(conn)
 	}
@@ -80,13 +82,18 @@ func (s *BirpcServer) Accept(lis net.Listener) error {
 // ServeConn uses the gob wire format (see package gob) on the
 // connection.  To use an alternate codec, use ServeCodec.
 func (s *BirpcServer) ServeConn(conn io.ReadWriteCloser) {
-	s.ServeCodec(NewGobBirpcCodec(conn))
+	s.ServeCodec(NewGobBirpcCodec(s.writeRetry.wrap(conn)))
 }
 
 // ServeCodec is like ServeConn but uses the specified codec to
 // decode requests and encode responses.
 func (s *BirpcServer) ServeCodec(codec BirpcCodec) {
 	defer codec.Close()
+	if !s.acquireConn() {
+		debugln("birpc: too many connections")
+		return
+	}
+	defer s.releaseConn()
 
 	// Client also handles the incoming connections.
 	c := &BirpcClient{
@@ -97,6 +104,7 @@ func (s *BirpcServer) ServeCodec(codec BirpcCodec) {
 		server:     true,
 		disconnect: make(chan struct{}),
 	}
+	c.idSent = true // the identity of the connection is the one of the client
 
 	s.eventHub.Publish(connectionEvent{c})
 	c.input()
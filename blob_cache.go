@@ -0,0 +1,147 @@
+package birpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+// ErrBlobNotCached is returned by CallInfo.BlobData for the blobs sent by
+// hash which the connection does not hold.
+var ErrBlobNotCached = errors.New("rpc: blob not cached on the connection")
+
+// blobCacheFull starts the errors of the servers without room for a blob.
+const blobCacheFull = "rpc: blob cache full"
+
+// Blob is a large immutable payload, like a bundle of tariff plan files,
+// carried in the arguments of the calls. Once cached by the server, see
+// the Blob method of the clients, it is sent by hash only.
+type Blob struct {
+	Hash string // hex encoded SHA-256 of the data
+	Data []byte // nil when cached by the server
+}
+
+// BlobHash returns the hash identifying data in a Blob.
+func BlobHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BlobCache makes the server cache up to maxBytes of blobs for each
+// connection, sent once by the clients and then referenced by hash, see
+// Blob. The blobs are dropped with the connection.
+func BlobCache(maxBytes int) ServerOption {
+	return func(server *basicServer) {
+		server.blobCacheSize = maxBytes
+	}
+}
+
+// emptyBlobHash is the hash of the empty blobs, whose data some codecs
+// decode as nil.
+var emptyBlobHash = BlobHash(nil)
+
+// blobStore holds the blobs cached for a connection.
+type blobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte // by hash
+	size  int
+}
+
+// put caches data unless it would exceed max bytes, returning its hash.
+func (s *blobStore) put(data []byte, max int) (string, error) {
+	if max <= 0 {
+		return "", errors.New("rpc: blob cache disabled")
+	}
+	hash := BlobHash(data)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, has := s.blobs[hash]; has {
+		return hash, nil
+	}
+	if s.size+len(data) > max {
+		return "", errors.New(blobCacheFull + ", " + strconv.Itoa(s.size) + " bytes used")
+	}
+	if s.blobs == nil {
+		s.blobs = make(map[string][]byte)
+	}
+	s.blobs[hash] = data
+	s.size += len(data)
+	return hash, nil
+}
+
+func (s *blobStore) get(hash string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, has := s.blobs[hash]
+	return data, has
+}
+
+// BlobData returns the data of b, sent along with it or cached on the
+// connection of the call.
+func (info *CallInfo) BlobData(b Blob) ([]byte, error) {
+	if b.Data != nil || b.Hash == "" || b.Hash == emptyBlobHash {
+		return b.Data, nil
+	}
+	if info.blobs != nil {
+		if data, has := info.blobs.get(b.Hash); has {
+			return data, nil
+		}
+	}
+	return nil, ErrBlobNotCached
+}
+
+// clientBlobs tracks the blobs cached by the server for a client.
+type clientBlobs struct {
+	mu          sync.Mutex
+	cached      map[string]bool // by hash
+	unsupported bool            // the server does not cache the blobs
+}
+
+// Blob returns data as a Blob for the arguments of the calls. The first
+// time, data is sent to the server to be cached for the connection, the
+// Blob referencing it by hash. The data is carried in the Blob instead for
+// the servers not caching it, either older ones or ones without room for
+// it, see BlobCache.
+func (client *basicClient) Blob(ctx *context.Context, data []byte) (Blob, error) {
+	hash := BlobHash(data)
+	b := &client.blobs
+	b.mu.Lock()
+	cached, unsupported := b.cached[hash], b.unsupported
+	b.mu.Unlock()
+	if cached {
+		return Blob{Hash: hash}, nil
+	}
+	if unsupported {
+		return Blob{Hash: hash, Data: data}, nil
+	}
+	var reply string
+	err := client.Call(ctx, "_goRPC_.PutBlob", &svc.BlobArgs{Data: data}, &reply)
+	if _, isServerErr := err.(ServerError); isServerErr {
+		// the servers without room for the blob keep caching the others
+		if !strings.HasPrefix(err.Error(), blobCacheFull) {
+			b.mu.Lock()
+			b.unsupported = true
+			b.mu.Unlock()
+		}
+		return Blob{Hash: hash, Data: data}, nil
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+	if reply != hash {
+		return Blob{}, errors.New("rpc: blob hash mismatch: " + reply)
+	}
+	b.mu.Lock()
+	if b.cached == nil {
+		b.cached = make(map[string]bool)
+	}
+	b.cached[hash] = true
+	b.mu.Unlock()
+	return Blob{Hash: hash}, nil
+}
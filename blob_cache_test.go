@@ -0,0 +1,79 @@
+package birpc
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type TariffPlans struct{}
+
+func (TariffPlans) Load(ctx *context.Context, plan Blob, size *int, info *CallInfo) error {
+	data, err := info.BlobData(plan)
+	*size = len(data)
+	return err
+}
+
+func TestBlobCache(t *testing.T) {
+	server := NewServer(BlobCache(100))
+	server.Register(TariffPlans{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	plan := bytes.Repeat([]byte("prefix,rate;"), 5)
+	for i := 0; i < 2; i++ {
+		b, err := client.Blob(ctx, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Data != nil || b.Hash != BlobHash(plan) {
+			t.Errorf("expected the blob to be sent by hash, got %+v", b)
+		}
+		var size int
+		if err = client.Call(ctx, "TariffPlans.Load", b, &size); err != nil || size != len(plan) {
+			t.Errorf("expected %d bytes, got %d: %v", len(plan), size, err)
+		}
+	}
+
+	// the blobs without room in the cache are sent along with the calls
+	big := bytes.Repeat([]byte{'x'}, 80)
+	b, err := client.Blob(ctx, big)
+	if err != nil || !bytes.Equal(b.Data, big) {
+		t.Errorf("expected the blob to carry its data, got %+v: %v", b, err)
+	}
+	var size int
+	if err = client.Call(ctx, "TariffPlans.Load", b, &size); err != nil || size != len(big) {
+		t.Errorf("expected %d bytes, got %d: %v", len(big), size, err)
+	}
+	if b, err = client.Blob(ctx, []byte("small")); err != nil || b.Data != nil {
+		t.Errorf("expected the small blob to be cached, got %+v: %v", b, err)
+	}
+
+	if err = client.Call(ctx, "TariffPlans.Load", Blob{Hash: BlobHash(big)}, &size); err == nil ||
+		err.Error() != ErrBlobNotCached.Error() {
+		t.Errorf("expected %v, got %v", ErrBlobNotCached, err)
+	}
+}
+
+func TestBlobCacheFallback(t *testing.T) {
+	server := NewServer() // no BlobCache
+	server.Register(TariffPlans{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	plan := []byte("prefix,rate;")
+	for i := 0; i < 2; i++ {
+		b, err := client.Blob(ctx, plan)
+		if err != nil || !bytes.Equal(b.Data, plan) {
+			t.Errorf("expected the blob to carry its data, got %+v: %v", b, err)
+		}
+		var size int
+		if err = client.Call(ctx, "TariffPlans.Load", b, &size); err != nil || size != len(plan) {
+			t.Errorf("expected %d bytes, got %d: %v", len(plan), size, err)
+		}
+	}
+	if !client.blobs.unsupported {
+		t.Error("expected the server to be known without blob cache")
+	}
+}
@@ -0,0 +1,109 @@
+package birpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrNoQuorum is returned by CallAll when fewer targets than the quorum
+// answered successfully.
+var ErrNoQuorum = errors.New("rpc: quorum not reached")
+
+// CallResult is the outcome of a call made by CallAll on one target.
+type CallResult struct {
+	Target ClientConnector
+	Reply  interface{} // nil if the call did not complete
+	Error  error
+}
+
+// CallAllOption customizes CallAll.
+type CallAllOption func(*callAllOptions)
+
+type callAllOptions struct {
+	quorum   int
+	timeout  time.Duration
+	newReply func() interface{}
+}
+
+// Quorum makes CallAll return as soon as n targets answered successfully,
+// canceling the calls still running, or as soon as that is no longer
+// possible.
+func Quorum(n int) CallAllOption {
+	return func(o *callAllOptions) { o.quorum = n }
+}
+
+// GlobalTimeout bounds all the calls made by CallAll together.
+func GlobalTimeout(d time.Duration) CallAllOption {
+	return func(o *callAllOptions) { o.timeout = d }
+}
+
+// ReplyFactory sets the function allocating the reply of each call made by
+// CallAll, *RawReply by default.
+func ReplyFactory(newReply func() interface{}) CallAllOption {
+	return func(o *callAllOptions) { o.newReply = newReply }
+}
+
+// CallAll calls serviceMethod with args on all the targets concurrently
+// and returns their results, in the order of the targets. The calls not
+// completed when CallAll returns, because of the quorum or the deadline,
+// have the context error. The error is ErrNoQuorum if a quorum was asked
+// for and not reached.
+func CallAll(ctx *context.Context, targets []ClientConnector, serviceMethod string, args interface{}, opts ...CallAllOption) ([]CallResult, error) {
+	o := callAllOptions{newReply: func() interface{} { return new(RawReply) }}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var cancel context.CancelFunc
+	if o.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type done struct {
+		i     int
+		reply interface{}
+		err   error
+	}
+	results := make([]CallResult, len(targets))
+	ch := make(chan done, len(targets)) // the late calls never block
+	for i, target := range targets {
+		results[i].Target = target
+		go func(i int, target ClientConnector) {
+			reply := o.newReply()
+			ch <- done{i, reply, target.Call(ctx, serviceMethod, args, reply)}
+		}(i, target)
+	}
+
+	var ok, failed int
+	completed := make([]bool, len(targets))
+	for n := 0; n < len(targets); n++ {
+		d := <-ch
+		completed[d.i] = true
+		results[d.i].Error = d.err
+		if d.err != nil {
+			failed++
+		} else {
+			results[d.i].Reply = d.reply
+			ok++
+		}
+		if o.quorum > 0 && (ok >= o.quorum || len(targets)-failed < o.quorum) {
+			break
+		}
+	}
+	for i, c := range completed {
+		if !c {
+			results[i].Error = context.Canceled
+			if err := ctx.Err(); err != nil {
+				results[i].Error = err
+			}
+		}
+	}
+	if o.quorum > 0 && ok < o.quorum {
+		return results, ErrNoQuorum
+	}
+	return results, nil
+}
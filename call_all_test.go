@@ -0,0 +1,98 @@
+package birpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Rater struct {
+	rate  float64
+	delay time.Duration
+	err   error
+}
+
+func (r *Rater) Rate(ctx *context.Context, dest string, reply *float64) error {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	*reply = r.rate
+	return r.err
+}
+
+func newRaters(t *testing.T, raters ...*Rater) (targets []ClientConnector) {
+	for _, r := range raters {
+		server := NewServer()
+		server.Register(r)
+		targets = append(targets, newPipeClient(t, server))
+	}
+	return
+}
+
+func TestCallAll(t *testing.T) {
+	ctx := context.Background()
+	targets := newRaters(t,
+		&Rater{rate: 1},
+		&Rater{err: errors.New("no rate")},
+		&Rater{rate: 3, delay: 10 * time.Millisecond})
+
+	results, err := CallAll(ctx, targets, "Rater.Rate", "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rate float64
+	if err := results[0].Reply.(*RawReply).Decode(&rate); err != nil || rate != 1 {
+		t.Errorf("unexpected rate %v: %v", rate, err)
+	}
+	if results[1].Error == nil || results[1].Reply != nil {
+		t.Errorf("unexpected result %+v", results[1])
+	}
+	if results[2].Target != targets[2] || results[2].Error != nil {
+		t.Errorf("unexpected result %+v", results[2])
+	}
+
+	results, err = CallAll(ctx, targets, "Rater.Rate", "1001",
+		ReplyFactory(func() interface{} { return new(float64) }),
+		GlobalTimeout(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *results[0].Reply.(*float64) != 1 {
+		t.Errorf("unexpected result %+v", results[0])
+	}
+	if !errors.Is(results[2].Error, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", results[2].Error)
+	}
+}
+
+func TestCallAllQuorum(t *testing.T) {
+	ctx := context.Background()
+	targets := newRaters(t,
+		&Rater{rate: 1},
+		&Rater{rate: 2, delay: time.Hour},
+		&Rater{rate: 3})
+
+	start := time.Now()
+	results, err := CallAll(ctx, targets, "Rater.Rate", "1001", Quorum(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("CallAll waited for the slow target")
+	}
+	if results[1].Error != context.Canceled || results[0].Error != nil || results[2].Error != nil {
+		t.Errorf("unexpected results %+v", results)
+	}
+
+	targets = newRaters(t,
+		&Rater{err: errors.New("no rate")},
+		&Rater{rate: 2, delay: time.Hour},
+		&Rater{err: errors.New("no rate")})
+	if _, err = CallAll(ctx, targets, "Rater.Rate", "1001", Quorum(2)); err != ErrNoQuorum {
+		t.Errorf("expected ErrNoQuorum, got %v", err)
+	}
+}
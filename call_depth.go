@@ -0,0 +1,24 @@
+package birpc
+
+import "github.com/cgrates/birpc/context"
+
+type callDepthKey struct{}
+
+// CallDepth returns the depth of the call served with ctx: 0 for the calls
+// made outside of any method, n+1 for the calls made with the context of
+// a call of depth n, as when a method of a bidirectional server calls its
+// client back through ctx.Client. It returns 0 if ctx does not belong to
+// a call. The depth travels with the requests, so a server can refuse the
+// calls nested too deep, see ServerConfig.MaxCallDepth.
+func CallDepth(ctx *context.Context) int {
+	depth, _ := ctx.Value(callDepthKey{}).(int)
+	return depth
+}
+
+// nextCallDepth returns the depth of a call made with ctx.
+func nextCallDepth(ctx *context.Context) int {
+	if depth, served := ctx.Value(callDepthKey{}).(int); served {
+		return depth + 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// PingPong calls its peer back until the calls are refused.
+type PingPong struct {
+	mu     sync.Mutex
+	depths []int
+}
+
+func (p *PingPong) Ping(ctx *context.Context, args int, reply *int, info *CallInfo) error {
+	p.mu.Lock()
+	p.depths = append(p.depths, info.Depth)
+	p.mu.Unlock()
+	if CallDepth(ctx) != info.Depth {
+		return errors.New("depth mismatch")
+	}
+	return ctx.Client.Call(ctx, "PingPong.Ping", args+1, reply)
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	serverSide, clientSide := new(PingPong), new(PingPong)
+	server := NewBirpcServer()
+	server.Register(serverSide)
+	if err := server.ApplyConfig(ServerConfig{MaxCallDepth: 4}); err != nil {
+		t.Fatal(err)
+	}
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+	client.Register(clientSide)
+
+	var reply int
+	if err := client.Call(context.Background(), "PingPong.Ping", 0, &reply); err == nil ||
+		err.Error() != ErrCallTooDeep.Error() {
+		t.Errorf("expected %v, got %v", ErrCallTooDeep, err)
+	}
+	if exp := []int{0, 2, 4}; !reflect.DeepEqual(serverSide.depths, exp) {
+		t.Errorf("expected the server to serve the depths %v, got %v", exp, serverSide.depths)
+	}
+	if exp := []int{1, 3, 5}; !reflect.DeepEqual(clientSide.depths, exp) {
+		t.Errorf("expected the client to serve the depths %v, got %v", exp, clientSide.depths)
+	}
+	if d := CallDepth(context.Background()); d != 0 {
+		t.Errorf("expected depth 0 outside of calls, got %d", d)
+	}
+}
@@ -0,0 +1,165 @@
+package birpc
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+var typeOfCallInfo = reflect.TypeOf((*CallInfo)(nil))
+
+// CallInfo describes the call being served. Methods needing it declare it
+// as an extra trailing parameter:
+//
+//	func (t *T) MethodName(ctx *context.Context, argType T1, replyType *T2, info *birpc.CallInfo) error
+type CallInfo struct {
+	ServiceMethod string    // name the method was registered with
+	Seq           uint64    // sequence number chosen by the client
+	Deadline      time.Time // deadline of the call, zero if none
+	Depth         int       // see CallDepth
+	// Fields are the reply fields selected by the client, nil for all.
+	// The server clears the others, so the method may skip them.
+	Fields []string
+	// Peer is the remote address of the connection, nil if the codec
+	// does not expose it.
+	Peer net.Addr
+	// Conn identifies the connection, zero unless the client sent Hello.
+	Conn ConnID
+	// Reads pauses the reading of the requests of the connection.
+	Reads *ReadControl
+	// TLS is the state of the connection, nil unless it uses TLS and the
+	// codec exposes it. See PeerCertificate.
+	TLS *tls.ConnectionState
+	// Session holds the values kept with the connection, nil when the
+	// method is called directly.
+	Session *Session
+
+	pending   *svc.Pending // the calls of the connection, see CancelService
+	blobs     *blobStore   // the blobs cached on the connection, see BlobData
+	deltas    *deltaStore  // the payloads kept on the connection, see DeltaData
+	deltaSize int
+}
+
+// serverConn holds the state shared by the calls served on a connection.
+type serverConn struct {
+	// first, to be aligned for their atomic ops on the 32-bit platforms
+	calls  int64 // counted by MaxConnectionCalls
+	active int64 // calls read and not answered yet
+
+	codec   writeServerCodec
+	sending *sync.Mutex
+	pending *svc.Pending
+	wg      *sync.WaitGroup // nil when serving a single request
+	peer    net.Addr
+	last    chan struct{} // closed once the last serial call is done
+	closed  chan struct{} // closed once the requests stop being read
+	id      atomic.Value  // ConnID sent by the client with Hello
+	reads   ReadControl
+
+	uploadsMu sync.Mutex
+	uploads   map[uint64]*Upload // by the Seq of their calls
+
+	blobs   blobStore  // see BlobCache
+	deltas  deltaStore // see DeltaEncoding
+	session Session    // see CallInfo
+
+	limiter tokenBucket // see ConnRateLimit
+
+	goneAway  int32 // the GoAway was sent, see Shutdown
+	closeIdle bool  // closed by Shutdown once idle, see Server.ServeCodec
+
+	retiring sync.Mutex  // protects the following
+	grace    *time.Timer // closes the connection after its GoAway
+	retired  bool        // the connection ended
+}
+
+func newServerConn(codec writeServerCodec, sending *sync.Mutex, pending *svc.Pending, wg *sync.WaitGroup) *serverConn {
+	return &serverConn{
+		codec:   codec,
+		sending: sending,
+		pending: pending,
+		wg:      wg,
+		peer:    remoteAddr(codec),
+		closed:  make(chan struct{}),
+	}
+}
+
+// serve runs the call of req on its own goroutine, bounded by MaxHandlers,
+// on the WorkerPool, or in the order read with SerialRequests. It is only
+// called by the reading goroutine.
+func (conn *serverConn) serve(server *basicServer, s *Service, mtype *MethodType, req *Request, argv, replyv reflect.Value) {
+	conn.wg.Add(1)
+	atomic.AddInt64(&conn.active, 1)
+	if req.Depth > 0 {
+		go s.call(server, conn, mtype, req, argv, replyv)
+		return
+	}
+	if server.pool != nil && !server.serial {
+		if !server.pool.submit(func() { s.call(server, conn, mtype, req, argv, replyv) }, server.queueDeadline(req, argv), conn) {
+			conn.rejectBusy(server, mtype, req)
+		}
+		return
+	}
+	if !server.handlers.acquire() {
+		conn.rejectBusy(server, mtype, req)
+		return
+	}
+	if !server.serial {
+		go func() {
+			defer server.handlers.release()
+			s.call(server, conn, mtype, req, argv, replyv)
+		}()
+		return
+	}
+	prev, done := conn.last, make(chan struct{})
+	conn.last = done
+	go func() {
+		defer server.handlers.release()
+		if prev != nil {
+			<-prev
+		}
+		s.call(server, conn, mtype, req, argv, replyv)
+		close(done)
+	}()
+}
+
+// rejectBusy fails the call of req with ErrServerBusy, when it cannot be
+// given a goroutine.
+func (conn *serverConn) rejectBusy(server *basicServer, mtype *MethodType, req *Request) {
+	if mtype.upload {
+		conn.closeUpload(req.Seq)
+	}
+	server.sendResponse(conn.sending, req, invalidRequest, conn.codec, ErrServerBusy.Error())
+	server.freeRequest(req)
+	conn.callDone()
+}
+
+// callDone marks a call given to serve as answered.
+func (conn *serverConn) callDone() {
+	atomic.AddInt64(&conn.active, -1)
+	conn.wg.Done()
+}
+
+// remoteAddr returns the remote address of a codec implementing
+// RemoteAddr() net.Addr, or nil.
+func remoteAddr(codec interface{}) net.Addr {
+	if c, ok := codec.(interface{ RemoteAddr() net.Addr }); ok {
+		return c.RemoteAddr()
+	}
+	return nil
+}
+
+// connRemoteAddr returns the remote address of rwc if it is a network
+// connection, for the codecs implementing RemoteAddr.
+func connRemoteAddr(rwc io.ReadWriteCloser) net.Addr {
+	if conn, ok := rwc.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
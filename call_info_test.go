@@ -0,0 +1,137 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type InfoService struct {
+	infos chan CallInfo
+}
+
+func (s *InfoService) Info(ctx *context.Context, args Args, reply *Reply, info *CallInfo) error {
+	s.infos <- *info
+	reply.C = args.A + args.B
+	return nil
+}
+
+func (s *InfoService) BadTrailing(ctx *context.Context, args Args, reply *Reply, extra *Args) error {
+	return nil
+}
+
+func TestCallInfo(t *testing.T) {
+	is := &InfoService{infos: make(chan CallInfo, 1)}
+	var report []RejectedMethod
+	server := NewServer()
+	if err := server.Register(is, ReportRejected(&report)); err != nil {
+		t.Fatal(err)
+	}
+	if len(report) != 1 || report[0].Name != "BadTrailing" || report[0].Reason != RejectTrailing {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if err := server.ApplyConfig(ServerConfig{CallTimeout: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	l, addr := listenTCP()
+	defer l.Close()
+	go server.Accept(l)
+	client, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	reply := new(Reply)
+	if err = client.Call(context.Background(), "InfoService.Info", Args{7, 8}, reply); err != nil || reply.C != 15 {
+		t.Fatalf("Info: %v %v", reply.C, err)
+	}
+	info := <-is.infos
+	if info.ServiceMethod != "InfoService.Info" || info.Seq == 0 {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if info.Peer == nil || info.Peer.String() != client.codec.(*gobClientCodec).rwc.(net.Conn).LocalAddr().String() {
+		t.Errorf("expected the client address as peer, got %v", info.Peer)
+	}
+	if d := time.Until(info.Deadline); d <= 0 || d > time.Minute {
+		t.Errorf("unexpected deadline %v", info.Deadline)
+	}
+
+	// the peer is unknown without a network connection
+	bc := newPipeClient(t, server)
+	if err = bc.Call(context.Background(), "InfoService.Info", Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Fatalf("Info over pipe: %v %v", reply.C, err)
+	}
+	if info = <-is.infos; info.Peer == nil || info.Peer.Network() != "pipe" {
+		t.Errorf("expected pipe peer, got %v", info.Peer)
+	}
+
+	srv, err := NewFuncService("Funcs", struct {
+		Info func(*context.Context, Args, *Reply, *CallInfo) error
+	}{is.Info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = srv.Call(context.Background(), "Funcs.Info", Args{1, 1}, reply); err != nil || reply.C != 2 {
+		t.Fatalf("direct Info: %v %v", reply.C, err)
+	}
+	if info = <-is.infos; info.ServiceMethod != "Funcs.Info" || info.Peer != nil {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	is := &InfoService{infos: make(chan CallInfo, 1)}
+	server := NewServer()
+	server.Register(is)
+	client := newPipeClient(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if err := client.Call(ctx, "InfoService.Info", Args{7, 8}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	if info := <-is.infos; info.Deadline.Before(deadline.Add(-time.Second)) || info.Deadline.After(deadline.Add(time.Second)) {
+		t.Errorf("expected the deadline %v, got %v", deadline, info.Deadline)
+	}
+
+	// the birpc codecs carry the deadline too
+	bserver := NewBirpcServer()
+	bserver.Register(is)
+	bclient := NewBirpcClient(newBirpcPipe(t, bserver))
+	defer bclient.Close()
+	if err := bclient.Call(ctx, "InfoService.Info", Args{7, 8}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	if info := <-is.infos; info.Deadline.Before(deadline.Add(-time.Second)) || info.Deadline.After(deadline.Add(time.Second)) {
+		t.Errorf("expected the deadline %v over birpc, got %v", deadline, info.Deadline)
+	}
+
+	// the client does not send the calls past their deadline
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := client.Call(expired, "InfoService.Info", Args{7, 8}, new(Reply)); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	// and the server rejects the requests expired before dispatch
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go server.ServeConn(c2)
+	codec := NewClientCodec(c1)
+	go codec.WriteRequest(&Request{ServiceMethod: "InfoService.Info", Seq: 1, Timeout: -time.Millisecond}, Args{7, 8})
+	var resp Response
+	if err := codec.ReadResponseHeader(&resp); err != nil {
+		t.Fatal(err)
+	}
+	codec.ReadResponseBody(nil)
+	if resp.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("expected the request to expire, got %+v", resp)
+	}
+	if stats := server.DeadlineStats(); stats.Expired != 1 || stats.Calls != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,155 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrReplyMismatch is returned when the targets of a call made with
+// AllMustSucceed do not reply the same.
+var ErrReplyMismatch = errors.New("rpc: replies mismatch")
+
+// Strategy makes a call on several targets and combines their results
+// into reply.
+type Strategy func(ctx *context.Context, targets []ClientConnector, serviceMethod string, args, reply interface{}) error
+
+// MismatchFunc is called with the results of a call whose targets replied
+// differently, for reporting.
+type MismatchFunc func(serviceMethod string, results []CallResult)
+
+// FirstSuccess returns the Strategy answering with the first successful
+// reply, canceling the other calls. If all the targets fail the error of
+// the first one is returned.
+func FirstSuccess() Strategy {
+	return func(ctx *context.Context, targets []ClientConnector, serviceMethod string, args, reply interface{}) error {
+		results, err := CallAll(ctx, targets, serviceMethod, args,
+			Quorum(1), ReplyFactory(replyFactory(reply)))
+		if err != nil {
+			return firstError(results, err)
+		}
+		for _, res := range results {
+			if res.Error == nil {
+				setReply(reply, res.Reply)
+				break
+			}
+		}
+		return nil
+	}
+}
+
+// MajorityQuorum returns the Strategy answering with the reply of the
+// majority of the targets, compared with reflect.DeepEqual. It waits for
+// all the targets and returns ErrNoQuorum if no reply has the majority.
+// onMismatch, if not nil, is called when the successful replies differ.
+func MajorityQuorum(onMismatch MismatchFunc) Strategy {
+	return func(ctx *context.Context, targets []ClientConnector, serviceMethod string, args, reply interface{}) error {
+		results, _ := CallAll(ctx, targets, serviceMethod, args, ReplyFactory(replyFactory(reply)))
+		var best interface{}
+		var votes int
+		for i, res := range results {
+			if res.Error != nil {
+				continue
+			}
+			n := 1
+			for _, other := range results[i+1:] {
+				if other.Error == nil && reflect.DeepEqual(res.Reply, other.Reply) {
+					n++
+				}
+			}
+			if n > votes {
+				best, votes = res.Reply, n
+			}
+		}
+		if onMismatch != nil && !sameReplies(results) {
+			onMismatch(serviceMethod, results)
+		}
+		if votes <= len(targets)/2 {
+			return ErrNoQuorum
+		}
+		setReply(reply, best)
+		return nil
+	}
+}
+
+// AllMustSucceed returns the Strategy failing unless all the targets
+// succeed with the same reply, compared with reflect.DeepEqual. On
+// mismatch onMismatch, if not nil, is called and ErrReplyMismatch is
+// returned.
+func AllMustSucceed(onMismatch MismatchFunc) Strategy {
+	return func(ctx *context.Context, targets []ClientConnector, serviceMethod string, args, reply interface{}) error {
+		results, _ := CallAll(ctx, targets, serviceMethod, args, ReplyFactory(replyFactory(reply)))
+		for _, res := range results {
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		if !sameReplies(results) {
+			if onMismatch != nil {
+				onMismatch(serviceMethod, results)
+			}
+			return ErrReplyMismatch
+		}
+		if len(results) != 0 {
+			setReply(reply, results[0].Reply)
+		}
+		return nil
+	}
+}
+
+// MultiConnector is a ClientConnector making its calls on all the Targets
+// with Strategy.
+type MultiConnector struct {
+	Targets  []ClientConnector
+	Strategy Strategy
+}
+
+// Call invokes the named function on the targets.
+func (m *MultiConnector) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	return m.Strategy(ctx, m.Targets, serviceMethod, args, reply)
+}
+
+// replyFactory allocates replies of the type reply points to.
+func replyFactory(reply interface{}) func() interface{} {
+	if reply == nil {
+		return func() interface{} { return nil }
+	}
+	typ := reflect.TypeOf(reply).Elem()
+	return func() interface{} { return reflect.New(typ).Interface() }
+}
+
+func setReply(reply, from interface{}) {
+	if reply != nil {
+		reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(from).Elem())
+	}
+}
+
+// sameReplies reports whether all the successful results have the same
+// reply.
+func sameReplies(results []CallResult) bool {
+	var first interface{}
+	var found bool
+	for _, res := range results {
+		if res.Error != nil {
+			continue
+		}
+		if !found {
+			first, found = res.Reply, true
+		} else if !reflect.DeepEqual(first, res.Reply) {
+			return false
+		}
+	}
+	return true
+}
+
+// firstError returns the first error of the results, or err if none
+// failed.
+func firstError(results []CallResult, err error) error {
+	for _, res := range results {
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package birpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestFirstSuccess(t *testing.T) {
+	ctx := context.Background()
+	conn := &MultiConnector{
+		Targets: newRaters(t,
+			&Rater{err: errors.New("no rate")},
+			&Rater{rate: 2, delay: time.Hour},
+			&Rater{rate: 3}),
+		Strategy: FirstSuccess(),
+	}
+	var rate float64
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err != nil || rate != 3 {
+		t.Errorf("expected rate 3, got %v: %v", rate, err)
+	}
+
+	conn.Targets = newRaters(t, &Rater{err: errors.New("no rate")}, &Rater{err: errors.New("no rate")})
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err == nil || err.Error() != "no rate" {
+		t.Errorf("expected the error of the targets, got %v", err)
+	}
+}
+
+func TestMajorityQuorum(t *testing.T) {
+	ctx := context.Background()
+	var mismatches int
+	conn := &MultiConnector{
+		Targets: newRaters(t, &Rater{rate: 1}, &Rater{rate: 2}, &Rater{rate: 2}),
+		Strategy: MajorityQuorum(func(serviceMethod string, results []CallResult) {
+			if serviceMethod != "Rater.Rate" || len(results) != 3 {
+				t.Errorf("unexpected mismatch report %s %+v", serviceMethod, results)
+			}
+			mismatches++
+		}),
+	}
+	var rate float64
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err != nil || rate != 2 {
+		t.Errorf("expected rate 2, got %v: %v", rate, err)
+	}
+	if mismatches != 1 {
+		t.Errorf("expected one mismatch reported, got %d", mismatches)
+	}
+
+	conn.Targets = newRaters(t, &Rater{rate: 1}, &Rater{rate: 2}, &Rater{err: errors.New("no rate")})
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err != ErrNoQuorum {
+		t.Errorf("expected %v, got %v", ErrNoQuorum, err)
+	}
+}
+
+func TestAllMustSucceed(t *testing.T) {
+	ctx := context.Background()
+	var mismatches int
+	conn := &MultiConnector{
+		Targets: newRaters(t, &Rater{rate: 1}, &Rater{rate: 1}),
+		Strategy: AllMustSucceed(func(string, []CallResult) {
+			mismatches++
+		}),
+	}
+	var rate float64
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err != nil || rate != 1 {
+		t.Errorf("expected rate 1, got %v: %v", rate, err)
+	}
+
+	conn.Targets = newRaters(t, &Rater{rate: 1}, &Rater{rate: 2})
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err != ErrReplyMismatch || mismatches != 1 {
+		t.Errorf("expected %v reported once, got %v reported %d times", ErrReplyMismatch, err, mismatches)
+	}
+
+	conn.Targets = newRaters(t, &Rater{rate: 1}, &Rater{err: errors.New("no rate")})
+	if err := conn.Call(ctx, "Rater.Rate", "1001", &rate); err == nil || err.Error() != "no rate" {
+		t.Errorf("expected the error of the failed target, got %v", err)
+	}
+}
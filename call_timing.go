@@ -0,0 +1,85 @@
+package birpc
+
+import (
+	"bufio"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// MessageSizer is implemented by the codecs counting the bytes they write
+// and read, letting the clients fill the sizes of their Calls. The gob
+// and JSON-RPC codecs of this module implement it.
+type MessageSizer interface {
+	BytesWritten() int64 // total bytes written
+	BytesRead() int64    // total bytes consumed by the decoding
+}
+
+func bytesWritten(codec interface{}) int64 {
+	if s, ok := codec.(MessageSizer); ok {
+		return s.BytesWritten()
+	}
+	return 0
+}
+
+func bytesRead(codec interface{}) int64 {
+	if s, ok := codec.(MessageSizer); ok {
+		return s.BytesRead()
+	}
+	return 0
+}
+
+// received records the arrival of the response of call, decoded by codec
+// since it had read start bytes.
+func (call *Call) received(codec interface{}, start int64) {
+	call.writing.Lock()
+	defer call.writing.Unlock()
+	call.Received = time.Now()
+	call.ResponseSize = int(bytesRead(codec) - start)
+}
+
+// Latency returns the time from the call being handed to the client to
+// its response, zero if not answered.
+func (call *Call) Latency() time.Duration {
+	if call.Received.IsZero() {
+		return 0
+	}
+	return call.Received.Sub(call.Enqueued)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	n int64 // first, for its atomic ops to be aligned on 32-bit platforms
+	w io.Writer
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return
+}
+
+// countingReader counts the bytes read from a buffered reader. Being an
+// io.ByteReader it is not buffered again by gob, so the count matches the
+// bytes decoded.
+type countingReader struct {
+	n int64 // first, for its atomic ops to be aligned on 32-bit platforms
+	r *bufio.Reader
+}
+
+func newCountingReader(r io.Reader) *countingReader {
+	return &countingReader{r: bufio.NewReader(r)}
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return
+}
+
+func (c *countingReader) ReadByte() (b byte, err error) {
+	if b, err = c.r.ReadByte(); err == nil {
+		atomic.AddInt64(&c.n, 1)
+	}
+	return
+}
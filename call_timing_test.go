@@ -0,0 +1,69 @@
+package birpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Echo struct{}
+
+func (Echo) Say(ctx *context.Context, args string, reply *string) error {
+	*reply = args
+	return nil
+}
+
+func checkCallTiming(t *testing.T, call *Call) {
+	t.Helper()
+	if call.Error != nil {
+		t.Fatal(call.Error)
+	}
+	if call.Enqueued.IsZero() || call.Written.Before(call.Enqueued) || call.Received.Before(call.Written) {
+		t.Errorf("unexpected timestamps %v %v %v", call.Enqueued, call.Written, call.Received)
+	}
+	if call.Latency() <= 0 {
+		t.Errorf("expected latency, got %v", call.Latency())
+	}
+}
+
+func TestCallTiming(t *testing.T) {
+	server := NewServer()
+	server.Register(Echo{})
+	client := newPipeClient(t, server)
+
+	var reply string
+	first := <-client.Go("Echo.Say", "hi", &reply, nil).Done
+	checkCallTiming(t, first)
+	// gob sends the type definitions with the first call only
+	small := <-client.Go("Echo.Say", "hi", &reply, nil).Done
+	if small.RequestSize >= first.RequestSize {
+		t.Errorf("expected the first call to be larger, got %d and %d", first.RequestSize, small.RequestSize)
+	}
+	large := <-client.Go("Echo.Say", strings.Repeat("x", 1000), &reply, nil).Done
+	checkCallTiming(t, large)
+	if small.RequestSize == 0 || small.ResponseSize == 0 {
+		t.Errorf("expected sizes, got %d %d", small.RequestSize, small.ResponseSize)
+	}
+	if d := large.RequestSize - small.RequestSize; d < 998 || d > 1010 {
+		t.Errorf("expected the request to grow by the argument, got %d -> %d", small.RequestSize, large.RequestSize)
+	}
+	if d := large.ResponseSize - small.ResponseSize; d < 998 || d > 1010 {
+		t.Errorf("expected the response to grow by the reply, got %d -> %d", small.ResponseSize, large.ResponseSize)
+	}
+
+	// bidirectional clients and error responses
+	bserver := NewBirpcServer()
+	bserver.Register(Echo{})
+	bclient := NewBirpcClient(newBirpcPipe(t, bserver))
+	defer bclient.Close()
+	call := <-bclient.Go("Echo.Say", "hi", &reply, nil).Done
+	checkCallTiming(t, call)
+	if call.RequestSize == 0 || call.ResponseSize == 0 {
+		t.Errorf("expected sizes, got %d %d", call.RequestSize, call.ResponseSize)
+	}
+	call = <-bclient.Go("Echo.Missing", "hi", &reply, nil).Done
+	if call.Error == nil || call.Received.IsZero() || call.ResponseSize == 0 {
+		t.Errorf("expected the error response to be measured, got %v %v %d", call.Error, call.Received, call.ResponseSize)
+	}
+}
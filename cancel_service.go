@@ -0,0 +1,88 @@
+package birpc
+
+import (
+	"github.com/cgrates/birpc/context"
+)
+
+// RequestIDMetadata is the key of the metadata identifying the calls of a
+// request across the connections, see WithRequestID.
+const RequestIDMetadata = "request-id"
+
+// WithRequestID returns a copy of ctx sending id as the request ID of the
+// calls made with it, by which the admins cancel them, see
+// CancelService.Request. The servers show it in their Diagnostics.
+func WithRequestID(ctx *context.Context, id string) *context.Context {
+	return WithMetadata(ctx, Metadata{RequestIDMetadata: id})
+}
+
+// errCancelDenied is returned to the callers cancelling the calls of the
+// other connections without being admins.
+var errCancelDenied = NewError(CodePermissionDenied, "rpc: only the admins cancel the calls of other connections")
+
+// CancelArgs are the arguments of CancelService.Call.
+type CancelArgs struct {
+	Conn string // the connection of the call, see ConnID, empty for the one of the caller
+	Seq  uint64 // the sequence number of the call on the connection
+}
+
+// CancelService is a service cancelling the calls being served, ending
+// the contexts they are served with, as the clients do on their own
+// connections when the contexts of their calls end. It is registered on
+// demand:
+//
+//	server.RegisterName("Cancel", server.CancelService(isAdmin))
+type CancelService struct {
+	server  *basicServer
+	isAdmin func(ctx *context.Context, info *CallInfo) bool
+}
+
+// CancelService returns the service cancelling the calls of the server.
+// The callers cancel the calls of their own connections, and the ones for
+// which isAdmin reports true, like those presenting an admin certificate,
+// the calls of any connection. Nobody is an admin if isAdmin is nil.
+func (server *basicServer) CancelService(isAdmin func(ctx *context.Context, info *CallInfo) bool) *CancelService {
+	return &CancelService{server: server, isAdmin: isAdmin}
+}
+
+func (s *CancelService) admin(ctx *context.Context, info *CallInfo) bool {
+	return s.isAdmin != nil && s.isAdmin(ctx, info)
+}
+
+// Call cancels the call args.Seq of the connection args.Conn, replying
+// whether it was being served.
+func (s *CancelService) Call(ctx *context.Context, args *CancelArgs, reply *bool, info *CallInfo) error {
+	if args.Conn == "" || args.Conn == info.Conn.String() {
+		*reply = info.pending != nil && info.pending.Cancel(args.Seq)
+		return nil
+	}
+	if !s.admin(ctx, info) {
+		return errCancelDenied
+	}
+	*reply = false
+	s.server.connSet.Range(func(key, _ interface{}) bool {
+		conn := key.(*serverConn)
+		if conn.connID().String() != args.Conn {
+			return true
+		}
+		*reply = conn.pending.Cancel(args.Seq)
+		return false
+	})
+	return nil
+}
+
+// Request cancels the calls of the request ID id on all the connections,
+// see WithRequestID, replying their number. Only the admins call it.
+func (s *CancelService) Request(ctx *context.Context, id string, reply *int, info *CallInfo) error {
+	if !s.admin(ctx, info) {
+		return errCancelDenied
+	}
+	*reply = 0
+	if id == "" {
+		return nil
+	}
+	s.server.connSet.Range(func(key, _ interface{}) bool {
+		*reply += key.(*serverConn).pending.CancelRequest(id)
+		return true
+	})
+	return nil
+}
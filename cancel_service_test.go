@@ -0,0 +1,76 @@
+package birpc
+
+import (
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Exports struct {
+	started chan uint64
+}
+
+func (e *Exports) Run(ctx *context.Context, _ string, _ *string, info *CallInfo) error {
+	e.started <- info.Seq
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestCancelService(t *testing.T) {
+	server := NewServer()
+	exports := &Exports{started: make(chan uint64, 2)}
+	server.Register(exports)
+	server.RegisterName("Cancel", server.CancelService(func(ctx *context.Context, _ *CallInfo) bool {
+		return MetadataFromContext(ctx)["role"] == "admin"
+	}))
+	owner, other := newPipeClient(t, server), newPipeClient(t, server)
+	ctx := context.Background()
+	if err := owner.Hello(ctx); err != nil {
+		t.Fatal(err)
+	}
+	admin := WithMetadata(ctx, Metadata{"role": "admin"})
+
+	// the callers cancel their own calls
+	call := owner.Go("Exports.Run", "cdrs", new(string), nil)
+	var cancelled bool
+	if err := owner.Call(ctx, "Cancel.Call", &CancelArgs{Seq: <-exports.started}, &cancelled); err != nil || !cancelled {
+		t.Errorf("expected the call to be cancelled, got %v: %v", cancelled, err)
+	}
+	if call = <-call.Done; call.Error == nil || call.Error.Error() != context.Canceled.Error() {
+		t.Errorf("expected the call to be cancelled, got %v", call.Error)
+	}
+
+	// and the admins the ones of the other connections
+	call = owner.Go("Exports.Run", "cdrs", new(string), nil)
+	args := &CancelArgs{Conn: owner.ConnID().String(), Seq: <-exports.started}
+	if err := other.Call(ctx, "Cancel.Call", args, &cancelled); ErrorCode(err) != CodePermissionDenied {
+		t.Errorf("expected the cancel to be denied, got %v", err)
+	}
+	if err := other.Call(admin, "Cancel.Call", args, &cancelled); err != nil || !cancelled {
+		t.Errorf("expected the call to be cancelled, got %v: %v", cancelled, err)
+	}
+	<-call.Done
+	if err := other.Call(admin, "Cancel.Call", args, &cancelled); err != nil || cancelled {
+		t.Errorf("expected no call to cancel, got %v: %v", cancelled, err)
+	}
+
+	// the admins cancel the calls by request ID
+	rctx := WithRequestID(ctx, "export-1001")
+	done := make(chan error, 2)
+	for _, client := range []*Client{owner, other} {
+		go func(client *Client) { done <- client.Call(rctx, "Exports.Run", "cdrs", new(string)) }(client)
+		<-exports.started
+	}
+	var n int
+	if err := owner.Call(ctx, "Cancel.Request", "export-1001", &n); ErrorCode(err) != CodePermissionDenied {
+		t.Errorf("expected the cancel to be denied, got %v", err)
+	}
+	if err := owner.Call(admin, "Cancel.Request", "export-1001", &n); err != nil || n != 2 {
+		t.Errorf("expected 2 calls to be cancelled, got %d: %v", n, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-done; err == nil {
+			t.Error("expected the call to be cancelled")
+		}
+	}
+}
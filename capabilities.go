@@ -0,0 +1,38 @@
+package birpc
+
+import (
+	"strings"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+// The features announced by the servers, see Capabilities.
+const (
+	CapabilityBlobCache = "blob_cache" // see BlobCache
+	CapabilityDelta     = "delta"      // see DeltaEncoding
+)
+
+// capabilities returns the optional features enabled on the server.
+func (server *basicServer) capabilities() (caps []string) {
+	if server.blobCacheSize > 0 {
+		caps = append(caps, CapabilityBlobCache)
+	}
+	if server.deltaSize > 0 {
+		caps = append(caps, CapabilityDelta)
+	}
+	return
+}
+
+// Capabilities returns the optional features enabled on the server among
+// only, all of them if only is empty. The servers predating the
+// negotiation have none.
+func (client *basicClient) Capabilities(ctx *context.Context, only ...string) ([]string, error) {
+	var caps []string
+	err := client.Call(ctx, "_goRPC_.Capabilities", &svc.CapabilitiesArgs{Only: only}, &caps)
+	if _, isServerErr := err.(ServerError); isServerErr &&
+		strings.HasSuffix(err.Error(), "can't find method _goRPC_.Capabilities") {
+		return nil, nil
+	}
+	return caps, err
+}
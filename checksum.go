@@ -0,0 +1,181 @@
+package birpc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrChecksumMismatch is returned for the calls whose reply does not match
+// the checksum sent by the server, see VerifyChecksums.
+var ErrChecksumMismatch = errors.New("rpc: reply checksum mismatch")
+
+// ChecksumReplies makes the server send a checksum of the replies of the
+// named methods, or of all the methods of the service if none is named,
+// along with them. The clients calling with a context returned by
+// VerifyChecksums check the replies they decode against it, adding an end
+// to end integrity check of the business-critical replies, such as the
+// debits and the balances, over the guarantees of the transport.
+func ChecksumReplies(methods ...string) RegisterOption {
+	return func(o *registerOptions) {
+		if o.checksums == nil {
+			o.checksums = make(map[string]bool)
+		}
+		if len(methods) == 0 {
+			o.checksums[""] = true
+		}
+		for _, name := range methods {
+			o.checksums[name] = true
+		}
+	}
+}
+
+type verifyChecksumsKey struct{}
+
+// VerifyChecksums returns a copy of ctx making the calls made with it
+// verify the replies sent with a checksum, failing with
+// ErrChecksumMismatch if they do not match. The reply must be decoded into
+// a value of the type the server replied with, or at least with the same
+// exported fields, and start out zero.
+func VerifyChecksums(ctx *context.Context) *context.Context {
+	return context.WithValue(ctx, verifyChecksumsKey{}, true)
+}
+
+func verifyChecksums(ctx *context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	verify, _ := ctx.Value(verifyChecksumsKey{}).(bool)
+	return verify
+}
+
+// verifyReply checks the reply of call against the checksum sent by the
+// server, if asked to.
+func (call *Call) verifyReply() {
+	if call.Error == nil && call.verify && call.Checksum != "" && ReplyChecksum(call.Reply) != call.Checksum {
+		call.Error = ErrChecksumMismatch
+	}
+}
+
+// ReplyChecksum returns the checksum of the reply v as sent by the server
+// with ChecksumReplies. It covers the value, not its encoding, so the
+// client and the server compute it alike whatever the codec: the exported
+// fields are hashed by name, leaving out the zero ones, which the codecs
+// may not send, and the map entries are sorted.
+func ReplyChecksum(v interface{}) string {
+	h := sha256.New()
+	hashValue(h, reflect.ValueOf(v))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func hashValue(h hash.Hash, v reflect.Value) {
+	var buf [9]byte
+	writeUint := func(tag byte, u uint64) {
+		buf[0] = tag
+		binary.BigEndian.PutUint64(buf[1:], u)
+		h.Write(buf[:])
+	}
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			if v.Kind() == reflect.Ptr {
+				v = reflect.Zero(v.Type().Elem())
+				continue
+			}
+			v = reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		h.Write([]byte{'n'})
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint('b', 1)
+		} else {
+			writeUint('b', 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint('i', uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint('u', v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeUint('f', math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		writeUint('c', math.Float64bits(real(v.Complex())))
+		writeUint('c', math.Float64bits(imag(v.Complex())))
+	case reflect.String:
+		writeUint('s', uint64(v.Len()))
+		h.Write([]byte(v.String()))
+	case reflect.Slice, reflect.Array:
+		writeUint('l', uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Map:
+		entries := make([][]byte, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			eh := sha256.New()
+			hashValue(eh, iter.Key())
+			hashValue(eh, iter.Value())
+			entries = append(entries, eh.Sum(nil))
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i], entries[j]) < 0 })
+		writeUint('m', uint64(len(entries)))
+		for _, e := range entries {
+			h.Write(e)
+		}
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			writeUint('t', uint64(t.UnixNano()))
+			return
+		}
+		h.Write([]byte{'{'})
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" || isEmptyValue(v.Field(i)) {
+				continue
+			}
+			writeUint('k', uint64(len(f.Name)))
+			h.Write([]byte(f.Name))
+			hashValue(h, v.Field(i))
+		}
+		h.Write([]byte{'}'})
+	default:
+		h.Write([]byte{'?'})
+	}
+}
+
+// isEmptyValue reports whether v is zero, or an empty collection, or
+// points to such a value, the values gob leaves out.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || isEmptyValue(v.Elem())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t.IsZero()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && !isEmptyValue(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,105 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Balance struct {
+	Account string
+	Value   float64
+	Units   map[string]float64
+	Updated time.Time
+	Debits  []float64
+}
+
+type Wallets struct{}
+
+func (Wallets) Debit(ctx *context.Context, amount float64, reply *Balance) error {
+	*reply = Balance{
+		Account: "1001",
+		Value:   10 - amount,
+		Units:   map[string]float64{"voice": 60, "sms": 0},
+		Updated: time.Now(),
+	}
+	return nil
+}
+
+func (Wallets) Get(ctx *context.Context, account string, reply *Balance) error {
+	return Wallets{}.Debit(ctx, 0, reply)
+}
+
+func TestChecksumReplies(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(Wallets{}, ChecksumReplies("Debit")); err != nil {
+		t.Fatal(err)
+	}
+	bserver := NewBirpcServer()
+	bserver.Register(Wallets{}, ChecksumReplies())
+	ctx := VerifyChecksums(context.Background())
+
+	for name, client := range map[string]interface {
+		ClientConnector
+		Go(string, interface{}, interface{}, chan *Call) *Call
+	}{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		var balance Balance
+		if err := client.Call(ctx, "Wallets.Debit", 2.5, &balance); err != nil || balance.Value != 7.5 {
+			t.Errorf("%s: unexpected balance %+v: %v", name, balance, err)
+		}
+		call := <-client.Go("Wallets.Debit", 2.5, new(Balance), nil).Done
+		if call.Error != nil || call.Checksum != ReplyChecksum(call.Reply) {
+			t.Errorf("%s: expected the checksum of %+v, got %q: %v", name, call.Reply, call.Checksum, call.Error)
+		}
+
+		// a reply decoded into a different type does not match
+		var partial struct{ Account string }
+		if err := client.Call(ctx, "Wallets.Debit", 2.5, &partial); err != ErrChecksumMismatch {
+			t.Errorf("%s: expected %v, got %v", name, ErrChecksumMismatch, err)
+		}
+		if err := client.Call(context.Background(), "Wallets.Debit", 2.5, &partial); err != nil {
+			t.Errorf("%s: unexpected error without verification: %v", name, err)
+		}
+	}
+
+	call := <-newPipeClient(t, server).Go("Wallets.Get", "1001", new(Balance), nil).Done
+	if call.Error != nil || call.Checksum != "" {
+		t.Errorf("expected no checksum, got %q: %v", call.Checksum, call.Error)
+	}
+}
+
+func TestReplyChecksum(t *testing.T) {
+	type inner struct{ A int }
+	type reply struct {
+		Inner  *inner
+		List   []int
+		Map    map[string]int
+		hidden int
+	}
+	base := ReplyChecksum(&reply{})
+	for _, r := range []*reply{
+		{Inner: &inner{}},
+		{List: []int{}},
+		{Map: map[string]int{}},
+		{hidden: 1},
+	} {
+		if sum := ReplyChecksum(r); sum != base {
+			t.Errorf("expected %+v to match the zero reply", r)
+		}
+	}
+	a := ReplyChecksum(reply{Map: map[string]int{"a": 1, "b": 2, "c": 3}})
+	b := ReplyChecksum(reply{Map: map[string]int{"c": 3, "b": 2, "a": 1}})
+	if a != b {
+		t.Error("expected the map order not to matter")
+	}
+	if ReplyChecksum(reply{List: []int{1, 2}}) == ReplyChecksum(reply{List: []int{2, 1}}) {
+		t.Error("expected the list order to matter")
+	}
+	if ReplyChecksum(&inner{A: 1}) == ReplyChecksum(&inner{A: 2}) {
+		t.Error("expected different values to differ")
+	}
+}
@@ -0,0 +1,166 @@
+package birpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrCircuitOpen is returned without calling the server while the circuit
+// breaker of its endpoint is open.
+var ErrCircuitOpen = errors.New("rpc: circuit open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // the calls go through
+	CircuitOpen                         // the calls fail with ErrCircuitOpen
+	CircuitHalfOpen                     // a probe call goes through at a time
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops the calls to an endpoint failing repeatedly, so
+// that a sick server is not buried under the calls it cannot answer. The
+// circuit opens after Failures consecutive failures; OpenTimeout later it
+// half-opens, letting a probe call through at a time, and closes again
+// after Probes successful probes, or opens again on a failed one. The zero
+// CircuitBreaker is closed, with the defaults. A CircuitBreaker is meant
+// for a single endpoint, see Interceptor.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failures opening the circuit,
+	// 5 if zero.
+	Failures int
+
+	// OpenTimeout is how long the circuit stays open before the probes,
+	// 30 seconds if zero.
+	OpenTimeout time.Duration
+
+	// Probes is the number of successful probes closing the circuit, 1 if
+	// zero.
+	Probes int
+
+	// Failed decides whether a call failing with the error counts as a
+	// failure. If nil the connection errors and the calls timing out do,
+	// the errors returned by the methods do not.
+	Failed func(error) bool
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int       // consecutive, while closed
+	openedAt time.Time // while open
+	probing  bool      // a probe is in flight, while half-open
+	probes   int       // successful, while half-open
+}
+
+// State returns the state of the circuit.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.halfOpen(time.Now())
+	return cb.state
+}
+
+// halfOpen half-opens the circuit once open for OpenTimeout.
+func (cb *CircuitBreaker) halfOpen(now time.Time) {
+	openTimeout := cb.OpenTimeout
+	if openTimeout <= 0 {
+		openTimeout = 30 * time.Second
+	}
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= openTimeout {
+		cb.state, cb.probing, cb.probes = CircuitHalfOpen, false, 0
+	}
+}
+
+// allow reports whether a call may go through, and whether it is a probe.
+func (cb *CircuitBreaker) allow() (probe bool, err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.halfOpen(time.Now())
+	switch cb.state {
+	case CircuitOpen:
+		return false, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if cb.probing {
+			return false, ErrCircuitOpen
+		}
+		cb.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record accounts the result of a call let through by allow.
+func (cb *CircuitBreaker) record(probe bool, err error) {
+	failed := cb.failed(err)
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if probe {
+		cb.probing = false
+		if cb.state != CircuitHalfOpen {
+			return
+		}
+		if failed {
+			cb.state, cb.openedAt = CircuitOpen, time.Now()
+			return
+		}
+		probes := cb.Probes
+		if probes <= 0 {
+			probes = 1
+		}
+		if cb.probes++; cb.probes >= probes {
+			cb.state, cb.failures = CircuitClosed, 0
+		}
+		return
+	}
+	if cb.state != CircuitClosed {
+		return
+	}
+	if !failed {
+		cb.failures = 0
+		return
+	}
+	failures := cb.Failures
+	if failures <= 0 {
+		failures = 5
+	}
+	if cb.failures++; cb.failures >= failures {
+		cb.state, cb.openedAt = CircuitOpen, time.Now()
+	}
+}
+
+func (cb *CircuitBreaker) failed(err error) bool {
+	if err == nil {
+		return false
+	}
+	if cb.Failed != nil {
+		return cb.Failed(err)
+	}
+	return IsConnectionError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Interceptor returns the ClientInterceptor guarding the calls with cb.
+func (cb *CircuitBreaker) Interceptor() ClientInterceptor {
+	return func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		probe, err := cb.allow()
+		if err != nil {
+			return err
+		}
+		err = invoker(ctx, serviceMethod, args, reply)
+		cb.record(probe, err)
+		return err
+	}
+}
@@ -0,0 +1,89 @@
+package birpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	cb := &CircuitBreaker{Failures: 3, OpenTimeout: 50 * time.Millisecond}
+	var calls int
+	var result error
+	block := make(chan struct{})
+	invoker := func(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+		calls++
+		if serviceMethod == "Block" {
+			<-block
+		}
+		return result
+	}
+	intercept := cb.Interceptor()
+	ctx := context.Background()
+	call := func(serviceMethod string) error {
+		return intercept(ctx, serviceMethod, nil, nil, invoker)
+	}
+
+	// the errors of the methods do not count
+	result = ServerError("invalid account")
+	for i := 0; i < 5; i++ {
+		call("Call")
+	}
+	if state := cb.State(); state != CircuitClosed {
+		t.Errorf("expected the circuit closed, got %v", state)
+	}
+
+	result = ErrShutdown
+	for i := 0; i < 3; i++ {
+		call("Call")
+	}
+	calls = 0
+	if err := call("Call"); err != ErrCircuitOpen || calls != 0 {
+		t.Errorf("expected %v without calling, got %v after %d calls", ErrCircuitOpen, err, calls)
+	}
+
+	// a failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	if state := cb.State(); state != CircuitHalfOpen {
+		t.Errorf("expected the circuit half-open, got %v", state)
+	}
+	if err := call("Call"); err != ErrShutdown || cb.State() != CircuitOpen {
+		t.Errorf("expected the probe to fail and open the circuit, got %v, %v", err, cb.State())
+	}
+
+	// a single probe goes through at a time
+	time.Sleep(60 * time.Millisecond)
+	result = nil
+	done := make(chan error)
+	go func() { done <- call("Block") }()
+	for cb.State() == CircuitHalfOpen {
+		cb.mu.Lock()
+		probing := cb.probing
+		cb.mu.Unlock()
+		if probing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := call("Call"); err != ErrCircuitOpen {
+		t.Errorf("expected %v during the probe, got %v", ErrCircuitOpen, err)
+	}
+	close(block)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+	if state := cb.State(); state != CircuitClosed {
+		t.Errorf("expected the circuit closed, got %v", state)
+	}
+
+	// the timeouts count too
+	result = context.DeadlineExceeded
+	for i := 0; i < 3; i++ {
+		call("Call")
+	}
+	if err := call("Call"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+}
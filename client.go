@@ -10,7 +10,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/cgrates/birpc/context"
 )
 
 // ServerError represents an error that has been returned from
@@ -25,12 +28,36 @@ var ErrShutdown = errors.New("connection is shut down")
 
 // Call represents an active RPC.
 type Call struct {
-	ServiceMethod string      // The name of the service and method to call.
-	Args          interface{} // The argument to the function (*struct).
-	Reply         interface{} // The reply from the function (*struct).
-	Error         error       // After completion, the error status.
-	Done          chan *Call  // Receives *Call when Go is complete.
-	seq           uint64      // Sequence num used to send. Non-zero when sent.
+	ServiceMethod string           // The name of the service and method to call.
+	Args          interface{}      // The argument to the function (*struct).
+	Reply         interface{}      // The reply from the function (*struct).
+	Error         error            // After completion, the error status.
+	Done          chan *Call       // Receives *Call when Go is complete.
+	seq           uint64           // Sequence num used to send. Non-zero when sent.
+	depth         int              // Depth of the request, set by Call.
+	fields        []string         // Reply fields requested, set by Call.
+	verify        bool             // Reply checked against Checksum, set by Call.
+	standalone    bool             // Reply encoded on its own, set by Call.
+	stream        *callStream      // Items of a streaming call, see CallStream.
+	writing       *sync.Mutex      // Held while the request is written.
+	ctx           *context.Context // Context of Call, bounding the write.
+
+	// Timing and sizes of the call, for latency breakdowns. The sizes are
+	// zero if the codec is not a MessageSizer.
+	Enqueued     time.Time // when the call was handed to the client
+	Written      time.Time // when the request was written, zero if it failed
+	Received     time.Time // when the response was decoded
+	RequestSize  int       // encoded size of the request in bytes
+	ResponseSize int       // encoded size of the response in bytes
+
+	// Checksum is the checksum sent by the server with the reply, see
+	// ChecksumReplies.
+	Checksum string
+	// Metadata are the metadata sent by the server along with the reply,
+	// see SetReplyMetadata.
+	Metadata Metadata
+	// Conn identifies the connection the call was sent on.
+	Conn ConnID
 }
 
 // Client represents an RPC Client.
@@ -64,10 +91,23 @@ func (client *Client) input() {
 	var response Response
 	for err == nil {
 		response = Response{}
+		start := bytesRead(client.codec)
 		err = client.codec.ReadResponseHeader(&response)
 		if err != nil {
 			break
 		}
+		if response.More {
+			if err = client.readStreamItem(client.codec, &response); err != nil {
+				err = errors.New("reading stream item: " + err.Error())
+			}
+			continue
+		}
+		if response.GoAway {
+			if err = client.codec.ReadResponseBody(nil); err == nil {
+				client.goAway()
+			}
+			continue
+		}
 		seq := response.Seq
 		client.mutex.Lock()
 		call := client.pending[seq]
@@ -89,19 +129,25 @@ func (client *Client) input() {
 			// We've got an error response. Give this to the request;
 			// any subsequent requests will get the ReadResponseBody
 			// error if there is one.
-			call.Error = ServerError(response.Error)
-			err = client.codec.ReadResponseBody(nil)
+			call.Metadata = response.Metadata
+			call.Error, err = readErrorBody(client.codec, &response)
 			if err != nil {
 				err = errors.New("reading error body: " + err.Error())
 			}
+			call.received(client.codec, start)
 			call.done()
 		default:
-			err = client.codec.ReadResponseBody(call.Reply)
+			err = readCallReply(client.codec, call)
 			if err != nil {
 				call.Error = errors.New("reading body " + err.Error())
 			}
+			call.Checksum = response.Checksum
+			call.Metadata = response.Metadata
+			call.verifyReply()
+			call.received(client.codec, start)
 			call.done()
 		}
+		client.retireIfIdle()
 	}
 	// Terminate pending calls.
 	client.reqMutex.Lock()
@@ -115,14 +161,16 @@ func (client *Client) input() {
 			err = io.ErrUnexpectedEOF
 		}
 	}
+	callErr := connError(client.id, err)
 	for _, call := range client.pending {
-		call.Error = err
+		call.Error = callErr
 		call.done()
 	}
 	client.mutex.Unlock()
 	client.reqMutex.Unlock()
+	client.stopWriter()
 	if err != io.EOF && !closing {
-		debugln("rpc: client protocol error:", err)
+		debugln(logPrefix("rpc: client protocol error", client.id)+":", err)
 	}
 }
 
@@ -145,17 +193,18 @@ func (call *Call) done() {
 // The read and write halves of the connection are serialized independently,
 // so no interlocking is required. However each half may be accessed
 // concurrently so the implementation of conn should protect against
-// concurrent reads or concurrent writes.
-func NewClient(conn io.ReadWriteCloser) *Client {
-	return NewClientWithCodec(NewClientCodec(conn))
+// concurrent reads or concurrent writes. The options customize the
+// client, see SendQueue.
+func NewClient(conn io.ReadWriteCloser, opts ...ClientOption) *Client {
+	return NewClientWithCodec(NewClientCodec(conn), opts...)
 }
 
 // NewClientWithCodec is like NewClient but uses the specified
 // codec to encode requests and decode responses.
-func NewClientWithCodec(codec ClientCodec) *Client {
+func NewClientWithCodec(codec ClientCodec, opts ...ClientOption) *Client {
 	client := &Client{
 		codec:       codec,
-		basicClient: newBasicClient(codec),
+		basicClient: newBasicClient(codec, opts...),
 	}
 	go client.input()
 	return client
@@ -182,24 +231,29 @@ func DialHTTPPathTimeout(network, address, path string, timeout time.Duration) (
 	if err != nil {
 		return nil, err
 	}
+	if err = httpConnect(conn, path); err != nil {
+		conn.Close()
+		return nil, &net.OpError{
+			Op:   "dial-http",
+			Net:  network + " " + address,
+			Addr: nil,
+			Err:  err,
+		}
+	}
+	return NewClient(conn), nil
+}
+
+// httpConnect switches conn to the RPC protocol using HTTP CONNECT on path.
+func httpConnect(conn net.Conn, path string) error {
 	io.WriteString(conn, "CONNECT "+path+" HTTP/1.0\n\n")
 
 	// Require successful HTTP response
 	// before switching to RPC protocol.
 	resp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: "CONNECT"})
-	if err == nil && resp.Status == connected {
-		return NewClient(conn), nil
-	}
-	if err == nil {
+	if err == nil && resp.Status != connected {
 		err = errors.New("unexpected HTTP response: " + resp.Status)
 	}
-	conn.Close()
-	return nil, &net.OpError{
-		Op:   "dial-http",
-		Net:  network + " " + address,
-		Addr: nil,
-		Err:  err,
-	}
+	return err
 }
 
 // Dial connects to an RPC server at the specified network address.
@@ -0,0 +1,122 @@
+package birpc
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ClientConn is a ClientConnector which owns the connections it uses.
+type ClientConn interface {
+	ClientConnector
+	Close() error
+}
+
+// ClientBuilder combines the client features into a ClientConn:
+//
+//	conn, err := birpc.NewClientBuilder().
+//		WithTLS(tlsCfg).
+//		WithRetry(birpc.RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond}).
+//		WithPool(8).
+//		WithInterceptor(logCalls).
+//		Dial(ctx, "birpc+tls://rater:2013")
+//
+// The interceptors see every call once, the retries happen under them
+// and use the connections of the pool.
+type ClientBuilder struct {
+	tlsConfig    *tls.Config
+	codec        string
+	dialTimeout  time.Duration
+	retry        *RetryPolicy
+	breaker      *CircuitBreaker
+	poolSize     int
+	interceptors []ClientInterceptor
+}
+
+// NewClientBuilder returns a ClientBuilder dialing a single connection.
+func NewClientBuilder() *ClientBuilder {
+	return &ClientBuilder{poolSize: 1}
+}
+
+// WithTLS enables TLS using cfg, overriding the TLS config of the target.
+func (b *ClientBuilder) WithTLS(cfg *tls.Config) *ClientBuilder {
+	b.tlsConfig = cfg
+	return b
+}
+
+// WithCodec overrides the codec of the target.
+func (b *ClientBuilder) WithCodec(name string) *ClientBuilder {
+	b.codec = name
+	return b
+}
+
+// WithDialTimeout overrides the dial timeout of the target.
+func (b *ClientBuilder) WithDialTimeout(d time.Duration) *ClientBuilder {
+	b.dialTimeout = d
+	return b
+}
+
+// WithRetry retries the failed calls following policy.
+func (b *ClientBuilder) WithRetry(policy RetryPolicy) *ClientBuilder {
+	b.retry = &policy
+	return b
+}
+
+// WithCircuitBreaker guards the calls with cb, under the retries, so
+// that each attempt counts and none is made while the circuit is open.
+func (b *ClientBuilder) WithCircuitBreaker(cb *CircuitBreaker) *ClientBuilder {
+	b.breaker = cb
+	return b
+}
+
+// WithPool spreads the calls over size connections.
+func (b *ClientBuilder) WithPool(size int) *ClientBuilder {
+	b.poolSize = size
+	return b
+}
+
+// WithInterceptor appends interceptors to the chain, the first one added
+// being the outermost.
+func (b *ClientBuilder) WithInterceptor(interceptors ...ClientInterceptor) *ClientBuilder {
+	b.interceptors = append(b.interceptors, interceptors...)
+	return b
+}
+
+// Dial connects to the target URI, see ParseTarget, and returns the
+// ClientConn combining the configured features.
+func (b *ClientBuilder) Dial(ctx *context.Context, target string) (ClientConn, error) {
+	t, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if b.tlsConfig != nil {
+		t.TLSConfig = b.tlsConfig
+	}
+	if b.codec != "" {
+		t.Codec = b.codec
+	}
+	if b.dialTimeout != 0 {
+		t.Timeout = b.dialTimeout
+	}
+	var conn ClientConn
+	if conn, err = DialPool(ctx, b.poolSize, t.Dial); err != nil {
+		return nil, err
+	}
+	if b.breaker != nil {
+		conn = &interceptedConn{
+			ClientConn: conn,
+			invoke:     chainClientInterceptors([]ClientInterceptor{b.breaker.Interceptor()}, conn.Call),
+		}
+	}
+	if b.retry != nil {
+		conn = &retryConn{ClientConn: conn, policy: *b.retry}
+	}
+	if len(b.interceptors) != 0 {
+		conn = &interceptedConn{
+			ClientConn: conn,
+			invoke:     chainClientInterceptors(b.interceptors, conn.Call),
+		}
+	}
+	return conn, nil
+}
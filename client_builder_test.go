@@ -0,0 +1,160 @@
+package birpc
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// trackListener remembers the accepted connections so tests can break them.
+type trackListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, c)
+		l.mu.Unlock()
+	}
+	return c, err
+}
+
+func (l *trackListener) closeConns() (n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, c := range l.conns {
+		c.Close()
+	}
+	n = len(l.conns)
+	l.conns = nil
+	return
+}
+
+func TestClientBuilder(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	l, addr := listenTCP()
+	tl := &trackListener{Listener: l}
+	defer l.Close()
+	go server.Accept(tl)
+
+	var mu sync.Mutex
+	var intercepted []string
+	conn, err := NewClientBuilder().
+		WithPool(2).
+		WithRetry(RetryPolicy{MaxAttempts: 3}).
+		WithInterceptor(func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+			mu.Lock()
+			intercepted = append(intercepted, serviceMethod)
+			mu.Unlock()
+			return invoker(ctx, serviceMethod, args, reply)
+		}).
+		Dial(context.Background(), "birpc://"+addr+"?timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		reply := new(Reply)
+		if err = conn.Call(ctx, "Arith.Add", &Args{i, 1}, reply); err != nil || reply.C != i+1 {
+			t.Errorf("Add: %v %v", reply.C, err)
+		}
+	}
+	if n := tl.closeConns(); n != 2 {
+		t.Errorf("expected 2 pooled connections, got %d", n)
+	}
+	// the broken connections are dialed again by the retries
+	for i := 0; i < 4; i++ {
+		reply := new(Reply)
+		if err = conn.Call(ctx, "Arith.Add", &Args{i, 1}, reply); err != nil || reply.C != i+1 {
+			t.Errorf("Add after reconnect: %v %v", reply.C, err)
+		}
+	}
+	if len(intercepted) != 8 {
+		t.Errorf("expected every call to be intercepted once, got %v", intercepted)
+	}
+	if err = conn.Call(ctx, "Arith.Div", Args{1, 0}, new(Reply)); err == nil || err.Error() != "divide by zero" {
+		t.Errorf("expected divide by zero, got %v", err)
+	}
+}
+
+type failingConn struct {
+	fails int
+	calls int
+}
+
+func (c *failingConn) Call(*context.Context, string, interface{}, interface{}) error {
+	if c.calls++; c.calls <= c.fails {
+		return ErrShutdown
+	}
+	return nil
+}
+
+func (c *failingConn) Close() error { return nil }
+
+func TestRetryPolicy(t *testing.T) {
+	fc := &failingConn{fails: 2}
+	rc := &retryConn{ClientConn: fc, policy: RetryPolicy{MaxAttempts: 3}}
+	if err := rc.Call(context.Background(), "Arith.Add", nil, nil); err != nil {
+		t.Errorf("expected success on the third attempt, got %v", err)
+	}
+	fc = &failingConn{fails: 3}
+	rc = &retryConn{ClientConn: fc, policy: RetryPolicy{MaxAttempts: 3}}
+	if err := rc.Call(context.Background(), "Arith.Add", nil, nil); err != ErrShutdown || fc.calls != 3 {
+		t.Errorf("expected %v after 3 calls, got %v after %d", ErrShutdown, err, fc.calls)
+	}
+	fc = &failingConn{fails: 3}
+	rc = &retryConn{ClientConn: fc, policy: RetryPolicy{MaxAttempts: 3, Retryable: func(error) bool { return false }}}
+	if rc.Call(context.Background(), "Arith.Add", nil, nil); fc.calls != 1 {
+		t.Errorf("expected no retries, got %d calls", fc.calls)
+	}
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith), IdempotentMethods("Add", "Mul"))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	methods, err := client.IdempotentMethods(ctx)
+	if err != nil || strings.Join(methods, ",") != "Arith.Add,Arith.Mul" {
+		t.Fatalf("unexpected idempotent methods %v: %v", methods, err)
+	}
+	idempotent := make(map[string]bool)
+	for _, m := range methods {
+		idempotent[m] = true
+	}
+	policy := RetryPolicy{MaxAttempts: 3, Idempotent: func(m string) bool { return idempotent[m] }}
+
+	fc := &failingConn{fails: 2}
+	rc := &retryConn{ClientConn: fc, policy: policy}
+	if err = rc.Call(ctx, "Arith.Add", nil, nil); err != nil || fc.calls != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d calls", err, fc.calls)
+	}
+	fc = &failingConn{fails: 2}
+	rc = &retryConn{ClientConn: fc, policy: policy}
+	if err = rc.Call(ctx, "Arith.Div", nil, nil); err != ErrShutdown || fc.calls != 1 {
+		t.Errorf("expected no retries, got %v after %d calls", err, fc.calls)
+	}
+	fc = &failingConn{fails: 2}
+	rc = &retryConn{ClientConn: fc, policy: policy}
+	args := &FailoverArgs{Idempotency: Idempotency{Key: NewIdempotencyKey()}}
+	if err = rc.Call(ctx, "Arith.Div", args, nil); err != nil || fc.calls != 3 {
+		t.Errorf("expected the call with a key retried, got %v after %d calls", err, fc.calls)
+	}
+
+	// the policy of the call overrides the one of the client
+	fc = &failingConn{fails: 2}
+	invoke := chainClientInterceptors([]ClientInterceptor{RetryInterceptor(policy)}, fc.Call)
+	if err = invoke(WithRetryPolicy(ctx, RetryPolicy{MaxAttempts: 1}), "Arith.Add", nil, nil); err != ErrShutdown || fc.calls != 1 {
+		t.Errorf("expected no retries, got %v after %d calls", err, fc.calls)
+	}
+}
@@ -59,7 +59,9 @@ func TestGobError(t *testing.T) {
 		if err == nil {
 			t.Fatal("no error")
 		}
-		if !strings.Contains(err.(error).Error(), "reading body EOF") {
+		// the newer versions of gob report the truncated body as an unexpected EOF
+		if msg := err.(error).Error(); !strings.Contains(msg, "reading body EOF") &&
+			!strings.Contains(msg, "reading body unexpected EOF") {
 			t.Fatal("expected `reading body EOF', got", err)
 		}
 	}()
@@ -0,0 +1,86 @@
+package birpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ClockOffset is an estimate of the offset of the clock of the peer
+// relative to the local clock: the time at the peer is the local time
+// plus Offset, within RTT/2.
+type ClockOffset struct {
+	Offset time.Duration `json:"offset"`
+	RTT    time.Duration `json:"rtt"` // round trip time of the sample used
+	At     time.Time     `json:"at"`  // local time of the estimate
+}
+
+// EstimateClockOffset asks the peer for its time samples times and
+// estimates the offset of its clock from the sample with the shortest
+// round trip, the least disturbed by queueing. The estimate is kept and
+// returned by ClockOffset afterwards.
+func (client *basicClient) EstimateClockOffset(ctx *context.Context, samples int) (best ClockOffset, err error) {
+	if samples <= 0 {
+		return best, errors.New("rpc: EstimateClockOffset needs at least one sample")
+	}
+	for i := 0; i < samples; i++ {
+		var peerTime int64
+		start := time.Now()
+		if err = client.Call(ctx, "_goRPC_.Time", start.UnixNano(), &peerTime); err != nil {
+			return
+		}
+		end := time.Now()
+		rtt := end.Sub(start)
+		if i != 0 && rtt >= best.RTT {
+			continue
+		}
+		best = ClockOffset{
+			Offset: time.Unix(0, peerTime).Sub(start.Add(rtt / 2)),
+			RTT:    rtt,
+			At:     end,
+		}
+	}
+	client.clock.Store(best)
+	return
+}
+
+// ClockOffset returns the last estimate of the clock offset of the peer,
+// see EstimateClockOffset. It reports false if there is none yet.
+func (client *basicClient) ClockOffset() (ClockOffset, bool) {
+	co, has := client.clock.Load().(ClockOffset)
+	return co, has
+}
+
+// SyncClock estimates the clock offset of the peer every interval until
+// the context is done or the connection is shut down, so that ClockOffset
+// stays fresh. The errors of the estimates are logged with DebugLog.
+func (client *basicClient) SyncClock(ctx *context.Context, interval time.Duration, samples int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := client.EstimateClockOffset(ctx, samples); err == ErrShutdown {
+			return
+		} else if err != nil {
+			debugln("rpc: clock sync:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PeerClockOffset returns the clock offset of the peer connected to the
+// BirpcClient found in ctx, for the handlers served over birpc
+// connections which keep their clock in sync. It reports false if there
+// is no estimate.
+func PeerClockOffset(ctx *context.Context) (time.Duration, bool) {
+	c, ok := ctx.Client.(interface{ ClockOffset() (ClockOffset, bool) })
+	if !ok {
+		return 0, false
+	}
+	co, has := c.ClockOffset()
+	return co.Offset, has
+}
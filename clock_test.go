@@ -0,0 +1,68 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestEstimateClockOffset(t *testing.T) {
+	client := newPipeClient(t, NewServer())
+	ctx := context.Background()
+	if _, has := client.ClockOffset(); has {
+		t.Error("unexpected estimate before measuring")
+	}
+	co, err := client.EstimateClockOffset(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same clock on both sides
+	if co.RTT <= 0 || co.Offset > co.RTT || co.Offset < -co.RTT {
+		t.Errorf("unexpected estimate %+v", co)
+	}
+	if last, has := client.ClockOffset(); !has || last != co {
+		t.Errorf("expected %+v to be kept, got %+v", co, last)
+	}
+}
+
+type Skew struct{}
+
+func (Skew) Check(ctx *context.Context, _ int, reply *bool) (err error) {
+	if _, has := PeerClockOffset(ctx); has {
+		return
+	}
+	if _, err = ctx.Client.(*BirpcClient).EstimateClockOffset(ctx, 2); err != nil {
+		return
+	}
+	_, *reply = PeerClockOffset(ctx)
+	return
+}
+
+func TestPeerClockOffset(t *testing.T) {
+	server := NewBirpcServer()
+	server.Register(Skew{})
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+
+	var synced bool
+	if err := client.Call(context.Background(), "Skew.Check", 0, &synced); err != nil || !synced {
+		t.Errorf("expected the handler to estimate the offset of its peer: %v %v", synced, err)
+	}
+	if _, has := PeerClockOffset(context.Background()); has {
+		t.Error("unexpected offset without client")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.SyncClock(ctx, time.Millisecond, 1)
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	<-done
+	if _, has := client.ClockOffset(); !has {
+		t.Error("expected SyncClock to estimate the offset")
+	}
+}
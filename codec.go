@@ -6,17 +6,23 @@ package birpc
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/gob"
 	"io"
 	"log"
+	"net"
+	"sync/atomic"
+	"time"
 )
 
 // NewServerCodec returns a new rpc.ServerCodec using GOB-RPC on conn.
 func NewServerCodec(conn io.ReadWriteCloser) ServerCodec {
 	buf := bufio.NewWriter(conn)
+	br := bufio.NewReaderSize(conn, readBufferSize)
 	return &gobServerCodec{
 		rwc:    conn,
-		dec:    gob.NewDecoder(conn),
+		br:     br,
+		dec:    gob.NewDecoder(br),
 		enc:    gob.NewEncoder(buf),
 		encBuf: buf,
 	}
@@ -24,6 +30,7 @@ func NewServerCodec(conn io.ReadWriteCloser) ServerCodec {
 
 type gobServerCodec struct {
 	rwc    io.ReadWriteCloser
+	br     *bufio.Reader
 	dec    *gob.Decoder
 	enc    *gob.Encoder
 	encBuf *bufio.Writer
@@ -38,6 +45,28 @@ func (c *gobServerCodec) ReadRequestBody(body interface{}) error {
 	return c.dec.Decode(body)
 }
 
+// BufferedRequest reports whether a whole request was read from the
+// connection and not decoded yet, see ServeCodec.
+func (c *gobServerCodec) BufferedRequest() bool {
+	buf, _ := c.br.Peek(c.br.Buffered())
+	values := 0
+	for len(buf) > 0 {
+		size, n := gobUint(buf)
+		if n == 0 || uint64(len(buf)-n) < size {
+			return false
+		}
+		msg := buf[n : n+int(size)]
+		buf = buf[n+int(size):]
+		// the messages of the types, of negative ids, precede the values
+		if id, n := gobUint(msg); n > 0 && id&1 == 0 {
+			if values++; values == 2 {
+				return true // the header and the body
+			}
+		}
+	}
+	return false
+}
+
 func (c *gobServerCodec) WriteResponse(r *Response, body interface{}) (err error) {
 	if err = c.enc.Encode(r); err != nil {
 		if c.encBuf.Flush() == nil {
@@ -68,13 +97,34 @@ func (c *gobServerCodec) Close() error {
 	c.closed = true
 	return c.rwc.Close()
 }
+
+// EncodeRawReply encodes a reply requested as RawReply.
+func (c *gobServerCodec) EncodeRawReply(reply interface{}) ([]byte, error) {
+	return gobEncodeRaw(reply)
+}
+
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *gobServerCodec) RemoteAddr() net.Addr {
+	return connRemoteAddr(c.rwc)
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *gobServerCodec) TLSConnectionState() *tls.ConnectionState {
+	return ConnTLSState(c.rwc)
+}
 func NewClientCodec(conn io.ReadWriteCloser) ClientCodec {
-	encBuf := bufio.NewWriter(conn)
+	cw := &countingWriter{w: conn}
+	cr := newCountingReader(conn)
+	encBuf := bufio.NewWriter(cw)
 	return &gobClientCodec{
 		rwc:    conn,
-		dec:    gob.NewDecoder(conn),
+		dec:    gob.NewDecoder(cr),
 		enc:    gob.NewEncoder(encBuf),
 		encBuf: encBuf,
+		cw:     cw,
+		cr:     cr,
 	}
 }
 
@@ -83,6 +133,25 @@ type gobClientCodec struct {
 	dec    *gob.Decoder
 	enc    *gob.Encoder
 	encBuf *bufio.Writer
+	cw     *countingWriter
+	cr     *countingReader
+}
+
+// BytesWritten implements MessageSizer.
+func (c *gobClientCodec) BytesWritten() int64 { return atomic.LoadInt64(&c.cw.n) }
+
+// BytesRead implements MessageSizer.
+func (c *gobClientCodec) BytesRead() int64 { return atomic.LoadInt64(&c.cr.n) }
+
+// ReadRawResponseBody reads a reply requested as RawReply.
+func (c *gobClientCodec) ReadRawResponseBody(raw *RawReply) error {
+	return gobReadRaw(c.dec, raw)
+}
+
+// SetWriteDeadline sets the write deadline of the connection, letting the
+// client bound the writes by the context of the calls.
+func (c *gobClientCodec) SetWriteDeadline(t time.Time) error {
+	return setWriteDeadline(c.rwc, t)
 }
 
 func (c *gobClientCodec) WriteRequest(r *Request, body interface{}) (err error) {
@@ -0,0 +1,83 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// The codec registries map codec names, as used by Config and by the
+// target URIs, to their constructors. Codec packages register themselves
+// from their init functions.
+var (
+	codecsMu     sync.RWMutex
+	serverCodecs = map[string]func(io.ReadWriteCloser) ServerCodec{
+		"gob": NewServerCodec,
+	}
+	clientCodecs = map[string]func(io.ReadWriteCloser) ClientCodec{
+		"gob": NewClientCodec,
+	}
+	birpcCodecs = map[string]func(io.ReadWriteCloser) BirpcCodec{
+		"gob": NewGobBirpcCodec,
+	}
+)
+
+// RegisterServerCodec makes a server codec available by name.
+func RegisterServerCodec(name string, newCodec func(io.ReadWriteCloser) ServerCodec) {
+	codecsMu.Lock()
+	serverCodecs[name] = newCodec
+	codecsMu.Unlock()
+}
+
+// RegisterClientCodec makes a client codec available by name.
+func RegisterClientCodec(name string, newCodec func(io.ReadWriteCloser) ClientCodec) {
+	codecsMu.Lock()
+	clientCodecs[name] = newCodec
+	codecsMu.Unlock()
+}
+
+// RegisterBirpcCodec makes a bidirectional codec available by name.
+func RegisterBirpcCodec(name string, newCodec func(io.ReadWriteCloser) BirpcCodec) {
+	codecsMu.Lock()
+	birpcCodecs[name] = newCodec
+	codecsMu.Unlock()
+}
+
+func getServerCodec(name string) (func(io.ReadWriteCloser) ServerCodec, error) {
+	if name == "" {
+		name = "gob"
+	}
+	codecsMu.RLock()
+	newCodec, has := serverCodecs[name]
+	codecsMu.RUnlock()
+	if !has {
+		return nil, errors.New("rpc: unknown codec " + name)
+	}
+	return newCodec, nil
+}
+
+func getClientCodec(name string) (func(io.ReadWriteCloser) ClientCodec, error) {
+	if name == "" {
+		name = "gob"
+	}
+	codecsMu.RLock()
+	newCodec, has := clientCodecs[name]
+	codecsMu.RUnlock()
+	if !has {
+		return nil, errors.New("rpc: unknown codec " + name)
+	}
+	return newCodec, nil
+}
+
+func getBirpcCodec(name string) (func(io.ReadWriteCloser) BirpcCodec, error) {
+	if name == "" {
+		name = "gob"
+	}
+	codecsMu.RLock()
+	newCodec, has := birpcCodecs[name]
+	codecsMu.RUnlock()
+	if !has {
+		return nil, errors.New("birpc: unknown codec " + name)
+	}
+	return newCodec, nil
+}
@@ -0,0 +1,215 @@
+package birpc
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Diff is a difference found between two replies. The Path names the
+// field with dots, and the elements of slices and maps with their index
+// or key in brackets, e.g. "Events[2].Cost". The path of the replies
+// themselves is empty, and "(error)" stands for the errors of the calls.
+type Diff struct {
+	Path string
+	A, B interface{}
+}
+
+func (d Diff) String() string {
+	return fmt.Sprintf("%s: %v != %v", d.Path, d.A, d.B)
+}
+
+// ToleranceRule reports whether the values a and b found at path are to
+// be considered equal even if they differ.
+type ToleranceRule func(path string, a, b interface{}) bool
+
+// IgnoreFields ignores the values at the given paths, the indexes and keys
+// being left out: "Events.Time" matches "Events[2].Time".
+func IgnoreFields(paths ...string) ToleranceRule {
+	ignored := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		ignored[p] = true
+	}
+	return func(path string, _, _ interface{}) bool {
+		return ignored[stripIndexes(path)]
+	}
+}
+
+// TimeTolerance considers equal the times at most d apart.
+func TimeTolerance(d time.Duration) ToleranceRule {
+	return func(_ string, a, b interface{}) bool {
+		ta, ok := a.(time.Time)
+		tb, ok2 := b.(time.Time)
+		if !ok || !ok2 {
+			return false
+		}
+		diff := ta.Sub(tb)
+		return diff <= d && diff >= -d
+	}
+}
+
+// FloatTolerance considers equal the floats at most epsilon apart.
+func FloatTolerance(epsilon float64) ToleranceRule {
+	return func(_ string, a, b interface{}) bool {
+		va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+		if !isFloat(va) || !isFloat(vb) {
+			return false
+		}
+		return math.Abs(va.Float()-vb.Float()) <= epsilon
+	}
+}
+
+func isFloat(v reflect.Value) bool {
+	return v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+// Compare makes the same call on the backends a and b concurrently, to
+// validate a migration or an active-active deployment, and returns the
+// differences between their replies. The reply of a is stored in reply
+// and its error returned, so a Compare can stand in for the calls to a.
+func Compare(ctx *context.Context, a, b ClientConnector, serviceMethod string, args, reply interface{}, rules ...ToleranceRule) ([]Diff, error) {
+	results, _ := CallAll(ctx, []ClientConnector{a, b}, serviceMethod, args,
+		ReplyFactory(replyFactory(reply)))
+	ra, rb := results[0], results[1]
+	if ra.Error != nil || rb.Error != nil {
+		if errString(ra.Error) == errString(rb.Error) {
+			return nil, ra.Error
+		}
+		return []Diff{{Path: "(error)", A: ra.Error, B: rb.Error}}, ra.Error
+	}
+	setReply(reply, ra.Reply)
+	return DiffValues(ra.Reply, rb.Reply, rules...), nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// DiffValues returns the structural differences between a and b. Only
+// the exported fields of the structs are compared.
+func DiffValues(a, b interface{}, rules ...ToleranceRule) []Diff {
+	c := &differ{rules: rules}
+	c.diff("", reflect.ValueOf(a), reflect.ValueOf(b))
+	return c.diffs
+}
+
+type differ struct {
+	rules []ToleranceRule
+	diffs []Diff
+}
+
+func (c *differ) report(path string, a, b reflect.Value) {
+	c.diffs = append(c.diffs, Diff{Path: path, A: valueOf(a), B: valueOf(b)})
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+func (c *differ) diff(path string, a, b reflect.Value) {
+	if a.IsValid() != b.IsValid() || (a.IsValid() && a.Type() != b.Type()) {
+		c.report(path, a, b)
+		return
+	}
+	if !a.IsValid() {
+		return
+	}
+	ia, ib := a.Interface(), b.Interface()
+	for _, rule := range c.rules {
+		if rule(path, ia, ib) {
+			return
+		}
+	}
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				c.report(path, a, b)
+			}
+			return
+		}
+		c.diff(path, a.Elem(), b.Elem())
+	case reflect.Struct:
+		if ta, ok := ia.(time.Time); ok {
+			if !ta.Equal(ib.(time.Time)) {
+				c.report(path, a, b)
+			}
+			return
+		}
+		for i := 0; i < a.NumField(); i++ {
+			if f := a.Type().Field(i); f.PkgPath == "" {
+				c.diff(joinPath(path, f.Name), a.Field(i), b.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		n := a.Len()
+		if b.Len() > n {
+			n = b.Len()
+		}
+		for i := 0; i < n; i++ {
+			var ea, eb reflect.Value
+			if i < a.Len() {
+				ea = a.Index(i)
+			}
+			if i < b.Len() {
+				eb = b.Index(i)
+			}
+			c.diff(fmt.Sprintf("%s[%d]", path, i), ea, eb)
+		}
+	case reflect.Map:
+		keys := a.MapKeys()
+		for _, k := range b.MapKeys() {
+			if !a.MapIndex(k).IsValid() {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			c.diff(fmt.Sprintf("%s[%v]", path, k.Interface()), a.MapIndex(k), b.MapIndex(k))
+		}
+	default:
+		if !reflect.DeepEqual(ia, ib) {
+			c.report(path, a, b)
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// stripIndexes removes the indexes and keys in brackets from path.
+func stripIndexes(path string) string {
+	if !strings.Contains(path, "[") {
+		return path
+	}
+	var sb strings.Builder
+	depth := 0
+	for _, r := range path {
+		switch {
+		case r == '[':
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,109 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type CDR struct {
+	ID       string
+	Cost     float64
+	Answered time.Time
+	Tags     map[string]string
+	Events   []CDREvent
+}
+
+type CDREvent struct {
+	Name string
+	At   time.Time
+}
+
+type CDRs struct {
+	cdr CDR
+	err error
+}
+
+func (s *CDRs) Get(ctx *context.Context, id string, reply *CDR) error {
+	*reply = s.cdr
+	return s.err
+}
+
+func TestDiffValues(t *testing.T) {
+	now := time.Now()
+	a := CDR{
+		ID:       "1",
+		Cost:     0.1,
+		Answered: now,
+		Tags:     map[string]string{"a": "1", "b": "2"},
+		Events:   []CDREvent{{"start", now}, {"stop", now}},
+	}
+	b := CDR{
+		ID:       "1",
+		Cost:     0.1000001,
+		Answered: now.Add(time.Millisecond),
+		Tags:     map[string]string{"a": "1", "c": "3"},
+		Events:   []CDREvent{{"start", now.Add(time.Second)}},
+	}
+	exp := []Diff{
+		{"Cost", 0.1, 0.1000001},
+		{"Answered", now, now.Add(time.Millisecond)},
+		{"Tags[b]", "2", nil},
+		{"Tags[c]", nil, "3"},
+		{"Events[0].At", now, now.Add(time.Second)},
+		{"Events[1]", CDREvent{"stop", now}, nil},
+	}
+	if diffs := DiffValues(&a, &b); !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("expected %v, got %v", exp, diffs)
+	}
+
+	exp = []Diff{
+		{"Tags[b]", "2", nil},
+		{"Tags[c]", nil, "3"},
+		{"Events[1]", CDREvent{"stop", now}, nil},
+	}
+	diffs := DiffValues(a, b, FloatTolerance(0.001), TimeTolerance(time.Second), IgnoreFields("Events.Name"))
+	if !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("expected %v, got %v", exp, diffs)
+	}
+	if diffs := DiffValues(a, b, IgnoreFields("Cost", "Answered", "Tags", "Events")); len(diffs) != 0 {
+		t.Errorf("unexpected diffs %v", diffs)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	now := time.Now()
+	newBackend := func(s *CDRs) ClientConnector {
+		server := NewServer()
+		server.Register(s)
+		return newPipeClient(t, server)
+	}
+	old := newBackend(&CDRs{cdr: CDR{ID: "1", Cost: 1, Answered: now}})
+	migrated := newBackend(&CDRs{cdr: CDR{ID: "1", Cost: 2, Answered: now.Add(time.Microsecond)}})
+	ctx := context.Background()
+
+	var reply CDR
+	diffs, err := Compare(ctx, old, migrated, "CDRs.Get", "1", &reply, TimeTolerance(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Cost != 1 {
+		t.Errorf("expected the reply of the first backend, got %+v", reply)
+	}
+	if exp := []Diff{{"Cost", 1.0, 2.0}}; !reflect.DeepEqual(diffs, exp) {
+		t.Errorf("expected %v, got %v", exp, diffs)
+	}
+
+	failing := newBackend(&CDRs{err: errors.New("not found")})
+	diffs, err = Compare(ctx, old, failing, "CDRs.Get", "1", &reply)
+	if err != nil || len(diffs) != 1 || diffs[0].Path != "(error)" || diffs[0].A != nil {
+		t.Errorf("unexpected diffs %v: %v", diffs, err)
+	}
+	diffs, err = Compare(ctx, failing, failing, "CDRs.Get", "1", &reply)
+	if err == nil || len(diffs) != 0 {
+		t.Errorf("unexpected diffs %v: %v", diffs, err)
+	}
+}
@@ -0,0 +1,213 @@
+package birpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// compressMaxFrame bounds the payloads carried by the frames of the
+// compressed connections, compressed or not.
+const compressMaxFrame = 64 << 20
+
+// The flags starting the frames of the compressed connections.
+const (
+	frameRaw        = 0
+	frameCompressed = 1
+)
+
+var errCompressedFrame = errors.New("rpc: invalid compressed frame")
+
+// Compressor compresses the payloads of the connections, see Compression.
+// Snappy and zstd, among others, are made available by registering their
+// block encoders with RegisterCompressor.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	// Decompress fails for the payloads decompressing to more than
+	// maxSize bytes.
+	Decompress(data []byte, maxSize int) ([]byte, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		"gzip":    &flateCompressor{gzip: true},
+		"deflate": &flateCompressor{},
+	}
+)
+
+// RegisterCompressor makes a compressor available by name, "gzip" and
+// "deflate" being available by default.
+func RegisterCompressor(name string, c Compressor) {
+	compressorsMu.Lock()
+	compressors[name] = c
+	compressorsMu.Unlock()
+}
+
+func getCompressor(name string) (Compressor, error) {
+	compressorsMu.RLock()
+	c, has := compressors[name]
+	compressorsMu.RUnlock()
+	if !has {
+		return nil, errors.New("rpc: unknown compressor " + name)
+	}
+	return c, nil
+}
+
+// Compression wraps the connections so that the payloads written by their
+// codecs are compressed, whatever the codec. Both ends of a connection
+// must use the same Compression, enabled on the clients by Target and on
+// the servers by ListenerConfig, or by wrapping the connections with Conn
+// before passing them to the codecs.
+//
+// Each write of the codec, a message or a part of a large one, is sent as
+// a frame flagged as compressed or not, so that the small messages are
+// spared the cost of the compression.
+type Compression struct {
+	// Algorithm is the name of a registered Compressor.
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Threshold is the size, in bytes, of the smallest payload compressed.
+	Threshold int `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+}
+
+// Conn returns conn wrapped to compress the payloads.
+func (c *Compression) Conn(conn net.Conn) (net.Conn, error) {
+	comp, err := getCompressor(c.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return newCompressConn(conn, comp, c.Threshold), nil
+}
+
+type compressConn struct {
+	net.Conn
+	comp      Compressor
+	threshold int
+	framer    *Framer
+	rbuf      []byte // the rest of the last frame read
+}
+
+func newCompressConn(conn net.Conn, comp Compressor, threshold int) *compressConn {
+	return &compressConn{
+		Conn:      conn,
+		comp:      comp,
+		threshold: threshold,
+		framer:    NewFramer(conn, compressMaxFrame+1),
+	}
+}
+
+func (c *compressConn) Read(p []byte) (int, error) {
+	for len(c.rbuf) == 0 {
+		frame, err := c.framer.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+		if len(frame) == 0 {
+			return 0, errCompressedFrame
+		}
+		switch frame[0] {
+		case frameRaw:
+			c.rbuf = frame[1:]
+		case frameCompressed:
+			if c.rbuf, err = c.comp.Decompress(frame[1:], compressMaxFrame); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, errCompressedFrame
+		}
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *compressConn) unwrapConn() net.Conn { return c.Conn }
+
+func (c *compressConn) Write(p []byte) (n int, err error) {
+	for len(p) != 0 {
+		chunk := p
+		if len(chunk) > compressMaxFrame {
+			chunk = chunk[:compressMaxFrame]
+		}
+		if err = c.writeFrame(chunk); err != nil {
+			return
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return
+}
+
+func (c *compressConn) writeFrame(data []byte) error {
+	if len(data) >= c.threshold {
+		compressed, err := c.comp.Compress(data)
+		if err != nil {
+			return err
+		}
+		// incompressible payloads are sent as they are
+		if len(compressed) < len(data) {
+			return c.framer.WriteFrame(append([]byte{frameCompressed}, compressed...))
+		}
+	}
+	return c.framer.WriteFrame(append([]byte{frameRaw}, data...))
+}
+
+// flateCompressor implements gzip and deflate, reusing the writers.
+type flateCompressor struct {
+	gzip    bool
+	writers sync.Pool
+}
+
+// resetWriter is implemented by the gzip and flate writers.
+type resetWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+func (c *flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w resetWriter
+	if pooled := c.writers.Get(); pooled != nil {
+		w = pooled.(resetWriter)
+		w.Reset(&buf)
+	} else if c.gzip {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	c.writers.Put(w)
+	return buf.Bytes(), nil
+}
+
+func (c *flateCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	var r io.ReadCloser
+	if c.gzip {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxSize {
+		return nil, ErrFrameTooLarge
+	}
+	return out, nil
+}
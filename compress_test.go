@@ -0,0 +1,92 @@
+package birpc
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// countedCompressor counts the payloads it compresses.
+type countedCompressor struct {
+	Compressor
+	compressed int32
+}
+
+func (c *countedCompressor) Compress(data []byte) ([]byte, error) {
+	atomic.AddInt32(&c.compressed, 1)
+	return c.Compressor.Compress(data)
+}
+
+func TestCompression(t *testing.T) {
+	comp := &countedCompressor{Compressor: &flateCompressor{gzip: true}}
+	RegisterCompressor("counted-gzip", comp)
+
+	l, addr := listenTCP()
+	l.Close()
+	server, err := NewServerFromConfig(Config{
+		Listeners: []ListenerConfig{{
+			Address:     addr,
+			Compression: &Compression{Algorithm: "counted-gzip", Threshold: 1024},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Register(new(Arith))
+	go server.ListenAndServe()
+
+	ctx := context.Background()
+	var client *Client
+	for i := 0; i < 100; i++ {
+		if client, err = DialTarget(ctx, "birpc://"+addr+"?compress=counted-gzip&threshold=1024"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// the small messages are sent as they are
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Add", &Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Fatalf("Add: %v %v", reply.C, err)
+	}
+	if n := atomic.LoadInt32(&comp.compressed); n != 0 {
+		t.Errorf("expected no payload compressed, got %d", n)
+	}
+
+	// the large request is compressed
+	if err = client.Call(ctx, "Arith.Scan", "7"+strings.Repeat(" ", 10000), reply); err != nil || reply.C != 7 {
+		t.Fatalf("Scan: %v %v", reply.C, err)
+	}
+	if n := atomic.LoadInt32(&comp.compressed); n == 0 {
+		t.Error("expected the request to be compressed")
+	}
+}
+
+func TestCompressionConfig(t *testing.T) {
+	for _, l := range []ListenerConfig{
+		{Address: ":0", Compression: &Compression{Algorithm: "unknown"}},
+		{Address: ":0", Compression: &Compression{Algorithm: "gzip"}, HTTPPath: "/rpc"},
+	} {
+		cfg := Config{Listeners: []ListenerConfig{l}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", l)
+		}
+	}
+	if _, err := ParseTarget("birpc://host:1?compress=unknown"); err == nil {
+		t.Error("expected an unknown compressor to be rejected")
+	}
+	target, err := ParseTarget("birpc://host:1?compress=deflate&threshold=512")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := target.Compression; c == nil || c.Algorithm != "deflate" || c.Threshold != 512 {
+		t.Errorf("unexpected compression %+v", c)
+	}
+}
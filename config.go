@@ -0,0 +1,350 @@
+package birpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config is a declarative description of a server, meant to be loaded
+// from the configuration files of the embedding application. See
+// NewServerFromConfig.
+type Config struct {
+	Listeners []ListenerConfig `json:"listeners,omitempty" yaml:"listeners,omitempty"`
+	TLS       *TLSConfig       `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Limits    ServerConfig     `json:"limits" yaml:"limits"`
+	Auth      AuthConfig       `json:"auth" yaml:"auth"`
+}
+
+// ListenerConfig describes one listener of the server.
+type ListenerConfig struct {
+	// Network is the listener network, "tcp" if empty.
+	Network string `json:"network,omitempty" yaml:"network,omitempty"`
+	Address string `json:"address" yaml:"address"`
+	// Codec is the name of a registered server codec, "gob" if empty.
+	Codec string `json:"codec,omitempty" yaml:"codec,omitempty"`
+	// Negotiate serves the codecs declared by the clients in a preamble,
+	// see WritePreamble, using Codec for the clients without one.
+	Negotiate bool `json:"negotiate,omitempty" yaml:"negotiate,omitempty"`
+	// Compression, if set, compresses the payloads of the connections,
+	// after the preambles. Not supported with HTTPPath.
+	Compression *Compression `json:"compression,omitempty" yaml:"compression,omitempty"`
+	// TLS enables TLS on the listener using Config.TLS.
+	TLS bool `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// HTTPPath, if set, serves the RPC connections over HTTP CONNECT
+	// on the given path instead of raw connections.
+	HTTPPath string `json:"http_path,omitempty" yaml:"http_path,omitempty"`
+	// Socket sets the permissions of the file of the "unix" listeners,
+	// see ListenUnix.
+	Socket *UnixSocketConfig `json:"socket,omitempty" yaml:"socket,omitempty"`
+}
+
+// TLSConfig holds the certificates used by the TLS listeners.
+type TLSConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// ClientCAFile is used to verify the client certificates.
+	ClientCAFile string `json:"client_ca_file,omitempty" yaml:"client_ca_file,omitempty"`
+	// RequireClientCert rejects the clients without a valid certificate.
+	RequireClientCert bool `json:"require_client_cert,omitempty" yaml:"require_client_cert,omitempty"`
+}
+
+// AuthConfig restricts who may connect to the server.
+type AuthConfig struct {
+	// AllowedNetworks lists the CIDRs the clients may connect from.
+	// An empty list allows everyone.
+	AllowedNetworks []string `json:"allowed_networks,omitempty" yaml:"allowed_networks,omitempty"`
+}
+
+// Validate checks the configuration for errors.
+func (cfg *Config) Validate() error {
+	for _, l := range cfg.Listeners {
+		if l.Address == "" {
+			return errors.New("rpc: listener without address")
+		}
+		if _, err := getServerCodec(l.Codec); err != nil {
+			return err
+		}
+		if l.Compression != nil {
+			if l.HTTPPath != "" {
+				return errors.New("rpc: listener " + l.Address + " cannot compress HTTP connections")
+			}
+			if _, err := getCompressor(l.Compression.Algorithm); err != nil {
+				return err
+			}
+		}
+		if l.Socket != nil {
+			if l.Network != "unix" {
+				return errors.New("rpc: listener " + l.Address + " is not a unix socket")
+			}
+			if err := l.Socket.Validate(); err != nil {
+				return err
+			}
+		}
+		if l.TLS && cfg.TLS == nil {
+			return errors.New("rpc: listener " + l.Address + " requires TLS but no TLS config is defined")
+		}
+	}
+	if cfg.TLS != nil {
+		if cfg.TLS.CertFile == "" || cfg.TLS.KeyFile == "" {
+			return errors.New("rpc: TLS config requires cert_file and key_file")
+		}
+		if cfg.TLS.RequireClientCert && cfg.TLS.ClientCAFile == "" {
+			return errors.New("rpc: require_client_cert needs client_ca_file")
+		}
+	}
+	if _, err := parseNetworks(cfg.Auth.AllowedNetworks); err != nil {
+		return err
+	}
+	return cfg.Limits.Validate()
+}
+
+// tlsConfig loads the certificates described by cfg.
+func (cfg *TLSConfig) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = x509.NewCertPool()
+		if !tlsCfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("rpc: no certificates found in " + cfg.ClientCAFile)
+		}
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsCfg, nil
+}
+
+func parseNetworks(cidrs []string) (nets []*net.IPNet, err error) {
+	for _, cidr := range cidrs {
+		var n *net.IPNet
+		if _, n, err = net.ParseCIDR(cidr); err != nil {
+			return nil, errors.New("rpc: bad allowed network: " + err.Error())
+		}
+		nets = append(nets, n)
+	}
+	return
+}
+
+// allowedAddr reports whether addr is part of any of nets. Non IP
+// addresses, like unix sockets, are always allowed.
+func allowedAddr(nets []*net.IPNet, addr net.Addr) bool {
+	if len(nets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewServerFromConfig returns a new Server with the limits from cfg
+// applied. The listeners are started by ListenAndServe.
+func NewServerFromConfig(cfg Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	server := NewServer()
+	if err := server.ApplyConfig(cfg.Limits); err != nil {
+		return nil, err
+	}
+	server.cfg = &cfg
+	return server, nil
+}
+
+// ListenAndServe starts the listeners defined in the Config the server was
+// created with and serves them. It blocks until one of the listeners fails
+// and returns its error, closing the other listeners.
+func (server *Server) ListenAndServe() error {
+	if server.cfg == nil {
+		return errors.New("rpc: server was not created from a Config")
+	}
+	if len(server.cfg.Listeners) == 0 {
+		return errors.New("rpc: no listeners in the server Config")
+	}
+	var tlsCfg *tls.Config
+	if server.cfg.TLS != nil {
+		var err error
+		if tlsCfg, err = server.cfg.TLS.tlsConfig(); err != nil {
+			return err
+		}
+	}
+	nets, _ := parseNetworks(server.cfg.Auth.AllowedNetworks)
+	var lis []net.Listener
+	defer func() {
+		for _, l := range lis {
+			l.Close()
+		}
+	}()
+	for _, lc := range server.cfg.Listeners {
+		network := lc.Network
+		if network == "" {
+			network = "tcp"
+		}
+		var l net.Listener
+		var err error
+		if network == "unix" {
+			l, err = ListenUnix(lc.Address, lc.Socket)
+		} else {
+			l, err = net.Listen(network, lc.Address)
+		}
+		if err != nil {
+			return err
+		}
+		if lc.TLS {
+			l = tls.NewListener(l, tlsCfg)
+		}
+		lis = append(lis, l)
+	}
+	errs := make(chan error, len(lis))
+	for i, l := range lis {
+		go func(l net.Listener, lc ListenerConfig) {
+			errs <- server.serveListener(l, lc, nets)
+		}(l, server.cfg.Listeners[i])
+	}
+	return <-errs
+}
+
+func (server *Server) serveListener(l net.Listener, lc ListenerConfig, nets []*net.IPNet) error {
+	defer server.trackListener(l)()
+	l = &filterListener{Listener: l, nets: nets}
+	if lc.HTTPPath != "" {
+		mux := http.NewServeMux()
+		mux.Handle(lc.HTTPPath, server)
+		return http.Serve(l, mux)
+	}
+	newCodec, err := getServerCodec(lc.Codec)
+	if err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			debugln("rpc.Serve: accept:", err.Error())
+			return server.acceptError(err)
+		}
+		if !lc.Negotiate {
+			if lc.Compression != nil {
+				// validated by NewServerFromConfig
+				conn, _ = lc.Compression.Conn(conn)
+			}
+			go server.ServeCodec(newCodec(conn))
+			continue
+		}
+		go func() {
+			name, rconn, err := readPreamble(conn, lc.Codec)
+			if err == nil && lc.Compression != nil {
+				rconn, err = lc.Compression.Conn(rconn)
+			}
+			var newCodec func(io.ReadWriteCloser) ServerCodec
+			if err == nil {
+				newCodec, err = getServerCodec(name)
+			}
+			if err != nil {
+				debugln("rpc: negotiating the codec:", err)
+				conn.Close()
+				return
+			}
+			server.ServeCodec(newCodec(rconn))
+		}()
+	}
+}
+
+// filterListener closes the accepted connections coming from addresses
+// outside of nets.
+type filterListener struct {
+	net.Listener
+	nets []*net.IPNet
+}
+
+func (l *filterListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || allowedAddr(l.nets, conn.RemoteAddr()) {
+			return conn, err
+		}
+		debugln("rpc: rejected connection from", conn.RemoteAddr())
+		conn.Close()
+	}
+}
+
+// jsonDuration is a time.Duration encoded in JSON as a duration string,
+// numbers are accepted as nanoseconds when decoding.
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = jsonDuration(v)
+	case string:
+		dur, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = jsonDuration(dur)
+	default:
+		return errors.New("rpc: invalid duration " + string(b))
+	}
+	return nil
+}
+
+type plainServerConfig ServerConfig
+
+// jsonServerConfig overrides the durations of ServerConfig for JSON.
+type jsonServerConfig struct {
+	*plainServerConfig
+	CallTimeout jsonDuration `json:"call_timeout,omitempty"`
+}
+
+// MarshalJSON encodes the durations as duration strings.
+func (cfg ServerConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonServerConfig{
+		plainServerConfig: (*plainServerConfig)(&cfg),
+		CallTimeout:       jsonDuration(cfg.CallTimeout),
+	})
+}
+
+// UnmarshalJSON accepts duration strings like "2s" for the durations.
+func (cfg *ServerConfig) UnmarshalJSON(b []byte) error {
+	aux := jsonServerConfig{
+		plainServerConfig: (*plainServerConfig)(cfg),
+		CallTimeout:       jsonDuration(cfg.CallTimeout),
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	cfg.CallTimeout = time.Duration(aux.CallTimeout)
+	return nil
+}
@@ -0,0 +1,394 @@
+package birpc
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables read by
+// Config.LoadEnv.
+const EnvPrefix = "BIRPC_"
+
+// configVars returns the variables which can be bound to the environment
+// or to command line flags.
+func (cfg *Config) configVars() []configVar {
+	l := &listenVars{cfg: cfg}
+	return []configVar{
+		{"LISTEN", "comma separated listen addresses, [network://]address", (*listenersVar)(l)},
+		{"CODEC", "codec used by the listeners", (*codecVar)(l)},
+		{"MAX_CONNS", "maximum number of connections", (*intVar)(&cfg.Limits.MaxConns)},
+		{"MAX_CONCURRENT_CALLS", "maximum number of calls served at once", (*intVar)(&cfg.Limits.MaxConcurrentCalls)},
+		{"MAX_CONCURRENT_COST", "maximum total cost of the calls served at once", (*intVar)(&cfg.Limits.MaxConcurrentCost)},
+		{"METHOD_COSTS", "comma separated method=cost weights", (*costsVar)(&cfg.Limits.MethodCosts)},
+		{"CALL_TIMEOUT", "timeout of the method calls", (*durationVar)(&cfg.Limits.CallTimeout)},
+		{"RATE_LIMIT", "calls per second accepted", (*floatVar)(&cfg.Limits.RateLimit)},
+		{"RATE_BURST", "calls accepted at once over the rate limit", (*intVar)(&cfg.Limits.RateBurst)},
+		{"CONN_RATE_LIMIT", "calls per second accepted from each connection", (*floatVar)(&cfg.Limits.ConnRateLimit)},
+		{"CONN_RATE_BURST", "calls accepted at once from each connection over its rate limit", (*intVar)(&cfg.Limits.ConnRateBurst)},
+		{"METHOD_RATE_LIMITS", "comma separated method=rate[/burst] limits", (*rateLimitsVar)(&cfg.Limits.MethodRateLimits)},
+		{"METHOD_CONCURRENCY", "comma separated method=max[/queue] limits", (*concurrencyVar)(&cfg.Limits.MethodConcurrency)},
+		{"ALLOW_METHODS", "comma separated patterns of the allowed methods", (*listVar)(&cfg.Limits.AllowMethods)},
+		{"DENY_METHODS", "comma separated patterns of the denied methods", (*listVar)(&cfg.Limits.DenyMethods)},
+		{"METHOD_ALIASES", "comma separated old=new method names", (*mapVar)(&cfg.Limits.MethodAliases)},
+		{"MAX_CALL_DEPTH", "maximum depth of the nested calls", (*intVar)(&cfg.Limits.MaxCallDepth)},
+		{"TLS_CERT", "TLS certificate file", &tlsVar{cfg, func(t *TLSConfig) interface{} { return &t.CertFile }}},
+		{"TLS_KEY", "TLS key file", &tlsVar{cfg, func(t *TLSConfig) interface{} { return &t.KeyFile }}},
+		{"TLS_CLIENT_CA", "CA file used to verify the client certificates", &tlsVar{cfg, func(t *TLSConfig) interface{} { return &t.ClientCAFile }}},
+		{"TLS_REQUIRE_CLIENT_CERT", "require client certificates", &tlsVar{cfg, func(t *TLSConfig) interface{} { return &t.RequireClientCert }}},
+		{"ALLOWED_NETWORKS", "comma separated CIDRs the clients may connect from", (*listVar)(&cfg.Auth.AllowedNetworks)},
+	}
+}
+
+type configVar struct {
+	name  string
+	usage string
+	value flag.Value
+}
+
+// LoadEnv overrides the fields of cfg with the environment variables that
+// are set. Call Config.Validate afterwards. The variables are:
+//
+//	BIRPC_LISTEN                   comma separated [network://]address list
+//	BIRPC_CODEC                    codec of the listeners
+//	BIRPC_MAX_CONNS                Limits.MaxConns
+//	BIRPC_MAX_CONCURRENT_CALLS     Limits.MaxConcurrentCalls
+//	BIRPC_MAX_CONCURRENT_COST      Limits.MaxConcurrentCost
+//	BIRPC_METHOD_COSTS             comma separated method=cost Limits.MethodCosts
+//	BIRPC_CALL_TIMEOUT             Limits.CallTimeout, e.g. "2s"
+//	BIRPC_RATE_LIMIT               Limits.RateLimit
+//	BIRPC_RATE_BURST               Limits.RateBurst
+//	BIRPC_CONN_RATE_LIMIT          Limits.ConnRateLimit
+//	BIRPC_CONN_RATE_BURST          Limits.ConnRateBurst
+//	BIRPC_METHOD_RATE_LIMITS       comma separated method=rate[/burst] Limits.MethodRateLimits
+//	BIRPC_METHOD_CONCURRENCY       comma separated method=max[/queue] Limits.MethodConcurrency
+//	BIRPC_ALLOW_METHODS            comma separated Limits.AllowMethods
+//	BIRPC_DENY_METHODS             comma separated Limits.DenyMethods
+//	BIRPC_METHOD_ALIASES           comma separated old=new Limits.MethodAliases
+//	BIRPC_MAX_CALL_DEPTH           Limits.MaxCallDepth
+//	BIRPC_TLS_CERT                 TLS.CertFile
+//	BIRPC_TLS_KEY                  TLS.KeyFile
+//	BIRPC_TLS_CLIENT_CA            TLS.ClientCAFile
+//	BIRPC_TLS_REQUIRE_CLIENT_CERT  TLS.RequireClientCert
+//	BIRPC_ALLOWED_NETWORKS         comma separated Auth.AllowedNetworks
+//
+// BIRPC_LISTEN replaces the listeners of the Config; "tls://" selects a
+// TCP listener with TLS enabled and an address without network is TCP.
+func (cfg *Config) LoadEnv() error {
+	return cfg.loadEnv(os.LookupEnv)
+}
+
+func (cfg *Config) loadEnv(lookup func(string) (string, bool)) (err error) {
+	for _, v := range cfg.configVars() {
+		val, has := lookup(EnvPrefix + v.name)
+		if !has {
+			continue
+		}
+		if err = v.value.Set(val); err != nil {
+			return errors.New("rpc: invalid " + EnvPrefix + v.name + ": " + err.Error())
+		}
+	}
+	return
+}
+
+// BindFlags defines flags on fs which override the fields of cfg when the
+// flags are parsed. Call Config.Validate after parsing. The flags match the
+// variables read by LoadEnv, lowercased and prefixed by "birpc." with
+// dashes instead of underscores: -birpc.listen, -birpc.max-conns,
+// -birpc.tls-cert and so on.
+func (cfg *Config) BindFlags(fs *flag.FlagSet) {
+	for _, v := range cfg.configVars() {
+		fs.Var(v.value, "birpc."+strings.ReplaceAll(strings.ToLower(v.name), "_", "-"), v.usage)
+	}
+}
+
+type intVar int
+
+func (v *intVar) String() string { return strconv.Itoa(int(*v)) }
+func (v *intVar) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	*v = intVar(i)
+	return err
+}
+
+type floatVar float64
+
+func (v *floatVar) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+func (v *floatVar) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	*v = floatVar(f)
+	return err
+}
+
+type durationVar time.Duration
+
+func (v *durationVar) String() string { return time.Duration(*v).String() }
+func (v *durationVar) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	*v = durationVar(d)
+	return err
+}
+
+type listVar []string
+
+func (v *listVar) String() string { return strings.Join(*v, ",") }
+func (v *listVar) Set(s string) error {
+	*v = splitList(s)
+	return nil
+}
+
+type mapVar map[string]string
+
+func (v *mapVar) String() string {
+	if v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for k, val := range *v {
+		pairs = append(pairs, k+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *mapVar) Set(s string) error {
+	m := make(map[string]string)
+	for _, pair := range splitList(s) {
+		i := strings.IndexByte(pair, '=')
+		if i == -1 {
+			return errors.New("missing = in " + pair)
+		}
+		m[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	*v = m
+	return nil
+}
+
+type costsVar map[string]int
+
+func (v *costsVar) String() string {
+	if v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for k, cost := range *v {
+		pairs = append(pairs, k+"="+strconv.Itoa(cost))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *costsVar) Set(s string) error {
+	m := make(map[string]int)
+	for _, pair := range splitList(s) {
+		i := strings.IndexByte(pair, '=')
+		if i == -1 {
+			return errors.New("missing = in " + pair)
+		}
+		cost, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+		if err != nil {
+			return err
+		}
+		m[strings.TrimSpace(pair[:i])] = cost
+	}
+	*v = m
+	return nil
+}
+
+type rateLimitsVar map[string]RateLimit
+
+func (v *rateLimitsVar) String() string {
+	if v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for k, limit := range *v {
+		pair := k + "=" + strconv.FormatFloat(limit.Rate, 'g', -1, 64)
+		if limit.Burst != 0 {
+			pair += "/" + strconv.Itoa(limit.Burst)
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *rateLimitsVar) Set(s string) error {
+	m := make(map[string]RateLimit)
+	for _, pair := range splitList(s) {
+		i := strings.IndexByte(pair, '=')
+		if i == -1 {
+			return errors.New("missing = in " + pair)
+		}
+		var limit RateLimit
+		rate, burst := strings.TrimSpace(pair[i+1:]), ""
+		if j := strings.IndexByte(rate, '/'); j != -1 {
+			rate, burst = rate[:j], rate[j+1:]
+		}
+		var err error
+		if limit.Rate, err = strconv.ParseFloat(rate, 64); err != nil {
+			return err
+		}
+		if burst != "" {
+			if limit.Burst, err = strconv.Atoi(burst); err != nil {
+				return err
+			}
+		}
+		m[strings.TrimSpace(pair[:i])] = limit
+	}
+	*v = m
+	return nil
+}
+
+type concurrencyVar map[string]ConcurrencyLimit
+
+func (v *concurrencyVar) String() string {
+	if v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for k, limit := range *v {
+		pair := k + "=" + strconv.Itoa(limit.Max)
+		if limit.Queue != 0 {
+			pair += "/" + strconv.Itoa(limit.Queue)
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (v *concurrencyVar) Set(s string) error {
+	m := make(map[string]ConcurrencyLimit)
+	for _, pair := range splitList(s) {
+		i := strings.IndexByte(pair, '=')
+		if i == -1 {
+			return errors.New("missing = in " + pair)
+		}
+		var limit ConcurrencyLimit
+		max, queue := strings.TrimSpace(pair[i+1:]), ""
+		if j := strings.IndexByte(max, '/'); j != -1 {
+			max, queue = max[:j], max[j+1:]
+		}
+		var err error
+		if limit.Max, err = strconv.Atoi(max); err != nil {
+			return err
+		}
+		if queue != "" {
+			if limit.Queue, err = strconv.Atoi(queue); err != nil {
+				return err
+			}
+		}
+		m[strings.TrimSpace(pair[:i])] = limit
+	}
+	*v = m
+	return nil
+}
+
+func splitList(s string) (l []string) {
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			l = append(l, e)
+		}
+	}
+	return
+}
+
+// tlsVar sets a field of the TLS config, creating it on first use so an
+// unset variable does not enable TLS.
+type tlsVar struct {
+	cfg   *Config
+	field func(*TLSConfig) interface{}
+}
+
+func (v *tlsVar) String() string {
+	if v.cfg == nil || v.cfg.TLS == nil {
+		return ""
+	}
+	switch f := v.field(v.cfg.TLS).(type) {
+	case *string:
+		return *f
+	case *bool:
+		return strconv.FormatBool(*f)
+	}
+	return ""
+}
+
+func (v *tlsVar) Set(s string) (err error) {
+	if v.cfg.TLS == nil {
+		v.cfg.TLS = new(TLSConfig)
+	}
+	switch f := v.field(v.cfg.TLS).(type) {
+	case *string:
+		*f = s
+	case *bool:
+		*f, err = strconv.ParseBool(s)
+	}
+	return
+}
+
+func (v *tlsVar) IsBoolFlag() bool {
+	_, isBool := v.field(new(TLSConfig)).(*bool)
+	return isBool
+}
+
+// listenVars holds the state shared by the listen and codec variables so
+// they can be set in any order.
+type listenVars struct {
+	cfg   *Config
+	codec string
+}
+
+type listenersVar listenVars
+
+func (v *listenersVar) String() string {
+	if v.cfg == nil {
+		return ""
+	}
+	addrs := make([]string, len(v.cfg.Listeners))
+	for i, l := range v.cfg.Listeners {
+		switch {
+		case l.TLS:
+			addrs[i] = "tls://" + l.Address
+		case l.Network != "" && l.Network != "tcp":
+			addrs[i] = l.Network + "://" + l.Address
+		default:
+			addrs[i] = l.Address
+		}
+	}
+	return strings.Join(addrs, ",")
+}
+
+func (v *listenersVar) Set(s string) error {
+	v.cfg.Listeners = nil
+	for _, addr := range splitList(s) {
+		l := ListenerConfig{Address: addr, Codec: v.codec}
+		if i := strings.Index(addr, "://"); i != -1 {
+			l.Network, l.Address = addr[:i], addr[i+3:]
+		}
+		if l.Network == "tls" {
+			l.Network, l.TLS = "tcp", true
+		}
+		v.cfg.Listeners = append(v.cfg.Listeners, l)
+	}
+	return nil
+}
+
+type codecVar listenVars
+
+func (v *codecVar) String() string { return v.codec }
+
+func (v *codecVar) Set(s string) error {
+	if _, err := getServerCodec(s); err != nil {
+		return err
+	}
+	v.codec = s
+	for i := range v.cfg.Listeners {
+		v.cfg.Listeners[i].Codec = s
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package birpc
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"BIRPC_LISTEN":             "127.0.0.1:2012, tls://:2013,unix:///tmp/birpc.sock",
+		"BIRPC_MAX_CONNS":          "100",
+		"BIRPC_CALL_TIMEOUT":       "1500ms",
+		"BIRPC_RATE_LIMIT":         "2.5",
+		"BIRPC_DENY_METHODS":       "Admin.*,Debug.*",
+		"BIRPC_METHOD_ALIASES":     "Old.Get=New.Get, Old.Set = New.Set",
+		"BIRPC_METHOD_COSTS":       "CDRs.Export=50",
+		"BIRPC_CONN_RATE_LIMIT":    "20",
+		"BIRPC_METHOD_RATE_LIMITS": "Rater.Rate=100/150, CDRs.Export=0.5",
+		"BIRPC_METHOD_CONCURRENCY": "CDRs.Rerate=2/10",
+		"BIRPC_TLS_CERT":           "cert.pem",
+		"BIRPC_TLS_KEY":            "key.pem",
+		"BIRPC_ALLOWED_NETWORKS":   "10.0.0.0/8",
+	}
+	var cfg Config
+	err := cfg.loadEnv(func(k string) (v string, has bool) {
+		v, has = env[k]
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	expListeners := []ListenerConfig{
+		{Address: "127.0.0.1:2012"},
+		{Network: "tcp", Address: ":2013", TLS: true},
+		{Network: "unix", Address: "/tmp/birpc.sock"},
+	}
+	if !reflect.DeepEqual(cfg.Listeners, expListeners) {
+		t.Errorf("expected listeners %+v, got %+v", expListeners, cfg.Listeners)
+	}
+	expLimits := ServerConfig{
+		MaxConns:    100,
+		CallTimeout: 1500 * time.Millisecond,
+		RateLimit:   2.5,
+		DenyMethods: []string{"Admin.*", "Debug.*"},
+		MethodAliases: map[string]string{
+			"Old.Get": "New.Get",
+			"Old.Set": "New.Set",
+		},
+		MethodCosts:   map[string]int{"CDRs.Export": 50},
+		ConnRateLimit: 20,
+		MethodRateLimits: map[string]RateLimit{
+			"Rater.Rate":  {Rate: 100, Burst: 150},
+			"CDRs.Export": {Rate: 0.5},
+		},
+		MethodConcurrency: map[string]ConcurrencyLimit{"CDRs.Rerate": {Max: 2, Queue: 10}},
+	}
+	if !reflect.DeepEqual(cfg.Limits, expLimits) {
+		t.Errorf("expected limits %+v, got %+v", expLimits, cfg.Limits)
+	}
+	if cfg.TLS == nil || cfg.TLS.CertFile != "cert.pem" || cfg.TLS.KeyFile != "key.pem" {
+		t.Errorf("unexpected TLS config: %+v", cfg.TLS)
+	}
+
+	env = map[string]string{"BIRPC_MAX_CONNS": "many"}
+	if err = cfg.loadEnv(func(k string) (v string, has bool) {
+		v, has = env[k]
+		return
+	}); err == nil {
+		t.Error("expected error for invalid BIRPC_MAX_CONNS")
+	}
+}
+
+func TestConfigBindFlags(t *testing.T) {
+	var cfg Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.BindFlags(fs)
+	if cfg.TLS != nil {
+		t.Error("binding the flags should not enable TLS")
+	}
+	err := fs.Parse([]string{
+		"-birpc.codec", "gob",
+		"-birpc.listen", ":2012",
+		"-birpc.max-concurrent-calls", "8",
+		"-birpc.tls-require-client-cert",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Listeners) != 1 || cfg.Listeners[0].Codec != "gob" {
+		t.Errorf("unexpected listeners: %+v", cfg.Listeners)
+	}
+	if cfg.Limits.MaxConcurrentCalls != 8 {
+		t.Errorf("expected 8 concurrent calls, got %d", cfg.Limits.MaxConcurrentCalls)
+	}
+	if cfg.TLS == nil || !cfg.TLS.RequireClientCert {
+		t.Errorf("unexpected TLS config: %+v", cfg.TLS)
+	}
+}
@@ -0,0 +1,122 @@
+package birpc
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestConfigJSON(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{
+		"listeners": [{"address": "127.0.0.1:2012"}, {"network": "unix", "address": "/tmp/birpc.sock", "codec": "gob"}],
+		"limits": {"max_conns": 10, "call_timeout": "2s", "deny_methods": ["Admin.*"]},
+		"auth": {"allowed_networks": ["127.0.0.0/8"]}
+	}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Limits.MaxConns != 10 || cfg.Limits.CallTimeout != 2*time.Second ||
+		len(cfg.Limits.DenyMethods) != 1 || len(cfg.Listeners) != 2 {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	b, err := json.Marshal(cfg.Limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var limits ServerConfig
+	if err = json.Unmarshal(b, &limits); err != nil {
+		t.Fatal(err)
+	}
+	if limits.CallTimeout != 2*time.Second {
+		t.Errorf("expected call_timeout to survive a round trip, got %s", b)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no address":  {Listeners: []ListenerConfig{{}}},
+		"bad codec":   {Listeners: []ListenerConfig{{Address: ":0", Codec: "xml"}}},
+		"missing tls": {Listeners: []ListenerConfig{{Address: ":0", TLS: true}}},
+		"tls no key":  {TLS: &TLSConfig{CertFile: "cert.pem"}},
+		"bad network": {Auth: AuthConfig{AllowedNetworks: []string{"10.0.0.1"}}},
+		"bad limit":   {Limits: ServerConfig{MaxConns: -1}},
+	} {
+		if _, err := NewServerFromConfig(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestNewServerFromConfig(t *testing.T) {
+	l, addr := listenTCP()
+	l.Close()
+	server, err := NewServerFromConfig(Config{
+		Listeners: []ListenerConfig{{Address: addr}},
+		Limits:    ServerConfig{DenyMethods: []string{"Arith.Mul"}},
+		Auth:      AuthConfig{AllowedNetworks: []string{"127.0.0.0/8"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Register(new(Arith))
+	go server.ListenAndServe()
+
+	var client *Client
+	for i := 0; i < 100; i++ {
+		if client, err = Dial("tcp", addr); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reply := new(Reply)
+	if err = client.Call(context.Background(), "Arith.Add", &Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("Add: %v %v", reply.C, err)
+	}
+	if err = client.Call(context.Background(), "Arith.Mul", &Args{1, 2}, reply); err == nil {
+		t.Error("expected Mul to be denied")
+	}
+}
+
+func TestListenAndServeNoListeners(t *testing.T) {
+	server, err := NewServerFromConfig(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+	select {
+	case err = <-errs:
+		if err == nil {
+			t.Error("expected an error without listeners")
+		}
+	case <-time.After(time.Second):
+		t.Error("ListenAndServe blocked without listeners")
+	}
+}
+
+func TestAllowedAddr(t *testing.T) {
+	nets, err := parseNetworks([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allowedAddr(nets, &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 1}) {
+		t.Error("expected 10.1.2.3 to be allowed")
+	}
+	if allowedAddr(nets, &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 1}) {
+		t.Error("expected 192.168.1.1 to be rejected")
+	}
+	if !allowedAddr(nets, &net.UnixAddr{Name: "/tmp/s", Net: "unix"}) {
+		t.Error("expected unix addresses to be allowed")
+	}
+}
@@ -0,0 +1,148 @@
+package birpc
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+// connEpoch counts the connections created by the process.
+var connEpoch uint64
+
+// ConnID identifies a connection on both of its sides, so their logs can
+// be correlated. The client assigns it when created and sends it to the
+// server along with its first request, see Hello. It is found in the logs of
+// both sides, in the CallInfo, the Call and the Diagnostics, and in the
+// ConnError failing the calls of a broken connection.
+type ConnID struct {
+	UUID  string // random UUID of the connection
+	Epoch uint64 // increases with each connection created by the client process
+}
+
+// String returns the UUID and the epoch of id, empty if id is zero.
+func (id ConnID) String() string {
+	if id.UUID == "" {
+		return ""
+	}
+	return id.UUID + "#" + strconv.FormatUint(id.Epoch, 10)
+}
+
+// random16 returns 16 random bytes, panicking if the system has none.
+func random16() (b [16]byte) {
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("rpc: reading random bytes: " + err.Error())
+	}
+	return
+}
+
+func newConnID() ConnID {
+	b := random16()
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return ConnID{
+		UUID:  fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:]),
+		Epoch: atomic.AddUint64(&connEpoch, 1),
+	}
+}
+
+// ConnID returns the identity of the connection of the client.
+func (client *basicClient) ConnID() ConnID {
+	return client.id
+}
+
+// Hello sends the identity of the connection to the server, which shows
+// it in its logs and in the CallInfo of the calls served on the
+// connection. The clients send it on their own along with their first
+// request, see ConnIDMetadata; Hello waits for the server to acknowledge
+// it.
+func (client *basicClient) Hello(ctx *context.Context) error {
+	var reply svc.HelloArgs
+	return client.Call(ctx, "_goRPC_.Hello", &svc.HelloArgs{UUID: client.id.UUID, Epoch: client.id.Epoch}, &reply)
+}
+
+// ConnIDMetadata is the key of the metadata carrying the identity of the
+// connection along with its first request, see ConnID.
+const ConnIDMetadata = "conn-id"
+
+// withConnID returns a copy of md with the identity id.
+func withConnID(md Metadata, id ConnID) Metadata {
+	with := make(Metadata, len(md)+1)
+	for k, v := range md {
+		with[k] = v
+	}
+	with[ConnIDMetadata] = id.String()
+	return with
+}
+
+// parseConnID parses an identity in the form returned by ConnID.String.
+func parseConnID(s string) (id ConnID, ok bool) {
+	hash := strings.LastIndexByte(s, '#')
+	if hash <= 0 {
+		return
+	}
+	epoch, err := strconv.ParseUint(s[hash+1:], 10, 64)
+	if err != nil {
+		return
+	}
+	return ConnID{UUID: s[:hash], Epoch: epoch}, true
+}
+
+// readConnID records the identity of the connection sent along with the
+// first request of the client, removing it from the metadata of the call.
+func (conn *serverConn) readConnID(req *Request) {
+	s, has := req.Metadata[ConnIDMetadata]
+	if !has {
+		return
+	}
+	delete(req.Metadata, ConnIDMetadata)
+	if id, ok := parseConnID(s); ok {
+		conn.setConnID(id.UUID, id.Epoch)
+	}
+}
+
+// connID returns the identity sent by the client with Hello, zero before.
+func (conn *serverConn) connID() ConnID {
+	id, _ := conn.id.Load().(ConnID)
+	return id
+}
+
+func (conn *serverConn) setConnID(uuid string, epoch uint64) {
+	conn.id.Store(ConnID{UUID: uuid, Epoch: epoch})
+}
+
+// ConnError fails the calls pending on a connection which broke,
+// identifying the connection. It wraps the cause, as io.ErrUnexpectedEOF.
+type ConnError struct {
+	Conn ConnID
+	Err  error
+}
+
+func (e *ConnError) Error() string {
+	return logPrefix("rpc: connection", e.Conn) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the cause of the error.
+func (e *ConnError) Unwrap() error { return e.Err }
+
+// connError wraps err, failing the calls pending on the connection id,
+// into a ConnError unless the connection was closed on purpose.
+func connError(id ConnID, err error) error {
+	if err == ErrShutdown {
+		return err
+	}
+	return &ConnError{Conn: id, Err: err}
+}
+
+// logPrefix appends the identity of a connection, if known, to the prefix
+// of its logs.
+func logPrefix(prefix string, id ConnID) string {
+	if id.UUID == "" {
+		return prefix
+	}
+	return prefix + " [" + id.String() + "]"
+}
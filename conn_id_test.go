@@ -0,0 +1,90 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Whoami struct{}
+
+func (Whoami) Conn(ctx *context.Context, _ string, reply *ConnID, info *CallInfo) error {
+	if _, has := MetadataFromContext(ctx)[ConnIDMetadata]; has {
+		return errors.New("unexpected identity in the metadata")
+	}
+	*reply = info.Conn
+	return nil
+}
+
+func TestConnID(t *testing.T) {
+	server := NewServer()
+	server.Register(Whoami{})
+	bserver := NewBirpcServer()
+	bserver.Register(Whoami{})
+	ctx := context.Background()
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	var lastEpoch uint64
+	for name, client := range map[string]interface {
+		ClientConnector
+		ConnID() ConnID
+		Hello(*context.Context) error
+	}{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		id := client.ConnID()
+		if !uuid.MatchString(id.UUID) || id.Epoch == 0 || id.Epoch == lastEpoch {
+			t.Errorf("%s: unexpected connection identity %v", name, id)
+		}
+		lastEpoch = id.Epoch
+
+		// the identity goes with the first call
+		var got ConnID
+		if err := client.Call(ctx, "Whoami.Conn", "", &got); err != nil || got != id {
+			t.Errorf("%s: expected %v, got %v: %v", name, id, got, err)
+		}
+		if err := client.Hello(ctx); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := client.Call(ctx, "Whoami.Conn", "", &got); err != nil || got != id {
+			t.Errorf("%s: expected %v, got %v: %v", name, id, got, err)
+		}
+	}
+
+	if a, b := newConnID(), newConnID(); a.UUID == b.UUID || b.Epoch <= a.Epoch {
+		t.Errorf("expected distinct identities with increasing epochs, got %v and %v", a, b)
+	}
+}
+
+func TestConnError(t *testing.T) {
+	server := NewServer()
+	blocker := &Blocker{release: make(chan struct{})}
+	defer close(blocker.release)
+	server.Register(blocker, NoReplyMethods())
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	client := NewClient(c1)
+	defer client.Close()
+
+	call := client.Go("Blocker.Hold", 1, nil, nil)
+	if call.Conn != client.ConnID() {
+		t.Errorf("expected the call sent on %v, got %v", client.ConnID(), call.Conn)
+	}
+	c2.Close()
+	<-call.Done
+	var connErr *ConnError
+	if !errors.As(call.Error, &connErr) || connErr.Conn != client.ConnID() || !errors.Is(call.Error, io.ErrUnexpectedEOF) {
+		t.Errorf("expected a ConnError of %v, got %v", client.ConnID(), call.Error)
+	}
+	if !IsConnectionError(call.Error) {
+		t.Errorf("expected %v to be a connection error", call.Error)
+	}
+	if id, ok := parseConnID(client.ConnID().String()); !ok || id != client.ConnID() {
+		t.Errorf("expected %v parsed, got %v", client.ConnID(), id)
+	}
+}
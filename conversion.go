@@ -0,0 +1,115 @@
+package birpc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Conversion converts the arguments and the reply of the calls to a
+// method between their representations on the client and on the server,
+// for talking to the servers of older versions during rolling upgrades,
+// like those taking a duration in seconds rather than nanoseconds. The
+// nil functions leave their values as they are.
+type Conversion struct {
+	// Args returns the arguments sent in place of args.
+	Args func(args interface{}) (interface{}, error)
+
+	// NewReply returns the value receiving the reply of the server, when
+	// the server replies with a type of its own. If nil the reply is
+	// received in the reply of the call.
+	NewReply func() interface{}
+
+	// Reply fills reply, the one of the call, from received, the value
+	// returned by NewReply or reply itself.
+	Reply func(received, reply interface{}) error
+}
+
+// ConversionInterceptor returns the ClientInterceptor applying the
+// conversions of the methods, by their service method names.
+func ConversionInterceptor(conversions map[string]Conversion) ClientInterceptor {
+	return func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) (err error) {
+		conv, has := conversions[serviceMethod]
+		if !has {
+			return invoker(ctx, serviceMethod, args, reply)
+		}
+		if conv.Args != nil {
+			if args, err = conv.Args(args); err != nil {
+				return
+			}
+		}
+		received := reply
+		if conv.NewReply != nil {
+			received = conv.NewReply()
+		}
+		if err = invoker(ctx, serviceMethod, args, received); err != nil || conv.Reply == nil {
+			return
+		}
+		return conv.Reply(received, reply)
+	}
+}
+
+// ScaleFields returns the Conversion multiplying the numeric fields named
+// in factors by their factor in the arguments, in the nested structs as
+// well, and dividing them in the reply, like
+//
+//	ScaleFields(map[string]float64{"Usage": 1e-9})
+//
+// for a server taking and returning the Usage in seconds while the client
+// has it in nanoseconds. The integers are rounded.
+func ScaleFields(factors map[string]float64) Conversion {
+	fields := &taggedFields{match: func(f reflect.StructField) bool {
+		_, has := factors[f.Name]
+		return has && isNumericKind(f.Type.Kind())
+	}}
+	scale := func(v interface{}, inverse bool) (interface{}, error) {
+		if v == nil {
+			return nil, nil
+		}
+		scaled, err := fields.rewrite(reflect.ValueOf(v), func(f reflect.StructField, v reflect.Value) (reflect.Value, error) {
+			factor := factors[f.Name]
+			if inverse {
+				factor = 1 / factor
+			}
+			return scaleNumber(v, factor), nil
+		})
+		return scaled.Interface(), err
+	}
+	return Conversion{
+		Args: func(args interface{}) (interface{}, error) {
+			return scale(args, false)
+		},
+		Reply: func(received, reply interface{}) error {
+			v := reflect.ValueOf(reply)
+			if v.Kind() != reflect.Ptr || v.IsNil() {
+				return errors.New("rpc: ScaleFields needs a non-nil pointer reply")
+			}
+			scaled, err := scale(received, true)
+			if err != nil {
+				return err
+			}
+			v.Elem().Set(reflect.ValueOf(scaled).Elem())
+			return nil
+		},
+	}
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64 && k != reflect.Uintptr
+}
+
+// scaleNumber returns a copy of the number v multiplied by factor.
+func scaleNumber(v reflect.Value, factor float64) reflect.Value {
+	c := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		c.SetFloat(v.Float() * factor)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		c.SetUint(uint64(math.Round(float64(v.Uint()) * factor)))
+	default:
+		c.SetInt(int64(math.Round(float64(v.Int()) * factor)))
+	}
+	return c
+}
@@ -0,0 +1,65 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type RatingArgs struct {
+	Account string
+	Usage   time.Duration
+}
+
+type RatingReply struct {
+	Usage time.Duration
+	Cost  float64
+}
+
+// LegacyRating takes the usage in seconds and returns the cost in cents.
+type LegacyRating struct{}
+
+func (LegacyRating) Rate(ctx *context.Context, args RatingArgs, reply *RatingReply) error {
+	*reply = RatingReply{Usage: args.Usage, Cost: float64(args.Usage) * 2}
+	return nil
+}
+
+func (LegacyRating) Balance(ctx *context.Context, account string, cents *int64) error {
+	*cents = 1050
+	return nil
+}
+
+func TestConversionInterceptor(t *testing.T) {
+	server := NewServer()
+	server.Register(LegacyRating{})
+	client := newPipeClient(t, server)
+	usage := ScaleFields(map[string]float64{"Usage": 1e-9})
+	invoke := chainClientInterceptors([]ClientInterceptor{ConversionInterceptor(map[string]Conversion{
+		"LegacyRating.Rate": usage,
+		"LegacyRating.Balance": {
+			NewReply: func() interface{} { return new(int64) },
+			Reply: func(received, reply interface{}) error {
+				*reply.(*float64) = float64(*received.(*int64)) / 100
+				return nil
+			},
+		},
+	})}, client.Call)
+	ctx := context.Background()
+
+	args := &RatingArgs{Account: "1001", Usage: 90 * time.Second}
+	var reply RatingReply
+	if err := invoke(ctx, "LegacyRating.Rate", args, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Usage != 90*time.Second || reply.Cost != 180 {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+	if args.Usage != 90*time.Second {
+		t.Errorf("expected the arguments to be kept, got %+v", args)
+	}
+	var balance float64
+	if err := invoke(ctx, "LegacyRating.Balance", "1001", &balance); err != nil || balance != 10.5 {
+		t.Errorf("expected 10.5, got %v: %v", balance, err)
+	}
+}
@@ -0,0 +1,213 @@
+package birpc
+
+import (
+	"log"
+	"net"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// TenantMetadata is the key of the metadata holding the tenant of the
+// calls, see DebugFilter.
+const TenantMetadata = "tenant"
+
+// DebugFilter selects the calls the server logs verbosely, with their
+// arguments and replies passed through Redact and the time spent decoding
+// them, in the method and encoding the response, for debugging a client
+// or a tenant without raising the logging of the whole server. The empty
+// fields match all the calls.
+type DebugFilter struct {
+	ID        string        `json:"id"`                   // assigned by the server
+	Method    string        `json:"method,omitempty"`     // path.Match pattern of "Service.Method"
+	Peer      string        `json:"peer,omitempty"`       // path.Match pattern of the remote address, or of its host
+	Tenant    string        `json:"tenant,omitempty"`     // see TenantMetadata
+	RequestID string        `json:"request_id,omitempty"` // see WithRequestID
+	TTL       time.Duration `json:"ttl,omitempty"`        // removes the filter once passed, unless zero
+	Expires   time.Time     `json:"expires,omitempty"`    // set by the server from TTL
+}
+
+// match reports whether the call req served on conn matches f.
+func (f *DebugFilter) match(conn *serverConn, req *Request) bool {
+	if f.Method != "" {
+		if ok, _ := path.Match(f.Method, req.ServiceMethod); !ok {
+			return false
+		}
+	}
+	if f.Peer != "" {
+		if conn.peer == nil {
+			return false
+		}
+		addr := conn.peer.String()
+		ok, _ := path.Match(f.Peer, addr)
+		if host, _, err := net.SplitHostPort(addr); !ok && err == nil {
+			ok, _ = path.Match(f.Peer, host)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return (f.Tenant == "" || req.Metadata[TenantMetadata] == f.Tenant) &&
+		(f.RequestID == "" || req.Metadata[RequestIDMetadata] == f.RequestID)
+}
+
+// debugFilters are the DebugFilters of a server.
+type debugFilters struct {
+	active  int32 // the number of filters, checked before locking
+	mu      sync.Mutex
+	lastID  uint64
+	filters map[string]DebugFilter
+}
+
+// debugCall is the state of a call logged by a DebugFilter.
+type debugCall struct {
+	filter string
+	args   interface{}
+	handle time.Duration
+}
+
+// AddDebugFilter starts logging the calls matching f, returning the ID of
+// the filter.
+func (server *basicServer) AddDebugFilter(f DebugFilter) string {
+	d := &server.debug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastID++
+	f.ID = strconv.FormatUint(d.lastID, 10)
+	if f.Expires = (time.Time{}); f.TTL > 0 {
+		f.Expires = time.Now().Add(f.TTL)
+	}
+	if d.filters == nil {
+		d.filters = make(map[string]DebugFilter)
+	}
+	d.filters[f.ID] = f
+	atomic.StoreInt32(&d.active, int32(len(d.filters)))
+	return f.ID
+}
+
+// RemoveDebugFilter stops the filter id, reporting whether it was active.
+func (server *basicServer) RemoveDebugFilter(id string) bool {
+	d := &server.debug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.filters[id]
+	delete(d.filters, id)
+	atomic.StoreInt32(&d.active, int32(len(d.filters)))
+	return ok
+}
+
+// DebugFilters returns the active filters, by ID.
+func (server *basicServer) DebugFilters() []DebugFilter {
+	d := &server.debug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(time.Now())
+	filters := make([]DebugFilter, 0, len(d.filters))
+	for _, f := range d.filters {
+		filters = append(filters, f)
+	}
+	sort.Slice(filters, func(i, j int) bool { return idLess(filters[i].ID, filters[j].ID) })
+	return filters
+}
+
+// idLess reports whether the filter of ID a was added before the one of b.
+func idLess(a, b string) bool {
+	return len(a) < len(b) || len(a) == len(b) && a < b
+}
+
+// expire removes the filters expired at now, with d.mu held.
+func (d *debugFilters) expire(now time.Time) {
+	for id, f := range d.filters {
+		if !f.Expires.IsZero() && now.After(f.Expires) {
+			delete(d.filters, id)
+		}
+	}
+	atomic.StoreInt32(&d.active, int32(len(d.filters)))
+}
+
+// on reports whether any filter is active, without locking.
+func (d *debugFilters) on() bool {
+	return atomic.LoadInt32(&d.active) != 0
+}
+
+// match returns the ID of the oldest filter matching req on conn, empty
+// if none.
+func (d *debugFilters) match(conn *serverConn, req *Request) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire(time.Now())
+	id := ""
+	for _, f := range d.filters {
+		if f.match(conn, req) && (id == "" || idLess(f.ID, id)) {
+			id = f.ID
+		}
+	}
+	return id
+}
+
+// debugStart starts logging the call req on conn with its arguments, if
+// matched by a DebugFilter.
+func (server *basicServer) debugStart(s *Service, conn *serverConn, req *Request, argv reflect.Value) {
+	if !server.debug.on() || s.Name == "_goRPC_" {
+		return
+	}
+	if id := server.debug.match(conn, req); id != "" {
+		req.debug = &debugCall{filter: id, args: Redact(argv.Interface())}
+	}
+}
+
+// debugEnd logs the call req matched by a DebugFilter once its response
+// is written, encoding taking the given time.
+func debugEnd(codec interface{}, req *Request, reply interface{}, errmsg string, encoding time.Duration) {
+	dc := req.debug
+	peer := ""
+	if addr := remoteAddr(codec); addr != nil {
+		peer = " from " + addr.String()
+	}
+	if errmsg != "" {
+		reply = nil
+	} else {
+		reply = Redact(reply)
+	}
+	log.Printf("rpc: debug filter %s: %s seq %d%s: args %+v reply %+v error %q decode %v handle %v encode %v",
+		dc.filter, req.ServiceMethod, req.Seq, peer, dc.args, reply, errmsg, req.decoding, dc.handle, encoding)
+}
+
+// DebugService is a service managing the DebugFilters of a server. It is
+// registered on demand, preferably on an admin listener:
+//
+//	server.RegisterName("Debug", server.DebugService())
+type DebugService struct {
+	server *basicServer
+}
+
+// DebugService returns the service managing the debug filters of the
+// server.
+func (server *basicServer) DebugService() *DebugService {
+	return &DebugService{server: server}
+}
+
+// Add adds the filter, replying with its ID.
+func (s *DebugService) Add(_ *context.Context, f *DebugFilter, reply *string) error {
+	*reply = s.server.AddDebugFilter(*f)
+	return nil
+}
+
+// Remove removes the filter of the given ID, replying whether it was
+// active.
+func (s *DebugService) Remove(_ *context.Context, id string, reply *bool) error {
+	*reply = s.server.RemoveDebugFilter(id)
+	return nil
+}
+
+// List replies with the active filters.
+func (s *DebugService) List(_ *context.Context, _ string, reply *[]DebugFilter) error {
+	*reply = s.server.DebugFilters()
+	return nil
+}
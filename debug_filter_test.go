@@ -0,0 +1,100 @@
+package birpc
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// syncBuffer is a buffer written by the server goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines waits for n lines to be logged, returning them.
+func (b *syncBuffer) lines(t *testing.T, n int) []string {
+	t.Helper()
+	var s string
+	var lines []string
+	if !eventually(func() bool {
+		b.mu.Lock()
+		s = b.buf.String()
+		b.mu.Unlock()
+		lines = strings.Split(strings.TrimSpace(s), "\n")
+		return s != "" && len(lines) >= n
+	}) {
+		t.Fatalf("expected %d lines logged, got %q", n, s)
+	}
+	return lines
+}
+
+func TestDebugFilter(t *testing.T) {
+	var logged syncBuffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	server := NewServer()
+	server.Register(new(Arith))
+	server.RegisterName("Debug", server.DebugService())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	var reply Reply
+
+	var id string
+	if err := client.Call(ctx, "Debug.Add", &DebugFilter{Method: "Arith.M*"}, &id); err != nil || id != "1" {
+		t.Fatalf("unexpected ID %q: %v", id, err)
+	}
+	server.AddDebugFilter(DebugFilter{Tenant: "cgrates.org", TTL: 50 * time.Millisecond})
+	if err := client.Call(ctx, "Arith.Add", Args{7, 8}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "Arith.Mul", &Args{7, 8}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	tenant := WithMetadata(ctx, Metadata{TenantMetadata: "cgrates.org"})
+	if err := client.Call(tenant, "Arith.Div", Args{7, 0}, &reply); err == nil {
+		t.Fatal("expected the division by zero to fail")
+	}
+	lines := logged.lines(t, 2)
+	if len(lines) != 2 ||
+		!strings.Contains(lines[0], "debug filter 1: Arith.Mul seq") ||
+		!strings.Contains(lines[0], "args &{A:7 B:8} reply &{C:56} error \"\"") ||
+		!strings.Contains(lines[0], "decode ") || !strings.Contains(lines[0], "encode ") ||
+		!strings.Contains(lines[1], "debug filter 2: Arith.Div seq") ||
+		!strings.Contains(lines[1], "error \"divide by zero\"") {
+		t.Errorf("unexpected log %q", lines)
+	}
+
+	// the filters are listed until removed or expired
+	var filters []DebugFilter
+	if err := client.Call(ctx, "Debug.List", "", &filters); err != nil ||
+		len(filters) != 2 || filters[0].Method != "Arith.M*" || filters[1].Expires.IsZero() {
+		t.Errorf("unexpected filters %+v: %v", filters, err)
+	}
+	var removed bool
+	if err := client.Call(ctx, "Debug.Remove", "1", &removed); err != nil || !removed {
+		t.Errorf("expected the filter removed, got %v: %v", removed, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if filters := server.DebugFilters(); len(filters) != 0 {
+		t.Errorf("expected the filters removed, got %+v", filters)
+	}
+	if err := client.Call(tenant, "Arith.Mul", &Args{7, 8}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if lines := logged.lines(t, 2); len(lines) != 2 {
+		t.Errorf("unexpected log %q", lines)
+	}
+}
@@ -0,0 +1,112 @@
+package birpc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// MessageSeq numbers the messages of a stream, so the receiver can drop
+// the duplicates and detect the lost ones, see DedupWindow. It is meant
+// to be embedded in the arguments of the notifications and filled by a
+// Sequencer.
+type MessageSeq struct {
+	Stream string // identifies the sender, unique per receiver
+	Seq    uint64 // starts at 1 and grows by one for every message
+}
+
+// MessageSequence implements Sequenced.
+func (m MessageSeq) MessageSequence() MessageSeq { return m }
+
+// Sequenced is implemented by the arguments carrying a MessageSeq.
+type Sequenced interface {
+	MessageSequence() MessageSeq
+}
+
+// Sequencer hands out the sequence numbers of a stream. It is safe for
+// concurrent use.
+type Sequencer struct {
+	seq    uint64 // first, to be aligned for the atomic ops
+	Stream string
+}
+
+// Next returns the next sequence number of the stream.
+func (s *Sequencer) Next() MessageSeq {
+	return MessageSeq{Stream: s.Stream, Seq: atomic.AddUint64(&s.seq, 1)}
+}
+
+// GapFunc is called with the range of sequence numbers, from and to
+// included, found missing on a stream.
+type GapFunc func(stream string, from, to uint64)
+
+// DedupWindow makes the server drop the calls whose arguments implement
+// Sequenced and repeat a sequence number already seen among the last size
+// ones of their stream, answering them without calling the method. The
+// calls older than the window are dropped as well. If onGap is not nil it
+// is called when a sequence number is skipped; the calls filling the gap
+// later are still served.
+func DedupWindow(size int, onGap GapFunc) ServerOption {
+	return func(server *basicServer) {
+		server.dedup = &dedupWindow{
+			size:    uint64(size),
+			onGap:   onGap,
+			streams: make(map[string]*streamWindow),
+		}
+	}
+}
+
+type dedupWindow struct {
+	size  uint64
+	onGap GapFunc
+
+	mu      sync.Mutex
+	streams map[string]*streamWindow
+}
+
+type streamWindow struct {
+	max  uint64          // highest sequence number seen
+	seen map[uint64]bool // sequence numbers seen in (max-size, max]
+}
+
+// accept reports whether the message ms was not seen before.
+func (d *dedupWindow) accept(ms MessageSeq) bool {
+	d.mu.Lock()
+	sw, has := d.streams[ms.Stream]
+	if !has {
+		sw = &streamWindow{seen: make(map[uint64]bool)}
+		d.streams[ms.Stream] = sw
+	}
+	var gapFrom uint64
+	switch {
+	case ms.Seq > sw.max:
+		if ms.Seq > sw.max+1 {
+			gapFrom = sw.max + 1
+		}
+		for seq := range sw.seen {
+			if seq+d.size <= ms.Seq {
+				delete(sw.seen, seq)
+			}
+		}
+		sw.max = ms.Seq
+	case ms.Seq+d.size <= sw.max || sw.seen[ms.Seq]:
+		d.mu.Unlock()
+		debugf("rpc: dropped duplicate message %d of stream %s\n", ms.Seq, ms.Stream)
+		return false
+	}
+	sw.seen[ms.Seq] = true
+	d.mu.Unlock()
+	if gapFrom != 0 && d.onGap != nil {
+		d.onGap(ms.Stream, gapFrom, ms.Seq-1)
+	}
+	return true
+}
+
+// Notify sends a call without waiting for its completion, for the
+// notifications whose outcome does not matter to the sender. The reply of
+// the server is discarded. It only fails if the client is shut down.
+func (client *basicClient) Notify(serviceMethod string, args interface{}) error {
+	if client.isShutdown() {
+		return ErrShutdown
+	}
+	client.Go(serviceMethod, args, nil, make(chan *Call, 1))
+	return nil
+}
@@ -0,0 +1,91 @@
+package birpc
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Event struct {
+	MessageSeq
+	Name string
+}
+
+type Events struct {
+	mu     sync.Mutex
+	names  []string
+	served chan struct{}
+}
+
+func (e *Events) Publish(ctx *context.Context, ev *Event) error {
+	e.mu.Lock()
+	e.names = append(e.names, ev.Name)
+	e.mu.Unlock()
+	e.served <- struct{}{}
+	return nil
+}
+
+func TestDedupWindow(t *testing.T) {
+	type gap struct {
+		stream   string
+		from, to uint64
+	}
+	var gaps []gap
+	server := NewServer(DedupWindow(4, func(stream string, from, to uint64) {
+		gaps = append(gaps, gap{stream, from, to})
+	}))
+	events := &Events{served: make(chan struct{}, 10)}
+	server.Register(events, NoReplyMethods())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	send := func(stream string, seq uint64, name string) {
+		ev := &Event{MessageSeq: MessageSeq{Stream: stream, Seq: seq}, Name: name}
+		if err := client.Call(ctx, "Events.Publish", ev, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seqr := &Sequencer{Stream: "a"}
+	for _, name := range []string{"a1", "a2"} {
+		if err := client.Call(ctx, "Events.Publish", &Event{MessageSeq: seqr.Next(), Name: name}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("a", 2, "a2 again")
+	send("b", 1, "b1")
+	send("a", 5, "a5")
+	send("a", 3, "a3 late")
+	send("a", 3, "a3 again")
+	send("a", 9, "a9")
+	send("a", 5, "a5 too old")
+	send("a", 8, "a8 late")
+
+	exp := []string{"a1", "a2", "b1", "a5", "a3 late", "a9", "a8 late"}
+	if !reflect.DeepEqual(events.names, exp) {
+		t.Errorf("expected %v, got %v", exp, events.names)
+	}
+	if expGaps := []gap{{"a", 3, 4}, {"a", 6, 8}}; !reflect.DeepEqual(gaps, expGaps) {
+		t.Errorf("expected gaps %v, got %v", expGaps, gaps)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	server := NewServer()
+	events := &Events{served: make(chan struct{}, 1)}
+	server.Register(events, NoReplyMethods())
+	client := newPipeClient(t, server)
+
+	if err := client.Notify("Events.Publish", &Event{Name: "n1"}); err != nil {
+		t.Fatal(err)
+	}
+	<-events.served
+	if len(events.names) != 1 || events.names[0] != "n1" {
+		t.Errorf("unexpected events %v", events.names)
+	}
+	client.Close()
+	if err := client.Notify("Events.Publish", &Event{Name: "n2"}); err != ErrShutdown {
+		t.Errorf("expected %v, got %v", ErrShutdown, err)
+	}
+}
@@ -0,0 +1,299 @@
+package birpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrDeltaBase is returned by CallInfo.DeltaData for the patches against
+// a payload the connection does not hold, the clients sending the whole
+// payload instead, see CallDelta.
+var ErrDeltaBase = errors.New("rpc: delta base not found")
+
+var errDeltaPatch = errors.New("rpc: invalid delta patch")
+
+// Delta carries a payload sent repeatedly under the same key, like an
+// encoded rating profile, as a patch against the previous one once the
+// server acknowledged it. See CallDelta and DeltaData.
+type Delta struct {
+	Key  string // identifies the successive payloads
+	Base string // hash of the payload patched, empty if Data is the payload
+	Hash string // hash of the payload, see BlobHash
+	Data []byte
+}
+
+// DeltaEncoding makes the server keep up to maxBytes of payloads for each
+// connection, letting the clients send the next ones as patches, see
+// CallDelta. The payloads of the keys least recently used are dropped
+// first.
+func DeltaEncoding(maxBytes int) ServerOption {
+	return func(server *basicServer) {
+		server.deltaSize = maxBytes
+	}
+}
+
+// deltaBase is a payload a patch may apply to.
+type deltaBase struct {
+	hash string
+	data []byte
+}
+
+// deltaKey holds the last payloads of a key, the latest first. The
+// previous one is kept for the clients which did not see the reply of the
+// latest call.
+type deltaKey struct {
+	bases [2]deltaBase
+	used  uint64
+}
+
+// deltaStore holds the payloads kept for a connection.
+type deltaStore struct {
+	mu   sync.Mutex
+	keys map[string]*deltaKey
+	size int
+	uses uint64
+}
+
+// base returns the payload of key of the given hash.
+func (s *deltaStore) base(key, hash string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, has := s.keys[key]; has {
+		for _, b := range k.bases {
+			if b.data != nil && b.hash == hash {
+				return b.data, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// put keeps data as the latest payload of key, dropping the payloads of
+// the keys least recently used beyond max bytes.
+func (s *deltaStore) put(key, hash string, data []byte, max int) {
+	if len(data) > max {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]*deltaKey)
+	}
+	k, has := s.keys[key]
+	if !has {
+		k = new(deltaKey)
+		s.keys[key] = k
+	}
+	if k.bases[0].hash == hash {
+		return
+	}
+	s.size += len(data) - len(k.bases[1].data)
+	k.bases[1], k.bases[0] = k.bases[0], deltaBase{hash: hash, data: data}
+	s.uses++
+	k.used = s.uses
+	for s.size > max {
+		// drop the oldest payload of the key least recently used
+		var lru string
+		for name, k := range s.keys {
+			if lru == "" || k.used < s.keys[lru].used {
+				lru = name
+			}
+		}
+		k := s.keys[lru]
+		if k.bases[1].data != nil {
+			s.size -= len(k.bases[1].data)
+			k.bases[1] = deltaBase{}
+			continue
+		}
+		s.size -= len(k.bases[0].data)
+		delete(s.keys, lru)
+	}
+}
+
+// DeltaData returns the payload carried by d, patching the previous one
+// of its key when needed, and keeps it for the next patches.
+func (info *CallInfo) DeltaData(d Delta) ([]byte, error) {
+	data := d.Data
+	if d.Base != "" {
+		var base []byte
+		has := false
+		if info.deltas != nil {
+			base, has = info.deltas.base(d.Key, d.Base)
+		}
+		if !has {
+			return nil, ErrDeltaBase
+		}
+		var err error
+		if data, err = applyDelta(base, d.Data); err != nil {
+			return nil, err
+		}
+	}
+	if d.Hash != "" && BlobHash(data) != d.Hash {
+		return nil, errDeltaPatch
+	}
+	if info.deltas != nil && d.Hash != "" {
+		info.deltas.put(d.Key, d.Hash, data, info.deltaSize)
+	}
+	return data, nil
+}
+
+// clientDeltas tracks the payloads acknowledged by the server for a
+// client.
+type clientDeltas struct {
+	mu         sync.Mutex
+	negotiated bool
+	supported  bool                 // the server accepts the patches
+	last       map[string]deltaBase // by key
+}
+
+// supportsDelta reports whether the server accepts the patches, asking
+// it the first time.
+func (client *basicClient) supportsDelta(ctx *context.Context) (bool, error) {
+	d := &client.deltas
+	d.mu.Lock()
+	negotiated, supported := d.negotiated, d.supported
+	d.mu.Unlock()
+	if negotiated {
+		return supported, nil
+	}
+	caps, err := client.Capabilities(ctx, CapabilityDelta)
+	if err != nil {
+		return false, err
+	}
+	supported = len(caps) != 0
+	d.mu.Lock()
+	d.negotiated, d.supported = true, supported
+	d.mu.Unlock()
+	return supported, nil
+}
+
+// CallDelta invokes the named function with the payload of key as a
+// Delta, a patch against the last payload of key acknowledged by the
+// server when the server supports it, see DeltaEncoding. The whole payload
+// is sent otherwise, and when the server lost the previous one. The
+// method finds the payload with CallInfo.DeltaData. The calls of a key are
+// expected to be made one at a time.
+func (client *basicClient) CallDelta(ctx *context.Context, serviceMethod, key string, payload []byte, reply interface{}) error {
+	supported, err := client.supportsDelta(ctx)
+	if err != nil {
+		return err
+	}
+	d := Delta{Key: key, Hash: BlobHash(payload), Data: payload}
+	if supported {
+		client.deltas.mu.Lock()
+		base, has := client.deltas.last[key]
+		client.deltas.mu.Unlock()
+		if has {
+			if patch := deltaPatch(base.data, payload); len(patch) < len(payload) {
+				d.Base, d.Data = base.hash, patch
+			}
+		}
+	}
+	err = client.Call(ctx, serviceMethod, d, reply)
+	if err != nil && d.Base != "" && err.Error() == ErrDeltaBase.Error() {
+		d.Base, d.Data = "", payload
+		err = client.Call(ctx, serviceMethod, d, reply)
+	}
+	if err == nil && supported {
+		client.deltas.mu.Lock()
+		if client.deltas.last == nil {
+			client.deltas.last = make(map[string]deltaBase)
+		}
+		client.deltas.last[key] = deltaBase{hash: d.Hash, data: append([]byte(nil), payload...)}
+		client.deltas.mu.Unlock()
+	}
+	return err
+}
+
+// deltaBlock is the size of the blocks of the payloads looked up in the
+// previous ones.
+const deltaBlock = 16
+
+// The operations of the patches.
+const (
+	deltaCopy   = 0 // offset and length copied from the base
+	deltaInsert = 1 // length followed by the bytes inserted
+)
+
+// deltaPatch returns the patch turning base into target, copying the
+// blocks of base found in target and inserting the rest.
+func deltaPatch(base, target []byte) []byte {
+	index := make(map[string]int, len(base)/deltaBlock)
+	for i := 0; i+deltaBlock <= len(base); i += deltaBlock {
+		if _, has := index[string(base[i:i+deltaBlock])]; !has {
+			index[string(base[i:i+deltaBlock])] = i
+		}
+	}
+	var patch []byte
+	lit := 0 // start of the bytes to insert
+	for i := 0; i+deltaBlock <= len(target); {
+		off, has := index[string(target[i:i+deltaBlock])]
+		if !has {
+			i++
+			continue
+		}
+		start, bstart := i, off
+		for start > lit && bstart > 0 && target[start-1] == base[bstart-1] {
+			start--
+			bstart--
+		}
+		end, bend := i+deltaBlock, off+deltaBlock
+		for end < len(target) && bend < len(base) && target[end] == base[bend] {
+			end++
+			bend++
+		}
+		patch = appendDeltaInsert(patch, target[lit:start])
+		patch = append(patch, deltaCopy)
+		patch = appendUvarint(patch, uint64(bstart))
+		patch = appendUvarint(patch, uint64(end-start))
+		i, lit = end, end
+	}
+	return appendDeltaInsert(patch, target[lit:])
+}
+
+func appendDeltaInsert(patch, data []byte) []byte {
+	if len(data) == 0 {
+		return patch
+	}
+	patch = append(patch, deltaInsert)
+	patch = appendUvarint(patch, uint64(len(data)))
+	return append(patch, data...)
+}
+
+// applyDelta returns the payload obtained by applying patch to base.
+func applyDelta(base, patch []byte) ([]byte, error) {
+	var data []byte
+	for len(patch) > 0 {
+		op := patch[0]
+		patch = patch[1:]
+		switch op {
+		case deltaCopy:
+			off, n := binary.Uvarint(patch)
+			if n <= 0 {
+				return nil, errDeltaPatch
+			}
+			size, m := binary.Uvarint(patch[n:])
+			if m <= 0 || off > uint64(len(base)) || size > uint64(len(base))-off {
+				return nil, errDeltaPatch
+			}
+			data = append(data, base[off:off+size]...)
+			patch = patch[n+m:]
+		case deltaInsert:
+			size, n := binary.Uvarint(patch)
+			if n <= 0 || size > uint64(len(patch)-n) {
+				return nil, errDeltaPatch
+			}
+			data = append(data, patch[n:n+int(size)]...)
+			patch = patch[n+int(size):]
+		default:
+			return nil, errDeltaPatch
+		}
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
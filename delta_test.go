@@ -0,0 +1,94 @@
+package birpc
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestDeltaPatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := make([]byte, 4096)
+	rnd.Read(base)
+	target := append([]byte(nil), base[:1000]...)
+	target = append(target, "inserted"...)
+	target = append(target, base[1000:2000]...)
+	target = append(target, base[2100:]...) // deleted 100 bytes
+	target[3000] ^= 0xff
+
+	patch := deltaPatch(base, target)
+	if len(patch) > 64 {
+		t.Errorf("expected a short patch, got %d bytes", len(patch))
+	}
+	if rcv, err := applyDelta(base, patch); err != nil || !bytes.Equal(rcv, target) {
+		t.Errorf("the patch does not rebuild the target: %v", err)
+	}
+	if rcv, err := applyDelta(nil, deltaPatch(nil, target)); err != nil || !bytes.Equal(rcv, target) {
+		t.Errorf("the patch does not rebuild the target from nothing: %v", err)
+	}
+	if _, err := applyDelta(base[:10], patch); err != errDeltaPatch {
+		t.Errorf("expected %v, got %v", errDeltaPatch, err)
+	}
+}
+
+type ProfileReply struct {
+	Size int // of the payload
+	Sent int // bytes of the Delta
+}
+
+type RatingProfiles struct{}
+
+func (RatingProfiles) Set(ctx *context.Context, d Delta, reply *ProfileReply, info *CallInfo) error {
+	data, err := info.DeltaData(d)
+	reply.Size, reply.Sent = len(data), len(d.Data)
+	return err
+}
+
+func TestCallDelta(t *testing.T) {
+	server := NewServer(DeltaEncoding(10000))
+	server.Register(RatingProfiles{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	if caps, err := client.Capabilities(ctx); err != nil || !reflect.DeepEqual(caps, []string{CapabilityDelta}) {
+		t.Errorf("expected the delta capability, got %v: %v", caps, err)
+	}
+	profile := bytes.Repeat([]byte("rating profile with many rates;"), 100)
+	var reply ProfileReply
+	if err := client.CallDelta(ctx, "RatingProfiles.Set", "RP1", profile, &reply); err != nil || reply.Sent != len(profile) {
+		t.Errorf("expected the whole profile to be sent first, got %+v: %v", reply, err)
+	}
+	profile[1500] = '!'
+	if err := client.CallDelta(ctx, "RatingProfiles.Set", "RP1", profile, &reply); err != nil ||
+		reply.Size != len(profile) || reply.Sent > 100 {
+		t.Errorf("expected a patch to be sent, got %+v: %v", reply, err)
+	}
+
+	// the payloads of RP1 are dropped to make room for RP2
+	if err := client.CallDelta(ctx, "RatingProfiles.Set", "RP2", bytes.Repeat([]byte{'x'}, 7000), &reply); err != nil {
+		t.Fatal(err)
+	}
+	profile[10] = '!'
+	if err := client.CallDelta(ctx, "RatingProfiles.Set", "RP1", profile, &reply); err != nil || reply.Sent != len(profile) {
+		t.Errorf("expected the whole profile to be sent again, got %+v: %v", reply, err)
+	}
+}
+
+func TestCallDeltaFallback(t *testing.T) {
+	server := NewServer() // no DeltaEncoding
+	server.Register(RatingProfiles{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	profile := bytes.Repeat([]byte("rating profile with many rates;"), 100)
+	for i := 0; i < 2; i++ {
+		var reply ProfileReply
+		if err := client.CallDelta(ctx, "RatingProfiles.Set", "RP1", profile, &reply); err != nil ||
+			reply.Size != len(profile) || reply.Sent != len(profile) {
+			t.Errorf("expected the whole profile to be sent, got %+v: %v", reply, err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package birpc
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Diagnostics is a snapshot of the state of a server, for debugging the
+// stalls in production.
+type Diagnostics struct {
+	Time        time.Time         `json:"time"`
+	Inflight    int64             `json:"inflight"` // calls admitted and not done yet
+	Cost        int64             `json:"cost"`     // total cost of the Inflight calls
+	Handlers    int               `json:"handlers"` // goroutines running the calls, counted with MaxHandlers
+	Connections []ConnDiagnostics `json:"connections"`
+	WorkerPool  *WorkerPoolStats  `json:"worker_pool,omitempty"`
+}
+
+// ConnDiagnostics describes a connection served by the server.
+type ConnDiagnostics struct {
+	Conn    string        `json:"conn,omitempty"` // see ConnID
+	Peer    string        `json:"peer,omitempty"`
+	Pending []PendingCall `json:"pending"` // oldest first
+}
+
+// PendingCall is a call being served.
+type PendingCall struct {
+	Seq           uint64        `json:"seq"`
+	ServiceMethod string        `json:"service_method"`
+	RequestID     string        `json:"request_id,omitempty"` // see WithRequestID
+	Age           time.Duration `json:"age"`
+}
+
+// Diagnostics returns a snapshot of the connections of the server with
+// their pending calls, and of its worker pool.
+func (server *basicServer) Diagnostics() Diagnostics {
+	now := time.Now()
+	d := Diagnostics{
+		Time:        now,
+		Inflight:    atomic.LoadInt64(&server.inflight),
+		Cost:        atomic.LoadInt64(&server.cost),
+		Handlers:    server.handlers.running(),
+		Connections: []ConnDiagnostics{},
+	}
+	server.connSet.Range(func(key, _ interface{}) bool {
+		conn := key.(*serverConn)
+		cd := ConnDiagnostics{
+			Conn:    conn.connID().String(),
+			Pending: []PendingCall{},
+		}
+		if conn.peer != nil {
+			cd.Peer = conn.peer.String()
+		}
+		for _, call := range conn.pending.Calls() {
+			cd.Pending = append(cd.Pending, PendingCall{
+				Seq:           call.Seq,
+				ServiceMethod: call.ServiceMethod,
+				RequestID:     call.RequestID,
+				Age:           now.Sub(call.Started),
+			})
+		}
+		sort.Slice(cd.Pending, func(i, j int) bool { return cd.Pending[i].Age > cd.Pending[j].Age })
+		d.Connections = append(d.Connections, cd)
+		return true
+	})
+	sort.Slice(d.Connections, func(i, j int) bool { return d.Connections[i].Peer < d.Connections[j].Peer })
+	if server.pool != nil {
+		stats := server.WorkerPoolStats()
+		d.WorkerPool = &stats
+	}
+	return d
+}
+
+// DumpDiagnostics writes the Diagnostics of the server to w, JSON encoded.
+func (server *basicServer) DumpDiagnostics(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(server.Diagnostics())
+}
+
+// DiagnosticsOnSignal makes the server dump its Diagnostics when the
+// process receives one of sigs, syscall.SIGHUP if none, until Shutdown.
+// The dump is written to the file at path, replaced each time, or to the
+// standard logger if path is empty.
+func DiagnosticsOnSignal(path string, sigs ...os.Signal) ServerOption {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	return func(server *basicServer) {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sigs...)
+		go server.dumpOnSignal(ch, path)
+	}
+}
+
+// dumpOnSignal dumps the Diagnostics to path on the signals received on
+// ch, until Shutdown.
+func (server *basicServer) dumpOnSignal(ch chan os.Signal, path string) {
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ch:
+			if err := server.dumpDiagnostics(path); err != nil {
+				log.Println("rpc: dumping diagnostics:", err)
+			}
+		case <-server.stopped:
+			return
+		}
+	}
+}
+
+func (server *basicServer) dumpDiagnostics(path string) error {
+	if path == "" {
+		b, err := json.Marshal(server.Diagnostics())
+		if err != nil {
+			return err
+		}
+		log.Printf("rpc: diagnostics: %s", b)
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = server.DumpDiagnostics(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// trackConn lists conn in the Diagnostics, and retires it as configured,
+// see Shutdown and MaxConnectionAge, until the returned function is called.
+func (server *basicServer) trackConn(conn *serverConn) func() {
+	server.connSet.Store(conn, struct{}{})
+	stopRetire := server.retireConn(conn)
+	return func() {
+		stopRetire()
+		server.connSet.Delete(conn)
+	}
+}
+
+// DiagnosticsService is a service publishing the Diagnostics of a server.
+// It is registered on demand, preferably on an admin listener:
+//
+//	server.RegisterName("Diagnostics", server.DiagnosticsService())
+type DiagnosticsService struct {
+	server *basicServer
+}
+
+// DiagnosticsService returns the service publishing the diagnostics of
+// the server.
+func (server *basicServer) DiagnosticsService() *DiagnosticsService {
+	return &DiagnosticsService{server: server}
+}
+
+// Snapshot replies with the current Diagnostics of the server.
+func (s *DiagnosticsService) Snapshot(_ *context.Context, _ string, reply *Diagnostics) error {
+	*reply = s.server.Diagnostics()
+	return nil
+}
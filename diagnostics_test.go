@@ -0,0 +1,94 @@
+package birpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestDiagnostics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "diagnostics.json")
+	server := NewServer(DiagnosticsOnSignal(path, syscall.SIGHUP))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	server.RegisterName("Diagnostics", server.DiagnosticsService())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	if err := client.Hello(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	call := client.Go("Blocker.Hold", 1, nil, nil)
+	defer func() {
+		close(blocker.release)
+		<-call.Done
+	}()
+	var d Diagnostics
+	eventually(func() bool {
+		if err := client.Call(ctx, "Diagnostics.Snapshot", "", &d); err != nil {
+			t.Fatal(err)
+		}
+		return len(d.Connections) == 1 && len(d.Connections[0].Pending) == 2
+	})
+	if len(d.Connections) != 1 || d.Connections[0].Conn != client.ConnID().String() {
+		t.Fatalf("unexpected connections %+v", d.Connections)
+	}
+	// the snapshot call is pending too
+	if pending := d.Connections[0].Pending; len(pending) != 2 || pending[0].ServiceMethod != "Blocker.Hold" ||
+		pending[0].Age <= 0 || pending[1].ServiceMethod != "Diagnostics.Snapshot" {
+		t.Errorf("unexpected pending calls %+v", pending)
+	}
+	if d.Inflight != 2 || d.WorkerPool != nil {
+		t.Errorf("unexpected diagnostics %+v", d)
+	}
+
+	self, _ := os.FindProcess(os.Getpid())
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if !eventually(func() bool {
+		var b []byte
+		if b, err = os.ReadFile(path); err == nil {
+			err = json.Unmarshal(b, &d)
+		}
+		return err == nil
+	}) {
+		t.Fatalf("diagnostics not dumped: %v", err)
+	}
+	if len(d.Connections) != 1 || len(d.Connections[0].Pending) != 1 {
+		t.Errorf("unexpected dumped diagnostics %+v", d)
+	}
+}
+
+// serverGoroutines returns the number of goroutines running the method of
+// the servers with the name.
+func serverGoroutines(name string) int {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 2)
+	return strings.Count(buf.String(), "birpc.(*basicServer)."+name+"(")
+}
+
+func TestDiagnosticsOnSignalShutdown(t *testing.T) {
+	before := serverGoroutines("dumpOnSignal")
+	server := NewServer(DiagnosticsOnSignal(""))
+	if !eventually(func() bool { return serverGoroutines("dumpOnSignal") == before+1 }) {
+		t.Fatal("expected the signals to be waited for")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return serverGoroutines("dumpOnSignal") == before }) {
+		t.Fatal("expected the signals to be released on Shutdown")
+	}
+}
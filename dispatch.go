@@ -0,0 +1,68 @@
+package birpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+// errDispatchStreaming is returned by Dispatch for the methods taking an
+// Upload or replying with a Stream.
+var errDispatchStreaming = errors.New("rpc: streaming methods cannot be dispatched")
+
+// Dispatch serves a call read by a front-end of its own, such as an HTTP
+// handler or a message consumer, through the same registration, checks
+// and metrics as the calls read by the codecs. dec decodes the arguments
+// into the value given, and enc is called once with the reply or the
+// error of the call: the errors of dec as returned, the others as
+// ServerError. Dispatch returns the error of enc.
+//
+// The methods see clnt as the Client of their context, to call back the
+// caller if it can be. The streaming methods are not served.
+func (server *basicServer) Dispatch(ctx *context.Context, clnt ClientConnector, serviceMethod string, dec func(interface{}) error, enc func(interface{}, error) error) error {
+	if clnt != nil {
+		ctx = context.WithClient(ctx, clnt)
+	}
+	req := server.getRequest()
+	req.ServiceMethod = serviceMethod
+	service, mtype, err := server.getService(req)
+	if err == nil && (mtype.upload || mtype.stream) {
+		err = errDispatchStreaming
+	}
+	if err != nil {
+		server.freeRequest(req)
+		return enc(nil, ServerError(err.Error()))
+	}
+	argv, argIsValue := getArgv(mtype)
+	start := time.Now()
+	if err := dec(argv.Interface()); err != nil {
+		server.freeRequest(req)
+		return enc(nil, err)
+	}
+	server.observeDecode(service, req, start)
+	if argIsValue {
+		argv = argv.Elem()
+	}
+	dc := &dispatchCodec{enc: enc}
+	conn := newServerConn(dc, new(sync.Mutex), svc.NewPending(ctx), nil)
+	service.call(server, conn, mtype, req, argv, getReplyv(mtype))
+	return dc.err
+}
+
+// dispatchCodec hands the response of a call made by Dispatch to its enc.
+type dispatchCodec struct {
+	enc func(interface{}, error) error
+	err error
+}
+
+func (c *dispatchCodec) WriteResponse(r *Response, reply interface{}) error {
+	if r.Error != "" {
+		c.err = c.enc(nil, ServerError(r.Error))
+	} else {
+		c.err = c.enc(reply, nil)
+	}
+	return c.err
+}
@@ -0,0 +1,91 @@
+package birpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Callback struct{}
+
+// Notify calls back the client of the call.
+func (Callback) Notify(ctx *context.Context, msg string, reply *string) error {
+	if ctx.Client == nil {
+		return errors.New("no client")
+	}
+	return ctx.Client.Call(ctx, "Echo", msg, reply)
+}
+
+type echoConnector struct{}
+
+func (echoConnector) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	*reply.(*string) = serviceMethod + " " + args.(string)
+	return nil
+}
+
+func TestDispatch(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	server.Register(Callback{})
+
+	// an HTTP front-end taking the method from the path
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Dispatch(context.Background(), nil, strings.TrimPrefix(r.URL.Path, "/"),
+			func(v interface{}) error {
+				return json.NewDecoder(r.Body).Decode(v)
+			},
+			func(reply interface{}, err error) error {
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return nil
+				}
+				return json.NewEncoder(w).Encode(reply)
+			})
+	})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+		reply      string
+	}{
+		{"/Arith.Add", `{"A":7,"B":8}`, http.StatusOK, "{\"C\":15}\n"},
+		{"/Arith.Div", `{"A":7,"B":0}`, http.StatusBadRequest, "divide by zero\n"},
+		{"/Arith.Missing", `{}`, http.StatusBadRequest, "rpc: can't find method Arith.Missing\n"},
+		{"/Arith.Add", `[`, http.StatusBadRequest, "unexpected EOF\n"},
+	} {
+		resp, err := http.Post(srv.URL+tc.path, "application/json", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reply bytes.Buffer
+		_, err = reply.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != tc.status || reply.String() != tc.reply {
+			t.Errorf("%s %s: unexpected response %d %q: %v", tc.path, tc.body, resp.StatusCode, reply.String(), err)
+		}
+	}
+
+	var reply string
+	err := server.Dispatch(context.Background(), echoConnector{}, "Callback.Notify",
+		func(v interface{}) error {
+			*v.(*string) = "hello"
+			return nil
+		},
+		func(v interface{}, err error) error {
+			if err == nil {
+				reply = *v.(*string)
+			}
+			return err
+		})
+	if err != nil || reply != "Echo hello" {
+		t.Errorf("unexpected reply %q: %v", reply, err)
+	}
+}
@@ -0,0 +1,67 @@
+package birpc
+
+import (
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ClientDuplex is a full-duplex call, on which both peers send items until
+// either side closes. The method serving it takes an Upload and replies
+// with a Stream:
+//
+//	func (t *T) Session(ctx *context.Context, upload *birpc.Upload, stream *birpc.Stream) error
+//
+// Both directions share the flow control of the connection: the items
+// received must be taken with Recv for the ones sent to get through.
+type ClientDuplex struct {
+	up   *ClientUpload
+	down *ClientStream
+}
+
+// OpenDuplex calls the full-duplex method serviceMethod. The items it
+// sends are decoded into the values returned by newItem. Canceling ctx
+// cancels the call.
+//
+// The request is written right away, ahead of the calls waiting in the
+// SendQueue.
+func (client *basicClient) OpenDuplex(ctx *context.Context, serviceMethod string, newItem func() interface{}) *ClientDuplex {
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          ackReply,
+		Done:          make(chan *Call, 2), // 2 for this call and cancel
+		depth:         nextCallDepth(ctx),
+		ctx:           ctx,
+		Enqueued:      time.Now(),
+		stream:        newCallStream(newItem),
+	}
+	client.send(call)
+	return &ClientDuplex{
+		up:   &ClientUpload{client: client, call: call, ctx: ctx},
+		down: &ClientStream{client: client, call: call, ctx: ctx},
+	}
+}
+
+// Send sends the item v to the method. It fails with ErrStreamClosed once
+// the method returned or the sending side was closed.
+func (d *ClientDuplex) Send(v interface{}) error {
+	return d.up.Send(v)
+}
+
+// CloseSend ends the items sent, the method receiving io.EOF. The items
+// it sends are still received.
+func (d *ClientDuplex) CloseSend() error {
+	return d.up.end()
+}
+
+// Recv returns the next item sent by the method. Once the method returned
+// it returns io.EOF, or the error the call failed with.
+func (d *ClientDuplex) Recv() (interface{}, error) {
+	return d.down.Recv()
+}
+
+// Close abandons the call, canceling it on the server if the method is
+// still running.
+func (d *ClientDuplex) Close() {
+	d.down.Close()
+}
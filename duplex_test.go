@@ -0,0 +1,78 @@
+package birpc
+
+import (
+	"io"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type EventSession struct{}
+
+// Subscribe sends an event for each subscription received, until it is
+// told to stop.
+func (EventSession) Subscribe(ctx *context.Context, upload *Upload, stream *Stream) error {
+	for {
+		var topic string
+		if err := upload.Recv(&topic); err != nil {
+			if err == io.EOF {
+				return stream.Send("bye")
+			}
+			return err
+		}
+		if topic == "stop" {
+			return nil
+		}
+		if err := stream.Send("subscribed to " + topic); err != nil {
+			return err
+		}
+	}
+}
+
+func newString() interface{} { return new(string) }
+
+func TestDuplex(t *testing.T) {
+	server := NewServer()
+	server.Register(EventSession{})
+	bserver := NewBirpcServer()
+	bserver.Register(EventSession{})
+
+	for name, client := range map[string]interface {
+		OpenDuplex(*context.Context, string, func() interface{}) *ClientDuplex
+	}{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		session := client.OpenDuplex(context.Background(), "EventSession.Subscribe", newString)
+		for _, topic := range []string{"cdrs", "balances"} {
+			if err := session.Send(topic); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if item, err := session.Recv(); err != nil || *item.(*string) != "subscribed to "+topic {
+				t.Errorf("%s: unexpected item %v: %v", name, item, err)
+			}
+		}
+		if err := session.CloseSend(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := session.Send("late"); err != ErrStreamClosed {
+			t.Errorf("%s: expected ErrStreamClosed, got %v", name, err)
+		}
+		if item, err := session.Recv(); err != nil || *item.(*string) != "bye" {
+			t.Errorf("%s: unexpected item %v: %v", name, item, err)
+		}
+		if _, err := session.Recv(); err != io.EOF {
+			t.Errorf("%s: expected EOF, got %v", name, err)
+		}
+
+		// the server ends the session
+		session = client.OpenDuplex(context.Background(), "EventSession.Subscribe", newString)
+		session.Send("stop")
+		if _, err := session.Recv(); err != io.EOF {
+			t.Errorf("%s: expected EOF, got %v", name, err)
+		}
+		if err := session.Send("cdrs"); err != ErrStreamClosed {
+			t.Errorf("%s: expected ErrStreamClosed, got %v", name, err)
+		}
+	}
+}
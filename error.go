@@ -0,0 +1,84 @@
+package birpc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The codes of Error, numbered as the ones of gRPC.
+const (
+	CodeCanceled           = 1
+	CodeUnknown            = 2
+	CodeInvalidArgument    = 3
+	CodeDeadlineExceeded   = 4
+	CodeNotFound           = 5
+	CodeAlreadyExists      = 6
+	CodePermissionDenied   = 7
+	CodeResourceExhausted  = 8
+	CodeFailedPrecondition = 9
+	CodeAborted            = 10
+	CodeOutOfRange         = 11
+	CodeUnimplemented      = 12
+	CodeInternal           = 13
+	CodeUnavailable        = 14
+	CodeDataLoss           = 15
+	CodeUnauthenticated    = 16
+)
+
+// Error is an error with a numeric code, like CodeNotFound, and details,
+// returned by the methods for the clients to tell the errors apart without
+// matching their messages. The applications number their own codes past
+// the ones of gRPC, like from 1000. The codecs of the package and of its
+// subpackages carry them: the clients get back an *Error with the code,
+// the message and the details, decoded into their type if registered with
+// RegisterErrorDetail and a RawReply otherwise, see ErrorDetail. The
+// errors given to WithErrorCode and WithErrorDetail are returned as an
+// *Error too, wrapping them.
+type Error struct {
+	Code    int
+	Message string
+	Details interface{}
+
+	err error // wrapped, the ServerError on the clients
+}
+
+// NewError returns an *Error of code with the message formatted as by
+// fmt.Sprintf.
+func NewError(code int, format string, a ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Unwrap returns the error given to WithErrorCode or WithErrorDetail, and
+// the ServerError on the clients.
+func (e *Error) Unwrap() error { return e.err }
+
+// As sets target to the details of the type it points to, decoded by the
+// clients for the types registered with RegisterErrorDetail.
+func (e *Error) As(target interface{}) bool { return asDetail(e.Details, target) }
+
+// WithErrorCode returns err with code, keeping the details of err if it
+// is an *Error already. The clients map the codes to messages in their own
+// language with LocalizedMessage.
+func WithErrorCode(err error, code int) error {
+	e := &Error{Code: code, Message: err.Error(), err: err}
+	var inner *Error
+	if errors.As(err, &inner) {
+		e.Details = inner.Details
+	}
+	return e
+}
+
+// ErrorCode returns the code of err if it is an *Error with one,
+// CodeUnknown for the other errors and 0 for nil.
+func ErrorCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Code != 0 {
+		return e.Code
+	}
+	return CodeUnknown
+}
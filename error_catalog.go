@@ -0,0 +1,55 @@
+package birpc
+
+import (
+	"strings"
+	"sync"
+)
+
+// MessageCatalog maps the error codes to the messages of a locale.
+type MessageCatalog map[int]string
+
+// The message catalogs, by locale.
+var (
+	catalogsMu sync.RWMutex
+	catalogs   = make(map[string]MessageCatalog)
+)
+
+// RegisterMessageCatalog makes the messages of catalog available for
+// locale, like "pt" or "pt-BR", merging them into those registered
+// already.
+func RegisterMessageCatalog(locale string, catalog MessageCatalog) {
+	catalogsMu.Lock()
+	defer catalogsMu.Unlock()
+	c := catalogs[locale]
+	if c == nil {
+		c = make(MessageCatalog, len(catalog))
+		catalogs[locale] = c
+	}
+	for code, msg := range catalog {
+		c[code] = msg
+	}
+}
+
+// LocalizedMessage returns the message for the code of err in the catalog
+// of locale, falling back to the catalog of its language, "pt" for
+// "pt-BR", and then to the message of err itself.
+func LocalizedMessage(err error, locale string) string {
+	if err == nil {
+		return ""
+	}
+	if code := ErrorCode(err); code != 0 {
+		catalogsMu.RLock()
+		defer catalogsMu.RUnlock()
+		for {
+			if msg, has := catalogs[locale][code]; has {
+				return msg
+			}
+			i := strings.LastIndexAny(locale, "-_")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+	}
+	return err.Error()
+}
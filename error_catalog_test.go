@@ -0,0 +1,48 @@
+package birpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// codeInsufficientBalance is a code of the application, past the ones of
+// gRPC.
+const codeInsufficientBalance = 1000
+
+type Transfers struct{}
+
+func (Transfers) Transfer(ctx *context.Context, amount float64, reply *float64) error {
+	err := WithErrorDetail(errors.New("insufficient balance"), InsufficientBalance{Available: 10})
+	return WithErrorCode(err, codeInsufficientBalance)
+}
+
+func TestLocalizedMessage(t *testing.T) {
+	RegisterMessageCatalog("pt", MessageCatalog{codeInsufficientBalance: "saldo insuficiente"})
+	RegisterMessageCatalog("pt-BR", MessageCatalog{codeInsufficientBalance + 1: "conta desativada"})
+	server := NewServer()
+	server.Register(Transfers{})
+	client := newPipeClient(t, server)
+
+	var left float64
+	err := client.Call(context.Background(), "Transfers.Transfer", 12.5, &left)
+	if code := ErrorCode(err); code != codeInsufficientBalance {
+		t.Fatalf("expected the code, got %d: %v", code, err)
+	}
+	if detail, ok := ErrorDetail[InsufficientBalance](err); !ok || detail.Available != 10 {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+	for locale, want := range map[string]string{
+		"pt-BR": "saldo insuficiente",
+		"pt":    "saldo insuficiente",
+		"de":    "insufficient balance",
+	} {
+		if msg := LocalizedMessage(err, locale); msg != want {
+			t.Errorf("expected %q for %s, got %q", want, locale, msg)
+		}
+	}
+	if msg := LocalizedMessage(errors.New("other"), "pt"); msg != "other" {
+		t.Errorf("expected the message of the error, got %q", msg)
+	}
+}
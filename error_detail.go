@@ -0,0 +1,177 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// WithErrorDetail returns err with detail, keeping the code of err if it
+// is an *Error already, for the methods returning the errors the clients
+// act upon, like the balance available along with an insufficient balance
+// error. The detail is encoded by the codec of the connection, like the
+// replies are, and retrieved by the clients with ErrorDetail.
+func WithErrorDetail(err error, detail interface{}) error {
+	e := &Error{Message: err.Error(), Details: detail, err: err}
+	var inner *Error
+	if errors.As(err, &inner) {
+		e.Code = inner.Code
+	}
+	return e
+}
+
+// The types of the details registered, see RegisterErrorDetail.
+var (
+	errorDetailsMu   sync.RWMutex
+	errorDetailTypes = make(map[string]reflect.Type)
+	errorDetailNames = make(map[reflect.Type]string)
+)
+
+// RegisterErrorDetail registers the type of detail under name, on both
+// the servers and the clients, for the clients to decode the details of
+// that type back into it: errors.As then matches the errors of the calls
+// against it, as it does the errors returned by the methods. The errors of
+// a registered type are sent as their own details, when returned by the
+// methods as they are or wrapped, like:
+//
+//	type QuotaExceeded struct{ Limit int }
+//
+//	func (e QuotaExceeded) Error() string { return "quota exceeded" }
+//
+//	birpc.RegisterErrorDetail("QuotaExceeded", QuotaExceeded{})
+//
+//	// on the clients
+//	var quota QuotaExceeded
+//	if errors.As(err, &quota) {
+//		// quota.Limit was sent by the server
+//	}
+//
+// The details of Error are sent with the name of their type too, when
+// registered.
+func RegisterErrorDetail(name string, detail interface{}) {
+	t := reflect.TypeOf(detail)
+	errorDetailsMu.Lock()
+	errorDetailTypes[name] = t
+	errorDetailNames[t] = name
+	errorDetailsMu.Unlock()
+}
+
+// errorDetailName returns the name the type of detail is registered under,
+// empty if not registered.
+func errorDetailName(detail interface{}) string {
+	errorDetailsMu.RLock()
+	defer errorDetailsMu.RUnlock()
+	return errorDetailNames[reflect.TypeOf(detail)]
+}
+
+// decodeErrorDetail decodes raw into the type registered under name,
+// returning nil if none or if raw does not decode into it.
+func decodeErrorDetail(name string, raw RawReply) interface{} {
+	errorDetailsMu.RLock()
+	t := errorDetailTypes[name]
+	errorDetailsMu.RUnlock()
+	if t == nil || raw.Unmarshal == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if raw.Decode(v.Interface()) != nil {
+			return nil
+		}
+		return v.Interface()
+	}
+	v := reflect.New(t)
+	if raw.Decode(v.Interface()) != nil {
+		return nil
+	}
+	return v.Elem().Interface()
+}
+
+// asDetail sets target, as given to errors.As, to detail if assignable.
+func asDetail(detail, target interface{}) bool {
+	v := reflect.ValueOf(target)
+	if detail == nil || v.Kind() != reflect.Ptr || v.IsNil() {
+		return false
+	}
+	d := reflect.ValueOf(detail)
+	if !d.Type().AssignableTo(v.Elem().Type()) {
+		return false
+	}
+	v.Elem().Set(d)
+	return true
+}
+
+// errorExtras are the code and the detail of an error, sent along its
+// message: they are given as the reply of the error responses.
+type errorExtras struct {
+	code       int         // see Error
+	detail     interface{} // nil if none
+	detailType string      // see RegisterErrorDetail
+}
+
+// newErrorExtras returns the code and the detail of err, nil if err has
+// neither. The detail is encoded on its own for the codecs which need it,
+// see rawReplyEncoder, and dropped if it cannot be.
+func newErrorExtras(codec interface{}, err error) *errorExtras {
+	extras := new(errorExtras)
+	var e *Error
+	if errors.As(err, &e) {
+		extras.code, extras.detail = e.Code, e.Details
+	}
+	if extras.detail != nil {
+		extras.detailType = errorDetailName(extras.detail)
+	} else {
+		for e := err; e != nil; e = errors.Unwrap(e) {
+			if name := errorDetailName(e); name != "" {
+				extras.detail, extras.detailType = e, name
+				break
+			}
+		}
+	}
+	if enc, ok := codec.(rawReplyEncoder); ok && extras.detail != nil {
+		var encErr error
+		if extras.detail, encErr = enc.EncodeRawReply(extras.detail); encErr != nil {
+			debugln("rpc: encoding error detail:", encErr)
+			extras.detail = nil
+		}
+	}
+	if extras.code == 0 && extras.detail == nil {
+		return nil
+	}
+	return extras
+}
+
+// ErrorDetail returns the detail attached by the server to err, see Error,
+// and whether err has one decoding as a T.
+func ErrorDetail[T any](err error) (detail T, ok bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		switch d := e.Details.(type) {
+		case RawReply:
+			ok = d.Decode(&detail) == nil
+		case T:
+			detail, ok = d, true
+		}
+	}
+	return
+}
+
+// readErrorBody reads the body of the error response resp, returning the
+// error of the call: an *Error if resp has a code or a detail, a
+// ServerError otherwise.
+func readErrorBody(codec interface{ ReadResponseBody(interface{}) error }, resp *Response) (callErr, err error) {
+	if resp.Code == 0 && !resp.Detail {
+		return ServerError(resp.Error), codec.ReadResponseBody(nil)
+	}
+	var detail RawReply
+	if !resp.Detail {
+		err = codec.ReadResponseBody(nil)
+	} else if err = readResponseBody(codec, &detail); err == errNoRawReply {
+		err = nil
+	}
+	e := &Error{Code: resp.Code, Message: resp.Error, err: ServerError(resp.Error)}
+	if e.Details = decodeErrorDetail(resp.DetailType, detail); e.Details == nil && detail.Unmarshal != nil {
+		e.Details = detail
+	}
+	return e, err
+}
@@ -0,0 +1,122 @@
+package birpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type InsufficientBalance struct {
+	Account   string
+	Available float64
+}
+
+type Debits struct{}
+
+func (Debits) Debit(ctx *context.Context, amount float64, reply *float64) error {
+	if amount > 10 {
+		return WithErrorDetail(errors.New("insufficient balance"),
+			InsufficientBalance{Account: "1001", Available: 10})
+	}
+	*reply = 10 - amount
+	return nil
+}
+
+func TestErrorDetail(t *testing.T) {
+	server := NewServer()
+	server.Register(Debits{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var left float64
+	err := client.Call(ctx, "Debits.Debit", 12.5, &left)
+	if err == nil || err.Error() != "insufficient balance" {
+		t.Fatalf("expected the insufficient balance, got %v", err)
+	}
+	if detail, ok := ErrorDetail[InsufficientBalance](err); !ok || detail.Account != "1001" || detail.Available != 10 {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+	var serverErr ServerError
+	if !errors.As(err, &serverErr) || serverErr != "insufficient balance" {
+		t.Errorf("expected a ServerError, got %#v", err)
+	}
+
+	// the connection goes on after the detail
+	if err = client.Call(ctx, "Debits.Debit", 2.5, &left); err != nil || left != 7.5 {
+		t.Errorf("expected 7.5, got %v: %v", left, err)
+	}
+	if _, ok := ErrorDetail[InsufficientBalance](errors.New("other")); ok {
+		t.Error("expected no detail")
+	}
+}
+
+func TestBirpcErrorDetail(t *testing.T) {
+	server := NewBirpcServer()
+	server.Register(Transfers{})
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+
+	var left float64
+	err := client.Call(context.Background(), "Transfers.Transfer", 12.5, &left)
+	if code := ErrorCode(err); code != codeInsufficientBalance {
+		t.Errorf("expected the code, got %d: %v", code, err)
+	}
+	if detail, ok := ErrorDetail[InsufficientBalance](err); !ok || detail.Available != 10 {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+}
+
+type QuotaExceeded struct {
+	Limit int
+}
+
+func (e QuotaExceeded) Error() string { return "quota exceeded" }
+
+type Quotas struct{}
+
+func (Quotas) Use(ctx *context.Context, units int, reply *int) error {
+	switch {
+	case units > 100:
+		return &Error{Code: CodeResourceExhausted, Message: "over the limit", Details: QuotaExceeded{Limit: 100}}
+	case units > 10:
+		return fmt.Errorf("using %d units: %w", units, QuotaExceeded{Limit: 10})
+	}
+	*reply = 10 - units
+	return nil
+}
+
+func TestRegisterErrorDetail(t *testing.T) {
+	RegisterErrorDetail("QuotaExceeded", QuotaExceeded{})
+	server := NewServer()
+	server.Register(Quotas{})
+	server.Register(Debits{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var left int
+	err := client.Call(ctx, "Quotas.Use", 20, &left)
+	if err == nil || err.Error() != "using 20 units: quota exceeded" {
+		t.Fatalf("expected the quota exceeded, got %v", err)
+	}
+	var quota QuotaExceeded
+	if !errors.As(err, &quota) || quota.Limit != 10 {
+		t.Errorf("expected the error of the server, got %+v", quota)
+	}
+	err = client.Call(ctx, "Quotas.Use", 200, &left)
+	if quota = (QuotaExceeded{}); !errors.As(err, &quota) || quota.Limit != 100 ||
+		ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expected the details of the server, got %+v: %v", quota, err)
+	}
+	if detail, ok := ErrorDetail[QuotaExceeded](err); !ok || detail.Limit != 100 {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+
+	// the details of the types not registered are not matched
+	var balance float64
+	err = client.Call(ctx, "Debits.Debit", 12.5, &balance)
+	if _, ok := ErrorDetail[InsufficientBalance](err); !ok || errors.As(err, &quota) {
+		t.Errorf("unexpected match of %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package birpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Profile struct {
+	Tenant, ID string
+}
+
+type Profiles struct{}
+
+func (Profiles) Get(ctx *context.Context, id string, reply *Profile) error {
+	switch id {
+	case "":
+		return NewError(CodeInvalidArgument, "missing profile")
+	case "1001":
+		*reply = Profile{Tenant: "cgrates.org", ID: id}
+		return nil
+	}
+	return &Error{Code: CodeNotFound, Message: "profile not found", Details: Profile{Tenant: "cgrates.org", ID: id}}
+}
+
+func TestError(t *testing.T) {
+	server := NewServer()
+	server.Register(Profiles{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var profile Profile
+	err := client.Call(ctx, "Profiles.Get", "1002", &profile)
+	var e *Error
+	if !errors.As(err, &e) || e.Code != CodeNotFound || e.Message != "profile not found" {
+		t.Fatalf("expected the error not found, got %#v", err)
+	}
+	if ErrorCode(err) != CodeNotFound {
+		t.Errorf("unexpected code %d", ErrorCode(err))
+	}
+	if detail, ok := ErrorDetail[Profile](err); !ok || detail.ID != "1002" {
+		t.Errorf("unexpected details %+v", detail)
+	}
+	if err = client.Call(ctx, "Profiles.Get", "", &profile); ErrorCode(err) != CodeInvalidArgument {
+		t.Errorf("expected an invalid argument, got %v", err)
+	}
+	if _, ok := ErrorDetail[Profile](err); ok {
+		t.Error("expected no details")
+	}
+	if err = client.Call(ctx, "Profiles.Get", "1001", &profile); err != nil || profile.ID != "1001" {
+		t.Errorf("unexpected profile %+v: %v", profile, err)
+	}
+
+	// WithErrorCode and WithErrorDetail keep what the other attached
+	wrapped := fmt.Errorf("denying: %w", errors.New("not the owner"))
+	err = WithErrorDetail(WithErrorCode(wrapped, CodePermissionDenied), Profile{ID: "1001"})
+	if ErrorCode(err) != CodePermissionDenied || err.Error() != "denying: not the owner" || !errors.Is(err, wrapped) {
+		t.Errorf("unexpected error %#v", err)
+	}
+	if detail, ok := ErrorDetail[Profile](WithErrorCode(err, CodeAborted)); !ok || detail.ID != "1001" {
+		t.Errorf("unexpected details %+v", detail)
+	}
+	wrapped = fmt.Errorf("getting: %w", NewError(CodeUnavailable, "try later"))
+	if ErrorCode(wrapped) != CodeUnavailable || ErrorCode(errors.New("other")) != CodeUnknown ||
+		ErrorCode(nil) != 0 {
+		t.Error("unexpected codes")
+	}
+}
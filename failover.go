@@ -0,0 +1,161 @@
+package birpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Failover makes its calls on the first available of an ordered list of
+// endpoints, the redundant servers in order of preference. The endpoints
+// failing with a connection error are demoted behind the others for a
+// cooldown, after which they are promoted back to their place. A failed
+// call is retried on the next endpoint when it is safe: when its
+// connection could not be dialed, so that the call was not sent, or when
+// its arguments carry an idempotency key, see Idempotent.
+type Failover struct {
+	dial      func(ctx *context.Context, address string) (*Client, error)
+	endpoints []*failoverEndpoint // in the order of preference
+
+	cooldown time.Duration // see FailoverCooldown
+}
+
+type failoverEndpoint struct {
+	address string
+	mu      sync.Mutex
+	client  *Client
+	demoted time.Time // the end of the cooldown, zero if not demoted
+}
+
+// FailoverOption configures a Failover, see NewFailover.
+type FailoverOption func(*Failover)
+
+// FailoverCooldown sets how long the endpoints failing stay behind the
+// others, 30 seconds by default.
+func FailoverCooldown(d time.Duration) FailoverOption {
+	return func(f *Failover) {
+		f.cooldown = d
+	}
+}
+
+// NewFailover returns a Failover over addresses, in order of preference,
+// connecting to them with dial. The connections are dialed on their first
+// use, and again once found shut down.
+func NewFailover(addresses []string, dial func(ctx *context.Context, address string) (*Client, error), opts ...FailoverOption) *Failover {
+	f := &Failover{
+		dial:      dial,
+		endpoints: make([]*failoverEndpoint, len(addresses)),
+		cooldown:  30 * time.Second,
+	}
+	for i, address := range addresses {
+		f.endpoints[i] = &failoverEndpoint{address: address}
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// order returns the endpoints in the order they are tried: those not
+// demoted first, each group in order of preference.
+func (f *Failover) order() []*failoverEndpoint {
+	now := time.Now()
+	order := make([]*failoverEndpoint, len(f.endpoints))
+	copy(order, f.endpoints)
+	sort.SliceStable(order, func(i, j int) bool {
+		return !order[i].isDemoted(now) && order[j].isDemoted(now)
+	})
+	return order
+}
+
+func (e *failoverEndpoint) isDemoted(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return now.Before(e.demoted)
+}
+
+// demote puts e behind the others for the cooldown, closing its
+// connection.
+func (f *Failover) demote(e *failoverEndpoint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.demoted = time.Now().Add(f.cooldown)
+	if e.client != nil {
+		e.client.Close()
+		e.client = nil
+	}
+}
+
+// promote puts e back to its place after a successful call.
+func (e *failoverEndpoint) promote() {
+	e.mu.Lock()
+	e.demoted = time.Time{}
+	e.mu.Unlock()
+}
+
+// get returns the client of e, dialing it again if needed.
+func (f *Failover) get(ctx *context.Context, e *failoverEndpoint) (client *Client, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.client == nil || e.client.isShutdown() {
+		if e.client, err = f.dial(ctx, e.address); err != nil {
+			return
+		}
+	}
+	return e.client, nil
+}
+
+// Active returns the address of the endpoint the calls are made on first.
+func (f *Failover) Active() string {
+	if len(f.endpoints) == 0 {
+		return ""
+	}
+	return f.order()[0].address
+}
+
+// Call invokes the named function on the first available endpoint.
+func (f *Failover) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	err := ErrShutdown
+	idempotent := false
+	if a, ok := args.(Idempotent); ok {
+		idempotent = a.IdempotencyKey() != ""
+	}
+	for _, e := range f.order() {
+		var client *Client
+		if client, err = f.get(ctx, e); err != nil {
+			debugln("rpc: failover dial", e.address+":", err)
+			f.demote(e)
+			if ctx.Err() != nil {
+				return err
+			}
+			continue
+		}
+		if err = client.Call(ctx, serviceMethod, args, reply); err == nil {
+			e.promote()
+			return nil
+		}
+		if !IsConnectionError(err) {
+			return err
+		}
+		f.demote(e)
+		if !idempotent || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// Close closes the connections to all the endpoints.
+func (f *Failover) Close() error {
+	for _, e := range f.endpoints {
+		e.mu.Lock()
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+		e.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type FailoverArgs struct {
+	Idempotency
+	Drop string // the address of the endpoint dropping the connection
+}
+
+// FailoverEndpoint replies with its address.
+type FailoverEndpoint struct {
+	address string
+	conn    io.Closer
+}
+
+func (e *FailoverEndpoint) Address(ctx *context.Context, args FailoverArgs, reply *string) error {
+	if args.Drop == e.address {
+		e.conn.Close()
+	}
+	*reply = e.address
+	return nil
+}
+
+func TestFailover(t *testing.T) {
+	dial := func(ctx *context.Context, address string) (*Client, error) {
+		if address == "a" {
+			return nil, errors.New("connection refused")
+		}
+		c1, c2 := net.Pipe()
+		server := NewServer()
+		server.Register(&FailoverEndpoint{address: address, conn: c2})
+		go server.ServeConn(c2)
+		return NewClient(c1), nil
+	}
+	f := NewFailover([]string{"a", "b", "c"}, dial, FailoverCooldown(100*time.Millisecond))
+	defer f.Close()
+	ctx := context.Background()
+
+	var got string
+	if err := f.Call(ctx, "FailoverEndpoint.Address", FailoverArgs{}, &got); err != nil || got != "b" {
+		t.Fatalf("expected %q, got %q: %v", "b", got, err)
+	}
+	if active := f.Active(); active != "b" {
+		t.Errorf("expected b to be active, got %q", active)
+	}
+
+	// the calls without idempotency key are not retried
+	if err := f.Call(ctx, "FailoverEndpoint.Address", FailoverArgs{Drop: "b"}, &got); !IsConnectionError(err) {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+	if active := f.Active(); active != "c" {
+		t.Errorf("expected c to be active, got %q", active)
+	}
+
+	// the idempotent ones are, on the demoted endpoints as the last resort
+	args := FailoverArgs{Idempotency: Idempotency{Key: NewIdempotencyKey()}, Drop: "c"}
+	if err := f.Call(ctx, "FailoverEndpoint.Address", args, &got); err != nil || got != "b" {
+		t.Errorf("expected %q, got %q: %v", "b", got, err)
+	}
+	if active := f.Active(); active != "b" {
+		t.Errorf("expected b to be promoted, got %q", active)
+	}
+
+	// the preferred endpoint gets its place back after the cooldown
+	time.Sleep(150 * time.Millisecond)
+	if active := f.Active(); active != "a" {
+		t.Errorf("expected a to be active, got %q", active)
+	}
+}
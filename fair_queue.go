@@ -0,0 +1,90 @@
+package birpc
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// FairQueueing makes the WorkerPool take the queued calls from the
+// connections in turn, instead of in the order they were read in, so that
+// a connection flooding the server with calls delays the calls of the
+// others by at most one of its own each. The calls of a connection keep
+// their order, see EarliestDeadlineFirst. The queue size given to
+// WorkerPool is shared by all the connections.
+func FairQueueing() ServerOption {
+	return func(server *basicServer) {
+		server.fair = true
+		server.orderPool()
+	}
+}
+
+// fairQueue queues the calls of the pool by connection, popping them from
+// the connections in round-robin.
+type fairQueue struct {
+	mu    sync.Mutex
+	size  int
+	n     int // calls queued
+	seq   uint64
+	conns map[*serverConn]*fairConn
+	ring  []*fairConn // the connections with calls queued, in turn
+	next  int         // index in ring of the connection popped next
+}
+
+// fairConn holds the calls queued by a connection.
+type fairConn struct {
+	conn  *serverConn
+	calls edfCalls
+}
+
+func (q *fairQueue) push(f func(), deadline time.Time, conn *serverConn) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n >= q.size {
+		return false
+	}
+	fc := q.conns[conn]
+	if fc == nil {
+		fc = &fairConn{conn: conn}
+		q.conns[conn] = fc
+		// joins the turn as the last connection, before the next one
+		q.ring = append(q.ring, nil)
+		copy(q.ring[q.next+1:], q.ring[q.next:])
+		q.ring[q.next] = fc
+		q.next++
+		if q.next == len(q.ring) {
+			q.next = 0
+		}
+	}
+	q.seq++
+	heap.Push(&fc.calls, edfCall{f: f, deadline: deadline, seq: q.seq})
+	q.n++
+	return true
+}
+
+func (q *fairQueue) pop() func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.n == 0 {
+		return nil
+	}
+	fc := q.ring[q.next]
+	f := heap.Pop(&fc.calls).(edfCall).f
+	q.n--
+	if len(fc.calls) == 0 {
+		delete(q.conns, fc.conn)
+		q.ring = append(q.ring[:q.next], q.ring[q.next+1:]...)
+	} else {
+		q.next++
+	}
+	if q.next >= len(q.ring) {
+		q.next = 0
+	}
+	return f
+}
+
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.n
+}
@@ -0,0 +1,39 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFairQueueing(t *testing.T) {
+	server := NewServer(WorkerPool(1, 10), FairQueueing())
+	rec := &Recorder{release: make(chan struct{})}
+	server.Register(rec)
+	firehose := newPipeClient(t, server)
+	other := newPipeClient(t, server)
+	waitQueued := func(n int) {
+		t.Helper()
+		waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Busy == 1 && s.Queued == n })
+	}
+
+	done := make(chan *Call, 6)
+	firehose.Go("Recorder.Record", DeadlineArgs{N: 0}, new(int), done)
+	waitQueued(0)
+	for n := 1; n <= 3; n++ {
+		firehose.Go("Recorder.Record", DeadlineArgs{N: n}, new(int), done)
+		waitQueued(n)
+	}
+	for n := 11; n <= 12; n++ {
+		other.Go("Recorder.Record", DeadlineArgs{N: n}, new(int), done)
+		waitQueued(n - 7)
+	}
+	close(rec.release)
+	for i := 0; i < 6; i++ {
+		if call := <-done; call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	}
+	if want := []int{0, 1, 11, 2, 12, 3}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected the order %v, got %v", want, rec.order)
+	}
+}
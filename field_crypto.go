@@ -0,0 +1,189 @@
+package birpc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// encryptedPrefix starts the values of the encrypted fields, followed by
+// the key ID, a colon and the base64 encoded nonce and ciphertext.
+const encryptedPrefix = "enc:"
+
+var errEncryptedField = errors.New("rpc: invalid encrypted field")
+
+// KeyProvider supplies the AES keys, of 16, 24 or 32 bytes, of the field
+// encryption. The keys are identified in the values encrypted, so that
+// they can be rotated, the old ones still decrypting.
+type KeyProvider interface {
+	// EncryptionKey returns the key encrypting the fields, and its ID.
+	EncryptionKey() (id string, key []byte, err error)
+	// DecryptionKey returns the key of the given ID.
+	DecryptionKey(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding the keys by ID, Current being the
+// one encrypting.
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// EncryptionKey returns the key of ID Current.
+func (k StaticKeys) EncryptionKey() (string, []byte, error) {
+	key, err := k.DecryptionKey(k.Current)
+	return k.Current, key, err
+}
+
+// DecryptionKey returns the key of the given ID.
+func (k StaticKeys) DecryptionKey(id string) ([]byte, error) {
+	key, has := k.Keys[id]
+	if !has {
+		return nil, errors.New("rpc: unknown encryption key " + id)
+	}
+	return key, nil
+}
+
+// EncryptFields returns a copy of v with its string fields tagged
+// `birpc:"encrypt"` encrypted, in the nested structs as well, so that the
+// personal data, like the caller numbers, stays encrypted up to the peer
+// holding the keys, past the intermediaries terminating TLS. The empty
+// strings are left as they are. v itself is not changed.
+func EncryptFields(v interface{}, keys KeyProvider) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	enc, err := cryptFields(reflect.ValueOf(v), encryptField(keys))
+	if err != nil {
+		return nil, err
+	}
+	return enc.Interface(), nil
+}
+
+// DecryptFields decrypts in place the fields of the value ptr points to,
+// encrypted by EncryptFields. The fields which are not encrypted are left
+// as they are.
+func DecryptFields(ptr interface{}, keys KeyProvider) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("rpc: DecryptFields needs a non-nil pointer")
+	}
+	dec, err := cryptFields(v, decryptField(keys))
+	if err != nil {
+		return err
+	}
+	v.Elem().Set(dec.Elem())
+	return nil
+}
+
+// FieldEncryption makes the server decrypt the fields of the arguments
+// encrypted by the clients, see EncryptFieldsInterceptor, and encrypt the
+// ones of the replies, using keys.
+func FieldEncryption(keys KeyProvider) ServerOption {
+	return func(server *basicServer) {
+		server.fieldKeys = keys
+	}
+}
+
+// EncryptFieldsInterceptor encrypts the fields of the arguments of the
+// calls, see EncryptFields, and decrypts the ones of the replies, using
+// keys.
+func EncryptFieldsInterceptor(keys KeyProvider) ClientInterceptor {
+	return func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		args, err := EncryptFields(args, keys)
+		if err != nil {
+			return err
+		}
+		if err = invoker(ctx, serviceMethod, args, reply); err != nil || reply == nil {
+			return err
+		}
+		return DecryptFields(reply, keys)
+	}
+}
+
+// encryptField returns the function encrypting the value of a field with
+// the key of keys, authenticating the name of the field along.
+func encryptField(keys KeyProvider) func(s, field string) (string, error) {
+	return func(s, field string) (string, error) {
+		if s == "" {
+			return s, nil
+		}
+		id, key, err := keys.EncryptionKey()
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(id, ":") {
+			return "", errors.New("rpc: invalid encryption key ID " + id)
+		}
+		aead, err := newFieldAEAD(key)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(s)+aead.Overhead())
+		if _, err = rand.Read(nonce); err != nil {
+			return "", err
+		}
+		sealed := aead.Seal(nonce, nonce, []byte(s), []byte(field))
+		return encryptedPrefix + id + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+	}
+}
+
+// decryptField returns the function decrypting the values encrypted by
+// encryptField.
+func decryptField(keys KeyProvider) func(s, field string) (string, error) {
+	return func(s, field string) (string, error) {
+		if !strings.HasPrefix(s, encryptedPrefix) {
+			return s, nil
+		}
+		s = s[len(encryptedPrefix):]
+		sep := strings.IndexByte(s, ':')
+		if sep < 0 {
+			return "", errEncryptedField
+		}
+		key, err := keys.DecryptionKey(s[:sep])
+		if err != nil {
+			return "", err
+		}
+		aead, err := newFieldAEAD(key)
+		if err != nil {
+			return "", err
+		}
+		sealed, err := base64.RawURLEncoding.DecodeString(s[sep+1:])
+		if err != nil || len(sealed) < aead.NonceSize() {
+			return "", errEncryptedField
+		}
+		plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+		if err != nil {
+			return "", errEncryptedField
+		}
+		return string(plain), nil
+	}
+}
+
+func newFieldAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedFields are the string fields tagged `birpc:"encrypt"`.
+var encryptedFields = &taggedFields{match: func(f reflect.StructField) bool {
+	return f.Type.Kind() == reflect.String && hasTagOption(f, "encrypt")
+}}
+
+// cryptFields returns a copy of v with crypt applied to the encrypted
+// fields, see taggedFields.rewrite.
+func cryptFields(v reflect.Value, crypt func(s, field string) (string, error)) (reflect.Value, error) {
+	return encryptedFields.rewrite(v, func(f reflect.StructField, v reflect.Value) (reflect.Value, error) {
+		s, err := crypt(v.String(), f.Name)
+		return reflect.ValueOf(s).Convert(v.Type()), err
+	})
+}
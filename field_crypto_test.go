@@ -0,0 +1,93 @@
+package birpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type CallRecord struct {
+	Caller  string `birpc:"encrypt"`
+	Callee  string `birpc:"encrypt"`
+	Account string
+	Extra   []CallRecordExtra
+}
+
+type CallRecordExtra struct {
+	Note string `birpc:"encrypt"`
+}
+
+// CallRecords sees the fields decrypted, the interceptors of the client
+// and the options of the server doing the encryption.
+type CallRecords struct{}
+
+func (CallRecords) Mask(ctx *context.Context, cdr *CallRecord, reply *CallRecord) error {
+	*reply = *cdr
+	reply.Caller = cdr.Caller[:3] + "****"
+	return nil
+}
+
+func TestEncryptFields(t *testing.T) {
+	keys := StaticKeys{Current: "k2", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 16),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}}
+	cdr := &CallRecord{Caller: "+4912345", Account: "1001", Extra: []CallRecordExtra{{Note: "secret"}}}
+	v, err := EncryptFields(cdr, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := v.(*CallRecord)
+	if !strings.HasPrefix(enc.Caller, "enc:k2:") || enc.Callee != "" || enc.Account != "1001" ||
+		!strings.HasPrefix(enc.Extra[0].Note, "enc:k2:") {
+		t.Errorf("unexpected encryption %+v", enc)
+	}
+	if cdr.Caller != "+4912345" || cdr.Extra[0].Note != "secret" {
+		t.Errorf("expected the original to be kept, got %+v", cdr)
+	}
+
+	// the ciphertexts are bound to their fields
+	swapped := &CallRecord{Callee: enc.Caller}
+	if err = DecryptFields(swapped, keys); err != errEncryptedField {
+		t.Errorf("expected %v, got %v", errEncryptedField, err)
+	}
+
+	// the old keys still decrypt after the rotation
+	keys.Current = "k1"
+	v, _ = EncryptFields(cdr, keys)
+	keys.Current = "k2"
+	if err = DecryptFields(v, keys); err != nil || v.(*CallRecord).Extra[0].Note != "secret" {
+		t.Errorf("unexpected decryption %+v: %v", v, err)
+	}
+}
+
+func TestFieldEncryption(t *testing.T) {
+	keys := StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 16)}}
+	server := NewServer(FieldEncryption(keys))
+	server.Register(CallRecords{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var reply CallRecord
+	invoke := chainClientInterceptors([]ClientInterceptor{EncryptFieldsInterceptor(keys)}, client.Call)
+	if err := invoke(ctx, "CallRecords.Mask", &CallRecord{Caller: "+4912345", Account: "1001"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Caller != "+49****" || reply.Account != "1001" {
+		t.Errorf("unexpected reply %+v", reply)
+	}
+
+	// the peers without the keys see the ciphertexts only
+	if err := client.Call(ctx, "CallRecords.Mask", &CallRecord{Caller: "+4912345"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(reply.Caller, "enc:k1:") {
+		t.Errorf("expected the reply to be encrypted, got %+v", reply)
+	}
+	if err := client.Call(ctx, "CallRecords.Mask", &CallRecord{Caller: "enc:k1:garbage"}, &reply); err == nil ||
+		err.Error() != errEncryptedField.Error() {
+		t.Errorf("expected %v, got %v", errEncryptedField, err)
+	}
+}
@@ -0,0 +1,132 @@
+package birpc
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type fieldMaskKey struct{}
+
+// WithFields returns a copy of ctx asking the servers to send only the
+// given fields of the replies of the calls made with it, leaving the
+// others zero, which gob does not send at all. The fields are named after
+// the Go fields of the reply and the nested ones are selected with dotted
+// paths, as "Account.Balance"; for the maps with string keys the names
+// select the keys. Unknown names are ignored and the replies which are not
+// structs or maps are sent whole. The mask is kept by the contexts derived
+// from ctx, including the ones of the nested calls made with them.
+func WithFields(ctx *context.Context, fields ...string) *context.Context {
+	return context.WithValue(ctx, fieldMaskKey{}, fields)
+}
+
+// fieldMask returns the fields selected by ctx, nil for all.
+func fieldMask(ctx *context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldMaskKey{}).([]string)
+	return fields
+}
+
+// maskTree holds the selected fields by level, a nil subtree selecting
+// the whole field.
+type maskTree map[string]maskTree
+
+func newMaskTree(fields []string) maskTree {
+	tree := make(maskTree)
+	for _, f := range fields {
+		node := tree
+		parts := strings.Split(f, ".")
+		for i, p := range parts {
+			sub, has := node[p]
+			if has && sub == nil {
+				break // already selected whole
+			}
+			if i == len(parts)-1 {
+				node[p] = nil
+				break
+			}
+			if !has {
+				sub = make(maskTree)
+				node[p] = sub
+			}
+			node = sub
+		}
+	}
+	return tree
+}
+
+// maskReply returns the reply of replyv with only the fields selected.
+func maskReply(replyv reflect.Value, fields []string) interface{} {
+	return maskValue(replyv, newMaskTree(fields)).Interface()
+}
+
+func maskValue(v reflect.Value, tree maskTree) reflect.Value {
+	if tree == nil {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		masked := maskValue(v.Elem(), tree)
+		ptr := reflect.New(masked.Type())
+		ptr.Elem().Set(masked)
+		return ptr
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		masked := reflect.New(v.Type()).Elem()
+		masked.Set(maskValue(v.Elem(), tree))
+		return masked
+	case reflect.Struct:
+		masked := reflect.New(v.Type()).Elem()
+		for name, sub := range tree {
+			f, ok := v.Type().FieldByName(name)
+			if !ok || f.PkgPath != "" {
+				continue
+			}
+			maskField(masked, v, f.Index, sub)
+		}
+		return masked
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v
+		}
+		masked := reflect.MakeMap(v.Type())
+		for name, sub := range tree {
+			key := reflect.ValueOf(name).Convert(v.Type().Key())
+			if val := v.MapIndex(key); val.IsValid() {
+				masked.SetMapIndex(key, maskValue(val, sub))
+			}
+		}
+		return masked
+	}
+	return v
+}
+
+// maskField sets the field of v at index, masked by sub, in masked,
+// allocating the structs embedded by pointer on the way. The fields
+// promoted through a nil pointer of v are left zero.
+func maskField(masked, v reflect.Value, index []int, sub maskTree) {
+	field, err := v.FieldByIndexErr(index)
+	if err != nil {
+		return
+	}
+	for _, i := range index[:len(index)-1] {
+		if masked = masked.Field(i); masked.Kind() == reflect.Ptr {
+			if masked.IsNil() {
+				if !masked.CanSet() {
+					return // an unexported embedded pointer
+				}
+				masked.Set(reflect.New(masked.Type().Elem()))
+			}
+			masked = masked.Elem()
+		}
+	}
+	masked.Field(index[len(index)-1]).Set(maskValue(field, sub))
+}
@@ -0,0 +1,107 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Owner struct {
+	Name, Address string
+}
+
+type Account struct {
+	ID      string
+	Balance float64
+	History []float64
+	Owner   *Owner
+}
+
+type Accounts struct{}
+
+func (Accounts) Get(ctx *context.Context, id string, reply *Account, info *CallInfo) error {
+	if id == "masked" && len(info.Fields) == 0 {
+		return errors.New("expected fields")
+	}
+	*reply = Account{
+		ID:      id,
+		Balance: 10,
+		History: []float64{1, 2, 3},
+		Owner:   &Owner{Name: "owner", Address: "address"},
+	}
+	return nil
+}
+
+func (Accounts) Settings(ctx *context.Context, id string, reply *map[string]string) error {
+	*reply = map[string]string{"a": "1", "b": "2", "c": "3"}
+	return nil
+}
+
+func TestFieldMask(t *testing.T) {
+	server := NewServer()
+	server.Register(Accounts{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var full Account
+	if err := client.Call(ctx, "Accounts.Get", "full", &full); err != nil || len(full.History) != 3 {
+		t.Fatalf("unexpected reply %+v: %v", full, err)
+	}
+	var masked Account
+	if err := client.Call(WithFields(ctx, "Balance", "Owner.Name", "Missing"), "Accounts.Get", "masked", &masked); err != nil {
+		t.Fatal(err)
+	}
+	if exp := (Account{Balance: 10, Owner: &Owner{Name: "owner"}}); !reflect.DeepEqual(masked, exp) {
+		t.Errorf("expected %+v, got %+v", exp, masked)
+	}
+
+	var settings map[string]string
+	if err := client.Call(WithFields(ctx, "a", "c"), "Accounts.Settings", "1001", &settings); err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string]string{"a": "1", "c": "3"}; !reflect.DeepEqual(settings, exp) {
+		t.Errorf("expected %v, got %v", exp, settings)
+	}
+}
+
+func TestMaskReply(t *testing.T) {
+	acc := &Account{ID: "1", Balance: 2, History: []float64{3}, Owner: &Owner{"n", "a"}}
+	for _, tc := range []struct {
+		fields []string
+		exp    *Account
+	}{
+		{[]string{"ID"}, &Account{ID: "1"}},
+		{[]string{"Owner"}, &Account{Owner: &Owner{"n", "a"}}},
+		{[]string{"Owner", "Owner.Name"}, &Account{Owner: &Owner{"n", "a"}}},
+		{[]string{"Owner.Address", "History"}, &Account{History: []float64{3}, Owner: &Owner{Address: "a"}}},
+	} {
+		if got := maskReply(reflect.ValueOf(acc), tc.fields); !reflect.DeepEqual(got, tc.exp) {
+			t.Errorf("%v: expected %+v, got %+v", tc.fields, tc.exp, got)
+		}
+	}
+	if acc.Owner.Address != "a" {
+		t.Error("the reply was modified")
+	}
+}
+
+type Inner struct{ X, Y int }
+
+type inner struct{ W int }
+
+type Outer struct {
+	*Inner
+	*inner
+	Z int
+}
+
+func TestMaskEmbeddedPointer(t *testing.T) {
+	reply := &Outer{Inner: &Inner{1, 2}, inner: &inner{3}, Z: 4}
+	if got := maskReply(reflect.ValueOf(reply), []string{"X", "W"}); !reflect.DeepEqual(got, &Outer{Inner: &Inner{X: 1}}) {
+		t.Errorf("unexpected masked reply %+v", got)
+	}
+	if got := maskReply(reflect.ValueOf(&Outer{Z: 4}), []string{"X", "Z"}); !reflect.DeepEqual(got, &Outer{Z: 4}) {
+		t.Errorf("unexpected masked reply %+v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package birpc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// hasTagOption reports whether the birpc tag of f lists option, as in
+// `birpc:"encrypt,redact"`.
+func hasTagOption(f reflect.StructField, option string) bool {
+	for _, o := range strings.Split(f.Tag.Get("birpc"), ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// taggedFields finds the exported struct fields selected by match in the
+// values, through the pointers, interfaces, slices, arrays and maps.
+type taggedFields struct {
+	match func(reflect.StructField) bool
+	types sync.Map // reflect.Type -> bool, whether it may hold such fields
+}
+
+func (tf *taggedFields) has(t reflect.Type) bool {
+	if has, ok := tf.types.Load(t); ok {
+		return has.(bool)
+	}
+	has := tf.scan(t, make(map[reflect.Type]bool))
+	tf.types.Store(t, has)
+	return has
+}
+
+func (tf *taggedFields) scan(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return true // depends on the values
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return tf.scan(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" && (tf.match(f) || tf.scan(f.Type, seen)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rewrite returns a copy of v with the fields matched replaced by the
+// values returned by fn, v itself if it has none. The parts of v without
+// such fields are shared by the copy.
+func (tf *taggedFields) rewrite(v reflect.Value, fn func(reflect.StructField, reflect.Value) (reflect.Value, error)) (reflect.Value, error) {
+	if !v.IsValid() || !tf.has(v.Type()) {
+		return v, nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, nil
+		}
+		elem, err := tf.rewrite(v.Elem(), fn)
+		if err != nil {
+			return v, err
+		}
+		if v.Kind() == reflect.Interface {
+			c := reflect.New(v.Type()).Elem()
+			c.Set(elem)
+			return c, nil
+		}
+		c := reflect.New(elem.Type())
+		c.Elem().Set(elem)
+		return c, nil
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			var field reflect.Value
+			var err error
+			if tf.match(f) {
+				field, err = fn(f, v.Field(i))
+			} else {
+				field, err = tf.rewrite(v.Field(i), fn)
+			}
+			if err != nil {
+				return v, err
+			}
+			c.Field(i).Set(field)
+		}
+		return c, nil
+	case reflect.Slice, reflect.Array:
+		var c reflect.Value
+		if v.Kind() == reflect.Array {
+			c = reflect.New(v.Type()).Elem()
+		} else if v.IsNil() {
+			return v, nil
+		} else {
+			c = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := tf.rewrite(v.Index(i), fn)
+			if err != nil {
+				return v, err
+			}
+			c.Index(i).Set(elem)
+		}
+		return c, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return v, nil
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, err := tf.rewrite(iter.Value(), fn)
+			if err != nil {
+				return v, err
+			}
+			c.SetMapIndex(iter.Key(), elem)
+		}
+		return c, nil
+	}
+	return v, nil
+}
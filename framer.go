@@ -0,0 +1,134 @@
+package birpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrFrameTooLarge is returned by Framer.ReadFrame for the frames larger
+// than its limit.
+var ErrFrameTooLarge = errors.New("rpc: frame too large")
+
+var errShortFrame = errors.New("rpc: short frame")
+
+// Framer reads and writes frames prefixed by their length as a 32-bit
+// big-endian integer, for the protocols carrying birpc messages among
+// their own. ReadFrame and WriteFrame may be called concurrently with
+// each other, and each of them from several goroutines.
+type Framer struct {
+	rw      io.ReadWriter
+	maxSize int
+	rmu     sync.Mutex
+	wmu     sync.Mutex
+	hdr     [4]byte
+}
+
+// NewFramer returns a Framer on rw reading frames of up to maxSize bytes,
+// or of any size if maxSize is not positive.
+func NewFramer(rw io.ReadWriter, maxSize int) *Framer {
+	return &Framer{rw: rw, maxSize: maxSize}
+}
+
+// ReadFrame reads the next frame.
+func (f *Framer) ReadFrame() ([]byte, error) {
+	f.rmu.Lock()
+	defer f.rmu.Unlock()
+	if _, err := io.ReadFull(f.rw, f.hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(f.hdr[:])
+	if f.maxSize > 0 && uint64(n) > uint64(f.maxSize) {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(f.rw, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteFrame writes data as a frame.
+func (f *Framer) WriteFrame(data []byte) error {
+	if uint64(len(data)) > 1<<32-1 {
+		return ErrFrameTooLarge
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	f.wmu.Lock()
+	defer f.wmu.Unlock()
+	_, err := f.rw.Write(frame)
+	return err
+}
+
+// RawRequest is a request carried in a frame, see DispatchRaw.
+type RawRequest struct {
+	Seq           uint64
+	ServiceMethod string
+	Args          []byte // encoded arguments
+}
+
+// RawResponse is the response to a RawRequest.
+type RawResponse struct {
+	Seq   uint64
+	Error string
+	Reply []byte // encoded reply, empty with Error
+}
+
+// MarshalBinary encodes the request as the sequence number and the length
+// of the method name as uvarints, followed by the name and the arguments.
+func (r *RawRequest) MarshalBinary() ([]byte, error) {
+	return appendFrame(r.Seq, r.ServiceMethod, r.Args), nil
+}
+
+// UnmarshalBinary decodes a request encoded by MarshalBinary. Args points
+// into data.
+func (r *RawRequest) UnmarshalBinary(data []byte) (err error) {
+	r.Seq, r.ServiceMethod, r.Args, err = parseFrame(data)
+	return
+}
+
+// MarshalBinary encodes the response like RawRequest, with the error in
+// place of the method name.
+func (r *RawResponse) MarshalBinary() ([]byte, error) {
+	return appendFrame(r.Seq, r.Error, r.Reply), nil
+}
+
+// UnmarshalBinary decodes a response encoded by MarshalBinary. Reply
+// points into data.
+func (r *RawResponse) UnmarshalBinary(data []byte) (err error) {
+	r.Seq, r.Error, r.Reply, err = parseFrame(data)
+	return
+}
+
+func appendFrame(seq uint64, s string, body []byte) []byte {
+	data := make([]byte, 0, 2*binary.MaxVarintLen64+len(s)+len(body))
+	data = appendUvarint(data, seq)
+	data = appendUvarint(data, uint64(len(s)))
+	data = append(data, s...)
+	return append(data, body...)
+}
+
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func parseFrame(data []byte) (seq uint64, s string, body []byte, err error) {
+	seq, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, "", nil, errShortFrame
+	}
+	data = data[n:]
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return 0, "", nil, errShortFrame
+	}
+	data = data[n:]
+	return seq, string(data[:size]), data[size:], nil
+}
@@ -0,0 +1,90 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// NewFuncService creates a service out of a struct of handler funcs
+// instead of the methods of a receiver. Every exported field of func type
+// is a method of the service, named after the field or after its birpc
+// tag, and needs the signature of an Rpc method without the receiver:
+//
+//	type ArithFuncs struct {
+//		Add func(ctx *context.Context, args *Args, reply *int) error `birpc:"Sum"`
+//		Div func(ctx *context.Context, args *Args, quo *Quotient) error
+//		Log func(string)                                                `birpc:"-"`
+//	}
+//
+// Fields tagged with "-" are ignored. Since no method set is involved,
+// the struct type does not need to be exported. As with NewService, the
+// handlers of unsuitable type are skipped and logged when DebugLog is set,
+// see LenientMethods and StrictMethods for the alternatives.
+func NewFuncService(name string, handlers interface{}, opts ...RegisterOption) (s *Service, err error) {
+	var o registerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if name == "" {
+		return nil, errors.New("rpc.Register: no service name for func service")
+	}
+	s = &Service{
+		Name:    name,
+		rcvr:    reflect.ValueOf(handlers),
+		typ:     reflect.TypeOf(handlers),
+		Methods: make(map[string]*MethodType),
+	}
+	v := reflect.Indirect(s.rcvr)
+	if v.Kind() != reflect.Struct {
+		return nil, errors.New("rpc.Register: func service " + name + " needs a struct of handlers, got " + s.typ.String())
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("birpc")
+		if tag == "-" || field.Type.Kind() != reflect.Func {
+			continue
+		}
+		if field.PkgPath != "" {
+			if tag != "" {
+				return nil, errors.New("rpc.Register: handler " + field.Name + " of func service " + name + " is not exported")
+			}
+			continue
+		}
+		mname := field.Name
+		if tag != "" {
+			mname = tag
+		}
+		if strings.Contains(mname, ".") {
+			return nil, errors.New("rpc.Register: invalid method name " + mname + " in func service " + name)
+		}
+		argType, replyType, withInfo, rej := suitableSignature(field.Type, 0, o.noReply)
+		if rej.Reason != "" {
+			rej.Name = mname
+			s.Rejected = append(s.Rejected, rej)
+			continue
+		}
+		fn := v.Field(i)
+		if fn.IsNil() {
+			return nil, errors.New("rpc.Register: handler " + field.Name + " of func service " + name + " is nil")
+		}
+		if _, dup := s.Methods[mname]; dup {
+			return nil, errors.New("rpc.Register: method " + mname + " defined twice in func service " + name)
+		}
+		s.Methods[mname] = &MethodType{
+			Method:    reflect.Method{Name: mname, Type: field.Type},
+			ArgType:   argType,
+			ReplyType: replyType,
+			fn:        fn,
+			withInfo:  withInfo,
+		}
+	}
+	if err = o.checkRejected(name, s.Rejected); err != nil {
+		return nil, err
+	}
+	if len(s.Methods) == 0 {
+		return nil, errors.New("rpc.Register: func service " + name + " has no handlers of suitable type")
+	}
+	o.setupMethods(handlers, s.Methods)
+	return
+}
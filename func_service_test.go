@@ -0,0 +1,85 @@
+package birpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type arithFuncs struct {
+	Add  func(ctx *context.Context, args Args, reply *Reply) error `birpc:"Sum"`
+	Mul  func(ctx *context.Context, args *Args, reply *Reply) error
+	Hook func(string) `birpc:"-"`
+}
+
+func TestRegisterFuncs(t *testing.T) {
+	funcs := &arithFuncs{
+		Add: func(ctx *context.Context, args Args, reply *Reply) error {
+			reply.C = args.A + args.B
+			return nil
+		},
+		Mul: func(ctx *context.Context, args *Args, reply *Reply) error {
+			if args.A < 0 {
+				return errors.New("negative")
+			}
+			reply.C = args.A * args.B
+			return nil
+		},
+	}
+	server := NewServer()
+	if err := server.RegisterFuncs("Arith", funcs); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	reply := new(Reply)
+	if err := client.Call(ctx, "Arith.Sum", Args{7, 8}, reply); err != nil || reply.C != 15 {
+		t.Errorf("Sum: %v %v", reply.C, err)
+	}
+	reply = new(Reply)
+	if err := client.Call(ctx, "Arith.Mul", &Args{7, 8}, reply); err != nil || reply.C != 56 {
+		t.Errorf("Mul: %v %v", reply.C, err)
+	}
+	if err := client.Call(ctx, "Arith.Mul", &Args{-1, 8}, reply); err == nil || err.Error() != "negative" {
+		t.Errorf("expected error negative, got %v", err)
+	}
+	for _, method := range []string{"Arith.Add", "Arith.Hook"} {
+		if err := client.Call(ctx, method, &Args{7, 8}, reply); err == nil {
+			t.Errorf("%s: expected error", method)
+		}
+	}
+
+	srv, err := NewFuncService("Arith", funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply = new(Reply)
+	if err = srv.Call(ctx, "Arith.Sum", Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("direct Sum: %v %v", reply.C, err)
+	}
+}
+
+func TestFuncServiceErrors(t *testing.T) {
+	valid := func(ctx *context.Context, args *Args, reply *Reply) error { return nil }
+	for name, handlers := range map[string]interface{}{
+		"not a struct": valid,
+		"nil handler":  &arithFuncs{Add: func(*context.Context, Args, *Reply) error { return nil }},
+		"no handlers":  struct{ F func() }{func() {}},
+		"bad signature": struct {
+			F func(*context.Context, *Args, Reply) error
+		}{func(*context.Context, *Args, Reply) error { return nil }},
+		"unexported": struct {
+			f func(*context.Context, *Args, *Reply) error `birpc:"F"`
+		}{valid},
+		"duplicate": struct {
+			F func(*context.Context, *Args, *Reply) error
+			G func(*context.Context, *Args, *Reply) error `birpc:"F"`
+		}{valid, valid},
+	} {
+		if _, err := NewFuncService("Test", handlers); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/cgrates/birpc
 
-go 1.16
+go 1.18
 
 require (
 	github.com/cenk/hub v1.0.1 // indirect
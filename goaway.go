@@ -0,0 +1,197 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrGoAway is returned by the calls made after the server asked the
+// client to stop sending new requests on the connection, see Shutdown. The
+// calls were not sent, the pools dial again.
+var ErrGoAway = errors.New("rpc: the server is going away")
+
+// ErrServerClosed is returned by Accept once the server is shut down, see
+// Shutdown.
+var ErrServerClosed = errors.New("rpc: server closed")
+
+// sendGoAway sends the GoAway of conn, once, reporting whether it was
+// sent now.
+func (server *basicServer) sendGoAway(conn *serverConn) bool {
+	if !atomic.CompareAndSwapInt32(&conn.goneAway, 0, 1) {
+		return false
+	}
+	if _, err := writeResponse(conn.sending, conn.codec, &Response{GoAway: true}, invalidRequest); err != nil {
+		debugln(logPrefix("rpc: writing the GoAway", conn.connID())+":", err)
+	}
+	return true
+}
+
+// retire sends the GoAway of conn, closing it grace later if positive and
+// still open.
+func (server *basicServer) retire(conn *serverConn, grace time.Duration) {
+	if !server.sendGoAway(conn) || grace <= 0 {
+		return
+	}
+	conn.retiring.Lock()
+	defer conn.retiring.Unlock()
+	if !conn.retired {
+		conn.grace = time.AfterFunc(grace, func() { closeConn(conn) })
+	}
+}
+
+// closeConn closes the connection of conn, ending the calls in progress.
+func closeConn(conn *serverConn) {
+	if c, ok := conn.codec.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// Shutdown retires the server gracefully: it closes the listeners it
+// accepts on, their Accept returning ErrServerClosed, and sends the
+// connections a GoAway, on which the clients stop sending new calls and
+// close the connections once the calls in progress are done. It returns
+// once they are all closed, or closes those left when ctx ends, aborting
+// their calls, and returns its error. The connections served afterwards
+// are sent the GoAway at once. The connections of a Server left idle, like
+// the ones of the clients predating the GoAway or of msgpackrpc, jsonrpc2
+// and jsonrpc.NewServerCodec which do not carry it, are closed by the
+// server; the calls the clients send meanwhile fail as on a connection
+// lost.
+func (server *basicServer) Shutdown(ctx *context.Context) error {
+	atomic.StoreInt32(&server.shuttingDown, 1)
+	server.stopOnce.Do(func() { close(server.stopped) })
+	server.listeners.Range(func(key, _ interface{}) bool {
+		key.(net.Listener).Close()
+		return true
+	})
+	server.connSet.Range(func(key, _ interface{}) bool {
+		server.sendGoAway(key.(*serverConn))
+		return true
+	})
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	wasIdle := make(map[*serverConn]bool)
+	for {
+		closed := true
+		server.connSet.Range(func(key, _ interface{}) bool {
+			closed = false
+			// closing the connections idle for a tick, their clients
+			// may not close them
+			conn := key.(*serverConn)
+			if !conn.closeIdle || atomic.LoadInt64(&conn.active) != 0 {
+				delete(wasIdle, conn)
+			} else if wasIdle[conn] {
+				closeConn(conn)
+			} else {
+				wasIdle[conn] = true
+			}
+			return true
+		})
+		if closed {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			server.connSet.Range(func(key, _ interface{}) bool {
+				closeConn(key.(*serverConn))
+				return true
+			})
+			return ctx.Err()
+		}
+	}
+}
+
+// trackListener registers lis to be closed by Shutdown, closing it at once
+// if shut down already, and returns the function forgetting it.
+func (server *basicServer) trackListener(lis net.Listener) (untrack func()) {
+	server.listeners.Store(lis, struct{}{})
+	if atomic.LoadInt32(&server.shuttingDown) != 0 {
+		lis.Close()
+	}
+	return func() { server.listeners.Delete(lis) }
+}
+
+// acceptError returns the error of Accept for the error err of its
+// listener, ErrServerClosed once shut down.
+func (server *basicServer) acceptError(err error) error {
+	if atomic.LoadInt32(&server.shuttingDown) != 0 {
+		return ErrServerClosed
+	}
+	return err
+}
+
+// MaxConnectionAge recycles the connections: they are sent a GoAway once
+// they are served for age, give or take a tenth to spread the reconnects,
+// and closed grace later if still open, unless grace is zero. The clients
+// dial again, rebalancing the load after the scaling of the servers.
+func MaxConnectionAge(age, grace time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.maxConnAge, server.connAgeGrace = age, grace
+	}
+}
+
+// MaxConnectionCalls recycles the connections like MaxConnectionAge once
+// they are sent the given number of calls, the internal ones left out.
+func MaxConnectionCalls(calls int, grace time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.maxConnCalls, server.connCallsGrace = int64(calls), grace
+	}
+}
+
+// countCall counts a call of conn, retiring it after the last one allowed
+// by MaxConnectionCalls.
+func (server *basicServer) countCall(conn *serverConn) {
+	if server.maxConnCalls > 0 && atomic.AddInt64(&conn.calls, 1) == server.maxConnCalls {
+		server.retire(conn, server.connCallsGrace)
+	}
+}
+
+// retireConn starts the GoAway of conn as configured by Shutdown and
+// MaxConnectionAge, returning the function stopping it once conn ends.
+func (server *basicServer) retireConn(conn *serverConn) (stop func()) {
+	if atomic.LoadInt32(&server.shuttingDown) != 0 {
+		server.sendGoAway(conn)
+	}
+	var age *time.Timer
+	if server.maxConnAge > 0 {
+		d := server.maxConnAge + time.Duration((rand.Float64()-0.5)*0.2*float64(server.maxConnAge))
+		age = time.AfterFunc(d, func() { server.retire(conn, server.connAgeGrace) })
+	}
+	return func() {
+		if age != nil {
+			age.Stop()
+		}
+		conn.retiring.Lock()
+		defer conn.retiring.Unlock()
+		conn.retired = true
+		if conn.grace != nil {
+			conn.grace.Stop()
+		}
+	}
+}
+
+// goAway stops the client sending new calls, closing it once the calls in
+// progress are done.
+func (client *basicClient) goAway() {
+	client.mutex.Lock()
+	client.goingAway = true
+	client.mutex.Unlock()
+	client.retireIfIdle()
+}
+
+// retireIfIdle closes the client once its calls are done after a GoAway.
+func (client *basicClient) retireIfIdle() {
+	client.mutex.Lock()
+	idle := client.goingAway && !client.closing && len(client.pending) == 0
+	client.mutex.Unlock()
+	if idle {
+		client.Close()
+	}
+}
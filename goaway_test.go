@@ -0,0 +1,211 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Settlement struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *Settlement) Settle(_ *context.Context, n int, reply *int) error {
+	s.started <- struct{}{}
+	<-s.release
+	*reply = n
+	return nil
+}
+
+func newSettlement() *Settlement {
+	return &Settlement{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+// waitGoingAway waits for client to receive the GoAway.
+func waitGoingAway(t *testing.T, client *Client) {
+	t.Helper()
+	for start := time.Now(); !client.isShutdown(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the GoAway was not received")
+		}
+	}
+}
+
+func TestGoAway(t *testing.T) {
+	server := NewServer()
+	settlement := newSettlement()
+	server.Register(settlement)
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var reply int
+	call := client.Go("Settlement.Settle", 7, &reply, nil)
+	<-settlement.started
+	shutdown := make(chan error, 1)
+	go func() {
+		sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(sctx)
+	}()
+	waitGoingAway(t, client)
+	if err := client.Call(ctx, "Settlement.Settle", 1, &reply); err != ErrGoAway {
+		t.Errorf("expected ErrGoAway, got %v", err)
+	}
+	if !IsConnectionError(ErrGoAway) {
+		t.Error("expected the GoAway to be retried on another connection")
+	}
+
+	// the calls in progress finish, then the connection closes
+	close(settlement.release)
+	if call = <-call.Done; call.Error != nil || reply != 7 {
+		t.Errorf("expected 7, got %d: %v", reply, call.Error)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected the connections to close, got %v", err)
+	}
+
+	// the connections served afterwards are sent the GoAway at once
+	waitGoingAway(t, newPipeClient(t, server))
+}
+
+func TestGoAwayShutdownTimeout(t *testing.T) {
+	server := NewServer()
+	settlement := newSettlement()
+	server.Register(settlement)
+	defer close(settlement.release)
+	client := newPipeClient(t, server)
+
+	var reply int
+	call := client.Go("Settlement.Settle", 7, &reply, nil)
+	<-settlement.started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to pass, got %v", err)
+	}
+	if call = <-call.Done; call.Error == nil {
+		t.Error("expected the call to end with the connection")
+	}
+}
+
+// noGoAwayCodec drops the GoAway, as the codecs which do not carry it.
+type noGoAwayCodec struct {
+	ServerCodec
+}
+
+func (c noGoAwayCodec) WriteResponse(resp *Response, body interface{}) error {
+	if resp.GoAway {
+		return nil
+	}
+	return c.ServerCodec.WriteResponse(resp, body)
+}
+
+func TestShutdownDrain(t *testing.T) {
+	server := NewServer()
+	settlement := newSettlement()
+	server.Register(settlement)
+	l, addr := listenTCP()
+	accepted := make(chan error, 1)
+	go func() { accepted <- server.Accept(l) }()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcpClient := NewClient(conn)
+	defer tcpClient.Close()
+	cli, srv := net.Pipe()
+	go server.ServeCodec(noGoAwayCodec{NewServerCodec(srv)})
+	client := NewClient(cli)
+	defer client.Close()
+
+	var reply int
+	call := client.Go("Settlement.Settle", 7, &reply, nil)
+	<-settlement.started
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	// the server stops accepting
+	if err := <-accepted; err != ErrServerClosed {
+		t.Errorf("expected %q, got %v", ErrServerClosed, err)
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("expected the listener to be closed")
+	}
+
+	// the call in progress finishes, then the server closes the idle
+	// connection the client keeps
+	close(settlement.release)
+	if call = <-call.Done; call.Error != nil || reply != 7 {
+		t.Errorf("expected 7, got %d: %v", reply, call.Error)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected the connections to close, got %v", err)
+	}
+	if err := client.Call(context.Background(), "Settlement.Settle", 1, &reply); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	server := NewServer(MaxConnectionAge(20*time.Millisecond, 0))
+	server.Register(Counter{})
+	client := newPipeClient(t, server)
+	waitGoingAway(t, client)
+	// the idle connections close at once
+	var count int
+	if err := client.Call(context.Background(), "Counter.Incr", 1, &count); !IsConnectionError(err) {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+
+	// the connections still open after the grace are closed
+	server = NewServer(MaxConnectionAge(10*time.Millisecond, 20*time.Millisecond))
+	settlement := newSettlement()
+	server.Register(settlement)
+	defer close(settlement.release)
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	client = NewClient(c1)
+	defer client.Close()
+	call := client.Go("Settlement.Settle", 1, &count, nil)
+	select {
+	case call = <-call.Done:
+		if call.Error == nil {
+			t.Error("expected the call to end with the connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection was not closed")
+	}
+}
+
+func TestMaxConnectionCalls(t *testing.T) {
+	server := NewServer(MaxConnectionCalls(2, 0))
+	server.Register(Counter{})
+	var dials int
+	dial := func(*context.Context) (*Client, error) {
+		dials++
+		return newPipeClient(t, server), nil
+	}
+	ctx := context.Background()
+	pool, err := DialPool(ctx, 1, dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	// the GoAway precedes the reply to the last call, so the next ones go
+	// to a new connection
+	for i := 1; i <= 5; i++ {
+		var count int
+		if err = pool.Call(ctx, "Counter.Incr", 1, &count); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if dials != 3 {
+		t.Errorf("expected 3 connections, got %d", dials)
+	}
+}
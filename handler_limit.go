@@ -0,0 +1,64 @@
+package birpc
+
+// MaxHandlers bounds the goroutines running the calls of all the
+// connections of the server to n. The calls read while n run make the
+// reading goroutine wait for one of them to end, pushing back on the
+// clients, which stop being read from, or fail with ErrServerBusy if
+// reject is true. Unlike MaxConcurrentCalls, which rejects the calls
+// already given a goroutine, the goroutines are never started.
+//
+// The nested calls (see CallDepth) are not bounded since the call they are
+// nested in may hold the last slot while waiting for them. With a
+// WorkerPool, which bounds the goroutines itself, the limit is not used.
+// On the connections of a BirpcClient or a Peer the responses are read by
+// the same goroutine as the calls, so a method waiting on a call of its
+// own peer while the others wait for its slot stalls the connection:
+// reject the calls there. MaxHandlers panics if n is not positive.
+func MaxHandlers(n int, reject bool) ServerOption {
+	if n < 1 {
+		panic("rpc: MaxHandlers needs at least one handler")
+	}
+	return func(server *basicServer) {
+		server.handlers = &handlerLimit{slots: make(chan struct{}, n), reject: reject}
+	}
+}
+
+// handlerLimit are the slots of the goroutines running the calls, see
+// MaxHandlers.
+type handlerLimit struct {
+	slots  chan struct{}
+	reject bool
+}
+
+// acquire takes a slot, waiting for one unless rejecting the calls,
+// reporting whether it was taken. It always succeeds on a nil l.
+func (l *handlerLimit) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if l.reject {
+		select {
+		case l.slots <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+	l.slots <- struct{}{}
+	return true
+}
+
+// release frees the slot taken by acquire.
+func (l *handlerLimit) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
+
+// running returns the number of slots taken.
+func (l *handlerLimit) running() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.slots)
+}
@@ -0,0 +1,62 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestMaxHandlers(t *testing.T) {
+	for _, reject := range []bool{true, false} {
+		server := NewServer(MaxHandlers(1, reject))
+		server.Register(new(Arith))
+		blocker := &Blocker{release: make(chan struct{})}
+		server.Register(blocker, NoReplyMethods())
+		client := newPipeClient(t, server)
+
+		waitHandlers := func(n int) {
+			t.Helper()
+			if !eventually(func() bool { return server.Diagnostics().Handlers == n }) {
+				t.Fatalf("expected %d handlers, got %d", n, server.Diagnostics().Handlers)
+			}
+		}
+
+		hold := client.Go("Blocker.Hold", 0, nil, nil)
+		waitHandlers(1)
+		add := client.Go("Arith.Add", &Args{7, 8}, new(Reply), nil)
+		if reject {
+			if <-add.Done; add.Error == nil || add.Error.Error() != ErrServerBusy.Error() {
+				t.Errorf("expected %q, got %v", ErrServerBusy, add.Error)
+			}
+		} else {
+			select {
+			case <-add.Done:
+				t.Error("expected the call to wait for the handler")
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		blocker.release <- struct{}{}
+		if <-hold.Done; hold.Error != nil {
+			t.Errorf("Hold: %v", hold.Error)
+		}
+		if !reject {
+			if <-add.Done; add.Error != nil || add.Reply.(*Reply).C != 15 {
+				t.Errorf("unexpected reply %+v: %v", add.Reply, add.Error)
+			}
+		}
+		waitHandlers(0)
+		if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, new(Reply)); err != nil {
+			t.Errorf("Add: %v", err)
+		}
+	}
+}
+
+func TestMaxHandlersBadLimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected MaxHandlers(0) to panic")
+		}
+	}()
+	MaxHandlers(0, false)
+}
@@ -0,0 +1,305 @@
+package birpc
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+var errHandoffToken = errors.New("rpc: invalid or expired handoff token")
+
+// Session holds the values kept with a connection by the methods served
+// on it, see CallInfo. The handoffs carry them over to the server taking
+// over the connection, see HandoffTokens.
+type Session struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// Get returns the value of key, empty if not set.
+func (s *Session) Get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+// Set sets the value of key, the empty value removing it.
+func (s *Session) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.values, key)
+		return
+	}
+	if s.values == nil {
+		s.values = make(map[string]string)
+	}
+	s.values[key] = value
+}
+
+func (s *Session) snapshot() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make(map[string]string, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return values
+}
+
+// restore adds values to the session.
+func (s *Session) restore(values map[string]string) {
+	for k, v := range values {
+		s.Set(k, v)
+	}
+}
+
+// handoffs is the state of the handoff of a server, see Handoff.
+type handoffs struct {
+	mu       sync.Mutex
+	address  string
+	started  chan struct{}        // closed by Handoff
+	waiting  int                  // connections waiting for the handoff
+	keys     KeyProvider          // nil unless HandoffTokens is used
+	ttl      time.Duration        // of the tokens
+	redeemed map[string]time.Time // the tokens resumed, until they expire
+}
+
+// handoffSession is the content of the handoff tokens.
+type handoffSession struct {
+	Values  map[string]string
+	Expires int64 // Unix nanoseconds
+}
+
+// HandoffTokens makes the server hand the connections off with a one-time
+// token carrying their Session, sealed with keys, and resume the sessions
+// of the tokens issued by the servers sharing the keys. The tokens expire
+// after ttl, a minute if not positive.
+func HandoffTokens(keys KeyProvider, ttl time.Duration) ServerOption {
+	return func(server *basicServer) {
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		server.handoff.keys, server.handoff.ttl = keys, ttl
+	}
+}
+
+// Handoff instructs the clients waiting for it, see AwaitHandoff and
+// HandoffConn, to reconnect to address, so that the server can be drained
+// before its maintenance. It returns the number of connections instructed.
+// The handoff is final: the connections waiting later are handed off at
+// once, to the address of the first Handoff. The server goes on serving
+// the calls until the clients leave.
+func (server *basicServer) Handoff(address string) int {
+	h := &server.handoff
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.started:
+	default:
+		h.address = address
+		close(h.started)
+	}
+	return h.waiting
+}
+
+// awaitHandoff waits for the handoff of conn, up to maxWait if positive,
+// and returns the address of the server taking over with the token
+// resuming the session of conn there.
+func (server *basicServer) awaitHandoff(ctx *context.Context, conn *serverConn, maxWait time.Duration) (address, token string, err error) {
+	h := &server.handoff
+	h.mu.Lock()
+	h.waiting++
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		h.waiting--
+		h.mu.Unlock()
+	}()
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-h.started:
+	case <-timeout:
+		return "", "", nil
+	case <-conn.closed:
+		return "", "", ErrShutdown
+	case <-ctx.Done():
+		return "", "", ctx.Err()
+	}
+	if h.keys != nil {
+		b, err := json.Marshal(handoffSession{
+			Values:  conn.session.snapshot(),
+			Expires: time.Now().Add(h.ttl).UnixNano(),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		if token, err = encryptField(h.keys)(string(b), "handoff"); err != nil {
+			return "", "", err
+		}
+	}
+	return h.address, token, nil
+}
+
+// resume restores on conn the session of token, which can be used only
+// once.
+func (server *basicServer) resume(conn *serverConn, token string) error {
+	h := &server.handoff
+	if h.keys == nil {
+		return errors.New("rpc: the server does not resume handoffs")
+	}
+	if !strings.HasPrefix(token, encryptedPrefix) {
+		return errHandoffToken
+	}
+	plain, err := decryptField(h.keys)(token, "handoff")
+	if err != nil {
+		return errHandoffToken
+	}
+	var session handoffSession
+	if err = json.Unmarshal([]byte(plain), &session); err != nil {
+		return errHandoffToken
+	}
+	now := time.Now()
+	expires := time.Unix(0, session.Expires)
+	if now.After(expires) {
+		return errHandoffToken
+	}
+	h.mu.Lock()
+	for t, exp := range h.redeemed {
+		if now.After(exp) {
+			delete(h.redeemed, t)
+		}
+	}
+	_, used := h.redeemed[token]
+	if !used {
+		if h.redeemed == nil {
+			h.redeemed = make(map[string]time.Time)
+		}
+		h.redeemed[token] = expires
+	}
+	h.mu.Unlock()
+	if used {
+		return errHandoffToken
+	}
+	conn.session.restore(session.Values)
+	return nil
+}
+
+// Handoff instructs a client to reconnect to another server.
+type Handoff struct {
+	Address string // of the server taking over
+	Token   string // resumes the session there, see Resume; empty without HandoffTokens
+}
+
+// AwaitHandoff waits for the server to hand the connection off, see the
+// Handoff method of Server, and returns where to reconnect. The servers
+// predating the handoffs fail it at once.
+func (client *basicClient) AwaitHandoff(ctx *context.Context) (Handoff, error) {
+	var reply svc.HandoffReply
+	err := client.Call(ctx, "_goRPC_.Handoff", &svc.HandoffArgs{}, &reply)
+	return Handoff{Address: reply.Address, Token: reply.Token}, err
+}
+
+// Resume restores on the connection the session handed off with token by
+// the previous server.
+func (client *basicClient) Resume(ctx *context.Context, token string) error {
+	return client.Call(ctx, "_goRPC_.Resume", &svc.ResumeArgs{Token: token}, new(bool))
+}
+
+// HandoffConn is a connection following the handoffs of its servers: it
+// reconnects to the address handed off to, resuming the session, and
+// sends the new calls there while the calls in progress end on the
+// previous connection.
+type HandoffConn struct {
+	dial func(ctx *context.Context, address string) (*Client, error)
+
+	mu      sync.Mutex
+	client  *Client
+	address string
+	closed  bool
+}
+
+// DialHandoff connects to address with dial, which connects to the
+// servers taken over by as well.
+func DialHandoff(ctx *context.Context, address string, dial func(ctx *context.Context, address string) (*Client, error)) (*HandoffConn, error) {
+	client, err := dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	h := &HandoffConn{dial: dial, client: client, address: address}
+	go h.follow(client)
+	return h, nil
+}
+
+// follow moves the connection to the servers the ones of client hand it
+// off to, until it closes.
+func (h *HandoffConn) follow(client *Client) {
+	ctx := context.Background()
+	for {
+		handoff, err := client.AwaitHandoff(ctx)
+		if err != nil {
+			return // the connection ended, or the server predates the handoffs
+		}
+		next, err := h.dial(ctx, handoff.Address)
+		if err != nil {
+			debugln("rpc: cannot follow the handoff to", handoff.Address+":", err)
+			return
+		}
+		if handoff.Token != "" {
+			if err = next.Resume(ctx, handoff.Token); err != nil {
+				debugln("rpc: cannot resume the session at", handoff.Address+":", err)
+			}
+		}
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			next.Close()
+			return
+		}
+		h.client, h.address = next, handoff.Address
+		h.mu.Unlock()
+		go closeIdle(client)
+		client = next
+	}
+}
+
+// closeIdle closes client once its calls are done.
+func closeIdle(client *Client) {
+	for client.pendingCalls() > 0 && !client.isShutdown() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	client.Close()
+}
+
+// Address returns the address of the current server.
+func (h *HandoffConn) Address() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.address
+}
+
+// Call calls the current server.
+func (h *HandoffConn) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	h.mu.Lock()
+	client := h.client
+	h.mu.Unlock()
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Close closes the connection to the current server.
+func (h *HandoffConn) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	return h.client.Close()
+}
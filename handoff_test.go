@@ -0,0 +1,129 @@
+package birpc
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Counter struct{}
+
+func (Counter) Incr(_ *context.Context, n int, reply *int, info *CallInfo) error {
+	count, _ := strconv.Atoi(info.Session.Get("count"))
+	*reply = count + n
+	info.Session.Set("count", strconv.Itoa(*reply))
+	return nil
+}
+
+func waitingHandoff(server *basicServer) int {
+	server.handoff.mu.Lock()
+	defer server.handoff.mu.Unlock()
+	return server.handoff.waiting
+}
+
+func TestHandoff(t *testing.T) {
+	keys := StaticKeys{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 16)}}
+	servers := map[string]*Server{
+		"a": NewServer(HandoffTokens(keys, time.Minute)),
+		"b": NewServer(HandoffTokens(keys, time.Minute)),
+	}
+	for _, server := range servers {
+		server.Register(Counter{})
+	}
+	dial := func(_ *context.Context, address string) (*Client, error) {
+		c1, c2 := net.Pipe()
+		go servers[address].ServeConn(c2)
+		return NewClient(c1), nil
+	}
+	ctx := context.Background()
+	conn, err := DialHandoff(ctx, "a", dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var count int
+	if err = conn.Call(ctx, "Counter.Incr", 2, &count); err != nil || count != 2 {
+		t.Fatalf("expected 2, got %d: %v", count, err)
+	}
+
+	for waitingHandoff(servers["a"].basicServer) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := servers["a"].Handoff("b"); n != 1 {
+		t.Errorf("expected to hand off 1 connection, got %d", n)
+	}
+	for start := time.Now(); conn.Address() != "b"; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the connection was not handed off")
+		}
+	}
+	// the session goes on on the new server
+	if err = conn.Call(ctx, "Counter.Incr", 3, &count); err != nil || count != 5 {
+		t.Fatalf("expected 5, got %d: %v", count, err)
+	}
+
+	// the connections waiting after the handoff are handed off at once,
+	// with a token resuming only once
+	client, _ := dial(ctx, "a")
+	defer client.Close()
+	handoff, err := client.AwaitHandoff(ctx)
+	if err != nil || handoff.Address != "b" || handoff.Token == "" {
+		t.Fatalf("unexpected handoff %+v: %v", handoff, err)
+	}
+	next, _ := dial(ctx, "b")
+	defer next.Close()
+	if err = next.Resume(ctx, handoff.Token); err != nil {
+		t.Fatal(err)
+	}
+	if err = next.Resume(ctx, handoff.Token); err == nil || err.Error() != errHandoffToken.Error() {
+		t.Errorf("expected the token to be used up, got %v", err)
+	}
+	if err = next.Resume(ctx, "forged"); err == nil || err.Error() != errHandoffToken.Error() {
+		t.Errorf("expected the token to be invalid, got %v", err)
+	}
+}
+
+func TestHandoffWithoutTokens(t *testing.T) {
+	server := NewServer()
+	server.Register(Counter{})
+	client := newPipeClient(t, server)
+	server.Handoff("other:2012")
+	handoff, err := client.AwaitHandoff(context.Background())
+	if err != nil || handoff != (Handoff{Address: "other:2012"}) {
+		t.Errorf("unexpected handoff %+v: %v", handoff, err)
+	}
+	if err = client.Resume(context.Background(), "token"); err == nil {
+		t.Error("expected the server not to resume the handoffs")
+	}
+
+	// the waits end with the connections
+	other := NewServer()
+	c1, c2 := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		other.ServeConn(c2)
+		close(served)
+	}()
+	waiting := NewClient(c1)
+	awaited := make(chan error, 1)
+	go func() {
+		_, err := waiting.AwaitHandoff(context.Background())
+		awaited <- err
+	}()
+	for waitingHandoff(other.basicServer) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiting.Close()
+	if err = <-awaited; err == nil {
+		t.Error("expected the wait to end with the connection")
+	}
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection is still served")
+	}
+}
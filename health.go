@@ -0,0 +1,111 @@
+package birpc
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Ready reports whether the server takes new calls: it is not once it
+// drains, see Drain and Shutdown.
+func (server *basicServer) Ready() bool {
+	return atomic.LoadInt32(&server.draining) == 0 && atomic.LoadInt32(&server.shuttingDown) == 0
+}
+
+// Live reports whether the server serves its calls: it is not while its
+// StallWatchdog, if any, detects a stall.
+func (server *basicServer) Live() bool {
+	return server.watchdog == nil || atomic.LoadInt32(&server.watchdog.stalled) == 0
+}
+
+// ReadinessHandler returns the HTTP handler of the readiness probes, as
+// of Kubernetes: it answers 200 while the server is Ready and 503 once it
+// drains, so that no new connections are sent to it.
+func (server *basicServer) ReadinessHandler() http.Handler {
+	return probeHandler(server.Ready)
+}
+
+// LivenessHandler returns the HTTP handler of the liveness probes, as of
+// Kubernetes: it answers 200 while the server is Live and 503 while it is
+// stalled, so that the process is restarted if the stall lasts.
+func (server *basicServer) LivenessHandler() http.Handler {
+	return probeHandler(server.Live)
+}
+
+func probeHandler(ok func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !ok() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// Drain retires the server as expected of the pods terminated: it stops
+// being Ready at once, goes on serving for delay while the load balancers
+// notice, then shuts down, see Shutdown, bounded by ctx. Drained is closed
+// once it returns.
+func (server *basicServer) Drain(ctx *context.Context, delay time.Duration) (err error) {
+	atomic.StoreInt32(&server.draining, 1)
+	defer server.drainOnce.Do(func() { close(server.drained) })
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	return server.Shutdown(ctx)
+}
+
+// Drained returns a channel closed once the server is drained, see Drain.
+func (server *basicServer) Drained() <-chan struct{} {
+	return server.drained
+}
+
+// DrainOnSignal makes the server Drain when the process receives one of
+// sigs, syscall.SIGTERM if none, waiting for delay then up to timeout for
+// the connections to close. The process exits once Drained:
+//
+//	server := birpc.NewServer(birpc.DrainOnSignal(5*time.Second, 20*time.Second))
+//	http.Handle("/readyz", server.ReadinessHandler())
+//	http.Handle("/livez", server.LivenessHandler())
+//	go server.Accept(l)
+//	<-server.Drained()
+//
+// The delay and the timeout fit in the terminationGracePeriodSeconds of
+// the pod. The signals are no longer waited for after Shutdown.
+func DrainOnSignal(delay, timeout time.Duration, sigs ...os.Signal) ServerOption {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGTERM}
+	}
+	return func(server *basicServer) {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, sigs...)
+		go server.drainOnSignal(ch, delay, timeout)
+	}
+}
+
+// drainOnSignal drains the server on the first signal received on ch,
+// unless Shutdown comes first.
+func (server *basicServer) drainOnSignal(ch chan os.Signal, delay, timeout time.Duration) {
+	defer signal.Stop(ch)
+	select {
+	case <-ch:
+	case <-server.stopped:
+		return
+	}
+	signal.Stop(ch) // a second signal ends the process
+	ctx, cancel := context.WithTimeout(context.Background(), delay+timeout)
+	defer cancel()
+	if err := server.Drain(ctx, delay); err != nil {
+		debugln("rpc: draining:", err)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package birpc
+
+import (
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestDrainOnSignal(t *testing.T) {
+	server := NewServer(DrainOnSignal(200*time.Millisecond, time.Second, syscall.SIGUSR1))
+	server.Register(Counter{})
+	client := newPipeClient(t, server)
+	if code := probe(server.ReadinessHandler()); code != http.StatusOK {
+		t.Fatalf("expected the server ready, got %d", code)
+	}
+
+	self, _ := os.FindProcess(os.Getpid())
+	if err := self.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); probe(server.ReadinessHandler()) != http.StatusServiceUnavailable; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the server is still ready")
+		}
+	}
+	// the calls are served during the delay
+	var count int
+	if err := client.Call(context.Background(), "Counter.Incr", 1, &count); err != nil {
+		t.Errorf("expected the call served while draining, got %v", err)
+	}
+	select {
+	case <-server.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server was not drained")
+	}
+	waitGoingAway(t, client)
+}
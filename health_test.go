@@ -0,0 +1,56 @@
+package birpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func probe(h http.Handler) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	return rec.Code
+}
+
+func TestDrainOnSignalShutdown(t *testing.T) {
+	before := serverGoroutines("drainOnSignal")
+	server := NewServer(DrainOnSignal(0, time.Second))
+	if !eventually(func() bool { return serverGoroutines("drainOnSignal") == before+1 }) {
+		t.Fatal("expected the signals to be waited for")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return serverGoroutines("drainOnSignal") == before }) {
+		t.Fatal("expected the signals to be released on Shutdown")
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	server := NewServer(StallWatchdog(20*time.Millisecond, func(StallReport) {}))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	client := newPipeClient(t, server)
+	if code := probe(server.LivenessHandler()); code != http.StatusOK {
+		t.Fatalf("expected the server live, got %d", code)
+	}
+
+	call := client.Go("Blocker.Hold", 1, nil, nil)
+	for start := time.Now(); probe(server.LivenessHandler()) != http.StatusServiceUnavailable; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the stall was not reported")
+		}
+	}
+	close(blocker.release)
+	<-call.Done
+	for start := time.Now(); probe(server.LivenessHandler()) != http.StatusOK; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the server is still stalled")
+		}
+	}
+}
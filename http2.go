@@ -0,0 +1,224 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+var errHTTP2Deadline = errors.New("rpc: deadlines are not supported on HTTP/2 streams")
+
+// AcceptHTTP2Conn answers the POST request r, of HTTP/2, with a stream of
+// its own: the body of r is read from the connection returned and its
+// writes are sent in the body of the response. Each connection is then an
+// HTTP/2 stream, which the L7 proxies forward unlike the CONNECT requests
+// of ServeHTTP. The handler must not return before the connection is
+// closed.
+//
+// Cleartext HTTP/2 (h2c) is served by wrapping the handler in the h2c
+// handler of golang.org/x/net/http2/h2c, the net/http server speaking
+// HTTP/2 only over TLS.
+func AcceptHTTP2Conn(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if r.ProtoMajor < 2 {
+		// HTTP/1 does not read the request while writing the response, the
+		// connection being closed rather than waiting for the end of r
+		w.Header().Set("Connection", "close")
+		http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+		return nil, errors.New("rpc: HTTP/2 required, got " + r.Proto)
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return nil, errors.New("rpc: POST required, got " + r.Method)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return nil, errors.New("rpc: response cannot be flushed")
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if local == nil {
+		local = http2Addr("")
+	}
+	return &http2Conn{
+		body:   r.Body,
+		w:      w,
+		flush:  flusher.Flush,
+		local:  local,
+		remote: http2Addr(r.RemoteAddr),
+	}, nil
+}
+
+// DialHTTP2Conn posts to url with client, http.DefaultClient if nil,
+// sending header along with the request, and returns the connection over
+// the bodies of the request and of the response, see AcceptHTTP2Conn.
+// The client must speak HTTP/2, like the http2.Transport of
+// golang.org/x/net with AllowHTTP for the "http" urls, or the default
+// transport for the "https" ones. ctx bounds the dialing only.
+func DialHTTP2Conn(ctx *context.Context, client *http.Client, url string, header http.Header) (net.Conn, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	// the stream outlives ctx, closed by its context instead
+	streamCtx, cancel := context.WithCancel(context.Background())
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodPost, url, pr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := client.Do(req)
+		done <- result{resp, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		cancel()
+		pw.Close()
+		return nil, ctx.Err()
+	}
+	if res.err == nil && res.resp.StatusCode != http.StatusOK {
+		res.resp.Body.Close()
+		res.err = errors.New("rpc: unexpected HTTP response: " + res.resp.Status)
+	} else if res.err == nil && res.resp.ProtoMajor < 2 {
+		res.resp.Body.Close()
+		res.err = errors.New("rpc: HTTP/2 required, got " + res.resp.Proto)
+	}
+	if res.err != nil {
+		cancel()
+		pw.Close()
+		return nil, res.err
+	}
+	return &http2Conn{
+		body:   res.resp.Body,
+		w:      pw,
+		local:  http2Addr(""),
+		remote: http2Addr(req.URL.Host),
+		cancel: func() {
+			pw.Close()
+			cancel()
+		},
+	}, nil
+}
+
+// DialHTTP2 connects to the RPC server at url over an HTTP/2 stream, see
+// DialHTTP2Conn.
+func DialHTTP2(ctx *context.Context, client *http.Client, url string) (*Client, error) {
+	conn, err := DialHTTP2Conn(ctx, client, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// DialBirpcHTTP2 is like DialHTTP2 but returns a BirpcClient.
+func DialBirpcHTTP2(ctx *context.Context, client *http.Client, url string, opts ...ServerOption) (*BirpcClient, error) {
+	conn, err := DialHTTP2Conn(ctx, client, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewBirpcClient(conn, opts...), nil
+}
+
+// HTTP2Handler returns the handler serving each of its requests as a
+// connection, see AcceptHTTP2Conn.
+func (server *Server) HTTP2Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := AcceptHTTP2Conn(w, r)
+		if err != nil {
+			debugln("rpc.HTTP2Handler:", err.Error())
+			return
+		}
+		server.ServeConn(conn)
+	})
+}
+
+// HTTP2Handler is like Server.HTTP2Handler for BirpcServer.
+func (s *BirpcServer) HTTP2Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := AcceptHTTP2Conn(w, r)
+		if err != nil {
+			debugln("rpc.HTTP2Handler:", err.Error())
+			return
+		}
+		s.ServeConn(conn)
+	})
+}
+
+// http2Conn carries a connection over the bodies of an HTTP/2 request and
+// of its response.
+type http2Conn struct {
+	body          io.ReadCloser
+	local, remote net.Addr
+	cancel        func() // ends the request of the clients
+
+	mu     sync.Mutex
+	w      io.Writer
+	flush  func() // sends the writes of the servers
+	closed bool
+}
+
+func (c *http2Conn) Read(p []byte) (int, error) {
+	return c.body.Read(p)
+}
+
+func (c *http2Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	n, err := c.w.Write(p)
+	if err == nil && c.flush != nil {
+		c.flush()
+	}
+	return n, err
+}
+
+// Close ends the stream, the response not being written once the handler
+// returned.
+func (c *http2Conn) Close() error {
+	if c.cancel != nil {
+		c.cancel() // unblocks the writes of the clients
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	return c.body.Close()
+}
+
+func (c *http2Conn) LocalAddr() net.Addr  { return c.local }
+func (c *http2Conn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *http2Conn) SetDeadline(t time.Time) error      { return errHTTP2Deadline }
+func (c *http2Conn) SetReadDeadline(t time.Time) error  { return errHTTP2Deadline }
+func (c *http2Conn) SetWriteDeadline(t time.Time) error { return errHTTP2Deadline }
+
+// http2Addr is the address of an HTTP/2 peer, as host:port.
+type http2Addr string
+
+func (http2Addr) Network() string  { return "h2" }
+func (a http2Addr) String() string { return string(a) }
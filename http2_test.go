@@ -0,0 +1,63 @@
+package birpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestHTTP2(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	ts := httptest.NewUnstartedServer(server.HTTP2Handler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	ctx := context.Background()
+	client, err := DialHTTP2(ctx, ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		reply := new(Reply)
+		if err = client.Call(ctx, "Arith.Add", Args{i, 2}, reply); err != nil || reply.C != i+2 {
+			t.Errorf("expected %d, got %d: %v", i+2, reply.C, err)
+		}
+	}
+
+	// HTTP/1 cannot carry the connections
+	tlsConfig := ts.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tlsConfig.NextProtos = nil
+	h1 := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	if h1Client, err := DialHTTP2(ctx, h1, ts.URL); err == nil {
+		h1Client.Close()
+		t.Error("expected HTTP/1 to be rejected")
+	} else if !strings.Contains(err.Error(), "505") {
+		t.Errorf("expected HTTP/1 to be rejected, got %v", err)
+	}
+}
+
+func TestHTTP2Birpc(t *testing.T) {
+	server := NewBirpcServer()
+	server.Register(new(Arith))
+	ts := httptest.NewUnstartedServer(server.HTTP2Handler())
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	ctx := context.Background()
+	client, err := DialBirpcHTTP2(ctx, ts.Client(), ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Mul", Args{3, 4}, reply); err != nil || reply.C != 12 {
+		t.Errorf("expected 12, got %d: %v", reply.C, err)
+	}
+}
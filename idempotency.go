@@ -0,0 +1,160 @@
+package birpc
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Idempotency carries the idempotency key of a call. It is meant to be
+// embedded in the arguments of the calls which may be delivered more than
+// once, so the server can recognize the repeated deliveries, see
+// IdempotencyCache.
+type Idempotency struct {
+	Key string
+}
+
+// IdempotencyKey implements Idempotent.
+func (i Idempotency) IdempotencyKey() string { return i.Key }
+
+// SetIdempotencyKey sets the key, letting an Outbox fill it.
+func (i *Idempotency) SetIdempotencyKey(key string) { i.Key = key }
+
+// Idempotent is implemented by the arguments carrying an idempotency key.
+// The calls with an empty key are not considered idempotent.
+type Idempotent interface {
+	IdempotencyKey() string
+}
+
+// NewIdempotencyKey returns a random key, unique for all practical
+// purposes.
+func NewIdempotencyKey() string {
+	b := random16()
+	return hex.EncodeToString(b[:])
+}
+
+// IdempotencyCache makes the server remember the replies of the calls
+// whose arguments implement Idempotent, for the last size keys and for up
+// to ttl each (forever if zero). A call repeating a remembered key is
+// answered with the reply of the first one without calling the method; if
+// the first one is still running the repetition waits for it. The failed
+// calls are not remembered, so repeating them calls the method again.
+//
+// The keys are scoped to the client sending them: to the subject of its
+// verified TLS certificate, else to its connection, so the clients cannot
+// read the replies of each other by guessing their keys. The calls still
+// running are never evicted, even beyond size.
+func IdempotencyCache(size int, ttl time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.idempotency = &idempotencyCache{
+			size:    size,
+			ttl:     ttl,
+			entries: make(map[idempotencyKey]*idempotentCall),
+		}
+	}
+}
+
+type idempotencyCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotentCall
+	order   []*idempotentCall // in the order they were added, for the eviction
+}
+
+// idempotencyKey is the key of a call within the scope of its client.
+type idempotencyKey struct {
+	client string      // subject of the verified TLS certificate
+	conn   *serverConn // of the clients without one
+	key    string
+}
+
+// newIdempotencyKey scopes key to the client on conn.
+func newIdempotencyKey(conn *serverConn, key string) idempotencyKey {
+	if state := peerTLS(conn.codec); state != nil && len(state.VerifiedChains) != 0 {
+		return idempotencyKey{client: state.VerifiedChains[0][0].Subject.String(), key: key}
+	}
+	return idempotencyKey{conn: conn, key: key}
+}
+
+type idempotentCall struct {
+	key    idempotencyKey
+	done   chan struct{} // closed once the reply is known
+	reply  interface{}
+	errmsg string
+	at     time.Time
+}
+
+// begin returns the call remembered for key and true if it is a new one,
+// which the caller must complete with finish.
+func (c *idempotencyCache) begin(key idempotencyKey) (call *idempotentCall, first bool) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, has := c.entries[key]; has && (c.ttl <= 0 || now.Sub(call.at) < c.ttl) {
+		return call, false
+	}
+	call = &idempotentCall{key: key, done: make(chan struct{}), at: now}
+	c.entries[key] = call
+	c.order = append(c.order, call)
+	if len(c.order) > c.size {
+		c.evict(len(c.order) - c.size)
+	}
+	return call, true
+}
+
+// evict forgets the n oldest finished calls, keeping the running ones.
+func (c *idempotencyCache) evict(n int) {
+	for n > 0 && c.order[0].finished() {
+		c.forget(c.order[0])
+		c.order[0] = nil
+		c.order = c.order[1:]
+		n--
+	}
+	if n == 0 {
+		return
+	}
+	// a call still running is the oldest, look for the finished behind it
+	kept := c.order[:0]
+	for _, old := range c.order {
+		if n > 0 && old.finished() {
+			c.forget(old)
+			n--
+			continue
+		}
+		kept = append(kept, old)
+	}
+	for i := len(kept); i < len(c.order); i++ {
+		c.order[i] = nil
+	}
+	c.order = kept
+}
+
+// forget removes call from the entries unless a newer one replaced it.
+func (c *idempotencyCache) forget(call *idempotentCall) {
+	if c.entries[call.key] == call {
+		delete(c.entries, call.key)
+	}
+}
+
+// finish records the outcome of call, forgetting it if it failed.
+func (c *idempotencyCache) finish(call *idempotentCall, reply interface{}, errmsg string) {
+	call.reply, call.errmsg = reply, errmsg
+	if errmsg != "" {
+		c.mu.Lock()
+		c.forget(call)
+		c.mu.Unlock()
+	}
+	close(call.done)
+}
+
+// finished reports whether the outcome of call is known.
+func (call *idempotentCall) finished() bool {
+	select {
+	case <-call.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,128 @@
+package birpc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Charge struct {
+	Idempotency
+	Amount int
+}
+
+// Wallet counts how often its methods really run.
+type Wallet struct {
+	mu      sync.Mutex
+	balance int
+	calls   int
+}
+
+func (w *Wallet) Debit(ctx *context.Context, args *Charge, balance *int) error {
+	time.Sleep(5 * time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	if args.Amount < 0 {
+		return errors.New("negative amount")
+	}
+	w.balance -= args.Amount
+	*balance = w.balance
+	return nil
+}
+
+func TestIdempotencyCache(t *testing.T) {
+	wallet := &Wallet{balance: 100}
+	server := NewServer(IdempotencyCache(2, 0))
+	server.Register(wallet)
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	// concurrent repetitions wait for the first call
+	var wg sync.WaitGroup
+	balances := make([]int, 3)
+	for i := range balances {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k1"}, 10}, &balances[i]); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, b := range balances {
+		if b != 90 {
+			t.Errorf("expected the balance of the first call, got %v", balances)
+		}
+	}
+	var balance int
+	if err := client.Call(ctx, "Wallet.Debit", &Charge{Amount: 10}, &balance); err != nil || balance != 80 {
+		t.Errorf("expected the calls without key to run, got %d %v", balance, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k2"}, -1}, &balance); err == nil {
+			t.Error("expected error")
+		}
+	}
+	if wallet.calls != 4 {
+		t.Errorf("expected the failed calls to run again, got %d calls", wallet.calls)
+	}
+
+	// k1 is evicted by two newer keys
+	client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k3"}, 1}, &balance)
+	client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k4"}, 1}, &balance)
+	client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k4"}, 1}, &balance)
+	client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k1"}, 10}, &balance)
+	if balance != 68 || wallet.calls != 7 {
+		t.Errorf("expected balance 68 after 7 calls, got %d after %d", balance, wallet.calls)
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	wallet := &Wallet{balance: 100}
+	server := NewServer(IdempotencyCache(10, 0))
+	server.Register(wallet)
+	ctx := context.Background()
+	var balance int
+	for _, client := range []*Client{newPipeClient(t, server), newPipeClient(t, server)} {
+		if err := client.Call(ctx, "Wallet.Debit", &Charge{Idempotency{"k1"}, 10}, &balance); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if balance != 80 || wallet.calls != 2 {
+		t.Errorf("expected the key run once per client, got balance %d after %d calls", balance, wallet.calls)
+	}
+}
+
+func TestIdempotencyKeepRunning(t *testing.T) {
+	c := &idempotencyCache{size: 1, entries: make(map[idempotencyKey]*idempotentCall)}
+	running, _ := c.begin(idempotencyKey{key: "k1"})
+	call, _ := c.begin(idempotencyKey{key: "k2"})
+	c.finish(call, 1, "")
+	if _, first := c.begin(idempotencyKey{key: "k1"}); first {
+		t.Error("expected the running call kept")
+	}
+	c.begin(idempotencyKey{key: "k3"})
+	if _, first := c.begin(idempotencyKey{key: "k2"}); !first {
+		t.Error("expected the finished call evicted")
+	}
+	c.finish(running, 1, "")
+}
+
+func TestOutboxIdempotencyKeys(t *testing.T) {
+	ob := NewOutbox(0, 0)
+	charge := &Charge{Amount: 1}
+	ob.Send("node1", "Wallet.Debit", charge)
+	keyed := &Charge{Idempotency{"mine"}, 1}
+	ob.Send("node1", "Wallet.Debit", keyed)
+	if len(charge.Key) != 32 || keyed.Key != "mine" {
+		t.Errorf("expected a generated key and the given one, got %q %q", charge.Key, keyed.Key)
+	}
+	if NewIdempotencyKey() == NewIdempotencyKey() {
+		t.Error("expected different keys")
+	}
+}
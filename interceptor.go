@@ -0,0 +1,125 @@
+package birpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Invoker performs a call, it has the signature of ClientConnector.Call.
+type Invoker func(ctx *context.Context, serviceMethod string, args, reply interface{}) error
+
+// ClientInterceptor wraps a client call. It may inspect or change the call
+// and must call invoker to continue the chain, or return without calling
+// it to short-circuit the call.
+type ClientInterceptor func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error
+
+// chainClientInterceptors returns an Invoker calling the interceptors in
+// order, the first one being the outermost, before calling invoker.
+func chainClientInterceptors(interceptors []ClientInterceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+			return interceptor(ctx, serviceMethod, args, reply, next)
+		}
+	}
+	return invoker
+}
+
+// interceptedConn applies the client interceptors to the calls of conn.
+type interceptedConn struct {
+	ClientConn
+	invoke Invoker
+}
+
+func (c *interceptedConn) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	return c.invoke(ctx, serviceMethod, args, reply)
+}
+
+// CallInterceptors makes the client run its calls, made with Call or Go,
+// under interceptors, the first one being the outermost. Unlike the ones
+// of ClientBuilder, they are bound to the connection. The internal calls
+// of the package are not intercepted.
+func CallInterceptors(interceptors ...ClientInterceptor) ClientOption {
+	return func(client *basicClient) {
+		client.interceptors = append(client.interceptors, interceptors...)
+	}
+}
+
+// internalMethod reports whether serviceMethod is of the internal service
+// of the package.
+func internalMethod(serviceMethod string) bool {
+	return strings.HasPrefix(serviceMethod, "_goRPC_.")
+}
+
+type interceptedCallKey struct{}
+
+// goIntercepted runs call, made with Go, under the interceptors of the
+// client, on a goroutine of its own.
+func (client *basicClient) goIntercepted(call *Call) {
+	call.Enqueued = time.Now()
+	go func() {
+		ctx := context.WithValue(context.Background(), interceptedCallKey{}, call)
+		call.Error = client.invoke(ctx, call.ServiceMethod, call.Args, call.Reply)
+		call.done()
+	}()
+}
+
+// interceptedCall copies the timings, the sizes and the reply metadata of
+// sent to the call made with Go whose interceptors sent it, if any.
+func interceptedCall(ctx *context.Context, sent *Call) {
+	call, _ := ctx.Value(interceptedCallKey{}).(*Call)
+	if call == nil {
+		return
+	}
+	call.Written, call.Received = sent.Written, sent.Received
+	call.RequestSize, call.ResponseSize = sent.RequestSize, sent.ResponseSize
+	call.Checksum, call.Metadata = sent.Checksum, sent.Metadata
+}
+
+// ServerHandler serves a call with args, see ServerInterceptor.
+type ServerHandler func(ctx *context.Context, args interface{}) error
+
+// ServerInterceptor wraps the calls served, like authenticating, logging
+// or validating them. It may change the context of the method or its
+// arguments, of the same type, and must call next to continue the chain,
+// or return without calling it to fail the call with its error. The
+// internal calls of the package are not intercepted.
+type ServerInterceptor func(ctx *context.Context, serviceMethod string, args interface{}, next ServerHandler) error
+
+// ServerInterceptors appends interceptors to the chain of the server, the
+// first one added being the outermost. They run after the admission of
+// the calls and the decryption of their fields, see FieldEncryption.
+func ServerInterceptors(interceptors ...ServerInterceptor) ServerOption {
+	return func(server *basicServer) {
+		server.interceptors = append(server.interceptors, interceptors...)
+	}
+}
+
+// intercept runs the call of serviceMethod with argv under the
+// interceptors of the server.
+func (server *basicServer) intercept(ctx *context.Context, serviceMethod string, argv reflect.Value,
+	call func(ctx *context.Context, argv reflect.Value) error) error {
+	handler := func(ctx *context.Context, args interface{}) error {
+		v := reflect.ValueOf(args)
+		if !v.IsValid() || !v.Type().AssignableTo(argv.Type()) {
+			return fmt.Errorf("rpc: the interceptors of %s changed its arguments to %T", serviceMethod, args)
+		}
+		if v.Type() != argv.Type() {
+			conv := reflect.New(argv.Type()).Elem()
+			conv.Set(v)
+			v = conv
+		}
+		return call(ctx, v)
+	}
+	for i := len(server.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := server.interceptors[i], handler
+		handler = func(ctx *context.Context, args interface{}) error {
+			return interceptor(ctx, serviceMethod, args, next)
+		}
+	}
+	return handler(ctx, argv.Interface())
+}
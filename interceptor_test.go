@@ -0,0 +1,136 @@
+package birpc
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestServerInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) ServerInterceptor {
+		return func(ctx *context.Context, serviceMethod string, args interface{}, next ServerHandler) error {
+			mu.Lock()
+			order = append(order, name+" "+serviceMethod)
+			mu.Unlock()
+			return next(ctx, args)
+		}
+	}
+	auth := func(ctx *context.Context, serviceMethod string, args interface{}, next ServerHandler) error {
+		if MetadataFromContext(ctx)["token"] != "secret" {
+			return WithErrorCode(errors.New("unauthenticated"), CodeUnauthenticated)
+		}
+		return next(ctx, args)
+	}
+	fee := func(ctx *context.Context, serviceMethod string, args interface{}, next ServerHandler) error {
+		switch amount := args.(float64); {
+		case amount < 0:
+			return next(ctx, "negative")
+		case amount > 0:
+			return next(ctx, amount+0.5)
+		}
+		return next(ctx, args)
+	}
+	server := NewServer(ServerInterceptors(record("outer"), auth), ServerInterceptors(fee))
+	server.Register(Debits{})
+	client := newPipeClient(t, server)
+
+	var left float64
+	err := client.Call(context.Background(), "Debits.Debit", 2.0, &left)
+	if ErrorCode(err) != CodeUnauthenticated {
+		t.Errorf("expected the call to be rejected, got %v", err)
+	}
+	ctx := WithMetadata(context.Background(), Metadata{"token": "secret"})
+	if err = client.Call(ctx, "Debits.Debit", 2.0, &left); err != nil || left != 7.5 {
+		t.Errorf("expected the fee to be added, got %v: %v", left, err)
+	}
+	if err = client.Call(ctx, "Debits.Debit", -1.0, &left); err == nil ||
+		!strings.Contains(err.Error(), "changed its arguments to string") {
+		t.Errorf("expected the change of type to fail the call, got %v", err)
+	}
+
+	// the internal calls are not intercepted
+	if _, err = client.Capabilities(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 3 || order[0] != "outer Debits.Debit" {
+		t.Errorf("unexpected interceptions %q", order)
+	}
+}
+
+type Ledger struct{}
+
+func (Ledger) Balance(ctx *context.Context, account string, reply *float64) error {
+	if account == "" {
+		return errors.New("missing account")
+	}
+	SetReplyMetadata(ctx, Metadata{"tenant": MetadataFromContext(ctx)["tenant"]})
+	*reply = 10
+	return nil
+}
+
+func TestCallInterceptors(t *testing.T) {
+	server := NewServer()
+	server.Register(Ledger{})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	count := func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		mu.Lock()
+		calls[serviceMethod]++
+		mu.Unlock()
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	tenant := func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		return invoker(WithMetadata(ctx, Metadata{"tenant": "cgrates.org"}), serviceMethod, args, reply)
+	}
+	fault := func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		if args == "faulty" {
+			return ErrShutdown
+		}
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	client := NewClient(c1, CallInterceptors(count, tenant), CallInterceptors(fault))
+	defer client.Close()
+
+	var balance float64
+	var md Metadata
+	ctx := ReceiveMetadata(context.Background(), &md)
+	if err := client.Call(ctx, "Ledger.Balance", "1001", &balance); err != nil || balance != 10 {
+		t.Errorf("expected 10, got %v: %v", balance, err)
+	}
+	if md["tenant"] != "cgrates.org" {
+		t.Errorf("expected the metadata to be added, got %v", md)
+	}
+	if err := client.Call(ctx, "Ledger.Balance", "faulty", &balance); err != ErrShutdown {
+		t.Errorf("expected the injected fault, got %v", err)
+	}
+
+	// Go is intercepted as well, the call reporting the one sent
+	call := <-client.Go("Ledger.Balance", "1002", &balance, nil).Done
+	if call.Error != nil || call.Metadata["tenant"] != "cgrates.org" || call.Written.IsZero() {
+		t.Errorf("unexpected call %+v", call)
+	}
+	call = <-client.Go("Ledger.Balance", "", &balance, nil).Done
+	if call.Error == nil || call.Error.Error() != "missing account" {
+		t.Errorf("expected the error of the server, got %v", call.Error)
+	}
+
+	// the internal calls are not intercepted
+	if _, err := client.Capabilities(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 || calls["Ledger.Balance"] != 4 {
+		t.Errorf("unexpected interceptions %v", calls)
+	}
+}
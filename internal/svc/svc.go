@@ -6,7 +6,9 @@
 package svc
 
 import (
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/cgrates/birpc/context"
 )
@@ -15,36 +17,90 @@ import (
 // connection (an rpc.ServerCodec).
 type Pending struct {
 	mu     sync.Mutex
-	m      map[uint64]context.CancelFunc // seq -> cancel
+	m      map[uint64]pendingCall // seq -> call
 	parent *context.Context
 }
 
+type pendingCall struct {
+	cancel        context.CancelFunc
+	serviceMethod string
+	requestID     string
+	started       time.Time
+}
+
+// Call describes a pending call, see Calls.
+type Call struct {
+	Seq           uint64
+	ServiceMethod string
+	RequestID     string
+	Started       time.Time
+}
+
 func NewPending(parent *context.Context) *Pending {
 	return &Pending{
-		m:      make(map[uint64]context.CancelFunc),
+		m:      make(map[uint64]pendingCall),
 		parent: parent,
 	}
 }
 
-func (s *Pending) Start(seq uint64) *context.Context {
-	ctx, cancel := context.WithCancel(s.parent)
+// Start records the call seq, returning its context. The context ends at
+// deadline, unless it is zero.
+func (s *Pending) Start(seq uint64, serviceMethod, requestID string, deadline time.Time) *context.Context {
+	var ctx *context.Context
+	var cancel context.CancelFunc
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(s.parent)
+	} else {
+		ctx, cancel = context.WithDeadline(s.parent, deadline)
+	}
 	s.mu.Lock()
 	// we assume seq is not already in map. If not, the client is broken.
-	s.m[seq] = cancel
+	s.m[seq] = pendingCall{cancel: cancel, serviceMethod: serviceMethod, requestID: requestID, started: time.Now()}
 	s.mu.Unlock()
 	return ctx
 }
 
-func (s *Pending) Cancel(seq uint64) {
+// Cancel cancels the call seq, reporting whether it was pending.
+func (s *Pending) Cancel(seq uint64) bool {
 	s.mu.Lock()
-	cancel, ok := s.m[seq]
+	call, ok := s.m[seq]
 	if ok {
 		delete(s.m, seq)
 	}
 	s.mu.Unlock()
 	if ok {
+		call.cancel()
+	}
+	return ok
+}
+
+// CancelRequest cancels the calls of the request ID id, returning their
+// number.
+func (s *Pending) CancelRequest(id string) int {
+	var cancels []context.CancelFunc
+	s.mu.Lock()
+	for seq, call := range s.m {
+		if call.requestID == id {
+			cancels = append(cancels, call.cancel)
+			delete(s.m, seq)
+		}
+	}
+	s.mu.Unlock()
+	for _, cancel := range cancels {
 		cancel()
 	}
+	return len(cancels)
+}
+
+// Calls returns the pending calls, in no particular order.
+func (s *Pending) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	calls := make([]Call, 0, len(s.m))
+	for seq, call := range s.m {
+		calls = append(calls, Call{Seq: seq, ServiceMethod: call.serviceMethod, RequestID: call.requestID, Started: call.started})
+	}
+	return calls
 }
 
 type CancelArgs struct {
@@ -70,3 +126,175 @@ func (*GoRPC) Cancel(_ *context.Context, args *CancelArgs, _ *bool) error {
 	args.pending.Cancel(args.Seq)
 	return nil
 }
+
+// HelloArgs carries the identity of a connection sent by the client.
+type HelloArgs struct {
+	UUID  string
+	Epoch uint64
+
+	// record keeps the identity on the server side of the connection, it
+	// is set by the Service.
+	record func(uuid string, epoch uint64)
+}
+
+// SetRecorder sets the function recording the identity. Do not use on the
+// client.
+func (a *HelloArgs) SetRecorder(record func(uuid string, epoch uint64)) {
+	a.record = record
+}
+
+// Hello records the identity of the connection and replies with it.
+func (*GoRPC) Hello(_ *context.Context, args *HelloArgs, reply *HelloArgs) error {
+	args.record(args.UUID, args.Epoch)
+	reply.UUID, reply.Epoch = args.UUID, args.Epoch
+	return nil
+}
+
+// Echo replies with its arguments, it is used to measure the round trip
+// time over the codec.
+func (*GoRPC) Echo(_ *context.Context, args []byte, reply *[]byte) error {
+	*reply = args
+	return nil
+}
+
+// Time replies with the current time of the server in nanoseconds since
+// the Unix epoch, it is used to estimate the clock offset between peers.
+func (*GoRPC) Time(_ *context.Context, _ int64, reply *int64) error {
+	*reply = time.Now().UnixNano()
+	return nil
+}
+
+// BlobArgs carries a blob sent by the client to be cached by the server.
+type BlobArgs struct {
+	Data []byte
+
+	// store caches the blob on the server side of the connection and
+	// returns its hash, it is set by the Service.
+	store func(data []byte) (string, error)
+}
+
+// SetStore sets the function caching the blob. Do not use on the client.
+func (a *BlobArgs) SetStore(store func(data []byte) (string, error)) {
+	a.store = store
+}
+
+// PutBlob caches the blob for the connection and replies with its hash.
+func (*GoRPC) PutBlob(_ *context.Context, args *BlobArgs, reply *string) (err error) {
+	*reply, err = args.store(args.Data)
+	return
+}
+
+// CapabilitiesArgs asks the server for the features it supports.
+type CapabilitiesArgs struct {
+	// Only restricts the reply to these features, if not empty.
+	Only []string
+
+	// capabilities are the features of the server, set by the Service.
+	capabilities []string
+}
+
+// SetCapabilities sets the features of the server. Do not use on the
+// client.
+func (a *CapabilitiesArgs) SetCapabilities(capabilities []string) {
+	a.capabilities = capabilities
+}
+
+// Capabilities replies with the features supported by the server.
+func (*GoRPC) Capabilities(_ *context.Context, args *CapabilitiesArgs, reply *[]string) error {
+	for _, c := range args.capabilities {
+		if len(args.Only) == 0 || contains(args.Only, c) {
+			*reply = append(*reply, c)
+		}
+	}
+	return nil
+}
+
+// IdempotentArgs asks the server for the methods safe to call again.
+type IdempotentArgs struct {
+	// Service restricts the reply to the methods of this service, if not
+	// empty.
+	Service string
+
+	// methods are the idempotent methods of the server, set by the
+	// Service.
+	methods []string
+}
+
+// SetMethods sets the idempotent methods of the server. Do not use on the
+// client.
+func (a *IdempotentArgs) SetMethods(methods []string) {
+	a.methods = methods
+}
+
+// Idempotent replies with the methods marked idempotent on the server.
+func (*GoRPC) Idempotent(_ *context.Context, args *IdempotentArgs, reply *[]string) error {
+	for _, m := range args.methods {
+		if args.Service == "" || strings.HasPrefix(m, args.Service+".") {
+			*reply = append(*reply, m)
+		}
+	}
+	return nil
+}
+
+// HandoffArgs waits for the server to hand the connection off to another
+// one.
+type HandoffArgs struct {
+	// MaxWait bounds the wait, the reply being empty once it passes, for
+	// the connections through proxies closing the idle calls. Zero waits
+	// until the handoff or the end of the connection.
+	MaxWait time.Duration
+
+	// wait blocks until the handoff and returns the address of the server
+	// taking over and the token resuming the session there, it is set by
+	// the Service.
+	wait func(ctx *context.Context, maxWait time.Duration) (address, token string, err error)
+}
+
+// SetWait sets the function waiting for the handoff. Do not use on the
+// client.
+func (a *HandoffArgs) SetWait(wait func(ctx *context.Context, maxWait time.Duration) (address, token string, err error)) {
+	a.wait = wait
+}
+
+// HandoffReply is the server taking over the connection, empty if the
+// wait timed out.
+type HandoffReply struct {
+	Address string
+	Token   string
+}
+
+// Handoff replies once the server hands the connection off.
+func (*GoRPC) Handoff(ctx *context.Context, args *HandoffArgs, reply *HandoffReply) (err error) {
+	reply.Address, reply.Token, err = args.wait(ctx, args.MaxWait)
+	return
+}
+
+// ResumeArgs carries the token of a handoff to the server taking over.
+type ResumeArgs struct {
+	Token string
+
+	// resume restores the session of the token on the server side of the
+	// connection, it is set by the Service.
+	resume func(token string) error
+}
+
+// SetResume sets the function restoring the session. Do not use on the
+// client.
+func (a *ResumeArgs) SetResume(resume func(token string) error) {
+	a.resume = resume
+}
+
+// Resume restores on the connection the session handed off with the
+// token.
+func (*GoRPC) Resume(_ *context.Context, args *ResumeArgs, _ *bool) error {
+	return args.resume(args.Token)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
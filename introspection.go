@@ -0,0 +1,117 @@
+package birpc
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// MethodDoc documents a method for the clients, see MethodDocs and
+// Describer.
+type MethodDoc struct {
+	Description string
+	// ArgsExample and ReplyExample are sample values of the argument and
+	// of the reply, published JSON encoded.
+	ArgsExample  interface{}
+	ReplyExample interface{}
+}
+
+// Describer is implemented by the receivers documenting their methods.
+// DescribeMethods returns the documentation by method name.
+type Describer interface {
+	DescribeMethods() map[string]MethodDoc
+}
+
+func setMethodDocs(methods map[string]*MethodType, docs map[string]MethodDoc) {
+	for name, doc := range docs {
+		mtype, has := methods[name]
+		if !has {
+			debugf("rpc.Register: documentation for unknown method %q\n", name)
+			continue
+		}
+		mtype.Doc = doc
+	}
+}
+
+// MethodDesc describes a registered method, see the Describe method of
+// Server and BirpcServer.
+type MethodDesc struct {
+	Name         string          `json:"name"` // "Service.Method"
+	ArgType      string          `json:"arg_type"`
+	ReplyType    string          `json:"reply_type,omitempty"` // empty if the method has no reply
+	Idempotent   bool            `json:"idempotent,omitempty"` // see IdempotentMethods
+	Description  string          `json:"description,omitempty"`
+	ArgsExample  json.RawMessage `json:"args_example,omitempty"`
+	ReplyExample json.RawMessage `json:"reply_example,omitempty"`
+}
+
+// Describe returns the description of the methods registered on the
+// server, sorted by name. The internal _goRPC_ service is left out.
+func (server *basicServer) Describe() (descs []MethodDesc) {
+	server.serviceMap.Range(func(_, value interface{}) bool {
+		if s := value.(*Service); s.Name != "_goRPC_" {
+			descs = append(descs, s.describe()...)
+		}
+		return true
+	})
+	sort.Slice(descs, func(i, j int) bool { return descs[i].Name < descs[j].Name })
+	return
+}
+
+func (s *Service) describe() []MethodDesc {
+	descs := make([]MethodDesc, 0, len(s.Methods))
+	for name, mtype := range s.Methods {
+		desc := MethodDesc{
+			Name:        s.Name + "." + name,
+			ArgType:     mtype.ArgType.String(),
+			Description: mtype.Doc.Description,
+			Idempotent:  mtype.idempotent,
+		}
+		if mtype.ReplyType != nil {
+			desc.ReplyType = mtype.ReplyType.String()
+		}
+		desc.ArgsExample = jsonExample(desc.Name, mtype.Doc.ArgsExample)
+		desc.ReplyExample = jsonExample(desc.Name, mtype.Doc.ReplyExample)
+		descs = append(descs, desc)
+	}
+	return descs
+}
+
+func jsonExample(name string, v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		debugf("rpc: cannot encode the example of %s: %v\n", name, err)
+		return nil
+	}
+	return b
+}
+
+// Introspection is a service publishing the description of the methods
+// of a server. It is registered on demand:
+//
+//	server.RegisterName("Introspection", server.Introspection())
+type Introspection struct {
+	server *basicServer
+}
+
+// Introspection returns the service describing the methods of the server.
+func (server *basicServer) Introspection() *Introspection {
+	return &Introspection{server: server}
+}
+
+// Methods returns the description of the methods of the service named in
+// args, or of all the methods if args is empty.
+func (i *Introspection) Methods(_ *context.Context, args string, reply *[]MethodDesc) error {
+	*reply = (*reply)[:0]
+	for _, desc := range i.server.Describe() {
+		if args == "" || strings.HasPrefix(desc.Name, args+".") {
+			*reply = append(*reply, desc)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type DocArith struct {
+	Arith
+}
+
+func (*DocArith) DescribeMethods() map[string]MethodDoc {
+	return map[string]MethodDoc{
+		"Add": {Description: "Adds two numbers", ArgsExample: Args{1, 2}, ReplyExample: Reply{3}},
+		"Mul": {Description: "Multiplies two numbers"},
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	server := NewServer()
+	if err := server.Register(new(DocArith), StrictMethods(), MethodDocs(map[string]MethodDoc{
+		"Mul": {Description: "Multiplies A by B"},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register(&Commands{}, NoReplyMethods()); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register(server.Introspection()); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+
+	var descs []MethodDesc
+	if err := client.Call(context.Background(), "Introspection.Methods", "DocArith", &descs); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(descs))
+	for i, d := range descs {
+		names[i] = d.Name
+	}
+	if exp := []string{"DocArith.Add", "DocArith.Div", "DocArith.Error", "DocArith.Mul", "DocArith.Scan", "DocArith.SleepMilli", "DocArith.String"}; !reflect.DeepEqual(names, exp) {
+		t.Fatalf("expected methods %v, got %v", exp, names)
+	}
+	expAdd := MethodDesc{
+		Name:         "DocArith.Add",
+		ArgType:      "birpc.Args",
+		ReplyType:    "*birpc.Reply",
+		Description:  "Adds two numbers",
+		ArgsExample:  []byte(`{"A":1,"B":2}`),
+		ReplyExample: []byte(`{"C":3}`),
+	}
+	if !reflect.DeepEqual(descs[0], expAdd) {
+		t.Errorf("expected %+v, got %+v", expAdd, descs[0])
+	}
+	if descs[3].Description != "Multiplies A by B" {
+		t.Errorf("expected the option to override the Describer, got %q", descs[3].Description)
+	}
+
+	if err := client.Call(context.Background(), "Introspection.Methods", "", &descs); err != nil {
+		t.Fatal(err)
+	}
+	var reset *MethodDesc
+	for i, d := range descs {
+		if d.Name == "Commands.Reset" {
+			reset = &descs[i]
+		}
+		if d.Name == "_goRPC_.Cancel" {
+			t.Error("internal methods should not be described")
+		}
+	}
+	if reset == nil || reset.ArgType != "*birpc.Args" || reset.ReplyType != "" {
+		t.Errorf("unexpected description of Commands.Reset: %+v", reset)
+	}
+}
@@ -56,6 +56,22 @@ func (t *Arith) Div(_ *context.Context, args *Args, reply *Reply) error {
 	return nil
 }
 
+// codeNegativeDivisor is a code of the application, past the ones of gRPC.
+const codeNegativeDivisor = 1000
+
+func (t *Arith) Mod(_ *context.Context, args *Args, reply *Reply) error {
+	switch {
+	case args.B == 0:
+		return &birpc.Error{Code: birpc.CodeInvalidArgument, Message: "divide by zero", Details: *args}
+	case args.B < 0:
+		return birpc.WithErrorCode(errors.New("negative divisor"), codeNegativeDivisor)
+	case args.A > 1000:
+		return fmt.Errorf("dividing %d: %w", args.A, Overflow{Max: 1000})
+	}
+	reply.C = args.A % args.B
+	return nil
+}
+
 func (t *Arith) Error(_ *context.Context, args *Args, reply *Reply) error {
 	panic("ERROR")
 }
@@ -448,3 +464,328 @@ func TestContextCodec(t *testing.T) {
 		t.Fatalf("expected to fail due to context cancellation: %v", err)
 	}
 }
+
+func TestCallSizes(t *testing.T) {
+	cli, srv := net.Pipe()
+	go ServeConn(srv)
+	client := NewClient(cli)
+	defer client.Close()
+
+	// the first request also carries the identity of the connection
+	if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	call := <-client.Go("Arith.Add", &Args{7, 8}, new(Reply), nil).Done
+	if call.Error != nil {
+		t.Fatal(call.Error)
+	}
+	// {"method":"Arith.Add","params":[{"A":7,"B":8}],"id":1}
+	if call.RequestSize != 55 {
+		t.Errorf("expected request size 55, got %d", call.RequestSize)
+	}
+	if call.ResponseSize == 0 || call.Received.Before(call.Written) {
+		t.Errorf("unexpected response size %d, received at %v", call.ResponseSize, call.Received)
+	}
+}
+
+func TestRawReply(t *testing.T) {
+	cli, srv := net.Pipe()
+	go ServeConn(srv)
+	client := NewClient(cli)
+	defer client.Close()
+
+	var raw birpc.RawReply
+	if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Format != "json" || string(raw.Data) != `{"C":15}` {
+		t.Fatalf("unexpected raw reply %q of %s", raw.Data, raw.Format)
+	}
+	var reply Reply
+	if err := raw.Decode(&reply); err != nil || reply.C != 15 {
+		t.Errorf("unexpected reply %+v: %v", reply, err)
+	}
+	var m map[string]int
+	if err := raw.Decode(&m); err != nil || m["C"] != 15 {
+		t.Errorf("unexpected reply %v: %v", m, err)
+	}
+
+	// the standalone replies are the usual ones with JSON
+	reply = Reply{}
+	if err := client.Call(birpc.WithStandaloneReply(context.Background()), "Arith.Add", &Args{7, 8}, &reply); err != nil || reply.C != 15 {
+		t.Errorf("unexpected reply %+v: %v", reply, err)
+	}
+}
+
+// SlowJSON blocks its encoding until released.
+type SlowJSON struct {
+	release chan struct{}
+}
+
+func (s *SlowJSON) MarshalJSON() ([]byte, error) {
+	<-s.release
+	return []byte(`"slow"`), nil
+}
+
+type Encodings struct {
+	slow *SlowJSON
+}
+
+func (e *Encodings) Slow(_ *context.Context, _ int, reply **SlowJSON) error {
+	*reply = e.slow
+	return nil
+}
+
+func (e *Encodings) Fast(_ *context.Context, i int, reply *int) error {
+	*reply = i
+	return nil
+}
+
+func (e *Encodings) Invalid(_ *context.Context, _ int, reply *interface{}) error {
+	*reply = make(chan int)
+	return nil
+}
+
+func TestEncodeOutsideSendingLock(t *testing.T) {
+	svc := &Encodings{slow: &SlowJSON{release: make(chan struct{})}}
+	server := birpc.NewServer()
+	server.Register(svc)
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	slow := client.Go("Encodings.Slow", 0, new(string), nil)
+	time.Sleep(10 * time.Millisecond) // let the slow reply start encoding
+	var fast int
+	if err := client.Call(context.Background(), "Encodings.Fast", 1, &fast); err != nil || fast != 1 {
+		t.Errorf("unexpected reply %d: %v", fast, err)
+	}
+	close(svc.slow.release)
+	if call := <-slow.Done; call.Error != nil || *call.Reply.(*string) != "slow" {
+		t.Errorf("unexpected slow reply %q: %v", *call.Reply.(*string), call.Error)
+	}
+
+	var reply interface{}
+	if err := client.Call(context.Background(), "Encodings.Invalid", 0, &reply); err == nil ||
+		!strings.Contains(err.Error(), "encoding reply") {
+		t.Errorf("expected an encoding error, got %v", err)
+	}
+}
+
+func TestChecksumReplies(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(new(Arith), birpc.ChecksumReplies("Add"))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	ctx := birpc.VerifyChecksums(context.Background())
+	var reply Reply
+	if err := client.Call(ctx, "Arith.Add", &Args{7, 8}, &reply); err != nil || reply.C != 15 {
+		t.Errorf("unexpected reply %+v: %v", reply, err)
+	}
+	var wrong map[string]interface{}
+	if err := client.Call(ctx, "Arith.Add", &Args{7, 8}, &wrong); err != birpc.ErrChecksumMismatch {
+		t.Errorf("expected %v, got %v", birpc.ErrChecksumMismatch, err)
+	}
+}
+
+type Counter struct{}
+
+func (Counter) Count(ctx *context.Context, n int, stream *birpc.Stream) error {
+	for i := 1; i <= n; i++ {
+		if err := stream.Send(&Reply{C: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(Counter{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		stream := client.CallStream(context.Background(), "Counter.Count", 3, func() interface{} { return new(Reply) })
+		var sum int
+		for {
+			item, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum += item.(*Reply).C
+		}
+		if sum != 6 {
+			t.Errorf("expected the items to sum to 6, got %d", sum)
+		}
+	}
+}
+
+func (Counter) Sum(ctx *context.Context, upload *birpc.Upload, reply *Reply) error {
+	for {
+		var args Args
+		if err := upload.Recv(&args); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		reply.C += args.A + args.B
+	}
+}
+
+func TestUpload(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(Counter{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		var reply Reply
+		upload := client.OpenUpload(context.Background(), "Counter.Sum", &reply)
+		for j := 0; j < 3; j++ {
+			if err := upload.Send(&Args{j, 1}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := upload.CloseAndRecv(); err != nil || reply.C != 6 {
+			t.Errorf("unexpected reply %+v: %v", reply, err)
+		}
+	}
+}
+
+func TestDispatchRaw(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(new(Arith))
+	data, err := server.DispatchRaw(context.Background(), "Arith.Add", []byte(`{"A":7,"B":8}`), Raw)
+	if err != nil || string(data) != `{"C":15}` {
+		t.Errorf("unexpected reply %s: %v", data, err)
+	}
+}
+
+func TestGoAway(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+	var reply Reply
+	if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server closes the idle connection, not sent the GoAway
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("expected the connection to close, got %v", err)
+	}
+}
+
+type Blocker struct {
+	started, release chan struct{}
+}
+
+func (b *Blocker) Wait(_ *context.Context, args *Args, reply *Reply) error {
+	close(b.started)
+	<-b.release
+	reply.C = args.A + args.B
+	return nil
+}
+
+func TestGoAwayPendingCallZero(t *testing.T) {
+	blocker := &Blocker{started: make(chan struct{}), release: make(chan struct{})}
+	server := birpc.NewServer()
+	server.Register(blocker)
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServeCodec(NewServerCodec(srv))
+	if _, err := io.WriteString(cli, `{"method":"Blocker.Wait","params":[{"A":7,"B":8}],"id":0}`); err != nil {
+		t.Fatal(err)
+	}
+	<-blocker.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(blocker.release)
+
+	// the call 0 gets its reply, not the GoAway
+	dec := json.NewDecoder(cli)
+	var resp ArithAddResp
+	if err := dec.Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Id != 0.0 || resp.Result.C != 15 || resp.Error != nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if err := dec.Decode(&resp); err != io.EOF {
+		t.Errorf("expected the connection closed, got %+v: %v", resp, err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected the connection to close, got %v", err)
+	}
+}
+
+type Overflow struct {
+	Max int
+}
+
+func (e Overflow) Error() string { return "overflow" }
+
+func TestError(t *testing.T) {
+	birpc.RegisterErrorDetail("Overflow", Overflow{})
+	server := birpc.NewServer()
+	server.Register(new(Arith))
+	bserver := birpc.NewBirpcServer()
+	bserver.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	bcli, bsrv := net.Pipe()
+	go bserver.ServeCodec(NewJSONBirpcCodec(bsrv))
+	clients := map[string]interface {
+		Call(*context.Context, string, interface{}, interface{}) error
+	}{
+		"client": NewClient(cli),
+		"birpc":  birpc.NewBirpcClientWithCodec(NewJSONBirpcCodec(bcli)),
+	}
+	defer cli.Close()
+	defer bcli.Close()
+	for name, client := range clients {
+		var reply Reply
+		err := client.Call(context.Background(), "Arith.Mod", &Args{7, 0}, &reply)
+		if birpc.ErrorCode(err) != birpc.CodeInvalidArgument || err.Error() != "divide by zero" {
+			t.Errorf("%s: expected an invalid argument, got %#v", name, err)
+		}
+		if details, ok := birpc.ErrorDetail[Args](err); !ok || details != (Args{7, 0}) {
+			t.Errorf("%s: unexpected details %+v", name, details)
+		}
+		err = client.Call(context.Background(), "Arith.Mod", &Args{7, -2}, &reply)
+		if birpc.ErrorCode(err) != codeNegativeDivisor || err.Error() != "negative divisor" {
+			t.Errorf("%s: expected the code of the error, got %#v", name, err)
+		}
+		var overflow Overflow
+		err = client.Call(context.Background(), "Arith.Mod", &Args{1001, 2}, &reply)
+		if !errors.As(err, &overflow) || overflow.Max != 1000 {
+			t.Errorf("%s: expected the overflow, got %#v", name, err)
+		}
+		if err = client.Call(context.Background(), "Arith.Mod", &Args{7, 2}, &reply); err != nil || reply.C != 1 {
+			t.Errorf("%s: unexpected reply %+v: %v", name, reply, err)
+		}
+	}
+}
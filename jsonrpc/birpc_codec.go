@@ -11,11 +11,14 @@
 package jsonrpc
 
 import (
+	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cgrates/birpc"
 )
@@ -24,6 +27,7 @@ type jsonCodec struct {
 	dec *json.Decoder // for reading JSON values
 	enc *json.Encoder // for writing JSON values
 	c   io.Closer
+	cw  *countingWriter
 
 	// temporary work space
 	msg            message
@@ -43,21 +47,49 @@ type jsonCodec struct {
 
 // NewJSONBirpcCodec returns a new birpc.Codec using JSON-RPC on conn.
 func NewJSONBirpcCodec(conn io.ReadWriteCloser) birpc.BirpcCodec {
+	cw := &countingWriter{w: conn}
 	return &jsonCodec{
 		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
+		enc:     json.NewEncoder(cw),
 		c:       conn,
+		cw:      cw,
 		pending: make(map[uint64]*json.RawMessage),
 	}
 }
 
+// BytesWritten implements birpc.MessageSizer.
+func (c *jsonCodec) BytesWritten() int64 { return atomic.LoadInt64(&c.cw.n) }
+
+// BytesRead implements birpc.MessageSizer.
+func (c *jsonCodec) BytesRead() int64 { return c.dec.InputOffset() }
+
+// SetWriteDeadline sets the write deadline of the connection, letting the
+// client bound the writes by the context of the calls.
+func (c *jsonCodec) SetWriteDeadline(t time.Time) error {
+	return setWriteDeadline(c.c, t)
+}
+
 // serverRequest and clientResponse combined
 type message struct {
-	Method string           `json:"method"`
-	Params *json.RawMessage `json:"params"`
-	Id     *json.RawMessage `json:"id"`
-	Result *json.RawMessage `json:"result"`
-	Error  interface{}      `json:"error"`
+	Method   string            `json:"method"`
+	Params   *json.RawMessage  `json:"params"`
+	Id       *json.RawMessage  `json:"id"`
+	Result   *json.RawMessage  `json:"result"`
+	Error    interface{}       `json:"error"`
+	Depth    int               `json:"depth,omitempty"`
+	Fields   []string          `json:"fields,omitempty"`
+	Checksum string            `json:"checksum,omitempty"`
+	More     bool              `json:"more,omitempty"`
+	Item     bool              `json:"item,omitempty"`
+	End      bool              `json:"end,omitempty"`
+	Timeout  time.Duration     `json:"timeout,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	GoAway   bool              `json:"goaway,omitempty"`
+	Code     int               `json:"code,omitempty"`
+	Detail   *json.RawMessage  `json:"detail,omitempty"`
+	// DetailType is the name of the type of Detail, see
+	// birpc.RegisterErrorDetail.
+	DetailType string `json:"detail_type,omitempty"`
 }
 
 func (c *jsonCodec) ReadHeader(req *birpc.Request, resp *birpc.Response) error {
@@ -73,11 +105,23 @@ func (c *jsonCodec) ReadHeader(req *birpc.Request, resp *birpc.Response) error {
 		c.serverRequest.Params = c.msg.Params
 
 		req.ServiceMethod = c.serverRequest.Method
+		req.Depth = c.msg.Depth
+		req.Fields = c.msg.Fields
+		req.Item = c.msg.Item
+		req.End = c.msg.End
+		req.Timeout = c.msg.Timeout
+		req.Metadata = c.msg.Metadata
 
 		// JSON request id can be any JSON value;
 		// RPC package expects uint64.  Translate to
 		// internal uint64 and save JSON on the side.
-		if c.serverRequest.Id == nil {
+		if req.Item || req.End {
+			// the items of an upload are sent with the id of its call
+			c.mutex.Lock()
+			req.Seq = uploadSeq(c.pending, c.serverRequest.Id)
+			c.mutex.Unlock()
+			c.serverRequest.Id = nil
+		} else if c.serverRequest.Id == nil {
 			// Notification
 		} else {
 			c.mutex.Lock()
@@ -98,6 +142,13 @@ func (c *jsonCodec) ReadHeader(req *birpc.Request, resp *birpc.Response) error {
 
 		resp.Error = ""
 		resp.Seq = c.clientResponse.Id
+		resp.Checksum = c.msg.Checksum
+		resp.More = c.msg.More
+		resp.Metadata = c.msg.Metadata
+		resp.GoAway = c.msg.GoAway
+		resp.Code = c.msg.Code
+		resp.Detail = c.msg.Detail != nil
+		resp.DetailType = c.msg.DetailType
 		if c.clientResponse.Error != nil || c.clientResponse.Result == nil {
 			x, ok := c.clientResponse.Error.(string)
 			if !ok {
@@ -135,37 +186,63 @@ func (c *jsonCodec) ReadResponseBody(x interface{}) error {
 	return json.Unmarshal(*c.clientResponse.Result, x)
 }
 
+// ReadRawResponseBody keeps the JSON result for a birpc.RawReply, or the
+// detail of the error.
+func (c *jsonCodec) ReadRawResponseBody(raw *birpc.RawReply) error {
+	if c.msg.Detail != nil {
+		return readRaw(*c.msg.Detail, raw)
+	}
+	return readRaw(*c.clientResponse.Result, raw)
+}
+
 func (c *jsonCodec) WriteRequest(r *birpc.Request, param interface{}) error {
 	return c.enc.Encode(&clientRequest{
-		Method: r.ServiceMethod,
-		Params: [1]interface{}{param},
-		Id:     r.Seq,
+		Method:   r.ServiceMethod,
+		Params:   [1]interface{}{param},
+		Id:       r.Seq,
+		Depth:    r.Depth,
+		Fields:   r.Fields,
+		Item:     r.Item,
+		End:      r.End,
+		Timeout:  r.Timeout,
+		Metadata: r.Metadata,
 	})
 }
 
 func (c *jsonCodec) WriteResponse(r *birpc.Response, x interface{}) error {
-	c.mutex.Lock()
-	b, ok := c.pending[r.Seq]
-	if !ok {
-		c.mutex.Unlock()
-		return errors.New("invalid sequence number in response")
+	data, err := c.EncodeResponse(r, x)
+	if err != nil {
+		return err
 	}
-	delete(c.pending, r.Seq)
-	c.mutex.Unlock()
+	return c.WriteEncodedResponse(data)
+}
 
-	if b == nil {
-		// Invalid request so no id.  Use JSON null.
-		b = &null
-	}
-	resp := serverResponse{Id: b}
-	if r.Error == "" {
-		resp.Result = x
-	} else {
-		resp.Error = r.Error
-	}
-	return c.enc.Encode(resp)
+// EncodeResponse implements birpc.ResponseEncoder.
+func (c *jsonCodec) EncodeResponse(r *birpc.Response, x interface{}) ([]byte, error) {
+	return encodeResponse(&c.mutex, c.pending, r, x)
+}
+
+// WriteEncodedResponse implements birpc.ResponseEncoder.
+func (c *jsonCodec) WriteEncodedResponse(data []byte) error {
+	_, err := c.cw.Write(data)
+	return err
 }
 
 func (c *jsonCodec) Close() error {
 	return c.c.Close()
 }
+
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *jsonCodec) RemoteAddr() net.Addr {
+	if conn, ok := c.c.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *jsonCodec) TLSConnectionState() *tls.ConnectionState {
+	return birpc.ConnTLSState(c.c)
+}
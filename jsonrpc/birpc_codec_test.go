@@ -14,6 +14,8 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/cgrates/birpc"
@@ -169,3 +171,55 @@ func TestJSONRPC(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type Depths struct{}
+
+func (Depths) Get(ctx *context.Context, args int, depth *int) error {
+	if args > 0 {
+		return ctx.Client.Call(ctx, "Depths.Get", args-1, depth)
+	}
+	*depth = birpc.CallDepth(ctx)
+	return nil
+}
+
+func TestJSONCallDepth(t *testing.T) {
+	srv := birpc.NewBirpcServer()
+	srv.Register(Depths{})
+	c1, c2 := net.Pipe()
+	go srv.ServeCodec(NewJSONBirpcCodec(c2))
+	clt := birpc.NewBirpcClientWithCodec(NewJSONBirpcCodec(c1))
+	defer clt.Close()
+	clt.Register(Depths{})
+
+	var depth int
+	if err := clt.Call(context.Background(), "Depths.Get", 3, &depth); err != nil {
+		t.Fatal(err)
+	}
+	if depth != 3 {
+		t.Errorf("expected depth 3, got %d", depth)
+	}
+}
+
+func TestWebsocket(t *testing.T) {
+	srv := birpc.NewBirpcServer()
+	number := make(chan int, 1)
+	srv.Register(&Airth2{number: number})
+	ts := httptest.NewServer(NewWebsocketHandler(srv))
+	defer ts.Close()
+
+	clt, err := DialWebsocket(context.Background(), "ws"+strings.TrimPrefix(ts.URL, "http")+"/birpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clt.Close()
+	clt.Register(&Airth2{number: number})
+
+	// Add calls back Mult on the client
+	var rep Reply2
+	if err = clt.Call(context.Background(), "Airth2.Add", Args{1, 2}, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep != 3 {
+		t.Fatalf("not expected: %d", rep)
+	}
+}
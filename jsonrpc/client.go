@@ -4,15 +4,18 @@
 
 // Package jsonrpc implements a JSON-RPC 1.0 ClientCodec and ServerCodec
 // for the rpc package.
-// For JSON-RPC 2.0 support, see https://godoc.org/?q=json-rpc+2.0
+// For JSON-RPC 2.0, see package jsonrpc2.
 package jsonrpc
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cgrates/birpc"
 )
@@ -21,6 +24,7 @@ type clientCodec struct {
 	dec *json.Decoder // for reading JSON values
 	enc *json.Encoder // for writing JSON values
 	c   io.Closer
+	cw  *countingWriter
 
 	// temporary work space
 	req  clientRequest
@@ -36,18 +40,59 @@ type clientCodec struct {
 
 // NewClientCodec returns a new rpc.ClientCodec using JSON-RPC on conn.
 func NewClientCodec(conn io.ReadWriteCloser) birpc.ClientCodec {
+	cw := &countingWriter{w: conn}
 	return &clientCodec{
 		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
+		enc:     json.NewEncoder(cw),
 		c:       conn,
+		cw:      cw,
 		pending: make(map[uint64]string),
 	}
 }
 
+// BytesWritten implements birpc.MessageSizer.
+func (c *clientCodec) BytesWritten() int64 { return atomic.LoadInt64(&c.cw.n) }
+
+// BytesRead implements birpc.MessageSizer.
+func (c *clientCodec) BytesRead() int64 { return c.dec.InputOffset() }
+
+// SetWriteDeadline sets the write deadline of the connection, letting the
+// client bound the writes by the context of the calls.
+func (c *clientCodec) SetWriteDeadline(t time.Time) error {
+	return setWriteDeadline(c.c, t)
+}
+
+var errNoWriteDeadline = errors.New("jsonrpc: connection does not support write deadlines")
+
+func setWriteDeadline(conn io.Closer, t time.Time) error {
+	if wd, ok := conn.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return wd.SetWriteDeadline(t)
+	}
+	return errNoWriteDeadline
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	n int64 // first, for its atomic ops to be aligned on 32-bit platforms
+	w io.Writer
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return
+}
+
 type clientRequest struct {
-	Method string         `json:"method"`
-	Params [1]interface{} `json:"params"`
-	Id     uint64         `json:"id"`
+	Method   string            `json:"method"`
+	Params   [1]interface{}    `json:"params"`
+	Id       uint64            `json:"id"`
+	Depth    int               `json:"depth,omitempty"`
+	Fields   []string          `json:"fields,omitempty"`
+	Item     bool              `json:"item,omitempty"`
+	End      bool              `json:"end,omitempty"`
+	Timeout  time.Duration     `json:"timeout,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func (c *clientCodec) WriteRequest(r *birpc.Request, param interface{}) error {
@@ -57,19 +102,41 @@ func (c *clientCodec) WriteRequest(r *birpc.Request, param interface{}) error {
 	c.req.Method = r.ServiceMethod
 	c.req.Params[0] = param
 	c.req.Id = r.Seq
+	c.req.Depth = r.Depth
+	c.req.Fields = r.Fields
+	c.req.Item = r.Item
+	c.req.End = r.End
+	c.req.Timeout = r.Timeout
+	c.req.Metadata = r.Metadata
 	return c.enc.Encode(&c.req)
 }
 
 type clientResponse struct {
-	Id     uint64           `json:"id"`
-	Result *json.RawMessage `json:"result"`
-	Error  interface{}      `json:"error"`
+	Id       uint64            `json:"id"`
+	Result   *json.RawMessage  `json:"result"`
+	Error    interface{}       `json:"error"`
+	Checksum string            `json:"checksum,omitempty"`
+	More     bool              `json:"more,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	GoAway   bool              `json:"goaway,omitempty"`
+	Code     int               `json:"code,omitempty"`
+	Detail   *json.RawMessage  `json:"detail,omitempty"`
+	// DetailType is the name of the type of Detail, see
+	// birpc.RegisterErrorDetail.
+	DetailType string `json:"detail_type,omitempty"`
 }
 
 func (r *clientResponse) reset() {
 	r.Id = 0
 	r.Result = nil
 	r.Error = nil
+	r.Checksum = ""
+	r.More = false
+	r.Metadata = nil
+	r.GoAway = false
+	r.Code = 0
+	r.Detail = nil
+	r.DetailType = ""
 }
 
 func (c *clientCodec) ReadResponseHeader(r *birpc.Response) error {
@@ -78,12 +145,21 @@ func (c *clientCodec) ReadResponseHeader(r *birpc.Response) error {
 		return err
 	}
 
-	c.mutex.Lock()
-	delete(c.pending, c.resp.Id)
-	c.mutex.Unlock()
+	if !c.resp.More {
+		c.mutex.Lock()
+		delete(c.pending, c.resp.Id)
+		c.mutex.Unlock()
+	}
 
 	r.Error = ""
 	r.Seq = c.resp.Id
+	r.Checksum = c.resp.Checksum
+	r.More = c.resp.More
+	r.Metadata = c.resp.Metadata
+	r.GoAway = c.resp.GoAway
+	r.Code = c.resp.Code
+	r.Detail = c.resp.Detail != nil
+	r.DetailType = c.resp.DetailType
 	if c.resp.Error != nil || c.resp.Result == nil {
 		x, ok := c.resp.Error.(string)
 		if !ok {
@@ -104,6 +180,25 @@ func (c *clientCodec) ReadResponseBody(x interface{}) error {
 	return json.Unmarshal(*c.resp.Result, x)
 }
 
+// ReadRawResponseBody keeps the JSON result for a birpc.RawReply, or the
+// detail of the error.
+func (c *clientCodec) ReadRawResponseBody(raw *birpc.RawReply) error {
+	if c.resp.Detail != nil {
+		return readRaw(*c.resp.Detail, raw)
+	}
+	return readRaw(*c.resp.Result, raw)
+}
+
+// readRaw copies result into raw, as the decoder reuses its buffer.
+func readRaw(result json.RawMessage, raw *birpc.RawReply) error {
+	*raw = birpc.RawReply{
+		Format:    "json",
+		Data:      append([]byte(nil), result...),
+		Unmarshal: json.Unmarshal,
+	}
+	return nil
+}
+
 func (c *clientCodec) Close() error {
 	return c.c.Close()
 }
@@ -5,10 +5,14 @@
 package jsonrpc
 
 import (
+	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/cgrates/birpc"
 )
@@ -17,7 +21,7 @@ var errMissingParams = errors.New("jsonrpc: request body missing params")
 
 type serverCodec struct {
 	dec *json.Decoder // for reading JSON values
-	enc *json.Encoder // for writing JSON values
+	w   io.Writer     // for writing the encoded responses
 	c   io.Closer
 
 	// temporary work space
@@ -38,28 +42,49 @@ type serverCodec struct {
 func NewServerCodec(conn io.ReadWriteCloser) birpc.ServerCodec {
 	return &serverCodec{
 		dec:     json.NewDecoder(conn),
-		enc:     json.NewEncoder(conn),
+		w:       conn,
 		c:       conn,
 		pending: make(map[uint64]*json.RawMessage),
 	}
 }
 
 type serverRequest struct {
-	Method string           `json:"method"`
-	Params *json.RawMessage `json:"params"`
-	Id     *json.RawMessage `json:"id"`
+	Method   string            `json:"method"`
+	Params   *json.RawMessage  `json:"params"`
+	Id       *json.RawMessage  `json:"id"`
+	Depth    int               `json:"depth,omitempty"`
+	Fields   []string          `json:"fields,omitempty"`
+	Item     bool              `json:"item,omitempty"`
+	End      bool              `json:"end,omitempty"`
+	Timeout  time.Duration     `json:"timeout,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 func (r *serverRequest) reset() {
 	r.Method = ""
 	r.Params = nil
 	r.Id = nil
+	r.Depth = 0
+	r.Fields = nil
+	r.Item = false
+	r.End = false
+	r.Timeout = 0
+	r.Metadata = nil
 }
 
 type serverResponse struct {
-	Id     *json.RawMessage `json:"id"`
-	Result interface{}      `json:"result"`
-	Error  interface{}      `json:"error"`
+	Id       *json.RawMessage  `json:"id"`
+	Result   interface{}       `json:"result"`
+	Error    interface{}       `json:"error"`
+	Checksum string            `json:"checksum,omitempty"`
+	More     bool              `json:"more,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	GoAway   bool              `json:"goaway,omitempty"`
+	Code     int               `json:"code,omitempty"`
+	Detail   interface{}       `json:"detail,omitempty"`
+	// DetailType is the name of the type of Detail, see
+	// birpc.RegisterErrorDetail.
+	DetailType string `json:"detail_type,omitempty"`
 }
 
 func (c *serverCodec) ReadRequestHeader(r *birpc.Request) error {
@@ -68,11 +93,24 @@ func (c *serverCodec) ReadRequestHeader(r *birpc.Request) error {
 		return err
 	}
 	r.ServiceMethod = c.req.Method
+	r.Depth = c.req.Depth
+	r.Fields = c.req.Fields
+	r.Item = c.req.Item
+	r.End = c.req.End
+	r.Timeout = c.req.Timeout
+	r.Metadata = c.req.Metadata
 
 	// JSON request id can be any JSON value;
 	// RPC package expects uint64.  Translate to
 	// internal uint64 and save JSON on the side.
 	c.mutex.Lock()
+	if r.Item || r.End {
+		// the items of an upload are sent with the id of its call
+		r.Seq = uploadSeq(c.pending, c.req.Id)
+		c.req.Id = nil
+		c.mutex.Unlock()
+		return nil
+	}
 	c.seq++
 	c.pending[c.seq] = c.req.Id
 	c.req.Id = nil
@@ -100,36 +138,122 @@ func (c *serverCodec) ReadRequestBody(x interface{}) error {
 
 var null = json.RawMessage([]byte("null"))
 
+// zero is the id of the GoAway of the birpc codec, which the birpc peers
+// never give their calls.
+var zero = json.RawMessage([]byte("0"))
+
 func (c *serverCodec) WriteResponse(r *birpc.Response, x interface{}) error {
-	c.mutex.Lock()
-	b, ok := c.pending[r.Seq]
+	data, err := c.EncodeResponse(r, x)
+	if err != nil {
+		return err
+	}
+	return c.WriteEncodedResponse(data)
+}
+
+// EncodeResponse implements birpc.ResponseEncoder. The GoAway is not sent:
+// the JSON-RPC clients may number their calls from 0 and take it for the
+// reply to the call of any id it is given.
+func (c *serverCodec) EncodeResponse(r *birpc.Response, x interface{}) ([]byte, error) {
+	if r.GoAway {
+		return nil, nil
+	}
+	return encodeResponse(&c.mutex, c.pending, r, x)
+}
+
+// WriteEncodedResponse implements birpc.ResponseEncoder.
+func (c *serverCodec) WriteEncodedResponse(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	_, err := c.w.Write(data)
+	return err
+}
+
+// encodeResponse encodes the response to the request whose id was saved
+// in pending, forgetting the id once the response is encoded, unless more
+// responses follow for a streaming call.
+func encodeResponse(mu *sync.Mutex, pending map[uint64]*json.RawMessage, r *birpc.Response, x interface{}) ([]byte, error) {
+	if r.GoAway {
+		data, err := json.Marshal(serverResponse{Id: &zero, Result: x, GoAway: true})
+		return append(data, '\n'), err
+	}
+	mu.Lock()
+	b, ok := pending[r.Seq]
+	mu.Unlock()
 	if !ok {
-		c.mutex.Unlock()
-		return errors.New("invalid sequence number in response")
+		return nil, errors.New("invalid sequence number in response")
 	}
-	delete(c.pending, r.Seq)
-	c.mutex.Unlock()
 
 	if b == nil {
 		// Invalid request so no id. Use JSON null.
 		b = &null
 	}
-	resp := serverResponse{Id: b}
+	resp := serverResponse{Id: b, Checksum: r.Checksum, More: r.More, Metadata: r.Metadata}
 	if r.Error == "" {
 		resp.Result = x
 	} else {
-		resp.Error = r.Error
+		resp.Error, resp.Code = r.Error, r.Code
+		if r.Detail {
+			resp.Detail, resp.DetailType = x, r.DetailType
+		}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
 	}
-	return c.enc.Encode(resp)
+	if !r.More {
+		mu.Lock()
+		delete(pending, r.Seq)
+		mu.Unlock()
+	}
+	return append(data, '\n'), nil
+}
+
+// uploadSeq returns the sequence number of the call with the JSON id, or
+// zero if it is not pending.
+func uploadSeq(pending map[uint64]*json.RawMessage, id *json.RawMessage) uint64 {
+	if id == nil {
+		return 0
+	}
+	for seq, b := range pending {
+		if b != nil && bytes.Equal(*b, *id) {
+			return seq
+		}
+	}
+	return 0
 }
 
 func (c *serverCodec) Close() error {
 	return c.c.Close()
 }
 
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *serverCodec) RemoteAddr() net.Addr {
+	if conn, ok := c.c.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *serverCodec) TLSConnectionState() *tls.ConnectionState {
+	return birpc.ConnTLSState(c.c)
+}
+
 // ServeConn runs the JSON-RPC server on a single connection.
 // ServeConn blocks, serving the connection until the client hangs up.
 // The caller typically invokes ServeConn in a go statement.
 func ServeConn(conn io.ReadWriteCloser) {
 	birpc.ServeCodec(NewServerCodec(conn))
 }
+
+// Raw encodes the arguments and replies of birpc.DispatchRaw as JSON.
+var Raw = birpc.RawCodec{Marshal: json.Marshal, Unmarshal: json.Unmarshal}
+
+func init() {
+	birpc.RegisterServerCodec("json", NewServerCodec)
+	birpc.RegisterClientCodec("json", NewClientCodec)
+	birpc.RegisterBirpcCodec("json", NewJSONBirpcCodec)
+}
@@ -0,0 +1,34 @@
+package jsonrpc
+
+import (
+	"net/http"
+
+	"github.com/cgrates/birpc"
+	"github.com/cgrates/birpc/context"
+)
+
+// NewWebsocketHandler returns a handler serving the WebSocket connections
+// with server using the JSON codec, for the clients reaching it through
+// browsers, proxies and load balancers passing only HTTP. The server may
+// call back the clients as on any other connection. The Origin of the
+// requests is not checked, see birpc.UpgradeWebsocket.
+func NewWebsocketHandler(server *birpc.BirpcServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := birpc.UpgradeWebsocket(w, r)
+		if err != nil {
+			return
+		}
+		server.ServeCodec(NewJSONBirpcCodec(conn))
+	})
+}
+
+// DialWebsocket connects to the WebSocket endpoint at rawurl, such as
+// "wss://host/birpc", served by NewWebsocketHandler, and returns a
+// BirpcClient using the JSON codec.
+func DialWebsocket(ctx *context.Context, rawurl string, opts ...birpc.ServerOption) (*birpc.BirpcClient, error) {
+	conn, err := birpc.DialWebsocketConn(ctx, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	return birpc.NewBirpcClientWithCodec(NewJSONBirpcCodec(conn), opts...), nil
+}
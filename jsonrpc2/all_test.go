@@ -0,0 +1,188 @@
+package jsonrpc2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc"
+	"github.com/cgrates/birpc/context"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith int
+
+func (t *Arith) Add(ctx *context.Context, args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (t *Arith) Neg(ctx *context.Context, n int, reply *int) error {
+	*reply = -n
+	return nil
+}
+
+func (t *Arith) Div(ctx *context.Context, args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+// codeNegativeDivisor is in the range reserved by the protocol, for it to
+// be sent in the "code" member.
+const codeNegativeDivisor = -32001
+
+func (t *Arith) Mod(ctx *context.Context, args *Args, reply *int) error {
+	switch {
+	case args.B == 0:
+		return &birpc.Error{Code: birpc.CodeInvalidArgument, Message: "divide by zero", Details: *args}
+	case args.B < 0:
+		return birpc.WithErrorCode(errors.New("negative divisor"), codeNegativeDivisor)
+	case args.A > 1000:
+		return fmt.Errorf("dividing %d: %w", args.A, Overflow{Max: 1000})
+	}
+	*reply = args.A % args.B
+	return nil
+}
+
+func newServer(t *testing.T) net.Conn {
+	server := birpc.NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestServer(t *testing.T) {
+	conn := newServer(t)
+	r := bufio.NewReader(conn)
+	for _, tc := range []struct{ req, resp string }{
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2},"id":1}`,
+			`{"jsonrpc":"2.0","result":3,"id":1}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":[{"A":1,"B":2}],"id":"a"}`,
+			`{"jsonrpc":"2.0","result":3,"id":"a"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Neg","params":[5],"id":2}`,
+			`{"jsonrpc":"2.0","result":-5,"id":2}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Div","params":{"A":1},"id":3}`,
+			`{"jsonrpc":"2.0","error":{"code":-32000,"message":"divide by zero"},"id":3}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Mul","params":{},"id":4}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found","data":"rpc: can't find method Arith.Mul"},"id":4}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Neg","params":{"A":1},"id":5}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"invalid params","data":"json: cannot unmarshal object into Go value of type int"},"id":5}`},
+		{`{"method":"Arith.Neg","params":[1],"id":6}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":6}`},
+		// the notification is not answered
+		{`{"jsonrpc":"2.0","method":"Arith.Neg","params":[1]}` + "\n" +
+			`{"jsonrpc":"2.0","method":"Arith.Neg","params":[7],"id":7}`,
+			`{"jsonrpc":"2.0","result":-7,"id":7}`},
+		{`[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"empty batch"},"id":null}`},
+		{`[1]`,
+			`[{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}]`},
+	} {
+		if _, err := conn.Write([]byte(tc.req + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != tc.resp+"\n" {
+			t.Errorf("%s:\nexpected %s\ngot      %s", tc.req, tc.resp, line)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	conn := newServer(t)
+	r := bufio.NewReader(conn)
+	conn.Write([]byte(`[
+		{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2},"id":1},
+		{"jsonrpc":"2.0","method":"Arith.Neg","params":[1]},
+		{"jsonrpc":"2.0","method":"Arith.Div","params":{"A":1},"id":2},
+		{"foo":"boo"}
+	]`))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the responses come in the order the calls returned
+	for _, resp := range []string{
+		`{"jsonrpc":"2.0","result":3,"id":1}`,
+		`{"jsonrpc":"2.0","error":{"code":-32000,"message":"divide by zero"},"id":2}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`,
+	} {
+		if !strings.Contains(line, resp) {
+			t.Errorf("expected %s in the batch response %s", resp, line)
+		}
+	}
+
+	// a batch of notifications is not answered
+	conn.Write([]byte(`[{"jsonrpc":"2.0","method":"Arith.Neg","params":[1]}]` + "\n" +
+		`{"jsonrpc":"2.0","method":"Arith.Neg","params":[3],"id":3}` + "\n"))
+	if line, err = r.ReadString('\n'); err != nil || line != `{"jsonrpc":"2.0","result":-3,"id":3}`+"\n" {
+		t.Errorf("unexpected response %s: %v", line, err)
+	}
+
+	conn.Write([]byte(`{"jsonrpc":}` + "\n"))
+	if line, err = r.ReadString('\n'); err != nil || line != `{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`+"\n" {
+		t.Errorf("unexpected response %s: %v", line, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	client := NewClient(newServer(t))
+	var reply int
+	if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, &reply); err != nil || reply != 15 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+	if err := client.Call(context.Background(), "Arith.Neg", 3, &reply); err != nil || reply != -3 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+	if err := client.Call(context.Background(), "Arith.Div", &Args{7, 0}, &reply); err != birpc.ServerError("divide by zero") {
+		t.Errorf("expected the error of the method, got %v", err)
+	}
+	if err := client.Call(context.Background(), "Arith.Mul", &Args{7, 0}, &reply); err != birpc.ServerError("method not found") {
+		t.Errorf("expected method not found, got %v", err)
+	}
+}
+
+type Overflow struct {
+	Max int
+}
+
+func (e Overflow) Error() string { return "overflow" }
+
+func TestError(t *testing.T) {
+	birpc.RegisterErrorDetail("Overflow", Overflow{})
+	client := NewClient(newServer(t))
+	var reply int
+	err := client.Call(context.Background(), "Arith.Mod", &Args{7, 0}, &reply)
+	if birpc.ErrorCode(err) != birpc.CodeInvalidArgument || err.Error() != "divide by zero" {
+		t.Errorf("expected an invalid argument, got %#v", err)
+	}
+	if details, ok := birpc.ErrorDetail[Args](err); !ok || details != (Args{7, 0}) {
+		t.Errorf("unexpected details %+v", details)
+	}
+	err = client.Call(context.Background(), "Arith.Mod", &Args{7, -2}, &reply)
+	if birpc.ErrorCode(err) != codeNegativeDivisor || err.Error() != "negative divisor" {
+		t.Errorf("expected the code of the error, got %#v", err)
+	}
+	var overflow Overflow
+	err = client.Call(context.Background(), "Arith.Mod", &Args{1001, 2}, &reply)
+	if !errors.As(err, &overflow) || overflow.Max != 1000 {
+		t.Errorf("expected the overflow, got %#v", err)
+	}
+	if err = client.Call(context.Background(), "Arith.Mod", &Args{7, 2}, &reply); err != nil || reply != 1 {
+		t.Errorf("unexpected reply %v: %v", reply, err)
+	}
+}
@@ -0,0 +1,200 @@
+// Package jsonrpc2 implements a JSON-RPC 2.0 ClientCodec and ServerCodec
+// for the rpc package, interoperating with the standard JSON-RPC clients
+// and servers.
+//
+// The server reads the batches, answering them with a batch once all of
+// their requests are answered, and the notifications, calling their
+// methods without answering. The params are decoded into the argument of
+// the methods: the objects as they are, and the arrays holding a single
+// value as that value. The client sends the arguments encoded as objects
+// as they are, and the others in an array. The metadata of the calls, see
+// birpc.Metadata, go in a "metadata" member of the requests and of the
+// responses, an extension of the protocol sent only when they are set.
+//
+// The errors returned by the methods with a code, see birpc.Error, are
+// sent with that code, and with their details in the data. The codes
+// reserved by the protocol go in a "code" member of the responses instead,
+// the error having CodeServerError, and the names of the types of the
+// details, see birpc.RegisterErrorDetail, in a "detail_type" member. The
+// client takes the codes out of the reserved range for the ones of
+// birpc.Error, so the errors of the other servers keep their codes too.
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cgrates/birpc"
+)
+
+// The error codes defined by JSON-RPC 2.0. The errors returned by the
+// methods are sent with CodeServerError.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeServerError    = -32000
+)
+
+// Error is the error object of a JSON-RPC 2.0 response.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type clientCodec struct {
+	dec *json.Decoder // for reading JSON values
+	enc *json.Encoder // for writing JSON values
+	c   io.Closer
+
+	// temporary work space, used by the reading goroutine
+	queue []json.RawMessage // responses of the batch being read
+	resp  clientResponse
+
+	mutex sync.Mutex // protects req
+	req   clientRequest
+}
+
+// NewClientCodec returns a new birpc.ClientCodec using JSON-RPC 2.0 on conn.
+func NewClientCodec(conn io.ReadWriteCloser) birpc.ClientCodec {
+	return &clientCodec{
+		dec: json.NewDecoder(conn),
+		enc: json.NewEncoder(conn),
+		c:   conn,
+	}
+}
+
+type clientRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      uint64          `json:"id"`
+	// Metadata extends the protocol, see birpc.Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (c *clientCodec) WriteRequest(r *birpc.Request, param interface{}) error {
+	params, err := json.Marshal(param)
+	if err != nil {
+		return err
+	}
+	if params = bytes.TrimSpace(params); params[0] != '{' {
+		// the params must be structured, holding a single value
+		params = append(append([]byte{'['}, params...), ']')
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.req = clientRequest{Version: "2.0", Method: r.ServiceMethod, Params: params, Id: r.Seq, Metadata: r.Metadata}
+	return c.enc.Encode(&c.req)
+}
+
+type clientResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+	Id      json.RawMessage `json:"id"`
+	// Metadata extends the protocol, see birpc.Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Code extends the protocol, see birpc.WithErrorCode.
+	Code int `json:"code,omitempty"`
+	// DetailType extends the protocol, see birpc.RegisterErrorDetail.
+	DetailType string `json:"detail_type,omitempty"`
+}
+
+func (c *clientCodec) ReadResponseHeader(r *birpc.Response) error {
+	if len(c.queue) == 0 {
+		var msg json.RawMessage
+		if err := c.dec.Decode(&msg); err != nil {
+			return err
+		}
+		c.queue = append(c.queue[:0], msg)
+		if msg = bytes.TrimSpace(msg); len(msg) != 0 && msg[0] == '[' {
+			c.queue = c.queue[:0]
+			if err := json.Unmarshal(msg, &c.queue); err != nil || len(c.queue) == 0 {
+				return fmt.Errorf("jsonrpc2: invalid batch %s", msg)
+			}
+		}
+	}
+	msg := c.queue[0]
+	c.queue = c.queue[1:]
+	c.resp = clientResponse{}
+	if err := json.Unmarshal(msg, &c.resp); err != nil {
+		return err
+	}
+	r.Error = ""
+	r.Seq = 0
+	r.Metadata = c.resp.Metadata
+	r.Code = 0
+	r.Detail = false
+	r.DetailType = c.resp.DetailType
+	if !bytes.Equal(c.resp.Id, null) {
+		// the errors answering unreadable requests have a null id, and
+		// no pending call
+		if err := json.Unmarshal(c.resp.Id, &r.Seq); err != nil {
+			return fmt.Errorf("jsonrpc2: invalid id %s", c.resp.Id)
+		}
+	}
+	if c.resp.Error != nil {
+		r.Error = c.resp.Error.Message
+		if r.Error == "" {
+			r.Error = "unspecified error"
+		}
+		code := c.resp.Error.Code
+		if !reservedCode(code) {
+			r.Code = code
+		} else if code == CodeServerError {
+			r.Code = c.resp.Code
+		}
+		// the data of the errors of the protocol are not details
+		r.Detail = len(c.resp.Error.Data) != 0 && (code == CodeServerError || !reservedCode(code))
+	}
+	return nil
+}
+
+func (c *clientCodec) ReadResponseBody(x interface{}) error {
+	if x == nil || len(c.resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(c.resp.Result, x)
+}
+
+// ReadRawResponseBody keeps the JSON result for a birpc.RawReply, or the
+// data of the error.
+func (c *clientCodec) ReadRawResponseBody(raw *birpc.RawReply) error {
+	data := c.resp.Result
+	if c.resp.Error != nil {
+		data = c.resp.Error.Data
+	}
+	*raw = birpc.RawReply{Format: "json", Data: data, Unmarshal: json.Unmarshal}
+	return nil
+}
+
+func (c *clientCodec) Close() error {
+	return c.c.Close()
+}
+
+// NewClient returns a new birpc.Client to handle requests to the
+// set of services at the other end of the connection.
+func NewClient(conn io.ReadWriteCloser) *birpc.Client {
+	return birpc.NewClientWithCodec(NewClientCodec(conn))
+}
+
+// Dial connects to a JSON-RPC 2.0 server at the specified network address.
+func Dial(network, address string) (*birpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), err
+}
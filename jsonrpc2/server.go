@@ -0,0 +1,262 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/cgrates/birpc"
+)
+
+var errInvalidSeq = errors.New("jsonrpc2: invalid sequence number in response")
+
+type serverCodec struct {
+	dec *json.Decoder // for reading JSON values
+	w   io.Writer
+	c   io.Closer
+
+	// temporary work space, used by the reading goroutine
+	queue  []json.RawMessage // requests of the batch being read
+	batch  *batch
+	req    serverRequest
+	cur    *pendingRequest
+	params json.RawMessage
+
+	// The JSON-RPC ids are kept in pending by the sequence numbers given
+	// to the requests, along with the batches they are part of.
+	mutex   sync.Mutex // protects seq, pending and the writes
+	seq     uint64
+	pending map[uint64]*pendingRequest
+}
+
+type pendingRequest struct {
+	id            json.RawMessage // empty for notifications
+	batch         *batch
+	invalidParams bool
+}
+
+// batch collects the responses to the requests of a batch, sent together
+// once all of them are answered.
+type batch struct {
+	remaining int
+	resps     []json.RawMessage
+}
+
+// NewServerCodec returns a new birpc.ServerCodec using JSON-RPC 2.0 on conn.
+func NewServerCodec(conn io.ReadWriteCloser) birpc.ServerCodec {
+	return &serverCodec{
+		dec:     json.NewDecoder(conn),
+		w:       conn,
+		c:       conn,
+		pending: make(map[uint64]*pendingRequest),
+	}
+}
+
+type serverRequest struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Id      json.RawMessage `json:"id"`
+	// Metadata extends the protocol, see birpc.Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type serverResponse struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Id      json.RawMessage `json:"id"`
+	// Metadata extends the protocol, see birpc.Metadata.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Code extends the protocol, see birpc.WithErrorCode.
+	Code int `json:"code,omitempty"`
+	// DetailType extends the protocol, see birpc.RegisterErrorDetail.
+	DetailType string `json:"detail_type,omitempty"`
+}
+
+func (c *serverCodec) ReadRequestHeader(r *birpc.Request) error {
+	for {
+		if len(c.queue) == 0 {
+			var msg json.RawMessage
+			if err := c.dec.Decode(&msg); err != nil {
+				if _, ok := err.(*json.SyntaxError); ok {
+					// the connection cannot be read further
+					c.reply(&pendingRequest{id: null}, &Error{Code: CodeParseError, Message: "parse error"})
+				}
+				return err
+			}
+			c.batch = nil
+			c.queue = append(c.queue[:0], msg)
+			if msg = bytes.TrimSpace(msg); len(msg) != 0 && msg[0] == '[' {
+				c.queue = c.queue[:0]
+				json.Unmarshal(msg, &c.queue)
+				if len(c.queue) == 0 {
+					c.reply(&pendingRequest{id: null}, &Error{Code: CodeInvalidRequest, Message: "empty batch"})
+					continue
+				}
+				c.batch = &batch{remaining: len(c.queue)}
+			}
+		}
+		msg := c.queue[0]
+		c.queue = c.queue[1:]
+		c.req = serverRequest{}
+		if err := json.Unmarshal(msg, &c.req); err != nil || c.req.Version != "2.0" || c.req.Method == "" {
+			// answered even without id, which could not be read
+			id := c.req.Id
+			if len(id) == 0 {
+				id = null
+			}
+			c.reply(&pendingRequest{id: id, batch: c.batch}, &Error{Code: CodeInvalidRequest, Message: "invalid request"})
+			continue
+		}
+		c.cur = &pendingRequest{id: c.req.Id, batch: c.batch}
+		c.params = c.req.Params
+		c.mutex.Lock()
+		c.seq++
+		c.pending[c.seq] = c.cur
+		r.Seq = c.seq
+		c.mutex.Unlock()
+		r.ServiceMethod = c.req.Method
+		r.Metadata = c.req.Metadata
+		return nil
+	}
+}
+
+func (c *serverCodec) ReadRequestBody(x interface{}) error {
+	if x == nil || len(c.params) == 0 {
+		return nil
+	}
+	if err := unmarshalParams(c.params, x); err != nil {
+		c.cur.invalidParams = true
+		return err
+	}
+	return nil
+}
+
+// unmarshalParams decodes params into x: the objects as they are, and the
+// arrays holding a single value as that value if it fits.
+func unmarshalParams(params json.RawMessage, x interface{}) error {
+	if params[0] == '[' {
+		var values []json.RawMessage
+		if err := json.Unmarshal(params, &values); err == nil && len(values) == 1 &&
+			json.Unmarshal(values[0], x) == nil {
+			return nil
+		}
+	}
+	return json.Unmarshal(params, x)
+}
+
+func (c *serverCodec) WriteResponse(r *birpc.Response, x interface{}) error {
+	c.mutex.Lock()
+	req, ok := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mutex.Unlock()
+	if !ok {
+		return errInvalidSeq
+	}
+	if r.Error != "" {
+		resp := serverResponse{Error: responseError(req, r.Error), Metadata: r.Metadata}
+		if resp.Error.Code == CodeServerError {
+			resp.Error.Code, resp.Code = errorCode(r.Code)
+			if r.Detail {
+				if data, err := json.Marshal(x); err == nil {
+					resp.Error.Data, resp.DetailType = data, r.DetailType
+				}
+			}
+		}
+		return c.write(req, resp)
+	}
+	result, err := json.Marshal(x)
+	if err != nil {
+		return c.reply(req, &Error{Code: CodeInternalError, Message: "encoding result: " + err.Error()})
+	}
+	return c.write(req, serverResponse{Result: result, Metadata: r.Metadata})
+}
+
+// responseError returns the error object of the error message of a
+// response, with the message in its data for the errors of the protocol.
+func responseError(req *pendingRequest, msg string) *Error {
+	switch {
+	case req.invalidParams:
+		return &Error{Code: CodeInvalidParams, Message: "invalid params", Data: errorData(msg)}
+	case strings.HasPrefix(msg, "rpc: can't find "),
+		strings.HasPrefix(msg, "rpc: service/method request ill-formed"):
+		return &Error{Code: CodeMethodNotFound, Message: "method not found", Data: errorData(msg)}
+	}
+	return &Error{Code: CodeServerError, Message: msg}
+}
+
+// errorCode returns the error code of the code of a response, see
+// birpc.Error, and the code going in the "code" member when none or
+// reserved by the protocol.
+func errorCode(code int) (int, int) {
+	if code != 0 && !reservedCode(code) {
+		return code, 0
+	}
+	return CodeServerError, code
+}
+
+// reservedCode reports whether code is reserved by JSON-RPC 2.0.
+func reservedCode(code int) bool {
+	return code >= -32768 && code <= -32000
+}
+
+func errorData(msg string) json.RawMessage {
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+// reply answers req with err.
+func (c *serverCodec) reply(req *pendingRequest, err *Error) error {
+	return c.write(req, serverResponse{Error: err})
+}
+
+var null = json.RawMessage("null")
+
+// write writes the response to req, unless it is a notification, or adds
+// it to the batch of req, writing the batch once complete.
+func (c *serverCodec) write(req *pendingRequest, resp serverResponse) error {
+	var data []byte
+	if len(req.id) != 0 {
+		resp.Version, resp.Id = "2.0", req.id
+		var err error
+		if data, err = json.Marshal(resp); err != nil {
+			return err
+		}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if b := req.batch; b != nil {
+		if data != nil {
+			b.resps = append(b.resps, data)
+		}
+		if b.remaining--; b.remaining != 0 || len(b.resps) == 0 {
+			return nil
+		}
+		data, _ = json.Marshal(b.resps)
+	}
+	if data == nil {
+		return nil // a notification
+	}
+	_, err := c.w.Write(append(data, '\n'))
+	return err
+}
+
+func (c *serverCodec) Close() error {
+	return c.c.Close()
+}
+
+// ServeConn runs the JSON-RPC 2.0 server on a single connection.
+// ServeConn blocks, serving the connection until the client hangs up.
+// The caller typically invokes ServeConn in a go statement.
+func ServeConn(conn io.ReadWriteCloser) {
+	birpc.ServeCodec(NewServerCodec(conn))
+}
+
+func init() {
+	birpc.RegisterServerCodec("jsonrpc2", NewServerCodec)
+	birpc.RegisterClientCodec("jsonrpc2", NewClientCodec)
+}
@@ -0,0 +1,272 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrLinkRejected is returned by the dials of Mesh refused by the remote
+// node, already linked with the local one.
+var ErrLinkRejected = errors.New("rpc: link rejected by the remote node")
+
+const (
+	meshHello     = "birpc-mesh "
+	meshAccepted  = "ok"
+	meshRejected  = "no"
+	meshHandshake = 5 * time.Second // bound of the handshakes
+)
+
+// the delays between the dials of a link, doubled after each failure
+var (
+	meshMinRetry = 50 * time.Millisecond
+	meshMaxRetry = 5 * time.Second
+)
+
+// Mesh keeps the links of a node with the other nodes, each link being a
+// Peer. The nodes dial each other, the link being established by the
+// first dial accepted, and dial again once it is down.
+//
+// Both ends may dial at the same time, before any of them learns about
+// the other's dial. The tie is broken by the IDs of the nodes, so that
+// exactly one connection survives: each node rejects the dials coming
+// while it has a link with the dialing node, or while its own dial is
+// pending and its ID is the smaller one.
+type Mesh struct {
+	id       string
+	register func(*Peer) error
+	opts     []ServerOption
+
+	mu     sync.Mutex
+	links  map[string]*meshLink
+	closed bool
+	quit   chan struct{}
+
+	// the liveness subsystem, see Gossip
+	gossip    *Service // nil unless enabled
+	timeout   time.Duration
+	heartbeat uint64
+	health    map[string]*meshHealth
+}
+
+type meshLink struct {
+	peer    *Peer // nil while down
+	dialing bool  // a dial of the local node waits for the answer
+}
+
+// NewMesh returns the Mesh of the node id. The Peers of its links are
+// created with the given options, their services registered by register
+// before they are started.
+func NewMesh(id string, register func(*Peer) error, opts ...ServerOption) *Mesh {
+	return &Mesh{
+		id:       id,
+		register: register,
+		opts:     opts,
+		links:    make(map[string]*meshLink),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Peer returns the Peer linked with the node id, nil while there is none.
+func (m *Mesh) Peer(id string) *Peer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l := m.links[id]; l != nil {
+		return l.peer
+	}
+	return nil
+}
+
+func (m *Mesh) link(id string) *meshLink {
+	l := m.links[id]
+	if l == nil {
+		l = new(meshLink)
+		m.links[id] = l
+	}
+	return l
+}
+
+// Connect keeps the node id, listening on address, linked with the local
+// one until the Mesh is closed. It dials whenever there is no link, waiting
+// longer after each failed dial.
+func (m *Mesh) Connect(id, network, address string) {
+	go func() {
+		retry := meshMinRetry
+		for {
+			peer, err := m.dial(id, network, address)
+			if err == ErrShutdown {
+				return
+			}
+			if peer != nil {
+				retry = meshMinRetry
+				select {
+				case <-peer.Done():
+				case <-m.quit:
+					return
+				}
+				continue
+			}
+			debugln("rpc: mesh dialing", id+":", err)
+			select {
+			case <-time.After(retry):
+			case <-m.quit:
+				return
+			}
+			if retry *= 2; retry > meshMaxRetry {
+				retry = meshMaxRetry
+			}
+		}
+	}()
+}
+
+// dial links with the node id, returning the Peer of the link, also the
+// one established by a dial of the other node.
+func (m *Mesh) dial(id, network, address string) (*Peer, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, ErrShutdown
+	}
+	l := m.link(id)
+	if peer := l.peer; peer != nil {
+		m.mu.Unlock()
+		return peer, nil
+	}
+	l.dialing = true
+	m.mu.Unlock()
+
+	conn, err := net.DialTimeout(network, address, meshHandshake)
+	if err == nil {
+		err = m.hello(conn)
+		if err != nil {
+			conn.Close()
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.dialing = false
+	if err != nil {
+		return l.peer, err
+	}
+	if m.closed {
+		conn.Close()
+		return nil, ErrShutdown
+	}
+	return m.start(id, l, conn)
+}
+
+// hello introduces the local node on conn, dialed by it, returning the
+// answer of the remote node.
+func (m *Mesh) hello(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(meshHandshake))
+	defer conn.SetDeadline(time.Time{})
+	framer := NewFramer(conn, 256)
+	if err := framer.WriteFrame([]byte(meshHello + m.id)); err != nil {
+		return err
+	}
+	answer, err := framer.ReadFrame()
+	if err != nil {
+		return err
+	}
+	if string(answer) != meshAccepted {
+		return ErrLinkRejected
+	}
+	return nil
+}
+
+// start starts the Peer of l, the link with the node id, on conn, with m.mu
+// held.
+func (m *Mesh) start(id string, l *meshLink, conn io.ReadWriteCloser) (*Peer, error) {
+	peer := NewPeer(m.opts...)
+	if m.register != nil {
+		if err := m.register(peer); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if m.gossip != nil {
+		if err := peer.Register(m.gossip); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	peer.Start(conn)
+	l.peer = peer
+	go func() {
+		<-peer.Done()
+		m.mu.Lock()
+		if l.peer == peer {
+			l.peer = nil
+			m.reportDead(id)
+		}
+		m.mu.Unlock()
+	}()
+	return peer, nil
+}
+
+// Accept accepts the dials of the other nodes on the listener. Accept
+// blocks until the listener returns a non-nil error; the caller typically
+// invokes it in a go statement.
+func (m *Mesh) Accept(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go m.ServeConn(conn)
+	}
+}
+
+// ServeConn answers the dial of another node on conn, linking with it
+// unless the tie is broken in favour of a dial of the local node.
+func (m *Mesh) ServeConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(meshHandshake))
+	framer := NewFramer(conn, 256)
+	hello, err := framer.ReadFrame()
+	if err != nil || len(hello) < len(meshHello) || string(hello[:len(meshHello)]) != meshHello {
+		debugln("rpc: mesh invalid hello:", err)
+		conn.Close()
+		return
+	}
+	id := string(hello[len(meshHello):])
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := m.link(id)
+	if m.closed || l.peer != nil || (l.dialing && m.id < id) {
+		framer.WriteFrame([]byte(meshRejected))
+		conn.Close()
+		return
+	}
+	if err := framer.WriteFrame([]byte(meshAccepted)); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	m.start(id, l, conn)
+}
+
+// Close stops dialing and closes the links.
+func (m *Mesh) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrShutdown
+	}
+	m.closed = true
+	close(m.quit)
+	var peers []*Peer
+	for _, l := range m.links {
+		if l.peer != nil {
+			peers = append(peers, l.peer)
+		}
+	}
+	m.mu.Unlock()
+	for _, peer := range peers {
+		peer.Close()
+	}
+	return nil
+}
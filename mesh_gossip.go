@@ -0,0 +1,170 @@
+package birpc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// meshGossipService is the name of the service exchanging the health of
+// the nodes between the Peers of a Mesh.
+const meshGossipService = "_birpcMesh_"
+
+// MeshNode is the health of a node, as gossiped between the nodes of a
+// Mesh.
+type MeshNode struct {
+	ID        string
+	Heartbeat uint64 // increased by the node at each round of gossip
+	Dead      bool   // reported by a node which lost its link with it
+}
+
+type meshHealth struct {
+	MeshNode
+	updated time.Time // when the heartbeat last grew
+}
+
+// meshGossip holds the handlers of the service registered on the Peers.
+type meshGossip struct {
+	Exchange func(ctx *context.Context, nodes []MeshNode, reply *[]MeshNode) error
+}
+
+// Gossip makes the node exchange the health of the nodes it knows with the
+// linked ones every interval, so that the nodes learn about the links lost
+// by the others before detecting it on their own. It must be called on all
+// the nodes, before Connect and Accept.
+//
+// Each node increases its heartbeat at each round, and the most recent
+// heartbeat of a node wins over the older ones. A node losing its link
+// with another one reports it dead with the last heartbeat it knew, which
+// the others adopt unless they know a more recent one. The nodes whose
+// heartbeat did not grow for timeout are considered dead as well, while a
+// node learning that it is reported dead, for instance after a restart,
+// increases its heartbeat past the reported one.
+func (m *Mesh) Gossip(interval, timeout time.Duration) error {
+	svc, err := NewFuncService(meshGossipService, &meshGossip{
+		Exchange: func(ctx *context.Context, nodes []MeshNode, reply *[]MeshNode) error {
+			m.merge(nodes)
+			*reply = m.Nodes()
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrShutdown
+	}
+	if m.gossip != nil {
+		return nil
+	}
+	m.gossip = svc
+	m.timeout = timeout
+	m.health = make(map[string]*meshHealth)
+	go m.gossipLoop(interval)
+	return nil
+}
+
+func (m *Mesh) gossipLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.quit:
+			return
+		}
+		m.mu.Lock()
+		m.heartbeat++
+		var peers []*Peer
+		for _, l := range m.links {
+			if l.peer != nil {
+				peers = append(peers, l.peer)
+			}
+		}
+		m.mu.Unlock()
+		for _, peer := range peers {
+			go m.exchange(peer, interval)
+		}
+	}
+}
+
+// exchange sends the health known by the node to peer, merging the health
+// known by the other end.
+func (m *Mesh) exchange(peer *Peer, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var nodes []MeshNode
+	if err := peer.Call(ctx, meshGossipService+".Exchange", m.Nodes(), &nodes); err != nil {
+		debugln("rpc: mesh gossip:", err)
+		return
+	}
+	m.merge(nodes)
+}
+
+// merge merges the health of the nodes reported by another node.
+func (m *Mesh) merge(nodes []MeshNode) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range nodes {
+		if n.ID == m.id {
+			if n.Heartbeat >= m.heartbeat {
+				// a previous run of the node, or a dead report
+				m.heartbeat = n.Heartbeat + 1
+			}
+			continue
+		}
+		h := m.health[n.ID]
+		if h == nil {
+			m.health[n.ID] = &meshHealth{MeshNode: n, updated: now}
+			continue
+		}
+		if n.Heartbeat > h.Heartbeat {
+			h.MeshNode = n
+			h.updated = now
+		} else if n.Heartbeat == h.Heartbeat && n.Dead {
+			h.Dead = true
+		}
+	}
+}
+
+// reportDead records the loss of the link with the node id, with m.mu held.
+func (m *Mesh) reportDead(id string) {
+	if m.health == nil {
+		return
+	}
+	if h := m.health[id]; h != nil {
+		h.Dead = true
+	} else {
+		m.health[id] = &meshHealth{MeshNode: MeshNode{ID: id, Dead: true}}
+	}
+}
+
+// Nodes returns the health of the nodes known by the node, itself
+// included, ordered by ID.
+func (m *Mesh) Nodes() []MeshNode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nodes := []MeshNode{{ID: m.id, Heartbeat: m.heartbeat}}
+	for _, h := range m.health {
+		nodes = append(nodes, h.MeshNode)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Alive reports whether the node id is known alive by gossip: its
+// heartbeat grew within the timeout given to Gossip, and no node reported
+// it dead since. The local node is always alive.
+func (m *Mesh) Alive(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == m.id {
+		return true
+	}
+	h := m.health[id]
+	return h != nil && !h.Dead && time.Since(h.updated) < m.timeout
+}
@@ -0,0 +1,130 @@
+package birpc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type NodeInfo struct {
+	id string
+}
+
+func (n *NodeInfo) ID(ctx *context.Context, _ int, reply *string) error {
+	*reply = n.id
+	return nil
+}
+
+func newMesh(t *testing.T, id string) (*Mesh, string) {
+	mesh := NewMesh(id, func(p *Peer) error {
+		return p.Register(&NodeInfo{id})
+	})
+	lis, addr := listenTCP()
+	go mesh.Accept(lis)
+	t.Cleanup(func() {
+		mesh.Close()
+		lis.Close()
+	})
+	return mesh, addr
+}
+
+// waitLinked waits for the nodes to be linked over the same connection,
+// returning the Peer of a.
+func waitLinked(t *testing.T, a, b *Mesh, aID, bID string) *Peer {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pa, pb := a.Peer(bID), b.Peer(aID)
+		var ida, idb string
+		if pa != nil && pb != nil &&
+			pa.Call(context.Background(), "NodeInfo.ID", 0, &ida) == nil &&
+			pb.Call(context.Background(), "NodeInfo.ID", 0, &idb) == nil {
+			if ida != bID || idb != aID {
+				t.Fatalf("unexpected node IDs %q and %q", ida, idb)
+			}
+			return pa
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the nodes are not linked")
+	return nil
+}
+
+func TestMesh(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		a, addrA := newMesh(t, fmt.Sprint("a", i))
+		b, addrB := newMesh(t, fmt.Sprint("b", i))
+		// both nodes dial at the same time
+		a.Connect(fmt.Sprint("b", i), "tcp", addrB)
+		b.Connect(fmt.Sprint("a", i), "tcp", addrA)
+		peer := waitLinked(t, a, b, fmt.Sprint("a", i), fmt.Sprint("b", i))
+
+		// a single connection survived, the link stays up
+		time.Sleep(20 * time.Millisecond)
+		if a.Peer(fmt.Sprint("b", i)) != peer {
+			t.Fatal("the link was replaced")
+		}
+
+		// the link is established again once down
+		peer.Close()
+		if waitLinked(t, a, b, fmt.Sprint("a", i), fmt.Sprint("b", i)) == peer {
+			t.Fatal("the link was not established again")
+		}
+	}
+}
+
+func TestMeshAcceptOnly(t *testing.T) {
+	a, _ := newMesh(t, "a")
+	b, addrB := newMesh(t, "b")
+	a.Connect("b", "tcp", addrB)
+	waitLinked(t, a, b, "a", "b")
+
+	b.Close()
+	if err := b.Close(); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown closing twice, got %v", err)
+	}
+	if !eventually(func() bool { return a.Peer("b") == nil }) {
+		t.Error("the link is still up after closing the other node")
+	}
+}
+
+// waitAlive waits for the Mesh to know the node alive or dead.
+func waitAlive(t *testing.T, m *Mesh, id string, alive bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Alive(id) != alive {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: expected alive %v, nodes %v", id, alive, m.Nodes())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMeshGossip(t *testing.T) {
+	// b learns about c only through a
+	a, addrA := newMesh(t, "a")
+	b, _ := newMesh(t, "b")
+	c, _ := newMesh(t, "c")
+	for _, m := range []*Mesh{a, b, c} {
+		if err := m.Gossip(20*time.Millisecond, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Connect("a", "tcp", addrA)
+	c.Connect("a", "tcp", addrA)
+	waitAlive(t, b, "c", true)
+	if !b.Alive("b") || b.Alive("d") {
+		t.Error("unexpected liveness of the local or unknown nodes")
+	}
+
+	// a reports c dead long before b's timeout
+	c.Close()
+	waitAlive(t, b, "c", false)
+
+	// the restarted node refutes the report
+	c, _ = newMesh(t, "c")
+	c.Gossip(20*time.Millisecond, time.Minute)
+	c.Connect("a", "tcp", addrA)
+	waitAlive(t, b, "c", true)
+	waitAlive(t, a, "c", true)
+}
@@ -0,0 +1,106 @@
+package birpc
+
+import (
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Metadata are the values sent along with a call or its reply, out of the
+// arguments and of the reply, like the tenant, the credentials or the
+// trace IDs. The codecs of the package and of its subpackages carry them.
+type Metadata map[string]string
+
+type (
+	outgoingMetadataKey struct{}
+	incomingMetadataKey struct{}
+	replyMetadataKey    struct{}
+	receiveMetadataKey  struct{}
+)
+
+// WithMetadata returns a copy of ctx sending md along with the calls made
+// with it, added to the metadata already set on ctx. The metadata of the
+// calls served are not sent along with the nested calls, unless set on
+// their contexts again.
+func WithMetadata(ctx *context.Context, md Metadata) *context.Context {
+	prev := outgoingMetadata(ctx)
+	merged := make(Metadata, len(prev)+len(md))
+	for k, v := range prev {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, outgoingMetadataKey{}, merged)
+}
+
+// outgoingMetadata returns the metadata set on ctx by WithMetadata.
+func outgoingMetadata(ctx *context.Context) Metadata {
+	if ctx == nil {
+		return nil
+	}
+	md, _ := ctx.Value(outgoingMetadataKey{}).(Metadata)
+	return md
+}
+
+// MetadataFromContext returns the metadata sent by the client along with
+// the call served with ctx, nil if none. They must not be modified.
+func MetadataFromContext(ctx *context.Context) Metadata {
+	md, _ := ctx.Value(incomingMetadataKey{}).(Metadata)
+	return md
+}
+
+// replyMetadata collects the metadata of the reply of a call served.
+type replyMetadata struct {
+	mu sync.Mutex
+	md Metadata
+}
+
+// SetReplyMetadata adds md to the metadata sent along with the reply of
+// the call served with ctx. It does nothing outside the calls served.
+func SetReplyMetadata(ctx *context.Context, md Metadata) {
+	rm, _ := ctx.Value(replyMetadataKey{}).(*replyMetadata)
+	if rm == nil {
+		return
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.md == nil {
+		rm.md = make(Metadata, len(md))
+	}
+	for k, v := range md {
+		rm.md[k] = v
+	}
+}
+
+// serveMetadata returns a copy of ctx holding the metadata of req for the
+// method, and collecting the ones of its reply.
+func serveMetadata(ctx *context.Context, req *Request) (*context.Context, *replyMetadata) {
+	if len(req.Metadata) != 0 {
+		ctx = context.WithValue(ctx, incomingMetadataKey{}, req.Metadata)
+	}
+	rm := new(replyMetadata)
+	return context.WithValue(ctx, replyMetadataKey{}, rm), rm
+}
+
+// metadata returns the metadata collected, nil if none.
+func (rm *replyMetadata) metadata() Metadata {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.md
+}
+
+// ReceiveMetadata returns a copy of ctx storing in *md the metadata sent
+// by the servers along with the replies of the calls made with it, nil if
+// none. See the Metadata field of Call for the calls made with Go.
+func ReceiveMetadata(ctx *context.Context, md *Metadata) *context.Context {
+	return context.WithValue(ctx, receiveMetadataKey{}, md)
+}
+
+// receiveMetadata stores the metadata of the reply of call where asked by
+// ctx, see ReceiveMetadata.
+func receiveMetadata(ctx *context.Context, call *Call) {
+	if md, _ := ctx.Value(receiveMetadataKey{}).(*Metadata); md != nil {
+		*md = call.Metadata
+	}
+}
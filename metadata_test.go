@@ -0,0 +1,57 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Tenants struct{}
+
+func (Tenants) Current(ctx *context.Context, _ string, reply *string) error {
+	md := MetadataFromContext(ctx)
+	*reply = md["tenant"]
+	SetReplyMetadata(ctx, Metadata{"served_for": md["tenant"]})
+	return nil
+}
+
+func TestMetadata(t *testing.T) {
+	server := NewServer()
+	server.Register(Tenants{})
+	client := newPipeClient(t, server)
+
+	var md Metadata
+	ctx := WithMetadata(context.Background(), Metadata{"tenant": "cgrates.org", "trace_id": "1"})
+	ctx = WithMetadata(ctx, Metadata{"trace_id": "2"})
+	var tenant string
+	if err := client.Call(ReceiveMetadata(ctx, &md), "Tenants.Current", "", &tenant); err != nil || tenant != "cgrates.org" {
+		t.Fatalf("expected the tenant, got %q: %v", tenant, err)
+	}
+	if exp := (Metadata{"served_for": "cgrates.org"}); !reflect.DeepEqual(md, exp) {
+		t.Errorf("expected the reply metadata %v, got %v", exp, md)
+	}
+	if outgoingMetadata(ctx)["trace_id"] != "2" {
+		t.Errorf("expected the latest trace_id, got %v", outgoingMetadata(ctx))
+	}
+
+	// none without metadata
+	if err := client.Call(ReceiveMetadata(context.Background(), &md), "Tenants.Current", "", &tenant); err != nil || tenant != "" {
+		t.Fatalf("expected no tenant, got %q: %v", tenant, err)
+	}
+	if md["served_for"] != "" {
+		t.Errorf("unexpected reply metadata %v", md)
+	}
+
+	// over birpc
+	bserver := NewBirpcServer()
+	bserver.Register(Tenants{})
+	bclient := NewBirpcClient(newBirpcPipe(t, bserver))
+	defer bclient.Close()
+	if err := bclient.Call(ReceiveMetadata(ctx, &md), "Tenants.Current", "", &tenant); err != nil || tenant != "cgrates.org" {
+		t.Fatalf("expected the tenant over birpc, got %q: %v", tenant, err)
+	}
+	if md["served_for"] != "cgrates.org" {
+		t.Errorf("unexpected reply metadata over birpc %v", md)
+	}
+}
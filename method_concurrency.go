@@ -0,0 +1,128 @@
+package birpc
+
+import (
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ConcurrencyLimit is the number of the calls of a method served at once,
+// see MethodConcurrency.
+type ConcurrencyLimit struct {
+	Max   int `json:"max" yaml:"max"`                         // calls served at once
+	Queue int `json:"queue,omitempty" yaml:"queue,omitempty"` // calls waiting for one of them to end, none by default
+}
+
+// methodSlots are the calls of a method served at once and the ones
+// waiting for a slot, in order.
+type methodSlots struct {
+	mu      sync.Mutex
+	limit   ConcurrencyLimit
+	running int
+	waiting []chan struct{}
+}
+
+// set changes the limit of the slots, admitting the waiting calls the new
+// limit allows.
+func (s *methodSlots) set(limit ConcurrencyLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	for len(s.waiting) != 0 && s.running < limit.Max {
+		s.running++
+		close(s.waiting[0])
+		s.waiting = s.waiting[1:]
+	}
+}
+
+// acquire takes a slot, waiting for one while ctx lasts if the queue is
+// not full. It returns ErrMethodBusy, or the error of ctx, if not taken.
+func (s *methodSlots) acquire(ctx *context.Context) error {
+	s.mu.Lock()
+	if s.running < s.limit.Max {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	if len(s.waiting) >= s.limit.Queue {
+		s.mu.Unlock()
+		return ErrMethodBusy
+	}
+	ready := make(chan struct{})
+	s.waiting = append(s.waiting, ready)
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	for i, w := range s.waiting {
+		if w == ready {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			s.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	// given a slot meanwhile
+	s.mu.Unlock()
+	s.release()
+	return ctx.Err()
+}
+
+// release frees a slot, handing it to the first call waiting.
+func (s *methodSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiting) != 0 && s.running <= s.limit.Max {
+		close(s.waiting[0])
+		s.waiting = s.waiting[1:]
+		return
+	}
+	s.running--
+}
+
+// methodConcurrency are the slots of the methods, see MethodConcurrency.
+type methodConcurrency struct {
+	mu    sync.RWMutex
+	slots map[string]*methodSlots
+}
+
+// set updates the slots of the methods to limits. The slots of the
+// methods no longer limited are dropped, the calls holding them releasing
+// them unawares.
+func (c *methodConcurrency) set(limits map[string]ConcurrencyLimit) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	slots := make(map[string]*methodSlots, len(limits))
+	for method, limit := range limits {
+		s := c.slots[method]
+		if s == nil {
+			s = new(methodSlots)
+		}
+		s.set(limit)
+		slots[method] = s
+	}
+	for method, s := range c.slots {
+		if slots[method] == nil {
+			// let the waiting calls through
+			s.set(ConcurrencyLimit{Max: int(^uint(0) >> 1)})
+		}
+	}
+	c.slots = slots
+}
+
+// acquire takes a slot of serviceMethod, see methodSlots.acquire,
+// returning the function releasing it.
+func (c *methodConcurrency) acquire(ctx *context.Context, serviceMethod string) (release func(), err error) {
+	c.mu.RLock()
+	s := c.slots[serviceMethod]
+	c.mu.RUnlock()
+	if s == nil {
+		return func() {}, nil
+	}
+	if err = s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	return s.release, nil
+}
@@ -0,0 +1,102 @@
+package birpc
+
+import (
+	"sync"
+	"time"
+)
+
+// MethodTimings describes where the time of the calls of a method goes,
+// telling the serialization-bound latencies from the logic-bound ones.
+type MethodTimings struct {
+	// Decode is the time spent decoding the arguments.
+	Decode HistogramSnapshot `json:"decode"`
+	// Handle is the time spent in the method.
+	Handle HistogramSnapshot `json:"handle"`
+	// Encode is the time spent encoding the response. For the codecs
+	// which are not a ResponseEncoder it includes writing it.
+	Encode HistogramSnapshot `json:"encode"`
+}
+
+// RecordMethodTimings makes the server record the MethodTimings of its
+// methods, in histograms with the given bucket bounds or with
+// DefaultDurationBuckets.
+func RecordMethodTimings(bounds ...time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.timings = &methodTimingsMap{bounds: bounds}
+	}
+}
+
+// MethodTimings returns the timings recorded for the methods called so
+// far, by method name, nil without RecordMethodTimings.
+func (server *basicServer) MethodTimings() map[string]MethodTimings {
+	if server.timings == nil {
+		return nil
+	}
+	timings := make(map[string]MethodTimings)
+	server.timings.m.Range(func(key, value interface{}) bool {
+		mt := value.(*methodTimings)
+		timings[key.(string)] = MethodTimings{
+			Decode: mt.decode.Snapshot(),
+			Handle: mt.handle.Snapshot(),
+			Encode: mt.encode.Snapshot(),
+		}
+		return true
+	})
+	return timings
+}
+
+type methodTimingsMap struct {
+	bounds []time.Duration
+	m      sync.Map // service method -> *methodTimings
+}
+
+type methodTimings struct {
+	decode, handle, encode *Histogram
+}
+
+// get returns the timings of serviceMethod, nil if they are not recorded.
+// The entries are only created when decoding, once the method is known to
+// exist, so the names sent by the clients cannot grow the map.
+func (tm *methodTimingsMap) get(serviceMethod string, create bool) *methodTimings {
+	if tm == nil {
+		return nil
+	}
+	if mt, has := tm.m.Load(serviceMethod); has {
+		return mt.(*methodTimings)
+	}
+	if !create {
+		return nil
+	}
+	mt, _ := tm.m.LoadOrStore(serviceMethod, &methodTimings{
+		decode: NewHistogram(tm.bounds...),
+		handle: NewHistogram(tm.bounds...),
+		encode: NewHistogram(tm.bounds...),
+	})
+	return mt.(*methodTimings)
+}
+
+// observeDecode records the decoding of the arguments of req, started at
+// start.
+func (server *basicServer) observeDecode(s *Service, req *Request, start time.Time) {
+	if s.Name == "_goRPC_" {
+		return
+	}
+	if server.debug.on() {
+		req.decoding = time.Since(start)
+	}
+	if mt := server.timings.get(req.ServiceMethod, true); mt != nil {
+		mt.decode.Observe(time.Since(start))
+	}
+}
+
+func (server *basicServer) observeHandle(req *Request, d time.Duration) {
+	if mt := server.timings.get(req.ServiceMethod, false); mt != nil {
+		mt.handle.Observe(d)
+	}
+}
+
+func (server *basicServer) observeEncode(req *Request, d time.Duration) {
+	if mt := server.timings.get(req.ServiceMethod, false); mt != nil {
+		mt.encode.Observe(d)
+	}
+}
@@ -0,0 +1,54 @@
+package birpc
+
+import (
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestMethodTimings(t *testing.T) {
+	server := NewServer(RecordMethodTimings())
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := client.Call(ctx, "Arith.Add", &Args{i, 1}, new(Reply)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := client.Call(ctx, "Arith.Missing", &Args{}, new(Reply)); err == nil {
+		t.Error("expected the unknown method to fail")
+	}
+	if _, err := client.MeasureRTT(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the encoding is recorded after the response is written
+	waitEncoded := func(server *basicServer, n uint64) {
+		eventually(func() bool { return server.MethodTimings()["Arith.Add"].Encode.Count >= n })
+	}
+	waitEncoded(server.basicServer, 3)
+	timings := server.MethodTimings()
+	if len(timings) != 1 {
+		t.Fatalf("expected the timings of Arith.Add only, got %v", timings)
+	}
+	add := timings["Arith.Add"]
+	if add.Decode.Count != 3 || add.Handle.Count != 3 || add.Encode.Count != 3 {
+		t.Errorf("unexpected timings %+v", add)
+	}
+
+	bserver := NewBirpcServer(RecordMethodTimings())
+	bserver.Register(new(Arith))
+	bclient := NewBirpcClient(newBirpcPipe(t, bserver))
+	if err := bclient.Call(ctx, "Arith.Add", &Args{1, 1}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	waitEncoded(bserver.basicServer, 1)
+	if add := bserver.MethodTimings()["Arith.Add"]; add.Decode.Count != 1 || add.Handle.Count != 1 || add.Encode.Count != 1 {
+		t.Errorf("unexpected timings %+v", add)
+	}
+
+	if timings := NewServer().MethodTimings(); timings != nil {
+		t.Errorf("unexpected timings %v", timings)
+	}
+}
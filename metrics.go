@@ -0,0 +1,131 @@
+package birpc
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds of the histogram buckets
+// used for the durations recorded by the server.
+var DefaultDurationBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// Histogram counts durations in buckets with fixed upper bounds. It is
+// safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []uint64 // one more than bounds, for the values over the last bound
+	count  uint64
+	sum    time.Duration
+}
+
+// NewHistogram returns a Histogram with the given bucket upper bounds,
+// DefaultDurationBuckets if none are given.
+func NewHistogram(bounds ...time.Duration) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultDurationBuckets
+	}
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe records d in the first bucket whose bound is not below it.
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return d <= h.bounds[i] })
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += d
+	h.mu.Unlock()
+}
+
+// Snapshot returns a copy of the current counts.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: append([]uint64(nil), h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+// HistogramSnapshot holds the counts of a Histogram at some point.
+// Counts[i] is the number of values up to Bounds[i] and above the
+// previous bound, the last count is for the values over all the bounds.
+type HistogramSnapshot struct {
+	Bounds []time.Duration `json:"bounds"`
+	Counts []uint64        `json:"counts"`
+	Count  uint64          `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+}
+
+// DeadlineStats describes the deadlines of the calls served, to help
+// tuning the timeouts of the clients. See the DeadlineStats method of
+// Server and BirpcServer.
+type DeadlineStats struct {
+	// Calls is the number of calls admitted by the server.
+	Calls uint64 `json:"calls"`
+	// WithDeadline is the number of calls which had a deadline.
+	WithDeadline uint64 `json:"with_deadline"`
+	// Exceeded is the number of calls which finished after their deadline.
+	Exceeded uint64 `json:"exceeded"`
+	// Expired is the number of calls rejected without being invoked as the
+	// deadline propagated by the client had passed.
+	Expired uint64 `json:"expired"`
+	// Remaining is the distribution of the time left before the deadline
+	// when the method was invoked.
+	Remaining HistogramSnapshot `json:"remaining"`
+}
+
+type deadlineStats struct {
+	calls        uint64
+	withDeadline uint64
+	exceeded     uint64
+	expired      uint64
+	remaining    *Histogram
+}
+
+// start records a call invoked with the deadline of its caller, zero if
+// none, whatever the CallTimeout.
+func (s *deadlineStats) start(deadline time.Time) {
+	atomic.AddUint64(&s.calls, 1)
+	if !deadline.IsZero() {
+		atomic.AddUint64(&s.withDeadline, 1)
+		s.remaining.Observe(time.Until(deadline))
+	}
+}
+
+// expire records a call rejected as its deadline had passed.
+func (s *deadlineStats) expire() {
+	atomic.AddUint64(&s.expired, 1)
+}
+
+// finish records the end of a call started with deadline.
+func (s *deadlineStats) finish(deadline time.Time) {
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		atomic.AddUint64(&s.exceeded, 1)
+	}
+}
+
+// DeadlineStats returns the deadline statistics of the calls served so far.
+func (server *basicServer) DeadlineStats() DeadlineStats {
+	return DeadlineStats{
+		Calls:        atomic.LoadUint64(&server.deadlines.calls),
+		WithDeadline: atomic.LoadUint64(&server.deadlines.withDeadline),
+		Exceeded:     atomic.LoadUint64(&server.deadlines.exceeded),
+		Expired:      atomic.LoadUint64(&server.deadlines.expired),
+		Remaining:    server.deadlines.remaining.Snapshot(),
+	}
+}
@@ -0,0 +1,63 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(time.Second, 10*time.Millisecond)
+	for _, d := range []time.Duration{-time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, time.Minute} {
+		h.Observe(d)
+	}
+	exp := HistogramSnapshot{
+		Bounds: []time.Duration{10 * time.Millisecond, time.Second},
+		Counts: []uint64{2, 1, 1},
+		Count:  4,
+		Sum:    time.Minute + 29*time.Millisecond,
+	}
+	if rcv := h.Snapshot(); !reflect.DeepEqual(rcv, exp) {
+		t.Errorf("expected %+v, got %+v", exp, rcv)
+	}
+}
+
+func TestDeadlineStats(t *testing.T) {
+	server := NewServer(DeadlineBuckets(10*time.Millisecond, time.Second))
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Call(ctx, "Arith.Add", Args{1, 2}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	// the CallTimeout is not the deadline of the callers
+	if err := server.ApplyConfig(ServerConfig{CallTimeout: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "Arith.SleepMilli", &Args{A: 100}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	if stats := server.DeadlineStats(); stats.Calls != 2 || stats.WithDeadline != 0 || stats.Exceeded != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	for _, sleep := range []int{0, 100} {
+		dctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		client.Call(dctx, "Arith.SleepMilli", &Args{A: sleep}, new(Reply))
+		cancel()
+	}
+	var stats DeadlineStats
+	eventually(func() bool {
+		stats = server.DeadlineStats()
+		return stats.Exceeded != 0
+	})
+	if stats.Calls != 4 || stats.WithDeadline != 2 || stats.Exceeded != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if exp := []uint64{0, 2, 0}; !reflect.DeepEqual(stats.Remaining.Counts, exp) {
+		t.Errorf("expected remaining counts %v, got %v", exp, stats.Remaining.Counts)
+	}
+}
@@ -0,0 +1,250 @@
+package msgpackrpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc"
+	"github.com/cgrates/birpc/context"
+)
+
+type Args struct {
+	A, B int
+}
+
+type Arith int
+
+func (t *Arith) Add(ctx *context.Context, args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (t *Arith) Neg(ctx *context.Context, n int, reply *int) error {
+	*reply = -n
+	return nil
+}
+
+func (t *Arith) Div(ctx *context.Context, args *Args, reply *int) error {
+	if args.B == 0 {
+		return errors.New("divide by zero")
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+// codeNegativeDivisor is a code of the application, past the ones of gRPC.
+const codeNegativeDivisor = 1000
+
+func (t *Arith) Mod(ctx *context.Context, args *Args, reply *int) error {
+	switch {
+	case args.B == 0:
+		return &birpc.Error{Code: birpc.CodeInvalidArgument, Message: "divide by zero", Details: *args}
+	case args.B < 0:
+		return birpc.WithErrorCode(errors.New("negative divisor"), codeNegativeDivisor)
+	case args.A > 1000:
+		return fmt.Errorf("dividing %d: %w", args.A, Overflow{Max: 1000})
+	}
+	*reply = args.A % args.B
+	return nil
+}
+
+func newServer(t *testing.T) net.Conn {
+	server := birpc.NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	t.Cleanup(func() { cli.Close() })
+	return cli
+}
+
+func TestServer(t *testing.T) {
+	conn := newServer(t)
+	r := bufio.NewReader(conn)
+	for _, tc := range []struct{ req, resp string }{
+		// [0, 1, "Arith.Add", [{"A": 1, "B": 2}]]
+		{"\x94\x00\x01\xa9Arith.Add\x91\x82\xa1A\x01\xa1B\x02",
+			"\x94\x01\x01\xc0\x03"},
+		// the params of several values: [0, 2, "Arith.Add", [1, 2]]
+		{"\x94\x00\x02\xa9Arith.Add\x92\x01\x02",
+			"\x94\x01\x02\xc0\x03"},
+		// [0, 3, "Arith.Div", [1, 0]]
+		{"\x94\x00\x03\xa9Arith.Div\x92\x01\x00",
+			"\x94\x01\x03\xaedivide by zero\xc0"},
+		// the notification is not answered: [2, "Arith.Neg", [1]]
+		{"\x93\x02\xa9Arith.Neg\x91\x01" + "\x94\x00\xcd\x01\x00\xa9Arith.Neg\x91\x07",
+			"\x94\x01\xcd\x01\x00\xc0\xf9"},
+	} {
+		if _, err := conn.Write([]byte(tc.req)); err != nil {
+			t.Fatal(err)
+		}
+		resp := make([]byte, len(tc.resp))
+		if _, err := io.ReadFull(r, resp); err != nil {
+			t.Fatal(err)
+		}
+		if string(resp) != tc.resp {
+			t.Errorf("%q:\nexpected %q\ngot      %q", tc.req, tc.resp, resp)
+		}
+	}
+
+	conn.Write([]byte("\x94\x00\x05\xa9Arith.Mul\x91\x01"))
+	dec := &decoder{r: r}
+	if resp, err := dec.decodeAny(); err != nil {
+		t.Fatal(err)
+	} else if a, ok := resp.([]interface{}); !ok || len(a) != 4 || a[1] != int64(5) ||
+		!strings.Contains(a[2].(string), "can't find method Arith.Mul") || a[3] != nil {
+		t.Errorf("unexpected response %v", resp)
+	}
+}
+
+func TestClient(t *testing.T) {
+	client := NewClient(newServer(t))
+	var reply int
+	if err := client.Call(context.Background(), "Arith.Add", &Args{7, 8}, &reply); err != nil || reply != 15 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+	if err := client.Call(context.Background(), "Arith.Neg", 3, &reply); err != nil || reply != -3 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+	if err := client.Call(context.Background(), "Arith.Div", &Args{7, 0}, &reply); err != birpc.ServerError("divide by zero") {
+		t.Errorf("expected the error of the method, got %v", err)
+	}
+	if err := client.Call(context.Background(), "Arith.Mul", &Args{7, 0}, &reply); err == nil {
+		t.Error("expected an error calling a missing method")
+	}
+	// the connection is still usable
+	if err := client.Call(context.Background(), "Arith.Neg", 4, &reply); err != nil || reply != -4 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+}
+
+type Callback struct{}
+
+// Double asks the caller for the number to double.
+func (Callback) Double(ctx *context.Context, method string, reply *int) error {
+	var n int
+	if err := ctx.Client.Call(ctx, method, nil, &n); err != nil {
+		return err
+	}
+	*reply = 2 * n
+	return nil
+}
+
+type Number int
+
+func (n Number) Get(ctx *context.Context, _ interface{}, reply *int) error {
+	*reply = int(n)
+	return nil
+}
+
+func TestBirpc(t *testing.T) {
+	srv := birpc.NewBirpcServer()
+	srv.Register(Callback{})
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewBirpcCodec(conn))
+
+	clt := birpc.NewBirpcClientWithCodec(NewBirpcCodec(cli))
+	clt.Register(Number(21))
+	defer clt.Close()
+	var reply int
+	if err := clt.Call(context.Background(), "Callback.Double", "Number.Get", &reply); err != nil || reply != 42 {
+		t.Errorf("unexpected reply %d: %v", reply, err)
+	}
+}
+
+type Record struct {
+	Name    string
+	Count   int64  `msgpack:"count"`
+	Skipped string `msgpack:"-"`
+	Small   int8
+	Big     uint64
+	Ratio   float64
+	Half    float32
+	Data    []byte
+	Tags    []string
+	Attrs   map[string]int
+	Next    *Record
+	Any     interface{}
+	Fixed   [2]uint16
+	private int
+}
+
+func TestEncoding(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	in := Record{
+		Name:    long,
+		Count:   -1 << 40,
+		Skipped: "skipped",
+		Small:   -100,
+		Big:     1 << 63,
+		Ratio:   0.25,
+		Half:    -1.5,
+		Data:    bytes.Repeat([]byte{1}, 70000),
+		Tags:    []string{"a", strings.Repeat("b", 40), ""},
+		Attrs:   map[string]int{"x": 1, "y": -40000},
+		Next:    &Record{Name: "next", Tags: make([]string, 20)},
+		Any:     []interface{}{"s", int64(-3), uint64(1 << 40), true, nil, map[string]interface{}{"k": 1.5}},
+		Fixed:   [2]uint16{1, 65535},
+		private: 1,
+	}
+	var enc encoder
+	if err := enc.encode(&in); err != nil {
+		t.Fatal(err)
+	}
+	var out Record
+	dec := &decoder{r: bufio.NewReader(bytes.NewReader(enc.buf))}
+	if err := dec.decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	in.Skipped, in.private = "", 0
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v\ngot      %+v", in, out)
+	}
+
+	now := time.Now()
+	enc.buf = enc.buf[:0]
+	enc.encode(now)
+	var tm time.Time
+	dec = &decoder{r: bufio.NewReader(bytes.NewReader(enc.buf))}
+	if err := dec.decode(&tm); err != nil || !tm.Equal(now) {
+		t.Errorf("unexpected time %v: %v", tm, err)
+	}
+}
+
+type Overflow struct {
+	Max int
+}
+
+func (e Overflow) Error() string { return "overflow" }
+
+func TestError(t *testing.T) {
+	birpc.RegisterErrorDetail("Overflow", Overflow{})
+	client := NewClient(newServer(t))
+	var reply int
+	err := client.Call(context.Background(), "Arith.Mod", &Args{7, 0}, &reply)
+	if birpc.ErrorCode(err) != birpc.CodeInvalidArgument || err.Error() != "divide by zero" {
+		t.Errorf("expected an invalid argument, got %#v", err)
+	}
+	if details, ok := birpc.ErrorDetail[Args](err); !ok || details != (Args{7, 0}) {
+		t.Errorf("unexpected details %+v", details)
+	}
+	err = client.Call(context.Background(), "Arith.Mod", &Args{7, -2}, &reply)
+	if birpc.ErrorCode(err) != codeNegativeDivisor || err.Error() != "negative divisor" {
+		t.Errorf("expected the code of the error, got %#v", err)
+	}
+	var overflow Overflow
+	err = client.Call(context.Background(), "Arith.Mod", &Args{1001, 2}, &reply)
+	if !errors.As(err, &overflow) || overflow.Max != 1000 {
+		t.Errorf("expected the overflow, got %#v", err)
+	}
+	if err = client.Call(context.Background(), "Arith.Mod", &Args{7, 2}, &reply); err != nil || reply != 1 {
+		t.Errorf("unexpected reply %v: %v", reply, err)
+	}
+}
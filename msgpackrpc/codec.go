@@ -0,0 +1,368 @@
+// Package msgpackrpc implements the msgpack-rpc wire format for the rpc
+// package, letting the components written in other languages call the
+// services and be called by them.
+//
+// The messages are MessagePack arrays: [0, msgid, method, params] for the
+// requests, [1, msgid, error, result] for the responses and [2, method,
+// params] for the notifications, whose methods are called without being
+// answered. The params holding a single value are decoded into the
+// argument of the methods, and the others as a whole, the structs taking
+// them by field order. The structs are encoded as maps keyed by field
+// name, or by their msgpack tag. The streaming calls and the uploads are
+// not supported.
+//
+// The metadata of the calls, see birpc.Metadata, go in a message [3,
+// metadata] preceding the request or the response they belong to, an
+// extension of the protocol sent only when they are set.
+//
+// The errors with a code or a detail, see birpc.Error, are sent as a map
+// {"message": message, "code": code, "detail": true, "detail_type": name}
+// in place of the message, the result holding the detail, also an
+// extension sent only when they are set. The details are captured as msgpack for ErrorDetail.
+package msgpackrpc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+
+	"github.com/cgrates/birpc"
+)
+
+// The types of the messages.
+const (
+	typeRequest      = 0
+	typeResponse     = 1
+	typeNotification = 2
+	typeMetadata     = 3 // the metadata of the next message
+)
+
+var errUnexpected = errors.New("msgpackrpc: unexpected message")
+
+type codec struct {
+	dec *decoder
+	c   io.ReadWriteCloser
+
+	// temporary work space, used by the reading goroutine
+	body bool // a body is left unread
+
+	wmu sync.Mutex // protects enc and the writes
+	enc encoder
+
+	// The peers number their requests with 32-bit msgids, which are
+	// mapped to the sequence numbers of package birpc on both sides.
+	mutex   sync.Mutex // protects seq, pending, calls
+	seq     uint64
+	pending map[uint64]pendingRequest // the requests being served
+	calls   map[uint32]uint64         // the seq of the calls, by msgid
+}
+
+type pendingRequest struct {
+	msgid  uint32
+	notify bool // a notification, not answered
+}
+
+func newCodec(conn io.ReadWriteCloser) *codec {
+	return &codec{
+		dec:     &decoder{r: bufio.NewReader(conn)},
+		c:       conn,
+		pending: make(map[uint64]pendingRequest),
+		calls:   make(map[uint32]uint64),
+	}
+}
+
+// NewServerCodec returns a new birpc.ServerCodec using msgpack-rpc on conn.
+func NewServerCodec(conn io.ReadWriteCloser) birpc.ServerCodec {
+	return newCodec(conn)
+}
+
+// NewClientCodec returns a new birpc.ClientCodec using msgpack-rpc on conn.
+func NewClientCodec(conn io.ReadWriteCloser) birpc.ClientCodec {
+	return newCodec(conn)
+}
+
+// NewBirpcCodec returns a new birpc.BirpcCodec using msgpack-rpc on conn.
+func NewBirpcCodec(conn io.ReadWriteCloser) birpc.BirpcCodec {
+	return newCodec(conn)
+}
+
+func (c *codec) ReadHeader(req *birpc.Request, resp *birpc.Response) error {
+	_, err := c.readHeader(req, resp)
+	return err
+}
+
+// readHeader reads the header of a request or a response, returning the
+// type of the message.
+func (c *codec) readHeader(req *birpc.Request, resp *birpc.Response) (int, error) {
+	if c.body {
+		// the body of the previous message was left unread
+		if _, err := c.dec.decodeAny(); err != nil {
+			return 0, err
+		}
+		c.body = false
+	}
+	var md map[string]string
+	n, typ, err := c.readType()
+	if err == nil && typ == typeMetadata && n == 2 {
+		if err = c.dec.decode(&md); err == nil {
+			n, typ, err = c.readType()
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case typ == typeRequest && n == 4:
+		var msgid uint32
+		if err = c.dec.decode(&msgid); err != nil {
+			return 0, err
+		}
+		req.Metadata = md
+		return typ, c.readRequest(req, pendingRequest{msgid: msgid})
+	case typ == typeNotification && n == 3:
+		req.Metadata = md
+		return typ, c.readRequest(req, pendingRequest{notify: true})
+	case typ == typeResponse && n == 4:
+		var msgid uint32
+		if err = c.dec.decode(&msgid); err != nil {
+			return 0, err
+		}
+		e, err := c.dec.decodeAny()
+		if err != nil {
+			return 0, err
+		}
+		c.mutex.Lock()
+		resp.Seq = c.calls[msgid]
+		delete(c.calls, msgid)
+		c.mutex.Unlock()
+		resp.Error, resp.Code, resp.Detail, resp.DetailType = "", 0, false, ""
+		resp.Metadata = md
+		if m, ok := e.(map[string]interface{}); ok && m["message"] != nil {
+			e = m["message"]
+			switch code := m["code"].(type) {
+			case int64:
+				resp.Code = int(code)
+			case uint64:
+				resp.Code = int(code)
+			}
+			resp.Detail = m["detail"] == true
+			resp.DetailType, _ = m["detail_type"].(string)
+		}
+		if e != nil {
+			if resp.Error = fmt.Sprint(e); resp.Error == "" {
+				resp.Error = "unspecified error"
+			}
+		}
+		c.body = true
+		return typ, nil
+	}
+	return 0, fmt.Errorf("msgpackrpc: invalid message of type %d and length %d", typ, n)
+}
+
+// readType reads the length of the next message and its type, -1 if
+// empty.
+func (c *codec) readType() (n, typ int, err error) {
+	if n, err = c.dec.readArrayLen(); err != nil {
+		return
+	}
+	typ = -1
+	if n != 0 {
+		err = c.dec.decode(&typ)
+	}
+	return
+}
+
+// readRequest reads the method of a request, assigning it the next
+// sequence number, and the header of its params.
+func (c *codec) readRequest(req *birpc.Request, p pendingRequest) error {
+	var method string
+	if err := c.dec.decode(&method); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.seq++
+	c.pending[c.seq] = p
+	req.Seq = c.seq
+	c.mutex.Unlock()
+	req.ServiceMethod = method
+	c.body = true
+	return nil
+}
+
+func (c *codec) ReadRequestHeader(r *birpc.Request) error {
+	typ, err := c.readHeader(r, new(birpc.Response))
+	if err == nil && typ == typeResponse {
+		err = errUnexpected
+	}
+	return err
+}
+
+func (c *codec) ReadResponseHeader(r *birpc.Response) error {
+	typ, err := c.readHeader(new(birpc.Request), r)
+	if err == nil && typ != typeResponse {
+		err = errUnexpected
+	}
+	return err
+}
+
+func (c *codec) ReadRequestBody(x interface{}) error {
+	c.body = false
+	n, err := c.dec.readArrayLen()
+	if err != nil {
+		return err
+	}
+	if n == 1 || x == nil {
+		for i := 0; i < n; i++ {
+			if err := c.dec.decode(x); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// the params of several values, taken by field order
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("msgpackrpc: cannot decode into %T", x)
+	}
+	return c.dec.decodeArray(n, v.Elem())
+}
+
+func (c *codec) ReadResponseBody(x interface{}) error {
+	c.body = false
+	return c.dec.decode(x)
+}
+
+// ReadRawResponseBody keeps the result for a birpc.RawReply, encoded again
+// as msgpack.
+func (c *codec) ReadRawResponseBody(raw *birpc.RawReply) error {
+	c.body = false
+	v, err := c.dec.decodeAny()
+	if err != nil {
+		return err
+	}
+	var enc encoder
+	if err = enc.encode(v); err != nil {
+		return err
+	}
+	*raw = birpc.RawReply{Format: "msgpack", Data: enc.buf, Unmarshal: unmarshal}
+	return nil
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	dec := decoder{r: bufio.NewReader(bytes.NewReader(data))}
+	return dec.decode(v)
+}
+
+func (c *codec) WriteRequest(r *birpc.Request, param interface{}) error {
+	msgid := uint32(r.Seq)
+	c.mutex.Lock()
+	c.calls[msgid] = r.Seq
+	c.mutex.Unlock()
+	return c.write(r.Metadata, typeRequest, msgid, r.ServiceMethod, []interface{}{param})
+}
+
+func (c *codec) WriteResponse(r *birpc.Response, x interface{}) error {
+	c.mutex.Lock()
+	p, ok := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mutex.Unlock()
+	if !ok {
+		return errors.New("invalid sequence number in response")
+	}
+	if p.notify {
+		return nil
+	}
+	if r.Error != "" && (r.Code != 0 || r.Detail) {
+		e := map[string]interface{}{"message": r.Error}
+		if r.Code != 0 {
+			e["code"] = r.Code
+		}
+		if !r.Detail {
+			x = nil
+		} else if e["detail"] = true; r.DetailType != "" {
+			e["detail_type"] = r.DetailType
+		}
+		return c.write(r.Metadata, typeResponse, p.msgid, e, x)
+	}
+	if r.Error != "" {
+		return c.write(r.Metadata, typeResponse, p.msgid, r.Error, nil)
+	}
+	return c.write(r.Metadata, typeResponse, p.msgid, nil, x)
+}
+
+// write writes the message of type typ with the values vs, preceded by
+// the message of its metadata md, if any.
+func (c *codec) write(md map[string]string, typ int, vs ...interface{}) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.enc.buf = c.enc.buf[:0]
+	if len(md) != 0 {
+		c.enc.encodeLen(2, 0x90, 16, mpArray16, mpArray32)
+		c.enc.encodeInt(typeMetadata)
+		if err := c.enc.encode(md); err != nil {
+			return err
+		}
+	}
+	c.enc.encodeLen(len(vs)+1, 0x90, 16, mpArray16, mpArray32)
+	c.enc.encodeInt(int64(typ))
+	for _, v := range vs {
+		if err := c.enc.encode(v); err != nil {
+			return err
+		}
+	}
+	_, err := c.c.Write(c.enc.buf)
+	return err
+}
+
+func (c *codec) Close() error {
+	return c.c.Close()
+}
+
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *codec) RemoteAddr() net.Addr {
+	if conn, ok := c.c.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *codec) TLSConnectionState() *tls.ConnectionState {
+	return birpc.ConnTLSState(c.c)
+}
+
+// NewClient returns a new birpc.Client to handle requests to the
+// set of services at the other end of the connection.
+func NewClient(conn io.ReadWriteCloser) *birpc.Client {
+	return birpc.NewClientWithCodec(NewClientCodec(conn))
+}
+
+// Dial connects to a msgpack-rpc server at the specified network address.
+func Dial(network, address string) (*birpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), err
+}
+
+// ServeConn runs the msgpack-rpc server on a single connection.
+// ServeConn blocks, serving the connection until the client hangs up.
+// The caller typically invokes ServeConn in a go statement.
+func ServeConn(conn io.ReadWriteCloser) {
+	birpc.ServeCodec(NewServerCodec(conn))
+}
+
+func init() {
+	birpc.RegisterServerCodec("msgpack", NewServerCodec)
+	birpc.RegisterClientCodec("msgpack", NewClientCodec)
+	birpc.RegisterBirpcCodec("msgpack", NewBirpcCodec)
+}
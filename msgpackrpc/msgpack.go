@@ -0,0 +1,753 @@
+package msgpackrpc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLen bounds the lengths read, keeping a corrupt stream from making the
+// decoder allocate without limit.
+const maxLen = 1 << 28
+
+var (
+	errTooLong = errors.New("msgpackrpc: length too large")
+	typeOfTime = reflect.TypeOf(time.Time{})
+)
+
+// The MessagePack formats, as their first byte.
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+
+	extTimestamp = -1
+)
+
+// field is an exported field of a struct, encoded by name.
+type field struct {
+	name  string
+	index int
+}
+
+var fieldsCache sync.Map // reflect.Type: []field
+
+// structFields returns the fields encoded of the struct type t, named by
+// their msgpack tag if any, "-" skipping them.
+func structFields(t reflect.Type) []field {
+	if f, ok := fieldsCache.Load(t); ok {
+		return f.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		if tag := sf.Tag.Get("msgpack"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, field{name: name, index: i})
+	}
+	fieldsCache.Store(t, fields)
+	return fields
+}
+
+// appendUint appends the size low bytes of u to b, big-endian.
+func appendUint(b []byte, size int, u uint64) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(u>>(8*uint(i))))
+	}
+	return b
+}
+
+// encoder appends the MessagePack encoding of values to buf.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(v interface{}) error {
+	return e.encodeValue(reflect.ValueOf(v))
+}
+
+func (e *encoder) encodeValue(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Invalid:
+		e.buf = append(e.buf, mpNil)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		return e.encodeValue(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, mpTrue)
+		} else {
+			e.buf = append(e.buf, mpFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, mpFloat32)
+		e.buf = appendUint(e.buf, 4, uint64(math.Float32bits(float32(v.Float()))))
+	case reflect.Float64:
+		e.buf = append(e.buf, mpFloat64)
+		e.buf = appendUint(e.buf, 8, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.encodeLen(v.Len(), 0x90, 16, mpArray16, mpArray32)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, mpNil)
+			return nil
+		}
+		e.encodeLen(v.Len(), 0x80, 16, mpMap16, mpMap32)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encodeValue(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encodeValue(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if v.Type() == typeOfTime {
+			e.encodeTime(v.Interface().(time.Time))
+			return nil
+		}
+		fields := structFields(v.Type())
+		e.encodeLen(len(fields), 0x80, 16, mpMap16, mpMap32)
+		for _, f := range fields {
+			e.encodeString(f.name)
+			if err := e.encodeValue(v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpackrpc: cannot encode %s", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) encodeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.encodeUint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(i))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, mpInt8, byte(i))
+	case i >= math.MinInt16:
+		e.buf = append(e.buf, mpInt16)
+		e.buf = appendUint(e.buf, 2, uint64(i))
+	case i >= math.MinInt32:
+		e.buf = append(e.buf, mpInt32)
+		e.buf = appendUint(e.buf, 4, uint64(i))
+	default:
+		e.buf = append(e.buf, mpInt64)
+		e.buf = appendUint(e.buf, 8, uint64(i))
+	}
+}
+
+func (e *encoder) encodeUint(u uint64) {
+	switch {
+	case u < 128:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, mpUint8, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = append(e.buf, mpUint16)
+		e.buf = appendUint(e.buf, 2, uint64(u))
+	case u <= math.MaxUint32:
+		e.buf = append(e.buf, mpUint32)
+		e.buf = appendUint(e.buf, 4, uint64(u))
+	default:
+		e.buf = append(e.buf, mpUint64)
+		e.buf = appendUint(e.buf, 8, u)
+	}
+}
+
+func (e *encoder) encodeString(s string) {
+	if len(s) < 32 {
+		e.buf = append(e.buf, 0xa0|byte(len(s)))
+	} else {
+		e.encodeLen(len(s), 0, 0, mpStr16, mpStr32, mpStr8)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) encodeBytes(b []byte) {
+	e.encodeLen(len(b), 0, 0, mpBin16, mpBin32, mpBin8)
+	e.buf = append(e.buf, b...)
+}
+
+// encodeLen appends the header of a value of length n: fixed with the
+// lengths under fixMax, else using the formats of 8 (if any), 16 and 32-bit
+// lengths.
+func (e *encoder) encodeLen(n int, fix byte, fixMax int, f16, f32 byte, f8 ...byte) {
+	switch {
+	case n < fixMax:
+		e.buf = append(e.buf, fix|byte(n))
+	case len(f8) != 0 && n <= math.MaxUint8:
+		e.buf = append(e.buf, f8[0], byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, f16)
+		e.buf = appendUint(e.buf, 2, uint64(n))
+	default:
+		e.buf = append(e.buf, f32)
+		e.buf = appendUint(e.buf, 4, uint64(n))
+	}
+}
+
+// encodeTime appends t as the 96-bit timestamp extension.
+func (e *encoder) encodeTime(t time.Time) {
+	e.buf = append(e.buf, mpExt8, 12, byte(extTimestamp&0xff))
+	e.buf = appendUint(e.buf, 4, uint64(t.Nanosecond()))
+	e.buf = appendUint(e.buf, 8, uint64(t.Unix()))
+}
+
+// decoder reads MessagePack values from r.
+type decoder struct {
+	r *bufio.Reader
+}
+
+func (d *decoder) readN(n int) ([]byte, error) {
+	if n > maxLen {
+		return nil, errTooLong
+	}
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+func (d *decoder) readUint(size int) (uint64, error) {
+	b, err := d.readN(size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// decode decodes the next value into v, a pointer, or skips it if v is nil.
+func (d *decoder) decode(v interface{}) error {
+	if v == nil {
+		_, err := d.decodeAny()
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpackrpc: cannot decode into %T", v)
+	}
+	return d.decodeValue(rv.Elem())
+}
+
+// readArrayLen reads the header of an array, returning its length.
+func (d *decoder) readArrayLen() (int, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n, ok, err := d.arrayLen(c)
+	if err == nil && !ok {
+		err = fmt.Errorf("msgpackrpc: expected an array, got format 0x%x", c)
+	}
+	return n, err
+}
+
+func (d *decoder) arrayLen(c byte) (n int, ok bool, err error) {
+	var u uint64
+	switch {
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f), true, nil
+	case c == mpArray16:
+		u, err = d.readUint(2)
+	case c == mpArray32:
+		u, err = d.readUint(4)
+	default:
+		return 0, false, nil
+	}
+	if u > maxLen {
+		err = errTooLong
+	}
+	return int(u), true, err
+}
+
+func (d *decoder) mapLen(c byte) (n int, ok bool, err error) {
+	var u uint64
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), true, nil
+	case c == mpMap16:
+		u, err = d.readUint(2)
+	case c == mpMap32:
+		u, err = d.readUint(4)
+	default:
+		return 0, false, nil
+	}
+	if u > maxLen {
+		err = errTooLong
+	}
+	return int(u), true, err
+}
+
+// bytesLen returns the length of the strings and binaries.
+func (d *decoder) bytesLen(c byte) (n int, ok bool, err error) {
+	var u uint64
+	switch {
+	case c&0xe0 == 0xa0:
+		return int(c & 0x1f), true, nil
+	case c == mpStr8, c == mpBin8:
+		u, err = d.readUint(1)
+	case c == mpStr16, c == mpBin16:
+		u, err = d.readUint(2)
+	case c == mpStr32, c == mpBin32:
+		u, err = d.readUint(4)
+	default:
+		return 0, false, nil
+	}
+	return int(u), true, err
+}
+
+// extLen returns the length of the extensions.
+func (d *decoder) extLen(c byte) (n int, ok bool, err error) {
+	var u uint64
+	switch {
+	case c >= mpFixExt1 && c <= mpFixExt16:
+		return 1 << (c - mpFixExt1), true, nil
+	case c == mpExt8:
+		u, err = d.readUint(1)
+	case c == mpExt16:
+		u, err = d.readUint(2)
+	case c == mpExt32:
+		u, err = d.readUint(4)
+	default:
+		return 0, false, nil
+	}
+	return int(u), true, err
+}
+
+// number decodes the numbers, as int64, uint64 or float64.
+func (d *decoder) number(c byte) (interface{}, bool, error) {
+	switch {
+	case c < 0x80:
+		return int64(c), true, nil
+	case c >= 0xe0:
+		return int64(int8(c)), true, nil
+	case c >= mpUint8 && c <= mpUint64:
+		u, err := d.readUint(1 << (c - mpUint8))
+		return u, true, err
+	case c >= mpInt8 && c <= mpInt64:
+		size := 1 << (c - mpInt8)
+		u, err := d.readUint(size)
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, true, err
+	case c == mpFloat32:
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), true, err
+	case c == mpFloat64:
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), true, err
+	}
+	return nil, false, nil
+}
+
+// decodeAny decodes the next value into the types of encoding/json, with
+// the integers as int64 or uint64, the binaries as []byte and the
+// timestamps as time.Time.
+func (d *decoder) decodeAny() (interface{}, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	return d.decodeAnyFormat(c)
+}
+
+func (d *decoder) decodeAnyFormat(c byte) (interface{}, error) {
+	switch c {
+	case mpNil:
+		return nil, nil
+	case mpFalse:
+		return false, nil
+	case mpTrue:
+		return true, nil
+	}
+	if x, ok, err := d.number(c); ok {
+		return x, err
+	}
+	if n, ok, err := d.bytesLen(c); ok {
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.readN(n)
+		if c == mpBin8 || c == mpBin16 || c == mpBin32 {
+			return b, err
+		}
+		return string(b), err
+	}
+	if n, ok, err := d.arrayLen(c); ok {
+		if err != nil {
+			return nil, err
+		}
+		a := make([]interface{}, 0, minCap(n))
+		for i := 0; i < n; i++ {
+			x, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, x)
+		}
+		return a, nil
+	}
+	if n, ok, err := d.mapLen(c); ok {
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, minCap(n))
+		for i := 0; i < n; i++ {
+			k, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			x, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := k.(string); ok {
+				m[s] = x
+			} else {
+				m[fmt.Sprint(k)] = x
+			}
+		}
+		return m, nil
+	}
+	if n, ok, err := d.extLen(c); ok {
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	}
+	return nil, fmt.Errorf("msgpackrpc: invalid format 0x%x", c)
+}
+
+// minCap bounds the capacity allocated ahead for n values.
+func minCap(n int) int {
+	if n > 1024 {
+		return 1024
+	}
+	return n
+}
+
+// decodeExt decodes an extension of n bytes, the timestamps as time.Time
+// and the others as their data.
+func (d *decoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.readN(n)
+	if err != nil || int8(typ) != extTimestamp {
+		return b, err
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))), nil
+	}
+	return nil, fmt.Errorf("msgpackrpc: invalid timestamp of %d bytes", n)
+}
+
+// decodeValue decodes the next value into v, converting between the kinds
+// of numbers, strings and binaries, and decoding the maps into structs by
+// field name and the arrays into structs by field order.
+func (d *decoder) decodeValue(v reflect.Value) error {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if c == mpNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		x, err := d.decodeAnyFormat(c)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("msgpackrpc: cannot decode %T into %s", x, v.Type())
+		}
+		v.Set(xv)
+		return nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		if err := d.r.UnreadByte(); err != nil {
+			return err
+		}
+		return d.decodeValue(v.Elem())
+	}
+	if n, ok, err := d.arrayLen(c); ok {
+		if err != nil {
+			return err
+		}
+		return d.decodeArray(n, v)
+	}
+	if n, ok, err := d.mapLen(c); ok {
+		if err != nil {
+			return err
+		}
+		return d.decodeMap(n, v)
+	}
+	x, err := d.decodeAnyFormat(c)
+	if err != nil {
+		return err
+	}
+	return setScalar(v, x)
+}
+
+func (d *decoder) decodeArray(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 0, minCap(n))
+		for i := 0; i < n; i++ {
+			s = reflect.Append(s, reflect.Zero(v.Type().Elem()))
+			if err := d.decodeValue(s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.Array:
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decodeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		// the positional params of the clients calling with several of them
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			if i >= len(fields) {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decodeValue(v.Field(fields[i].index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpackrpc: cannot decode an array into %s", v.Type())
+}
+
+func (d *decoder) decodeMap(n int, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), minCap(n)))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decodeValue(key); err != nil {
+				return err
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decodeValue(elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+		return nil
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		for i := 0; i < n; i++ {
+			var name string
+			if err := d.decodeValue(reflect.ValueOf(&name).Elem()); err != nil {
+				return err
+			}
+			idx := -1
+			for _, f := range fields {
+				if f.name == name {
+					idx = f.index
+					break
+				}
+				if idx < 0 && strings.EqualFold(f.name, name) {
+					idx = f.index
+				}
+			}
+			if idx < 0 {
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decodeValue(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("msgpackrpc: cannot decode a map into %s", v.Type())
+}
+
+// setScalar sets v to x, a value decoded by decodeAny other than arrays
+// and maps.
+func setScalar(v reflect.Value, x interface{}) error {
+	xv := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Bool:
+		if b, ok := x.(bool); ok {
+			v.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := x.(type) {
+		case int64:
+			if !v.OverflowInt(n) {
+				v.SetInt(n)
+				return nil
+			}
+		case uint64:
+			if n <= math.MaxInt64 && !v.OverflowInt(int64(n)) {
+				v.SetInt(int64(n))
+				return nil
+			}
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch n := x.(type) {
+		case int64:
+			if n >= 0 && !v.OverflowUint(uint64(n)) {
+				v.SetUint(uint64(n))
+				return nil
+			}
+		case uint64:
+			if !v.OverflowUint(n) {
+				v.SetUint(n)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := x.(type) {
+		case int64:
+			v.SetFloat(float64(n))
+			return nil
+		case uint64:
+			v.SetFloat(float64(n))
+			return nil
+		case float64:
+			v.SetFloat(n)
+			return nil
+		}
+	case reflect.String:
+		switch s := x.(type) {
+		case string:
+			v.SetString(s)
+			return nil
+		case []byte:
+			v.SetString(string(s))
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := x.(type) {
+			case []byte:
+				v.SetBytes(b)
+				return nil
+			case string:
+				v.SetBytes([]byte(b))
+				return nil
+			}
+		}
+	case reflect.Struct:
+		if t, ok := x.(time.Time); ok && v.Type() == typeOfTime {
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	if xv.Type().AssignableTo(v.Type()) {
+		v.Set(xv)
+		return nil
+	}
+	return fmt.Errorf("msgpackrpc: cannot decode %T into %s", x, v.Type())
+}
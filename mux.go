@@ -0,0 +1,499 @@
+package birpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrStreamReset is returned by the MuxStreams reset by the other end, or
+// refused by it.
+var ErrStreamReset = errors.New("rpc: stream reset")
+
+var errMuxProtocol = errors.New("rpc: mux protocol error")
+
+// The types of the frames of a Mux.
+const (
+	muxOpen   = iota // opens a stream, the data naming it
+	muxData          // data of a stream
+	muxWindow        // grows the send window of a stream by the length
+	muxClose         // no more data on the stream
+	muxReset         // the stream is abandoned
+)
+
+const (
+	muxHeader    = 9         // type, stream ID and length
+	muxWindowMax = 256 << 10 // bytes sent on a stream ahead of its reads
+	muxFrameMax  = 32 << 10  // data carried by a frame
+	muxBacklog   = 64        // streams waiting to be accepted
+)
+
+// Mux multiplexes independent streams over one connection, letting several
+// sessions, each with its own codec or authentication, share it. Each
+// stream is a net.Conn on its own, with the writes limited by the window
+// of data the other end agreed to buffer, so that a stream not read does
+// not stall the others.
+//
+// Both ends open and accept streams; Mux implements net.Listener for
+// the latter, so that a Server can Accept them.
+type Mux struct {
+	conn   io.ReadWriteCloser
+	wmu    sync.Mutex // serializes the writes of the frames
+	accept chan *MuxStream
+
+	mu      sync.Mutex
+	streams map[uint32]*MuxStream
+	nextID  uint32
+	err     error         // why the Mux is closed
+	done    chan struct{} // closed with the Mux
+}
+
+// NewMux returns a Mux over conn. The ends must pass different values for
+// dialer, the end which dialed conn typically passing true, so that the
+// IDs of the streams they open do not clash.
+func NewMux(conn io.ReadWriteCloser, dialer bool) *Mux {
+	m := &Mux{
+		conn:    conn,
+		accept:  make(chan *MuxStream, muxBacklog),
+		streams: make(map[uint32]*MuxStream),
+		nextID:  2,
+		done:    make(chan struct{}),
+	}
+	if dialer {
+		m.nextID = 1
+	}
+	go m.input()
+	return m
+}
+
+// OpenStream opens a stream, named for the other end to tell the streams
+// apart.
+func (m *Mux) OpenStream(name string) (*MuxStream, error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil, m.err
+	}
+	s := newMuxStream(m, m.nextID, name)
+	m.nextID += 2
+	m.streams[s.id] = s
+	m.mu.Unlock()
+	if err := m.writeFrame(muxOpen, s.id, []byte(name)); err != nil {
+		m.remove(s.id)
+		return nil, err
+	}
+	return s, nil
+}
+
+// AcceptStream waits for the next stream opened by the other end.
+func (m *Mux) AcceptStream() (*MuxStream, error) {
+	select {
+	case s := <-m.accept:
+		return s, nil
+	case <-m.done:
+		return nil, m.err
+	}
+}
+
+// Accept implements net.Listener, waiting for the next stream.
+func (m *Mux) Accept() (net.Conn, error) {
+	s, err := m.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Addr returns the local address of the connection, if it is a network
+// connection.
+func (m *Mux) Addr() net.Addr {
+	if conn, ok := m.conn.(net.Conn); ok {
+		return conn.LocalAddr()
+	}
+	return muxAddr{}
+}
+
+// Close closes the connection, and with it all the streams.
+func (m *Mux) Close() error {
+	if !m.shutdown(ErrShutdown) {
+		return ErrShutdown
+	}
+	return nil
+}
+
+// Done returns a channel closed once the Mux is closed.
+func (m *Mux) Done() <-chan struct{} {
+	return m.done
+}
+
+// shutdown closes the Mux for err, reporting whether it was open.
+func (m *Mux) shutdown(err error) bool {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return false
+	}
+	m.err = err
+	close(m.done)
+	m.mu.Unlock()
+	m.conn.Close()
+	return true
+}
+
+func (m *Mux) writeFrame(typ byte, id uint32, data []byte) error {
+	return m.writeHeader(typ, id, uint32(len(data)), data)
+}
+
+// writeHeader writes a frame whose length field is n, followed by data.
+func (m *Mux) writeHeader(typ byte, id, n uint32, data []byte) error {
+	frame := make([]byte, muxHeader+len(data))
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:], id)
+	binary.BigEndian.PutUint32(frame[5:], n)
+	copy(frame[muxHeader:], data)
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	select {
+	case <-m.done:
+		return m.err
+	default:
+	}
+	if _, err := m.conn.Write(frame); err != nil {
+		m.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+func (m *Mux) stream(id uint32) *MuxStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.streams[id]
+}
+
+func (m *Mux) remove(id uint32) {
+	m.mu.Lock()
+	delete(m.streams, id)
+	m.mu.Unlock()
+}
+
+// input reads the frames until the connection fails.
+func (m *Mux) input() {
+	var hdr [muxHeader]byte
+	var err error
+	for err == nil {
+		if _, err = io.ReadFull(m.conn, hdr[:]); err != nil {
+			break
+		}
+		typ, id, n := hdr[0], binary.BigEndian.Uint32(hdr[1:]), binary.BigEndian.Uint32(hdr[5:])
+		var data []byte
+		if typ == muxOpen || typ == muxData {
+			if n > muxWindowMax {
+				err = errMuxProtocol
+				break
+			}
+			data = make([]byte, n)
+			if _, err = io.ReadFull(m.conn, data); err != nil {
+				break
+			}
+		}
+		err = m.handle(typ, id, n, data)
+	}
+	if err == io.EOF {
+		err = ErrShutdown
+	}
+	m.shutdown(err)
+}
+
+func (m *Mux) handle(typ byte, id, n uint32, data []byte) error {
+	if typ == muxOpen {
+		m.mu.Lock()
+		if m.streams[id] != nil {
+			m.mu.Unlock()
+			return errMuxProtocol
+		}
+		s := newMuxStream(m, id, string(data))
+		m.streams[id] = s
+		m.mu.Unlock()
+		select {
+		case m.accept <- s:
+		default:
+			// the backlog is full
+			m.remove(id)
+			go m.writeFrame(muxReset, id, nil)
+		}
+		return nil
+	}
+	s := m.stream(id)
+	if s == nil {
+		// a stream closed locally, or reset
+		return nil
+	}
+	switch typ {
+	case muxData:
+		return s.receive(data)
+	case muxWindow:
+		s.mu.Lock()
+		s.sendWindow += n
+		s.mu.Unlock()
+		notify(s.sendReady)
+	case muxClose:
+		s.mu.Lock()
+		s.remoteClosed = true
+		done := s.closed
+		s.mu.Unlock()
+		notify(s.recvReady)
+		if done {
+			m.remove(id)
+		}
+	case muxReset:
+		s.mu.Lock()
+		s.reset = true
+		s.mu.Unlock()
+		notify(s.recvReady)
+		notify(s.sendReady)
+		m.remove(id)
+	default:
+		return errMuxProtocol
+	}
+	return nil
+}
+
+// notify wakes up the goroutine waiting on c, if any.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// MuxStream is a stream of a Mux.
+type MuxStream struct {
+	mux  *Mux
+	id   uint32
+	name string
+
+	recvReady chan struct{}
+	sendReady chan struct{}
+
+	mu            sync.Mutex
+	buf           []byte // received, not read yet
+	recvWindow    uint32 // bytes the other end may send
+	consumed      uint32 // bytes read since the last window update
+	sendWindow    uint32 // bytes the other end agreed to receive
+	remoteClosed  bool   // no more data will be received
+	closed        bool   // closed locally
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newMuxStream(m *Mux, id uint32, name string) *MuxStream {
+	return &MuxStream{
+		mux:        m,
+		id:         id,
+		name:       name,
+		recvReady:  make(chan struct{}, 1),
+		sendReady:  make(chan struct{}, 1),
+		recvWindow: muxWindowMax,
+		sendWindow: muxWindowMax,
+	}
+}
+
+// Name returns the name given by the end which opened the stream.
+func (s *MuxStream) Name() string {
+	return s.name
+}
+
+func (s *MuxStream) receive(data []byte) error {
+	s.mu.Lock()
+	if uint32(len(data)) > s.recvWindow {
+		s.mu.Unlock()
+		return errMuxProtocol
+	}
+	s.recvWindow -= uint32(len(data))
+	if s.closed {
+		// nobody reads anymore, give the window back
+		s.recvWindow += uint32(len(data))
+		s.mu.Unlock()
+		go s.mux.writeHeader(muxWindow, s.id, uint32(len(data)), nil)
+		return nil
+	}
+	s.buf = append(s.buf, data...)
+	s.mu.Unlock()
+	notify(s.recvReady)
+	return nil
+}
+
+// Read reads the data received, returning io.EOF once the other end
+// closed the stream.
+func (s *MuxStream) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		switch {
+		case s.closed:
+			s.mu.Unlock()
+			return 0, ErrShutdown
+		case len(s.buf) != 0:
+			n := copy(p, s.buf)
+			s.buf = s.buf[n:]
+			s.consumed += uint32(n)
+			var update uint32
+			if s.consumed >= muxWindowMax/2 {
+				update, s.consumed = s.consumed, 0
+				s.recvWindow += update
+			}
+			s.mu.Unlock()
+			if update != 0 {
+				s.mux.writeHeader(muxWindow, s.id, update, nil)
+			}
+			return n, nil
+		case s.reset:
+			s.mu.Unlock()
+			return 0, ErrStreamReset
+		case s.remoteClosed:
+			s.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := s.readDeadline
+		s.mu.Unlock()
+		if err := s.wait(s.recvReady, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes p, waiting for the other end to read the data sent ahead
+// once its window is full.
+func (s *MuxStream) Write(p []byte) (int, error) {
+	var written int
+	for len(p) != 0 {
+		s.mu.Lock()
+		switch {
+		case s.closed:
+			s.mu.Unlock()
+			return written, ErrShutdown
+		case s.reset:
+			s.mu.Unlock()
+			return written, ErrStreamReset
+		}
+		n := uint32(len(p))
+		if n > muxFrameMax {
+			n = muxFrameMax
+		}
+		if n > s.sendWindow {
+			n = s.sendWindow
+		}
+		if n == 0 {
+			deadline := s.writeDeadline
+			s.mu.Unlock()
+			if err := s.wait(s.sendReady, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		s.sendWindow -= n
+		s.mu.Unlock()
+		if err := s.mux.writeFrame(muxData, s.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += int(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// wait waits for c to be notified, for the deadline or for the Mux to be
+// closed.
+func (s *MuxStream) wait(c chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-c:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-s.mux.done:
+		return s.mux.err
+	}
+}
+
+// Close closes the stream, telling the other end that no more data
+// follows. The data received afterwards is dropped.
+func (s *MuxStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrShutdown
+	}
+	s.closed = true
+	s.buf = nil
+	done := s.remoteClosed || s.reset
+	reset := s.reset
+	s.mu.Unlock()
+	notify(s.recvReady)
+	notify(s.sendReady)
+	if done {
+		s.mux.remove(s.id)
+	}
+	if reset {
+		return nil
+	}
+	return s.mux.writeFrame(muxClose, s.id, nil)
+}
+
+// LocalAddr returns the local address of the connection of the Mux.
+func (s *MuxStream) LocalAddr() net.Addr {
+	return s.mux.Addr()
+}
+
+// RemoteAddr returns the remote address of the connection of the Mux.
+func (s *MuxStream) RemoteAddr() net.Addr {
+	if conn, ok := s.mux.conn.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return muxAddr{}
+}
+
+// SetDeadline sets the read and write deadlines of the stream.
+func (s *MuxStream) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline of the reads of the stream.
+func (s *MuxStream) SetReadDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.readDeadline = t
+	s.mu.Unlock()
+	notify(s.recvReady)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline of the writes of the stream.
+func (s *MuxStream) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	s.writeDeadline = t
+	s.mu.Unlock()
+	notify(s.sendReady)
+	return nil
+}
+
+// muxAddr is the address of the Muxes over connections other than network
+// ones.
+type muxAddr struct{}
+
+func (muxAddr) Network() string { return "mux" }
+func (muxAddr) String() string  { return "mux" }
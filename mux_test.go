@@ -0,0 +1,154 @@
+package birpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func newMuxPair(t *testing.T) (*Mux, *Mux) {
+	a, b := net.Pipe()
+	ma, mb := NewMux(a, true), NewMux(b, false)
+	t.Cleanup(func() {
+		ma.Close()
+		mb.Close()
+	})
+	return ma, mb
+}
+
+func TestMux(t *testing.T) {
+	ma, mb := newMuxPair(t)
+	server := NewServer()
+	server.Register(new(Arith))
+	bserver := NewBirpcServer()
+	bserver.Register(new(Arith))
+	go func() {
+		// the sessions are routed by the names of their streams
+		for {
+			s, err := mb.AcceptStream()
+			if err != nil {
+				return
+			}
+			switch s.Name() {
+			case "billing":
+				go server.ServeConn(s)
+			case "events":
+				go bserver.ServeConn(s)
+			default:
+				s.Close()
+			}
+		}
+	}()
+
+	s1, err := ma.OpenStream("billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := ma.OpenStream("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, bclient := NewClient(s1), NewBirpcClient(s2)
+	for i := 0; i < 10; i++ {
+		var r1, r2 Reply
+		call := client.Go("Arith.Add", Args{i, 1}, &r1, nil)
+		if err := bclient.Call(context.Background(), "Arith.Mul", &Args{i, 2}, &r2); err != nil || r2.C != 2*i {
+			t.Errorf("unexpected reply %d: %v", r2.C, err)
+		}
+		if <-call.Done; call.Error != nil || r1.C != i+1 {
+			t.Errorf("unexpected reply %d: %v", r1.C, call.Error)
+		}
+	}
+
+	// an unknown session is refused
+	s3, _ := ma.OpenStream("unknown")
+	if _, err := s3.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	// closing a session leaves the others up
+	client.Close()
+	var r Reply
+	if err := bclient.Call(context.Background(), "Arith.Add", Args{1, 1}, &r); err != nil || r.C != 2 {
+		t.Errorf("unexpected reply %d: %v", r.C, err)
+	}
+
+	ma.Close()
+	if err := bclient.Call(context.Background(), "Arith.Add", Args{1, 1}, &r); err == nil {
+		t.Error("expected an error once the Mux is closed")
+	}
+	if _, err := ma.OpenStream("billing"); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown, got %v", err)
+	}
+	select {
+	case <-mb.Done():
+	case <-time.After(time.Second):
+		t.Error("the other end is still up")
+	}
+	if err := server.Accept(mb); err == nil {
+		t.Error("expected Accept to fail on a closed Mux")
+	}
+}
+
+func TestMuxFlowControl(t *testing.T) {
+	ma, mb := newMuxPair(t)
+	data := bytes.Repeat([]byte("0123456789"), muxWindowMax/5)
+	written := make(chan error, 1)
+	s, _ := ma.OpenStream("bulk")
+	go func() {
+		_, err := s.Write(data)
+		s.Close()
+		written <- err
+	}()
+	bulk, _ := mb.AcceptStream()
+
+	// the writer waits for the reads, the other streams go on
+	select {
+	case err := <-written:
+		t.Fatalf("the write did not wait for the window: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	echo, _ := ma.OpenStream("echo")
+	peer, _ := mb.AcceptStream()
+	go io.Copy(peer, peer)
+	echo.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(echo, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("unexpected echo %q: %v", buf, err)
+	}
+
+	got, err := io.ReadAll(bulk)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read %d bytes of %d: %v", len(got), len(data), err)
+	}
+	if err := <-written; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMuxDeadline(t *testing.T) {
+	ma, mb := newMuxPair(t)
+	s, _ := ma.OpenStream("")
+	peer, _ := mb.AcceptStream()
+	s.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := s.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	s.SetReadDeadline(time.Time{})
+	peer.Write([]byte("x"))
+	if _, err := s.Read(make([]byte, 1)); err != nil {
+		t.Error(err)
+	}
+
+	// a write over the window times out
+	s.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, err := s.Write(make([]byte, 2*muxWindowMax)); !errors.Is(err, os.ErrDeadlineExceeded) || n != muxWindowMax {
+		t.Errorf("expected a timeout after %d bytes, got %d: %v", muxWindowMax, n, err)
+	}
+}
@@ -0,0 +1,105 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// preambleMagic starts the preamble a client sends to declare its codec,
+// followed by the codec name and a newline.
+const preambleMagic = "BIRPC "
+
+// preambleMax bounds the codec names read from the preambles.
+const preambleMax = 64
+
+var errPreamble = errors.New("rpc: invalid preamble")
+
+// WritePreamble declares the codec of the connection to a server accepting
+// negotiation, see NegotiateServerCodec. It is written before any message.
+func WritePreamble(w io.Writer, codec string) error {
+	if codec == "" {
+		codec = "gob"
+	}
+	if len(codec) > preambleMax {
+		return errPreamble
+	}
+	_, err := w.Write([]byte(preambleMagic + codec + "\n"))
+	return err
+}
+
+// readPreamble reads the codec name declared on conn, returning def for the
+// connections starting without preamble, along with the connection to pass
+// to the codec.
+func readPreamble(conn net.Conn, def string) (string, net.Conn, error) {
+	magic := make([]byte, len(preambleMagic))
+	n, err := io.ReadFull(conn, magic)
+	if string(magic) != preambleMagic {
+		if n != 0 && (err == nil || err == io.ErrUnexpectedEOF) {
+			// the first message of a client not negotiating
+			return def, &preambleConn{Conn: conn, buf: magic[:n]}, nil
+		}
+		return "", nil, err
+	}
+	var name []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", nil, err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		if len(name) == preambleMax {
+			return "", nil, errPreamble
+		}
+		name = append(name, b[0])
+	}
+	return string(name), conn, nil
+}
+
+// NegotiateServerCodec returns the server codec declared by the client with
+// WritePreamble on conn, or the codec def for the clients which do not
+// declare one, letting a listener serve several codecs. It waits for the
+// client to write first.
+func NegotiateServerCodec(conn net.Conn, def string) (ServerCodec, error) {
+	name, conn, err := readPreamble(conn, def)
+	if err != nil {
+		return nil, err
+	}
+	newCodec, err := getServerCodec(name)
+	if err != nil {
+		return nil, err
+	}
+	return newCodec(conn), nil
+}
+
+// NegotiateBirpcCodec is like NegotiateServerCodec for BirpcServer.
+func NegotiateBirpcCodec(conn net.Conn, def string) (BirpcCodec, error) {
+	name, conn, err := readPreamble(conn, def)
+	if err != nil {
+		return nil, err
+	}
+	newCodec, err := getBirpcCodec(name)
+	if err != nil {
+		return nil, err
+	}
+	return newCodec(conn), nil
+}
+
+// preambleConn gives back the bytes read looking for a preamble.
+type preambleConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (c *preambleConn) Read(p []byte) (int, error) {
+	if len(c.buf) != 0 {
+		n := copy(p, c.buf)
+		c.buf = c.buf[n:]
+		return n, nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *preambleConn) unwrapConn() net.Conn { return c.Conn }
@@ -0,0 +1,74 @@
+package birpc
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestNegotiate(t *testing.T) {
+	// a second codec, counting its connections
+	var counted int32
+	RegisterServerCodec("counted-gob", func(conn io.ReadWriteCloser) ServerCodec {
+		atomic.AddInt32(&counted, 1)
+		return NewServerCodec(conn)
+	})
+	RegisterClientCodec("counted-gob", NewClientCodec)
+
+	l, addr := listenTCP()
+	l.Close()
+	server, err := NewServerFromConfig(Config{
+		Listeners: []ListenerConfig{{Address: addr, Negotiate: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Register(new(Arith))
+	go server.ListenAndServe()
+
+	ctx := context.Background()
+	var client *Client
+	for i := 0; i < 100; i++ {
+		if client, err = DialTarget(ctx, "birpc://"+addr+"?codec=counted-gob&negotiate=true"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Add", &Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("Add: %v %v", reply.C, err)
+	}
+	if n := atomic.LoadInt32(&counted); n != 1 {
+		t.Errorf("expected the declared codec to serve 1 connection, got %d", n)
+	}
+
+	// the clients without preamble get the codec of the listener
+	plain, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if err = plain.Call(ctx, "Arith.Add", &Args{2, 2}, reply); err != nil || reply.C != 4 {
+		t.Errorf("Add: %v %v", reply.C, err)
+	}
+
+	// an unknown codec closes the connection
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	WritePreamble(conn, "xml")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package birpc
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Chain calls its peer back n times and replies with the depth reached.
+type Chain struct {
+	mu   sync.Mutex
+	seen []int
+}
+
+func (c *Chain) Next(ctx *context.Context, n int, depth *int) error {
+	if n == 0 {
+		*depth = CallDepth(ctx)
+		return nil
+	}
+	return ctx.Client.Call(ctx, "Chain.Next", n-1, depth)
+}
+
+func (c *Chain) Record(ctx *context.Context, n int) error {
+	time.Sleep(time.Duration(5-n%5) * time.Millisecond)
+	c.mu.Lock()
+	c.seen = append(c.seen, n)
+	c.mu.Unlock()
+	return nil
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n.
+func waitGoroutines(t *testing.T, n int) {
+	t.Helper()
+	if !eventually(func() bool { return runtime.NumGoroutine() <= n }) {
+		t.Errorf("expected at most %d goroutines, got %d", n, runtime.NumGoroutine())
+	}
+}
+
+func TestNestedCalls(t *testing.T) {
+	for name, opts := range map[string][]ServerOption{
+		"concurrent": nil,
+		"serial":     {SerialRequests()},
+	} {
+		goroutines := runtime.NumGoroutine()
+		server := NewBirpcServer(opts...)
+		server.Register(new(Chain), NoReplyMethods())
+		client := NewBirpcClient(newBirpcPipe(t, server), opts...)
+		client.Register(new(Chain), NoReplyMethods())
+
+		ctx := context.Background()
+		for n := 0; n <= 16; n++ {
+			var depth int
+			if err := client.Call(ctx, "Chain.Next", n, &depth); err != nil {
+				t.Fatalf("%s: chain of %d: %v", name, n, err)
+			}
+			if depth != n {
+				t.Errorf("%s: expected depth %d, got %d", name, n, depth)
+			}
+		}
+		// concurrent chains sharing the connection
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				var depth int
+				if err := client.Call(ctx, "Chain.Next", n, &depth); err != nil || depth != n {
+					t.Errorf("%s: chain of %d reached %d: %v", name, n, depth, err)
+				}
+			}(i + 4)
+		}
+		wg.Wait()
+		client.Close()
+		<-client.DisconnectNotify()
+		waitGoroutines(t, goroutines)
+	}
+}
+
+func TestSerialRequests(t *testing.T) {
+	chain := new(Chain)
+	server := NewBirpcServer(SerialRequests())
+	server.Register(chain, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+
+	var exp []int
+	for i := 0; i < 20; i++ {
+		client.Notify("Chain.Record", i)
+		exp = append(exp, i)
+	}
+	// the later calls are faster, so only the serial serving keeps them
+	// in order
+	if err := client.Call(context.Background(), "Chain.Record", 20, nil); err != nil {
+		t.Fatal(err)
+	}
+	exp = append(exp, 20)
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	if len(chain.seen) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, chain.seen)
+	}
+	for i := range exp {
+		if chain.seen[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, chain.seen)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package birpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+var (
+	// ErrOutboxFull is returned when too many calls are buffered for an
+	// offline client.
+	ErrOutboxFull = errors.New("rpc: outbox full")
+	// ErrOutboxExpired is returned for the buffered calls which were not
+	// delivered within the TTL of the outbox.
+	ErrOutboxExpired = errors.New("rpc: outbox call expired")
+)
+
+// Outbox routes server-initiated calls to bidirectional clients known by
+// an identity chosen by the application, typically sent by the clients
+// when they connect. While a client is offline its calls are buffered, up
+// to a limit and for a limited time, and they are delivered in order once
+// a client attaches again with the same identity.
+type Outbox struct {
+	maxQueued int
+	ttl       time.Duration
+	store     OutboxStore // nil unless NewOutboxWithStore is used
+
+	mu      sync.Mutex
+	clients map[string]*outboxClient
+}
+
+type outboxClient struct {
+	conn     ClientConnector // nil while offline
+	flushing bool
+	queue    []*outboxCall
+}
+
+type outboxCall struct {
+	serviceMethod string
+	args, reply   interface{}
+	expires       time.Time
+	done          chan error // nil for Send
+	msgID         uint64     // ID in the store, 0 if not stored
+}
+
+// NewOutbox returns an Outbox buffering up to maxQueued calls per offline
+// client, each for up to ttl. A zero ttl keeps the calls until delivered.
+func NewOutbox(maxQueued int, ttl time.Duration) *Outbox {
+	return &Outbox{
+		maxQueued: maxQueued,
+		ttl:       ttl,
+		clients:   make(map[string]*outboxClient),
+	}
+}
+
+// NewOutboxWithStore is like NewOutbox but keeps the calls buffered with
+// Send in store, loading the ones already there. With a persistent store
+// they survive restarts and are delivered at least once: a call is only
+// removed from the store after the client replied to it, so Send never
+// uses Notify. The calls made with Call are never stored since nobody
+// would wait for their reply after a restart.
+func NewOutboxWithStore(maxQueued int, ttl time.Duration, store OutboxStore) (o *Outbox, err error) {
+	o = NewOutbox(maxQueued, ttl)
+	o.store = store
+	clients, err := store.Clients()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range clients {
+		msgs, err := store.List(id)
+		if err != nil {
+			return nil, err
+		}
+		oc := o.client(id)
+		for _, msg := range msgs {
+			oc.queue = append(oc.queue, &outboxCall{
+				serviceMethod: msg.ServiceMethod,
+				args:          msg.Args,
+				expires:       msg.Expires,
+				msgID:         msg.ID,
+			})
+		}
+	}
+	return
+}
+
+// Attach binds the identity id to conn and delivers the calls buffered for
+// it. If conn is a BirpcClient it is detached when it disconnects.
+func (o *Outbox) Attach(id string, conn ClientConnector) {
+	o.mu.Lock()
+	oc := o.client(id)
+	oc.conn = conn
+	startFlush := !oc.flushing
+	oc.flushing = true
+	o.mu.Unlock()
+	if startFlush {
+		go o.flush(id, oc)
+	}
+	if dn, ok := conn.(interface{ DisconnectNotify() chan struct{} }); ok {
+		go func() {
+			<-dn.DisconnectNotify()
+			o.detach(id, conn)
+		}()
+	}
+}
+
+// Detach marks the client with identity id as offline.
+func (o *Outbox) Detach(id string) {
+	o.mu.Lock()
+	if oc, has := o.clients[id]; has {
+		oc.conn = nil
+		o.prune(id, oc)
+	}
+	o.mu.Unlock()
+}
+
+// detach marks the client offline if it is still bound to conn.
+func (o *Outbox) detach(id string, conn ClientConnector) {
+	o.mu.Lock()
+	if oc, has := o.clients[id]; has && oc.conn == conn {
+		oc.conn = nil
+		o.prune(id, oc)
+	}
+	o.mu.Unlock()
+}
+
+func (o *Outbox) client(id string) *outboxClient {
+	oc, has := o.clients[id]
+	if !has {
+		oc = new(outboxClient)
+		o.clients[id] = oc
+	}
+	return oc
+}
+
+// prune drops oc, the client with identity id, once offline with nothing
+// buffered. The lock must be held.
+func (o *Outbox) prune(id string, oc *outboxClient) {
+	if oc.conn == nil && !oc.flushing && len(oc.queue) == 0 && o.clients[id] == oc {
+		delete(o.clients, id)
+	}
+}
+
+// Call calls serviceMethod on the client with identity id. If the client
+// is offline, or older calls are still buffered for it, the call waits to
+// be delivered until ctx is done or the TTL of the outbox expires.
+func (o *Outbox) Call(ctx *context.Context, id, serviceMethod string, args, reply interface{}) error {
+	o.mu.Lock()
+	oc := o.client(id)
+	if conn := oc.conn; conn != nil && !oc.flushing {
+		o.mu.Unlock()
+		return conn.Call(ctx, serviceMethod, args, reply)
+	}
+	call := o.newCall(serviceMethod, args, reply)
+	call.done = make(chan error, 1)
+	dropped, err := o.enqueue(id, oc, call)
+	o.mu.Unlock()
+	o.forget(id, dropped...)
+	if err != nil {
+		return err
+	}
+	var expired <-chan time.Time
+	if o.ttl > 0 {
+		timer := time.NewTimer(o.ttl)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err = <-call.done:
+		return err
+	case <-ctx.Done():
+		o.cancel(id, call)
+		return ctx.Err()
+	case <-expired:
+		o.cancel(id, call)
+		return ErrOutboxExpired
+	}
+}
+
+// Send is like Call but does not wait for the call to be delivered and
+// discards its reply. It fails only if the outbox of an offline client is
+// full.
+//
+// The buffered calls are redelivered when the connection breaks before
+// they are answered. If their arguments embed an Idempotency with an empty
+// key, a new key is set before buffering them, so receivers using
+// IdempotencyCache serve them only once, when connected over TLS: without a
+// verified certificate the keys are scoped to a single connection.
+func (o *Outbox) Send(id, serviceMethod string, args interface{}) error {
+	o.mu.Lock()
+	oc := o.client(id)
+	if conn := oc.conn; conn != nil && !oc.flushing && o.store == nil {
+		if notifier, ok := conn.(interface {
+			Notify(string, interface{}) error
+		}); ok {
+			err := notifier.Notify(serviceMethod, args)
+			o.mu.Unlock()
+			return err
+		}
+	}
+	call := o.newCall(serviceMethod, args, nil)
+	if o.store != nil {
+		if o.maxQueued > 0 && len(oc.queue) >= o.maxQueued {
+			o.mu.Unlock()
+			return ErrOutboxFull
+		}
+		msg := &OutboxMessage{Client: id, ServiceMethod: serviceMethod, Args: args, Expires: call.expires}
+		if err := o.store.Append(msg); err != nil {
+			o.prune(id, oc)
+			o.mu.Unlock()
+			return err
+		}
+		call.msgID = msg.ID
+	}
+	dropped, err := o.enqueue(id, oc, call)
+	o.mu.Unlock()
+	if err != nil {
+		dropped = append(dropped, call)
+	}
+	o.forget(id, dropped...)
+	return err
+}
+
+// Queued returns the number of calls buffered for the identity id.
+func (o *Outbox) Queued(id string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if oc, has := o.clients[id]; has {
+		return len(oc.queue)
+	}
+	return 0
+}
+
+func (o *Outbox) newCall(serviceMethod string, args, reply interface{}) *outboxCall {
+	call := &outboxCall{serviceMethod: serviceMethod, args: args, reply: reply}
+	// buffered calls may be delivered twice, if the connection breaks
+	// before their reply arrives
+	if ik, ok := args.(interface {
+		Idempotent
+		SetIdempotencyKey(string)
+	}); ok && ik.IdempotencyKey() == "" {
+		ik.SetIdempotencyKey(NewIdempotencyKey())
+	}
+	if o.ttl > 0 {
+		call.expires = time.Now().Add(o.ttl)
+	}
+	return call
+}
+
+// enqueue buffers call, dropping the expired calls first and returning
+// them to be forgotten once the lock is released. The lock must be held.
+func (o *Outbox) enqueue(id string, oc *outboxClient, call *outboxCall) (dropped []*outboxCall, err error) {
+	now := time.Now()
+	queue := oc.queue[:0]
+	for _, c := range oc.queue {
+		if c.expires.IsZero() || now.Before(c.expires) {
+			queue = append(queue, c)
+		} else {
+			dropped = append(dropped, c)
+		}
+	}
+	oc.queue = queue
+	if o.maxQueued > 0 && len(oc.queue) >= o.maxQueued {
+		return dropped, ErrOutboxFull
+	}
+	oc.queue = append(oc.queue, call)
+	if oc.conn != nil && !oc.flushing {
+		oc.flushing = true
+		go o.flush(id, oc)
+	}
+	return dropped, nil
+}
+
+// forget removes calls from the store, the ones stored. It does I/O, so
+// the lock must not be held.
+func (o *Outbox) forget(id string, calls ...*outboxCall) {
+	for _, call := range calls {
+		if call.msgID == 0 {
+			continue
+		}
+		if err := o.store.Delete(id, call.msgID); err != nil {
+			debugln("rpc: outbox removal of", call.serviceMethod, "for", id, "failed:", err)
+		}
+	}
+}
+
+// cancel removes call from the queue of id, if still there.
+func (o *Outbox) cancel(id string, call *outboxCall) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	oc, has := o.clients[id]
+	if !has {
+		return
+	}
+	for i, c := range oc.queue {
+		if c == call {
+			oc.queue = append(oc.queue[:i], oc.queue[i+1:]...)
+			o.prune(id, oc)
+			return
+		}
+	}
+}
+
+// flush delivers the queued calls of oc in order while it is online. The
+// calls failing because of the connection are put back in the queue and
+// the client is considered offline. The TTL of the outbox bounds the
+// deliveries too, the calls answered past it failing with
+// ErrOutboxExpired.
+func (o *Outbox) flush(id string, oc *outboxClient) {
+	for {
+		o.mu.Lock()
+		conn := oc.conn
+		if conn == nil || len(oc.queue) == 0 {
+			oc.flushing = false
+			o.prune(id, oc)
+			o.mu.Unlock()
+			return
+		}
+		call := oc.queue[0]
+		oc.queue = oc.queue[1:]
+		o.mu.Unlock()
+		if !call.expires.IsZero() && time.Now().After(call.expires) {
+			o.forget(id, call)
+			continue
+		}
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if !call.expires.IsZero() {
+			ctx, cancel = context.WithDeadline(ctx, call.expires)
+		}
+		err := conn.Call(ctx, call.serviceMethod, call.args, call.reply)
+		if ctx.Err() != nil {
+			// checked first, the deadline errors being net.Errors
+			err = ErrOutboxExpired
+		}
+		cancel()
+		if err != nil && err != ErrOutboxExpired && IsConnectionError(err) {
+			o.mu.Lock()
+			oc.queue = append([]*outboxCall{call}, oc.queue...)
+			if oc.conn == conn {
+				oc.conn = nil
+			}
+			o.mu.Unlock()
+			continue
+		}
+		o.forget(id, call)
+		if call.done != nil {
+			call.done <- err
+		} else if err != nil {
+			debugln("rpc: outbox delivery of", call.serviceMethod, "to", id, "failed:", err)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package birpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMessage is a call buffered by an Outbox with Send, as kept by an
+// OutboxStore.
+type OutboxMessage struct {
+	ID            uint64 // assigned by the store, growing with every Append
+	Client        string // identity of the client
+	ServiceMethod string
+	// Args are the call arguments. The stores persisting the messages
+	// encode them with gob, so their concrete types must be registered
+	// with gob.Register.
+	Args    interface{}
+	Expires time.Time // zero if the message does not expire
+}
+
+// OutboxStore keeps the calls buffered by an Outbox, see NewOutboxWithStore.
+// A persistent store lets the buffered calls survive restarts: a message
+// is only deleted once delivered, so it is delivered at least once.
+type OutboxStore interface {
+	// Append stores msg, setting its ID.
+	Append(msg *OutboxMessage) error
+	// List returns the messages of client in the order they were added.
+	List(client string) ([]*OutboxMessage, error)
+	// Delete removes the message id of client.
+	Delete(client string, id uint64) error
+	// Clients returns the identities with stored messages.
+	Clients() ([]string, error)
+}
+
+// NewMemoryOutboxStore returns an OutboxStore keeping the messages in
+// memory, which is what an Outbox does without store.
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{msgs: make(map[string][]*OutboxMessage)}
+}
+
+type memoryOutboxStore struct {
+	mu     sync.Mutex
+	lastID uint64
+	msgs   map[string][]*OutboxMessage
+}
+
+func (s *memoryOutboxStore) Append(msg *OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	msg.ID = s.lastID
+	s.msgs[msg.Client] = append(s.msgs[msg.Client], msg)
+	return nil
+}
+
+func (s *memoryOutboxStore) List(client string) ([]*OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*OutboxMessage(nil), s.msgs[client]...), nil
+}
+
+func (s *memoryOutboxStore) Delete(client string, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.msgs[client]
+	for i, msg := range msgs {
+		if msg.ID == id {
+			s.msgs[client] = append(msgs[:i], msgs[i+1:]...)
+			break
+		}
+	}
+	if len(s.msgs[client]) == 0 {
+		delete(s.msgs, client)
+	}
+	return nil
+}
+
+func (s *memoryOutboxStore) Clients() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := make([]string, 0, len(s.msgs))
+	for client := range s.msgs {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	return clients, nil
+}
+
+func encodeOutboxMessage(msg *OutboxMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeOutboxMessage(b []byte) (*OutboxMessage, error) {
+	msg := new(OutboxMessage)
+	return msg, gob.NewDecoder(bytes.NewReader(b)).Decode(msg)
+}
+
+// NewFileOutboxStore returns an OutboxStore keeping every message in its
+// own file, under a directory per client inside dir.
+func NewFileOutboxStore(dir string) (OutboxStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &fileOutboxStore{dir: dir}
+	clients, err := s.Clients()
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		ids, err := s.ids(client)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) != 0 && ids[len(ids)-1] > s.lastID {
+			s.lastID = ids[len(ids)-1]
+		}
+	}
+	return s, nil
+}
+
+type fileOutboxStore struct {
+	dir    string
+	mu     sync.Mutex
+	lastID uint64
+}
+
+func (s *fileOutboxStore) clientDir(client string) string {
+	return filepath.Join(s.dir, url.PathEscape(client))
+}
+
+func (s *fileOutboxStore) msgFile(client string, id uint64) string {
+	return filepath.Join(s.clientDir(client), fmt.Sprintf("%020d.msg", id))
+}
+
+func (s *fileOutboxStore) Append(msg *OutboxMessage) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	msg.ID = s.lastID
+	b, err := encodeOutboxMessage(msg)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(s.clientDir(msg.Client), 0700); err != nil {
+		return
+	}
+	// write aside and rename, so a crash never leaves a partial message
+	path := s.msgFile(msg.Client, msg.ID)
+	if err = ioutil.WriteFile(path+".tmp", b, 0600); err != nil {
+		return
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// ids returns the sorted ids of the messages of client.
+func (s *fileOutboxStore) ids(client string) (ids []uint64, err error) {
+	files, err := ioutil.ReadDir(s.clientDir(client))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), ".msg") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), ".msg"), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return
+}
+
+func (s *fileOutboxStore) List(client string) (msgs []*OutboxMessage, err error) {
+	ids, err := s.ids(client)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		b, err := ioutil.ReadFile(s.msgFile(client, id))
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeOutboxMessage(b)
+		if err != nil {
+			return nil, errors.New("rpc: corrupted outbox message " + s.msgFile(client, id) + ": " + err.Error())
+		}
+		msgs = append(msgs, msg)
+	}
+	return
+}
+
+func (s *fileOutboxStore) Delete(client string, id uint64) error {
+	if err := os.Remove(s.msgFile(client, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(s.clientDir(client)) // only succeeds once empty
+	return nil
+}
+
+func (s *fileOutboxStore) Clients() (clients []string, err error) {
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		client, err := url.PathUnescape(d.Name())
+		if err != nil {
+			continue
+		}
+		clients = append(clients, client)
+	}
+	return
+}
+
+// RedisConn is the subset of a Redis connection used by the Redis
+// OutboxStore, matching the Do method of the common Redis clients; wrap
+// the other clients to provide it. Do must be safe for concurrent use.
+type RedisConn interface {
+	Do(command string, args ...interface{}) (reply interface{}, err error)
+}
+
+// NewRedisOutboxStore returns an OutboxStore keeping the messages in
+// Redis, under keys starting with prefix: a hash of messages per client,
+// the set of the clients and the counter of the message ids.
+func NewRedisOutboxStore(conn RedisConn, prefix string) OutboxStore {
+	return &redisOutboxStore{conn: conn, prefix: prefix}
+}
+
+type redisOutboxStore struct {
+	conn   RedisConn
+	prefix string
+}
+
+func (s *redisOutboxStore) msgsKey(client string) string {
+	return s.prefix + "outbox:" + client
+}
+
+func (s *redisOutboxStore) Append(msg *OutboxMessage) error {
+	id, err := s.conn.Do("INCR", s.prefix+"outbox_seq")
+	if err != nil {
+		return err
+	}
+	n, ok := id.(int64)
+	if !ok {
+		return fmt.Errorf("rpc: unexpected INCR reply %T", id)
+	}
+	msg.ID = uint64(n)
+	b, err := encodeOutboxMessage(msg)
+	if err != nil {
+		return err
+	}
+	if _, err = s.conn.Do("HSET", s.msgsKey(msg.Client), msg.ID, b); err != nil {
+		return err
+	}
+	_, err = s.conn.Do("SADD", s.prefix+"outbox_clients", msg.Client)
+	return err
+}
+
+func (s *redisOutboxStore) List(client string) (msgs []*OutboxMessage, err error) {
+	reply, err := s.conn.Do("HVALS", s.msgsKey(client))
+	if err != nil {
+		return
+	}
+	vals, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("rpc: unexpected HVALS reply %T", reply)
+	}
+	for _, v := range vals {
+		b, err := redisBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeOutboxMessage(b)
+		if err != nil {
+			return nil, errors.New("rpc: corrupted outbox message of " + client + ": " + err.Error())
+		}
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+	return
+}
+
+func (s *redisOutboxStore) Delete(client string, id uint64) error {
+	if _, err := s.conn.Do("HDEL", s.msgsKey(client), id); err != nil {
+		return err
+	}
+	if n, err := s.conn.Do("HLEN", s.msgsKey(client)); err != nil || n != int64(0) {
+		return err
+	}
+	_, err := s.conn.Do("SREM", s.prefix+"outbox_clients", client)
+	return err
+}
+
+func (s *redisOutboxStore) Clients() (clients []string, err error) {
+	reply, err := s.conn.Do("SMEMBERS", s.prefix+"outbox_clients")
+	if err != nil {
+		return
+	}
+	vals, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("rpc: unexpected SMEMBERS reply %T", reply)
+	}
+	for _, v := range vals {
+		b, err := redisBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, string(b))
+	}
+	sort.Strings(clients)
+	return
+}
+
+func redisBytes(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("rpc: unexpected Redis value %T", v)
+}
@@ -0,0 +1,174 @@
+package birpc
+
+import (
+	"encoding/gob"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements the commands used by the Redis outbox store.
+type fakeRedis struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	hashes map[string]map[string][]byte
+	sets   map[string]map[string]bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		counts: make(map[string]int64),
+		hashes: make(map[string]map[string][]byte),
+		sets:   make(map[string]map[string]bool),
+	}
+}
+
+func (r *fakeRedis) Do(command string, args ...interface{}) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := args[0].(string)
+	switch command {
+	case "INCR":
+		r.counts[key]++
+		return r.counts[key], nil
+	case "HSET":
+		if r.hashes[key] == nil {
+			r.hashes[key] = make(map[string][]byte)
+		}
+		r.hashes[key][fmt.Sprint(args[1])] = args[2].([]byte)
+		return int64(1), nil
+	case "HDEL":
+		delete(r.hashes[key], fmt.Sprint(args[1]))
+		return int64(1), nil
+	case "HLEN":
+		return int64(len(r.hashes[key])), nil
+	case "HVALS":
+		vals := []interface{}{}
+		for _, v := range r.hashes[key] {
+			vals = append(vals, v)
+		}
+		return vals, nil
+	case "SADD":
+		if r.sets[key] == nil {
+			r.sets[key] = make(map[string]bool)
+		}
+		r.sets[key][args[1].(string)] = true
+		return int64(1), nil
+	case "SREM":
+		delete(r.sets[key], args[1].(string))
+		return int64(1), nil
+	case "SMEMBERS":
+		vals := []interface{}{}
+		for v := range r.sets[key] {
+			vals = append(vals, v)
+		}
+		return vals, nil
+	}
+	return nil, fmt.Errorf("unknown command %s", command)
+}
+
+func TestOutboxStores(t *testing.T) {
+	gob.Register(&Args{})
+	fileStore, err := NewFileOutboxStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]OutboxStore{
+		"memory": NewMemoryOutboxStore(),
+		"file":   fileStore,
+		"redis":  NewRedisOutboxStore(newFakeRedis(), "test:"),
+	} {
+		expires := time.Now().Add(time.Hour).Round(0)
+		var ids []uint64
+		for i := 1; i <= 3; i++ {
+			msg := &OutboxMessage{Client: "node/1", ServiceMethod: "Balances.Update", Args: &Args{i, i}, Expires: expires}
+			if err := store.Append(msg); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			ids = append(ids, msg.ID)
+		}
+		store.Append(&OutboxMessage{Client: "node2", ServiceMethod: "Balances.Update", Args: 1})
+		if !sort.SliceIsSorted(ids, func(i, j int) bool { return ids[i] < ids[j] }) {
+			t.Errorf("%s: expected growing ids, got %v", name, ids)
+		}
+		if err := store.Delete("node/1", ids[1]); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		msgs, err := store.List("node/1")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var got []interface{}
+		for _, msg := range msgs {
+			got = append(got, msg.Args)
+			if !msg.Expires.Equal(expires) || msg.ServiceMethod != "Balances.Update" {
+				t.Errorf("%s: unexpected message %+v", name, msg)
+			}
+		}
+		if exp := []interface{}{&Args{1, 1}, &Args{3, 3}}; !reflect.DeepEqual(got, exp) {
+			t.Errorf("%s: expected %v, got %v", name, exp, got)
+		}
+		store.Delete("node2", msgs[0].ID+1) // not there
+		for _, msg := range msgs {
+			store.Delete("node/1", msg.ID)
+		}
+		if clients, err := store.Clients(); err != nil || !reflect.DeepEqual(clients, []string{"node2"}) {
+			t.Errorf("%s: expected node2 left, got %v %v", name, clients, err)
+		}
+	}
+}
+
+func TestOutboxRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileOutboxStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ob, err := NewOutboxWithStore(0, 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := ob.Send("node1", "Balances.Update", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a new process finds the calls buffered by the previous one
+	if store, err = NewFileOutboxStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if ob, err = NewOutboxWithStore(0, 0, store); err != nil {
+		t.Fatal(err)
+	}
+	if n := ob.Queued("node1"); n != 3 {
+		t.Fatalf("expected 3 calls restored, got %d", n)
+	}
+	balances := &Balances{}
+	server := NewBirpcServer()
+	server.Register(balances, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+	ob.Attach("node1", client)
+	ob.Send("node1", "Balances.Update", 4)
+	var got []int
+	eventually(func() bool {
+		balances.mu.Lock()
+		got = append([]int(nil), balances.updates...)
+		balances.mu.Unlock()
+		return len(got) >= 4
+	})
+	if exp := []int{1, 2, 3, 4}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	// removed from the store once delivered
+	if !eventually(func() bool {
+		clients, _ := store.Clients()
+		return len(clients) == 0
+	}) {
+		t.Error("expected the delivered calls to be removed from the store")
+	}
+}
@@ -0,0 +1,107 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestOutbox(t *testing.T) {
+	ob := NewOutbox(4, time.Second)
+	ctx := context.Background()
+
+	// buffered while the client is offline
+	for i := 1; i <= 3; i++ {
+		if err := ob.Send("node1", "Balances.Update", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balances := &Balances{}
+	server := NewBirpcServer()
+	server.Register(balances, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+
+	// the call waits behind the buffered ones
+	callErr := make(chan error, 1)
+	go func() {
+		callErr <- ob.Call(ctx, "node1", "Balances.Update", 5, nil)
+	}()
+	for ob.Queued("node1") != 4 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := ob.Send("node1", "Balances.Update", 4); err != ErrOutboxFull {
+		t.Errorf("expected %v, got %v", ErrOutboxFull, err)
+	}
+	ob.Attach("node1", client)
+	if err := <-callErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.Call(ctx, "node1", "Balances.Update", 6, nil); err != nil {
+		t.Fatal(err)
+	}
+	if exp := []int{1, 2, 3, 5, 6}; !reflect.DeepEqual(balances.updates, exp) {
+		t.Errorf("expected %v, got %v", exp, balances.updates)
+	}
+
+	// offline again after the client disconnects
+	client.Close()
+	<-client.DisconnectNotify()
+	time.Sleep(time.Millisecond)
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := ob.Call(ctx2, "node1", "Balances.Update", 7, nil); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if n := ob.Queued("node1"); n != 0 {
+		t.Errorf("expected the cancelled call to be removed, got %d queued", n)
+	}
+	ob.mu.Lock()
+	_, has := ob.clients["node1"]
+	ob.mu.Unlock()
+	if has {
+		t.Error("expected the offline client with nothing buffered to be dropped")
+	}
+
+	ob = NewOutbox(0, 5*time.Millisecond)
+	if err := ob.Call(ctx, "node2", "Balances.Update", 1, nil); err != ErrOutboxExpired {
+		t.Errorf("expected %v, got %v", ErrOutboxExpired, err)
+	}
+	ob.Send("node2", "Balances.Update", 1)
+	time.Sleep(10 * time.Millisecond)
+	ob.Send("node2", "Balances.Update", 2)
+	if n := ob.Queued("node2"); n != 1 {
+		t.Errorf("expected the expired call to be dropped, got %d queued", n)
+	}
+}
+
+func TestOutboxDeliveryTTL(t *testing.T) {
+	ob := NewOutbox(0, 20*time.Millisecond)
+	blocker := &Blocker{release: make(chan struct{})}
+	defer close(blocker.release)
+	server := NewBirpcServer()
+	server.Register(blocker, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+
+	if err := ob.Send("node1", "Blocker.Hold", 1); err != nil {
+		t.Fatal(err)
+	}
+	ob.Attach("node1", client)
+	// the delivery blocked in the client gives up with the TTL, keeping
+	// the client online
+	var conn ClientConnector
+	if !eventually(func() bool {
+		ob.mu.Lock()
+		defer ob.mu.Unlock()
+		oc := ob.clients["node1"]
+		conn = oc.conn
+		return !oc.flushing
+	}) {
+		t.Fatal("expected the delivery to give up with the TTL")
+	}
+	if conn != client {
+		t.Error("expected the client to stay attached")
+	}
+}
@@ -0,0 +1,57 @@
+package birpc
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// PanicReport describes a panic of a method recovered by RecoverPanics.
+type PanicReport struct {
+	ServiceMethod string
+	Conn          ConnID      // of the client, see Hello
+	Value         interface{} // passed to panic
+	Stack         []byte      // of the method when it panicked, nil unless captured
+}
+
+// RecoverPanics makes the server recover the panics of the methods it
+// serves, which otherwise crash the process: the calls fail with an error
+// coded CodeInternal, see ErrorCode, and the connection goes on. The
+// stack of the methods is captured if withStack, and the panics are passed
+// to onPanic, or logged if nil.
+func RecoverPanics(withStack bool, onPanic func(PanicReport)) ServerOption {
+	return func(server *basicServer) {
+		server.panics = &panicRecovery{withStack: withStack, onPanic: onPanic}
+	}
+}
+
+type panicRecovery struct {
+	withStack bool
+	onPanic   func(PanicReport)
+}
+
+// protect runs the method of the call of serviceMethod on conn, recovering
+// its panic as configured by RecoverPanics.
+func (server *basicServer) protect(conn *serverConn, serviceMethod string, method func() error) (err error) {
+	pr := server.panics
+	if pr == nil {
+		return method()
+	}
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		report := PanicReport{ServiceMethod: serviceMethod, Conn: conn.connID(), Value: v}
+		if pr.withStack {
+			report.Stack = debug.Stack()
+		}
+		if pr.onPanic != nil {
+			pr.onPanic(report)
+		} else {
+			log.Printf("%s: %v\n%s", logPrefix("rpc: panic serving "+serviceMethod, report.Conn), v, report.Stack)
+		}
+		err = WithErrorCode(fmt.Errorf("rpc: panic serving %s: %v", serviceMethod, v), CodeInternal)
+	}()
+	return method()
+}
@@ -0,0 +1,43 @@
+package birpc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Tariffs struct{}
+
+func (Tariffs) Rate(_ *context.Context, usage int, reply *float64) error {
+	var rates map[string]float64
+	if usage < 0 {
+		rates["negative"] = 1 // panics on the nil map
+	}
+	*reply = float64(usage) * 0.5
+	return nil
+}
+
+func TestRecoverPanics(t *testing.T) {
+	reports := make(chan PanicReport, 1)
+	server := NewServer(RecoverPanics(true, func(r PanicReport) { reports <- r }))
+	server.Register(Tariffs{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var cost float64
+	err := client.Call(ctx, "Tariffs.Rate", -1, &cost)
+	if ErrorCode(err) != CodeInternal || !strings.Contains(err.Error(), "assignment to entry in nil map") {
+		t.Errorf("expected the panic, got %v", err)
+	}
+	report := <-reports
+	if report.ServiceMethod != "Tariffs.Rate" || !bytes.Contains(report.Stack, []byte("Tariffs.Rate")) {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// the connection goes on
+	if err = client.Call(ctx, "Tariffs.Rate", 60, &cost); err != nil || cost != 30 {
+		t.Errorf("expected 30, got %v: %v", cost, err)
+	}
+}
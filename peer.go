@@ -0,0 +1,124 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrPeerStarted is returned when starting a Peer more than once.
+var ErrPeerStarted = errors.New("rpc: peer already started")
+
+// Peer is one end of a symmetric link between two nodes, serving the
+// calls of the other end and calling it over the same connection. The
+// services are registered before the link is started, so none of the
+// calls of the other end finds them missing, and the link is closed as a
+// whole with Close.
+type Peer struct {
+	*basicServer
+
+	mu     sync.Mutex
+	client *BirpcClient // nil until started
+	closed bool
+	done   chan struct{} // closed once the link is down
+}
+
+// NewPeer returns a Peer serving the calls of the other end with the given
+// options. The link is started with Start or StartCodec.
+func NewPeer(opts ...ServerOption) *Peer {
+	return &Peer{
+		basicServer: newBasicServer(opts...),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start starts the link on conn, using the gob wire format.
+func (p *Peer) Start(conn io.ReadWriteCloser) error {
+	return p.StartCodec(NewGobBirpcCodec(p.writeRetry.wrap(conn)))
+}
+
+// StartCodec is like Start but uses the specified codec. It fails, closing
+// the codec, if the Peer was started or closed already.
+func (p *Peer) StartCodec(codec BirpcCodec) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil || p.closed {
+		codec.Close()
+		if p.closed {
+			return ErrShutdown
+		}
+		return ErrPeerStarted
+	}
+	p.client = &BirpcClient{
+		codec:       codec,
+		basicServer: p.basicServer,
+		basicClient: newBasicClient(codec),
+		disconnect:  make(chan struct{}),
+	}
+	go p.client.input()
+	go func(c *BirpcClient) {
+		<-c.DisconnectNotify()
+		close(p.done)
+	}(p.client)
+	return nil
+}
+
+// link returns the client of the link, nil if the Peer was not started.
+func (p *Peer) link() *BirpcClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.client
+}
+
+// Call calls the other end, failing with ErrShutdown before the link is
+// started or once it is down.
+func (p *Peer) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	c := p.link()
+	if c == nil {
+		return ErrShutdown
+	}
+	return c.Call(ctx, serviceMethod, args, reply)
+}
+
+// Go is like Client.Go, calling the other end asynchronously.
+func (p *Peer) Go(serviceMethod string, args, reply interface{}, done chan *Call) *Call {
+	if c := p.link(); c != nil {
+		return c.Go(serviceMethod, args, reply, done)
+	}
+	if done == nil {
+		done = make(chan *Call, 1)
+	}
+	call := &Call{ServiceMethod: serviceMethod, Args: args, Reply: reply, Done: done, Error: ErrShutdown}
+	call.done()
+	return call
+}
+
+// Close closes the link, failing the pending calls to the other end, and
+// waits for the calls of the other end being served to return.
+func (p *Peer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrShutdown
+	}
+	p.closed = true
+	c := p.client
+	if c == nil {
+		close(p.done)
+	}
+	p.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+	err := c.Close()
+	<-p.done
+	return err
+}
+
+// Done returns a channel closed once the link is down, closed by either
+// end, and the calls of the other end returned.
+func (p *Peer) Done() <-chan struct{} {
+	return p.done
+}
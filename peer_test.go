@@ -0,0 +1,59 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Dispatcher struct{}
+
+// Route asks the rater calling it for the rate of dest.
+func (Dispatcher) Route(ctx *context.Context, dest string, reply *float64) error {
+	return ctx.Client.Call(ctx, "Rater.Rate", dest, reply)
+}
+
+func TestPeer(t *testing.T) {
+	dispatcher, rater := NewPeer(), NewPeer()
+	dispatcher.Register(Dispatcher{})
+	rater.Register(&Rater{rate: 0.5})
+	if err := rater.Call(context.Background(), "Dispatcher.Route", "49", new(float64)); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown before Start, got %v", err)
+	}
+
+	a, b := net.Pipe()
+	dispatcher.Start(a)
+	rater.Start(b)
+	c, _ := net.Pipe()
+	if err := rater.Start(c); err != ErrPeerStarted {
+		t.Errorf("expected ErrPeerStarted, got %v", err)
+	}
+	var rate float64
+	if err := dispatcher.Call(context.Background(), "Rater.Rate", "49", &rate); err != nil || rate != 0.5 {
+		t.Errorf("unexpected rate %v: %v", rate, err)
+	}
+	rate = 0
+	if call := <-rater.Go("Dispatcher.Route", "49", &rate, nil).Done; call.Error != nil || rate != 0.5 {
+		t.Errorf("unexpected routed rate %v: %v", rate, call.Error)
+	}
+
+	if err := dispatcher.Close(); err != nil {
+		t.Error(err)
+	}
+	select {
+	case <-rater.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the other end of the link is still up")
+	}
+	if err := rater.Call(context.Background(), "Dispatcher.Route", "49", &rate); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown, got %v", err)
+	}
+	if err := dispatcher.Close(); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown closing twice, got %v", err)
+	}
+	if err := dispatcher.Start(c); err != ErrShutdown {
+		t.Errorf("expected ErrShutdown starting a closed Peer, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package birpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Pool spreads the calls over a fixed number of connections to the same
+// server, in round robin, since a single connection serializes the
+// writes of its calls. The connections found shut down, or closed by the
+// health checks and the idle reaping, are dialed again on their next use.
+type Pool struct {
+	dial  func(ctx *context.Context) (*Client, error)
+	slots []poolSlot
+	next  uint32
+
+	healthInterval time.Duration // see PoolHealthCheck
+	healthTimeout  time.Duration
+	idleTimeout    time.Duration // see PoolIdleTimeout
+	quit           chan struct{}
+	closeOnce      sync.Once
+}
+
+type poolSlot struct {
+	mu       sync.Mutex
+	client   *Client
+	lastUsed time.Time
+}
+
+// PoolOption configures a Pool, see DialPool.
+type PoolOption func(*Pool)
+
+// PoolHealthCheck makes the pool call the built-in echo method on each of
+// its connections every interval, closing the ones which fail to answer
+// within timeout, interval if zero.
+func PoolHealthCheck(interval, timeout time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.healthInterval, p.healthTimeout = interval, timeout
+	}
+}
+
+// PoolIdleTimeout makes the pool close the connections without calls for
+// d, sparing the servers the connections of the quiet clients.
+func PoolIdleTimeout(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.idleTimeout = d
+	}
+}
+
+// DialPool returns a Pool of size connections obtained from dial. All the
+// connections are dialed before returning.
+func DialPool(ctx *context.Context, size int, dial func(ctx *context.Context) (*Client, error), opts ...PoolOption) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		dial:  dial,
+		slots: make([]poolSlot, size),
+		quit:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	now := time.Now()
+	for i := range p.slots {
+		client, err := dial(ctx)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.slots[i].client, p.slots[i].lastUsed = client, now
+	}
+	if interval := p.maintenanceInterval(); interval > 0 {
+		go p.maintain(interval)
+	}
+	return p, nil
+}
+
+// maintenanceInterval returns the period of the health checks and of the
+// idle reaping, zero without them.
+func (p *Pool) maintenanceInterval() time.Duration {
+	interval := p.healthInterval
+	if p.idleTimeout > 0 && (interval <= 0 || p.idleTimeout/2 < interval) {
+		interval = p.idleTimeout / 2
+	}
+	return interval
+}
+
+// maintain checks the connections every interval until the pool closes.
+func (p *Pool) maintain(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastHealth time.Time
+	for {
+		select {
+		case <-p.quit:
+			return
+		case now := <-ticker.C:
+			if p.idleTimeout > 0 {
+				p.reapIdle(now)
+			}
+			if p.healthInterval > 0 && now.Sub(lastHealth) >= p.healthInterval {
+				lastHealth = now
+				p.checkHealth()
+			}
+		}
+	}
+}
+
+// reapIdle closes the connections without calls since idleTimeout.
+func (p *Pool) reapIdle(now time.Time) {
+	for i := range p.slots {
+		slot := &p.slots[i]
+		slot.mu.Lock()
+		if slot.client != nil && now.Sub(slot.lastUsed) >= p.idleTimeout && slot.client.pendingCalls() == 0 {
+			slot.client.Close()
+			slot.client = nil
+		}
+		slot.mu.Unlock()
+	}
+}
+
+// checkHealth closes the connections failing to answer the echo calls.
+func (p *Pool) checkHealth() {
+	timeout := p.healthTimeout
+	if timeout <= 0 {
+		timeout = p.healthInterval
+	}
+	for i := range p.slots {
+		slot := &p.slots[i]
+		slot.mu.Lock()
+		client := slot.client
+		slot.mu.Unlock()
+		if client == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		var reply []byte
+		err := client.Call(ctx, "_goRPC_.Echo", []byte(nil), &reply)
+		cancel()
+		if err == nil {
+			continue
+		}
+		debugln("rpc: pool health check:", err)
+		slot.mu.Lock()
+		if slot.client == client {
+			client.Close()
+			slot.client = nil
+		}
+		slot.mu.Unlock()
+	}
+}
+
+// get returns the client of the next slot, dialing it again if needed,
+// or ErrShutdown once the pool is closed.
+func (p *Pool) get(ctx *context.Context) (client *Client, err error) {
+	slot := &p.slots[int(atomic.AddUint32(&p.next, 1)-1)%len(p.slots)]
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	select {
+	case <-p.quit:
+		return nil, ErrShutdown
+	default:
+	}
+	if slot.client == nil || slot.client.isShutdown() {
+		if slot.client, err = p.dial(ctx); err != nil {
+			return
+		}
+	}
+	slot.lastUsed = time.Now()
+	return slot.client, nil
+}
+
+// Call invokes the named function on one of the connections of the pool.
+func (p *Pool) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	client, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Close closes all the connections of the pool.
+func (p *Pool) Close() error {
+	p.closeOnce.Do(func() { close(p.quit) })
+	for i := range p.slots {
+		slot := &p.slots[i]
+		slot.mu.Lock()
+		if slot.client != nil {
+			slot.client.Close()
+		}
+		slot.mu.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package birpc
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// poolConns returns the number of connections held by p.
+func poolConns(p *Pool) (n int) {
+	for i := range p.slots {
+		p.slots[i].mu.Lock()
+		if p.slots[i].client != nil {
+			n++
+		}
+		p.slots[i].mu.Unlock()
+	}
+	return
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	var dials int32
+	dial := func(ctx *context.Context) (*Client, error) {
+		atomic.AddInt32(&dials, 1)
+		c1, c2 := net.Pipe()
+		go server.ServeConn(c2)
+		return NewClient(c1), nil
+	}
+	ctx := context.Background()
+	p, err := DialPool(ctx, 2, dial, PoolIdleTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	time.Sleep(100 * time.Millisecond)
+	if n := poolConns(p); n != 0 {
+		t.Errorf("expected the idle connections to be closed, got %d", n)
+	}
+	reply := new(Reply)
+	if err = p.Call(ctx, "Arith.Add", Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("expected 3, got %d: %v", reply.C, err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 3 {
+		t.Errorf("expected a connection to be dialed again, got %d dials", n)
+	}
+
+	// no connection is dialed once closed
+	p.Close()
+	if err = p.Call(ctx, "Arith.Add", Args{1, 2}, reply); err != ErrShutdown {
+		t.Errorf("expected %v, got %v", ErrShutdown, err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 3 {
+		t.Errorf("expected no connection dialed, got %d dials", n)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	var dials int32
+	dial := func(ctx *context.Context) (*Client, error) {
+		c1, c2 := net.Pipe()
+		if atomic.AddInt32(&dials, 1) == 1 {
+			// the first server reads the calls without answering
+			go io.Copy(ioutil.Discard, c2)
+		} else {
+			go server.ServeConn(c2)
+		}
+		return NewClient(c1), nil
+	}
+	p, err := DialPool(context.Background(), 2, dial, PoolHealthCheck(20*time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	time.Sleep(100 * time.Millisecond)
+	if n := poolConns(p); n != 1 {
+		t.Errorf("expected the unhealthy connection to be closed, got %d connections", n)
+	}
+}
@@ -0,0 +1,141 @@
+package birpc
+
+import (
+	stdcontext "context"
+	"io"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Labels of the profiles taken with ProfileMethods.
+const (
+	ProfileMethodLabel    = "rpc_method"
+	ProfileTenantLabel    = "rpc_tenant"
+	ProfileRequestIDLabel = "rpc_request_id"
+)
+
+// ProfileMetadata is the key of the metadata flagging the calls to trace,
+// see WithProfile.
+const ProfileMetadata = "profile"
+
+// WithProfile returns a copy of ctx flagging the calls made with it for
+// tracing by the servers using TraceProfiledCalls. The methods forward the
+// flag to the calls they make on behalf of a flagged call with
+// WithProfile(ctx) if Profiled(ctx).
+func WithProfile(ctx *context.Context) *context.Context {
+	return WithMetadata(ctx, Metadata{ProfileMetadata: "1"})
+}
+
+// Profiled reports whether the call served with ctx was flagged by
+// WithProfile.
+func Profiled(ctx *context.Context) bool {
+	return MetadataFromContext(ctx)[ProfileMetadata] != ""
+}
+
+// methodProfiling selects the methods labeled by ProfileMethods.
+type methodProfiling struct {
+	patterns []string // path.Match patterns of "Service.Method", all if empty
+}
+
+// ProfileMethods attributes the CPU and allocation samples of the
+// profiles taken in production to the methods: their invocations run with
+// the pprof labels ProfileMethodLabel, "Service.Method",
+// ProfileTenantLabel, the TenantMetadata of the call, and
+// ProfileRequestIDLabel, its RequestIDMetadata, the last two if sent. The
+// labels are set on the goroutine serving the call and inherited by the
+// ones it starts; the method runs in a runtime/trace region named after
+// it. Only the methods matching any of the path.Match patterns are
+// labeled, all if none are given.
+//
+//	go tool pprof -tagfocus rpc_method=CDRs.Rerate http://host/debug/pprof/profile
+func ProfileMethods(patterns ...string) ServerOption {
+	return func(server *basicServer) {
+		server.profiling = &methodProfiling{patterns: patterns}
+	}
+}
+
+// callTracing traces the calls flagged by WithProfile, see
+// TraceProfiledCalls.
+type callTracing struct {
+	open    func(serviceMethod string, seq uint64) (io.WriteCloser, error)
+	running sync.Mutex // held while tracing a call
+}
+
+// TraceProfiledCalls traces the calls flagged by WithProfile with
+// runtime/trace, from the invocation of their method to its return, into
+// the writer returned by open, closed afterwards. The trace is global to
+// the process and records what runs meanwhile, the flagged call being
+// found by its task and region, named after the method. A call flagged
+// while another one, or the program, is tracing is only given its task
+// and region in that trace. The flagged calls are labeled as by
+// ProfileMethods, whatever their method.
+func TraceProfiledCalls(open func(serviceMethod string, seq uint64) (io.WriteCloser, error)) ServerOption {
+	return func(server *basicServer) {
+		server.tracing = &callTracing{open: open}
+	}
+}
+
+// start starts tracing the call req unless a trace is running already,
+// returning the function stopping it.
+func (t *callTracing) start(req *Request) (stop func()) {
+	if !t.running.TryLock() {
+		return func() {}
+	}
+	if trace.IsEnabled() {
+		t.running.Unlock()
+		return func() {}
+	}
+	w, err := t.open(req.ServiceMethod, req.Seq)
+	if err == nil {
+		if err = trace.Start(w); err != nil {
+			w.Close()
+		}
+	}
+	if err != nil {
+		debugln("rpc: tracing "+req.ServiceMethod+":", err)
+		t.running.Unlock()
+		return func() {}
+	}
+	return func() {
+		trace.Stop()
+		if err := w.Close(); err != nil {
+			debugln("rpc: closing the trace of "+req.ServiceMethod+":", err)
+		}
+		t.running.Unlock()
+	}
+}
+
+// profile runs the invocation f of the call req with the labels of
+// ProfileMethods, if used and matching the method, and traced if flagged
+// by WithProfile with TraceProfiledCalls.
+func (server *basicServer) profile(ctx *context.Context, req *Request, f func(ctx *context.Context) error) (err error) {
+	flagged := server.tracing != nil && req.Metadata[ProfileMetadata] != ""
+	p := server.profiling
+	if !flagged && (p == nil || len(p.patterns) != 0 && !matchAny(p.patterns, req.ServiceMethod)) {
+		return f(ctx)
+	}
+	labels := []string{ProfileMethodLabel, req.ServiceMethod}
+	if tenant := req.Metadata[TenantMetadata]; tenant != "" {
+		labels = append(labels, ProfileTenantLabel, tenant)
+	}
+	if id := req.Metadata[RequestIDMetadata]; id != "" {
+		labels = append(labels, ProfileRequestIDLabel, id)
+	}
+	if flagged {
+		defer server.tracing.start(req)()
+	}
+	pprof.Do(ctx.Context, pprof.Labels(labels...), func(labeled stdcontext.Context) {
+		if flagged {
+			var task *trace.Task
+			labeled, task = trace.NewTask(labeled, req.ServiceMethod)
+			defer task.End()
+		}
+		trace.WithRegion(labeled, req.ServiceMethod, func() {
+			err = f(&context.Context{Context: labeled, Client: ctx.Client})
+		})
+	})
+	return
+}
@@ -0,0 +1,89 @@
+package birpc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Rerater struct{}
+
+func (Rerater) labels(ctx *context.Context, reply *[]string) error {
+	method, _ := pprof.Label(ctx.Context, ProfileMethodLabel)
+	tenant, _ := pprof.Label(ctx.Context, ProfileTenantLabel)
+	id, _ := pprof.Label(ctx.Context, ProfileRequestIDLabel)
+	*reply = []string{method, tenant, id}
+	return nil
+}
+
+func (r Rerater) Rerate(ctx *context.Context, _ string, reply *[]string) error {
+	return r.labels(ctx, reply)
+}
+
+func (r Rerater) Count(ctx *context.Context, _ string, reply *[]string) error {
+	return r.labels(ctx, reply)
+}
+
+func TestProfileMethods(t *testing.T) {
+	server := NewServer(ProfileMethods("Rerater.Rerate"))
+	server.Register(Rerater{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var labels []string
+	tenant := WithRequestID(WithMetadata(ctx, Metadata{TenantMetadata: "cgrates.org"}), "rerate-1")
+	if err := client.Call(tenant, "Rerater.Rerate", "", &labels); err != nil ||
+		labels[0] != "Rerater.Rerate" || labels[1] != "cgrates.org" || labels[2] != "rerate-1" {
+		t.Errorf("unexpected labels %q: %v", labels, err)
+	}
+	if err := client.Call(ctx, "Rerater.Rerate", "", &labels); err != nil || labels[0] != "Rerater.Rerate" || labels[1] != "" {
+		t.Errorf("unexpected labels %q: %v", labels, err)
+	}
+	if err := client.Call(ctx, "Rerater.Count", "", &labels); err != nil || labels[0] != "" {
+		t.Errorf("expected the method not profiled, got %q: %v", labels, err)
+	}
+}
+
+type traceBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *traceBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTraceProfiledCalls(t *testing.T) {
+	var traces []*traceBuffer
+	server := NewServer(TraceProfiledCalls(func(serviceMethod string, _ uint64) (io.WriteCloser, error) {
+		if serviceMethod != "Rerater.Rerate" {
+			return nil, errors.New("unexpected method " + serviceMethod)
+		}
+		b := new(traceBuffer)
+		traces = append(traces, b)
+		return b, nil
+	}))
+	server.Register(Rerater{})
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var labels []string
+	if err := client.Call(ctx, "Rerater.Rerate", "", &labels); err != nil || labels[0] != "" || len(traces) != 0 {
+		t.Errorf("expected the call not traced, got %q %d: %v", labels, len(traces), err)
+	}
+	if err := client.Call(WithProfile(ctx), "Rerater.Rerate", "", &labels); err != nil || labels[0] != "Rerater.Rerate" {
+		t.Errorf("expected the call labeled, got %q: %v", labels, err)
+	}
+	if len(traces) != 1 || !traces[0].closed || traces[0].Len() == 0 {
+		t.Fatalf("expected the call traced, got %d traces", len(traces))
+	}
+	// the calls failing to open their trace are still served
+	if err := client.Call(WithProfile(ctx), "Rerater.Count", "", &labels); err != nil || labels[0] != "Rerater.Count" {
+		t.Errorf("expected the call labeled, got %q: %v", labels, err)
+	}
+}
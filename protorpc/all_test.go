@@ -0,0 +1,216 @@
+package protorpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc"
+	"github.com/cgrates/birpc/context"
+)
+
+// CDR is a protobuf message, as generated for:
+//
+//	message CDR {
+//		string account = 1;
+//		int64 usage = 2;
+//	}
+type CDR struct {
+	Account string
+	Usage   int64
+}
+
+func (m *CDR) Marshal() ([]byte, error) {
+	b := appendString(nil, 1, m.Account)
+	return appendVarint(b, 2, uint64(m.Usage)), nil
+}
+
+func (m *CDR) Unmarshal(b []byte) error {
+	*m = CDR{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		switch key {
+		case 1<<3 | wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			m.Account, b = string(b[n:n+int(l)]), b[n+int(l):]
+		case 2<<3 | wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			m.Usage, b = int64(v), b[n:]
+		default:
+			return errors.New("unexpected field")
+		}
+	}
+	return nil
+}
+
+type Args struct {
+	A, B int
+}
+
+type Rater struct{}
+
+// Rate doubles the usage, failing for the CDRs without account.
+func (Rater) Rate(ctx *context.Context, cdr *CDR, reply *CDR) error {
+	if cdr.Account == "" {
+		return errors.New("missing account")
+	}
+	*reply = CDR{Account: cdr.Account, Usage: 2 * cdr.Usage}
+	return nil
+}
+
+// Find returns the CDRs of the account, none found but the ones of 1001.
+func (Rater) Find(ctx *context.Context, account string, reply *CDR) error {
+	switch account {
+	case "1001":
+		*reply = CDR{Account: account, Usage: 60}
+		return nil
+	case "":
+		return &birpc.Error{Code: birpc.CodeInvalidArgument, Message: "missing account", Details: Args{1, 2}}
+	}
+	return &birpc.Error{Code: birpc.CodeNotFound, Message: "no CDRs", Details: &CDR{Account: account}}
+}
+
+// Add takes arguments which are not protobuf messages.
+func (Rater) Add(ctx *context.Context, args *Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+// Callback asks the caller for the CDR to rate.
+func (r Rater) Callback(ctx *context.Context, method string, reply *CDR) error {
+	var cdr CDR
+	if err := ctx.Client.Call(ctx, method, nil, &cdr); err != nil {
+		return err
+	}
+	return r.Rate(ctx, &cdr, reply)
+}
+
+type Source struct{}
+
+func (Source) Next(ctx *context.Context, _ interface{}, reply *CDR) error {
+	*reply = CDR{Account: "1001", Usage: 30}
+	return nil
+}
+
+func TestEnvelope(t *testing.T) {
+	env := envelope{ServiceMethod: "A.B", Seq: 1}
+	if b := env.marshal(); string(b) != "\x0a\x03A.B\x10\x01" {
+		t.Errorf("unexpected encoding %q", b)
+	}
+	env = envelope{
+		ServiceMethod: "Rater.Rate",
+		Seq:           1 << 40,
+		Error:         "err",
+		Depth:         2,
+		Fields:        []string{"Usage", ""},
+		Raw:           true,
+		Checksum:      "sum",
+		More:          true,
+		Item:          true,
+		End:           true,
+		Encoding:      encodingGob,
+		Body:          []byte{0, 1},
+		Metadata:      map[string]string{"tenant": "cgrates.org", "": ""},
+		GoAway:        true,
+		Code:          -5,
+		Detail:        true,
+		DetailType:    "QuotaExceeded",
+	}
+	var got envelope
+	// unknown fields of all the wire types are skipped
+	b := append(env.marshal(), 13<<3|wireVarint, 1, 14<<3|wireFixed64, 0, 0, 0, 0, 0, 0, 0, 0,
+		18<<3|wireFixed32|0x80, 1, 0, 0, 0, 0, 19<<3|wireBytes|0x80, 1, 1, 0)
+	if err := got.unmarshal(b); err != nil || !reflect.DeepEqual(got, env) {
+		t.Errorf("unexpected envelope %+v: %v", got, err)
+	}
+	if err := got.unmarshal(b[:len(b)-1]); err != errTruncated {
+		t.Errorf("expected errTruncated, got %v", err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(Rater{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var cdr CDR
+	if err := client.Call(context.Background(), "Rater.Rate", &CDR{Account: "1001", Usage: 60}, &cdr); err != nil ||
+		cdr != (CDR{Account: "1001", Usage: 120}) {
+		t.Errorf("unexpected reply %+v: %v", cdr, err)
+	}
+	if err := client.Call(context.Background(), "Rater.Rate", &CDR{}, &cdr); err != birpc.ServerError("missing account") {
+		t.Errorf("expected the error of the method, got %v", err)
+	}
+	var sum int
+	if err := client.Call(context.Background(), "Rater.Add", &Args{1, 2}, &sum); err != nil || sum != 3 {
+		t.Errorf("unexpected reply %d: %v", sum, err)
+	}
+	if err := client.Call(context.Background(), "Rater.Mul", &Args{1, 2}, &sum); err == nil {
+		t.Error("expected an error calling a missing method")
+	}
+	// a protobuf message sent to a method taking another type
+	if err := client.Call(context.Background(), "Rater.Add", &CDR{Account: "1001"}, &sum); err == nil {
+		t.Error("expected an error decoding the arguments")
+	}
+	if err := client.Call(context.Background(), "Rater.Rate", &CDR{Account: "1002", Usage: 1}, &cdr); err != nil ||
+		cdr != (CDR{Account: "1002", Usage: 2}) {
+		t.Errorf("unexpected reply %+v: %v", cdr, err)
+	}
+}
+
+func TestBirpc(t *testing.T) {
+	srv := birpc.NewBirpcServer()
+	srv.Register(Rater{})
+	cli, conn := net.Pipe()
+	go srv.ServeCodec(NewBirpcCodec(conn))
+
+	clt := birpc.NewBirpcClientWithCodec(NewBirpcCodec(cli))
+	clt.Register(Source{})
+	defer clt.Close()
+	var cdr CDR
+	if err := clt.Call(context.Background(), "Rater.Callback", "Source.Next", &cdr); err != nil ||
+		cdr != (CDR{Account: "1001", Usage: 60}) {
+		t.Errorf("unexpected reply %+v: %v", cdr, err)
+	}
+}
+
+func TestError(t *testing.T) {
+	server := birpc.NewServer()
+	server.Register(Rater{})
+	cli, srv := net.Pipe()
+	go server.ServeCodec(NewServerCodec(srv))
+	client := NewClient(cli)
+	defer client.Close()
+
+	var cdr CDR
+	err := client.Call(context.Background(), "Rater.Find", "1002", &cdr)
+	if birpc.ErrorCode(err) != birpc.CodeNotFound || err.Error() != "no CDRs" {
+		t.Errorf("expected the CDRs not found, got %#v", err)
+	}
+	// the details are decoded as encoded, as protobuf or gob
+	if details, ok := birpc.ErrorDetail[CDR](err); !ok || details.Account != "1002" {
+		t.Errorf("unexpected details %+v", details)
+	}
+	err = client.Call(context.Background(), "Rater.Find", "", &cdr)
+	if details, ok := birpc.ErrorDetail[Args](err); !ok || details != (Args{1, 2}) {
+		t.Errorf("unexpected details %+v: %v", details, err)
+	}
+	if err = client.Call(context.Background(), "Rater.Find", "1001", &cdr); err != nil || cdr.Usage != 60 {
+		t.Errorf("unexpected reply %+v: %v", cdr, err)
+	}
+}
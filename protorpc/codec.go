@@ -0,0 +1,293 @@
+// Package protorpc implements a compact binary ClientCodec, ServerCodec
+// and BirpcCodec for the rpc package, carrying the headers of the messages
+// in a protobuf envelope.
+//
+// Each message is a frame prefixed by its length as a 32-bit big-endian
+// integer, see birpc.Framer, holding an envelope encoded as the protobuf
+// message:
+//
+//	message Envelope {
+//		string service_method = 1; // set on the requests only
+//		uint64 seq = 2;
+//		string error = 3;
+//		int64 depth = 4;
+//		repeated string fields = 5;
+//		bool raw = 6;
+//		string checksum = 7;
+//		bool more = 8;
+//		bool item = 9;
+//		bool end = 10;
+//		Encoding encoding = 11;
+//		bytes body = 12;
+//		map<string, string> metadata = 13;
+//		bool go_away = 14;
+//		int64 code = 15;
+//		bool detail = 16; // the body is the detail of the error
+//		string detail_type = 17;
+//	}
+//
+//	enum Encoding {
+//		PROTO = 0;
+//		GOB = 1;
+//	}
+//
+// The arguments and replies implementing Message are encoded by their own
+// Marshal method, and the others as gob, one gob stream per body, as are
+// the details of the errors, see birpc.Error. The package depends on no
+// protobuf runtime, so the messages of google.golang.org/protobuf must be
+// wrapped to be encoded as protobuf, see Message.
+package protorpc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/cgrates/birpc"
+)
+
+// maxFrame bounds the size of the messages read.
+const maxFrame = 64 << 20
+
+// Message is implemented by the protobuf messages whose generated code
+// marshals them, as by the gogo and vtprotobuf generators. A proto.Message
+// of google.golang.org/protobuf does not implement it: wrap it in a type
+// whose methods call proto.Marshal and proto.Unmarshal.
+type Message interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// The encodings of the bodies.
+const (
+	encodingProto = 0
+	encodingGob   = 1
+)
+
+type codec struct {
+	c      io.Closer
+	framer *birpc.Framer // serializes the writes
+
+	// temporary work space, used by the reading goroutine
+	env envelope
+}
+
+// NewServerCodec returns a new birpc.ServerCodec using protobuf on conn.
+func NewServerCodec(conn io.ReadWriteCloser) birpc.ServerCodec {
+	return newCodec(conn)
+}
+
+// NewClientCodec returns a new birpc.ClientCodec using protobuf on conn.
+func NewClientCodec(conn io.ReadWriteCloser) birpc.ClientCodec {
+	return newCodec(conn)
+}
+
+// NewBirpcCodec returns a new birpc.BirpcCodec using protobuf on conn.
+func NewBirpcCodec(conn io.ReadWriteCloser) birpc.BirpcCodec {
+	return newCodec(conn)
+}
+
+func newCodec(conn io.ReadWriteCloser) *codec {
+	return &codec{c: conn, framer: birpc.NewFramer(conn, maxFrame)}
+}
+
+func (c *codec) ReadHeader(req *birpc.Request, resp *birpc.Response) error {
+	frame, err := c.framer.ReadFrame()
+	if err != nil {
+		return err
+	}
+	c.env = envelope{}
+	if err := c.env.unmarshal(frame); err != nil {
+		return err
+	}
+	if c.env.ServiceMethod != "" {
+		req.Seq = c.env.Seq
+		req.ServiceMethod = c.env.ServiceMethod
+		req.Depth = int(c.env.Depth)
+		req.Fields = c.env.Fields
+		req.Raw = c.env.Raw
+		req.Item = c.env.Item
+		req.End = c.env.End
+		req.Metadata = c.env.Metadata
+	} else {
+		resp.Seq = c.env.Seq
+		resp.Error = c.env.Error
+		resp.Checksum = c.env.Checksum
+		resp.More = c.env.More
+		resp.Metadata = c.env.Metadata
+		resp.GoAway = c.env.GoAway
+		resp.Code = int(c.env.Code)
+		resp.Detail = c.env.Detail
+		resp.DetailType = c.env.DetailType
+	}
+	return nil
+}
+
+func (c *codec) ReadRequestHeader(r *birpc.Request) error {
+	var resp birpc.Response
+	if err := c.ReadHeader(r, &resp); err != nil {
+		return err
+	}
+	if c.env.ServiceMethod == "" {
+		return errors.New("protorpc: unexpected response")
+	}
+	return nil
+}
+
+func (c *codec) ReadResponseHeader(r *birpc.Response) error {
+	var req birpc.Request
+	if err := c.ReadHeader(&req, r); err != nil {
+		return err
+	}
+	if c.env.ServiceMethod != "" {
+		return errors.New("protorpc: unexpected request")
+	}
+	return nil
+}
+
+func (c *codec) ReadRequestBody(x interface{}) error {
+	return c.readBody(x)
+}
+
+func (c *codec) ReadResponseBody(x interface{}) error {
+	return c.readBody(x)
+}
+
+func (c *codec) readBody(x interface{}) error {
+	body, encoding := c.env.Body, c.env.Encoding
+	c.env.Body = nil
+	if x == nil || len(body) == 0 {
+		// discarded, or a nil body
+		return nil
+	}
+	switch encoding {
+	case encodingProto:
+		m, ok := x.(Message)
+		if !ok {
+			return fmt.Errorf("protorpc: %T does not implement protorpc.Message", x)
+		}
+		return m.Unmarshal(body)
+	case encodingGob:
+		return gob.NewDecoder(bytes.NewReader(body)).Decode(x)
+	}
+	return fmt.Errorf("protorpc: unknown encoding %d", encoding)
+}
+
+// ReadRawResponseBody keeps the body for a birpc.RawReply, decoded as
+// protobuf or gob as it was encoded.
+func (c *codec) ReadRawResponseBody(raw *birpc.RawReply) error {
+	body := c.env.Body
+	c.env.Body = nil
+	*raw = birpc.RawReply{Format: "proto", Data: body, Unmarshal: unmarshalProto}
+	if c.env.Encoding == encodingGob {
+		*raw = birpc.RawReply{Format: "gob", Data: body, Unmarshal: unmarshalGob}
+	}
+	return nil
+}
+
+func unmarshalProto(data []byte, v interface{}) error {
+	m, ok := v.(Message)
+	if !ok {
+		return fmt.Errorf("protorpc: %T does not implement protorpc.Message", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func unmarshalGob(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (c *codec) WriteRequest(r *birpc.Request, x interface{}) error {
+	return c.write(&envelope{
+		ServiceMethod: r.ServiceMethod,
+		Seq:           r.Seq,
+		Depth:         int64(r.Depth),
+		Fields:        r.Fields,
+		Raw:           r.Raw,
+		Item:          r.Item,
+		End:           r.End,
+		Metadata:      r.Metadata,
+	}, x)
+}
+
+func (c *codec) WriteResponse(r *birpc.Response, x interface{}) error {
+	return c.write(&envelope{
+		Seq:        r.Seq,
+		Error:      r.Error,
+		Checksum:   r.Checksum,
+		More:       r.More,
+		Metadata:   r.Metadata,
+		GoAway:     r.GoAway,
+		Code:       int64(r.Code),
+		Detail:     r.Detail,
+		DetailType: r.DetailType,
+	}, x)
+}
+
+func (c *codec) write(env *envelope, x interface{}) (err error) {
+	switch m := x.(type) {
+	case nil:
+		// sent without body
+	case Message:
+		env.Body, err = m.Marshal()
+	default:
+		var buf bytes.Buffer
+		err = gob.NewEncoder(&buf).Encode(x)
+		env.Encoding, env.Body = encodingGob, buf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	return c.framer.WriteFrame(env.marshal())
+}
+
+func (c *codec) Close() error {
+	return c.c.Close()
+}
+
+// RemoteAddr returns the remote address of the connection, if it is a
+// network connection.
+func (c *codec) RemoteAddr() net.Addr {
+	if conn, ok := c.c.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+// TLSConnectionState returns the state of the connection, if it is a TLS
+// connection.
+func (c *codec) TLSConnectionState() *tls.ConnectionState {
+	return birpc.ConnTLSState(c.c)
+}
+
+// NewClient returns a new birpc.Client to handle requests to the
+// set of services at the other end of the connection.
+func NewClient(conn io.ReadWriteCloser) *birpc.Client {
+	return birpc.NewClientWithCodec(NewClientCodec(conn))
+}
+
+// Dial connects to a protobuf RPC server at the specified network address.
+func Dial(network, address string) (*birpc.Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), err
+}
+
+// ServeConn runs the protobuf RPC server on a single connection.
+// ServeConn blocks, serving the connection until the client hangs up.
+// The caller typically invokes ServeConn in a go statement.
+func ServeConn(conn io.ReadWriteCloser) {
+	birpc.ServeCodec(NewServerCodec(conn))
+}
+
+func init() {
+	birpc.RegisterServerCodec("proto", NewServerCodec)
+	birpc.RegisterClientCodec("proto", NewClientCodec)
+	birpc.RegisterBirpcCodec("proto", NewBirpcCodec)
+}
@@ -0,0 +1,225 @@
+package protorpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var errTruncated = errors.New("protorpc: truncated envelope")
+
+// envelope is the protobuf message carrying the headers and the body.
+type envelope struct {
+	ServiceMethod string
+	Seq           uint64
+	Error         string
+	Depth         int64
+	Fields        []string
+	Raw           bool
+	Checksum      string
+	More          bool
+	Item          bool
+	End           bool
+	Encoding      uint64
+	Body          []byte
+	Metadata      map[string]string
+	GoAway        bool
+	Code          int64
+	Detail        bool
+	DetailType    string
+}
+
+// The protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendUvarint(b, uint64(field<<3|wireVarint))
+	return appendUvarint(b, v)
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if v {
+		return appendVarint(b, field, 1)
+	}
+	return b
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendUvarint(b, uint64(field<<3|wireBytes))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = appendUvarint(b, uint64(field<<3|wireBytes))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func (e *envelope) marshal() []byte {
+	b := make([]byte, 0, 32+len(e.ServiceMethod)+len(e.Error)+len(e.Body))
+	b = appendString(b, 1, e.ServiceMethod)
+	b = appendVarint(b, 2, e.Seq)
+	b = appendString(b, 3, e.Error)
+	b = appendVarint(b, 4, uint64(e.Depth))
+	for _, f := range e.Fields {
+		// repeated strings are kept even when empty
+		b = appendUvarint(b, 5<<3|wireBytes)
+		b = appendUvarint(b, uint64(len(f)))
+		b = append(b, f...)
+	}
+	b = appendBool(b, 6, e.Raw)
+	b = appendString(b, 7, e.Checksum)
+	b = appendBool(b, 8, e.More)
+	b = appendBool(b, 9, e.Item)
+	b = appendBool(b, 10, e.End)
+	b = appendVarint(b, 11, e.Encoding)
+	b = appendBytes(b, 12, e.Body)
+	keys := make([]string, 0, len(e.Metadata))
+	for k := range e.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// a map<string, string> entry, sorted for a stable encoding
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, e.Metadata[k])
+		b = appendUvarint(b, 13<<3|wireBytes)
+		b = appendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	b = appendBool(b, 14, e.GoAway)
+	b = appendVarint(b, 15, uint64(e.Code))
+	b = appendBool(b, 16, e.Detail)
+	b = appendString(b, 17, e.DetailType)
+	return b
+}
+
+func (e *envelope) unmarshal(b []byte) error {
+	return readFields(b, func(field, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			e.ServiceMethod = string(data)
+		case 2:
+			e.Seq = v
+		case 3:
+			e.Error = string(data)
+		case 4:
+			e.Depth = int64(v)
+		case 5:
+			e.Fields = append(e.Fields, string(data))
+		case 6:
+			e.Raw = v != 0
+		case 7:
+			e.Checksum = string(data)
+		case 8:
+			e.More = v != 0
+		case 9:
+			e.Item = v != 0
+		case 10:
+			e.End = v != 0
+		case 11:
+			e.Encoding = v
+		case 12:
+			e.Body = data
+		case 13:
+			if data == nil {
+				break // not of the bytes wire type
+			}
+			var key, value string
+			err := readFields(data, func(field, _ uint64, data []byte) error {
+				switch field {
+				case 1:
+					key = string(data)
+				case 2:
+					value = string(data)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if e.Metadata == nil {
+				e.Metadata = make(map[string]string)
+			}
+			e.Metadata[key] = value
+		case 14:
+			e.GoAway = v != 0
+		case 15:
+			e.Code = int64(v)
+		case 16:
+			e.Detail = v != 0
+		case 17:
+			e.DetailType = string(data)
+		}
+		return nil
+	})
+}
+
+// readFields calls f with the number and the value of the fields of the
+// message b, v holding the varints and data the bytes.
+func readFields(b []byte, f func(field, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		field, wire := key>>3, key&7
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errTruncated
+			}
+			b = b[size:]
+			continue
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errTruncated
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("protorpc: invalid wire type %d", wire)
+		}
+		if err := f(field, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
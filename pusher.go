@@ -0,0 +1,145 @@
+package birpc
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrPusherClosed is returned when pushing to a closed OrderedPusher.
+var ErrPusherClosed = errors.New("rpc: pusher is closed")
+
+// PusherOptions configure an OrderedPusher.
+type PusherOptions struct {
+	// QueueSize is the number of calls which can wait to be sent, Push
+	// blocks once it is reached. It defaults to 64.
+	QueueSize int
+
+	// Retry, if set, retries the calls failing with a retryable error
+	// before moving to the next one.
+	Retry *RetryPolicy
+
+	// OnError is called with the calls which failed for good.
+	OnError func(serviceMethod string, args interface{}, err error)
+}
+
+// OrderedPusher delivers calls to a peer, typically the server pushing to
+// a BirpcClient, in the order they were pushed. Since the methods are
+// served concurrently by the peer, a call is only sent once the previous
+// one returned, including its retries; this trades throughput for the
+// ordering needed by event streams.
+type OrderedPusher struct {
+	client ClientConnector
+	opts   PusherOptions
+	queue  chan pushedCall
+	stop   chan struct{} // closed by Abort
+	done   chan struct{}
+
+	stopOnce sync.Once
+
+	mu     sync.RWMutex // protects closed and sending to queue
+	closed bool
+}
+
+type pushedCall struct {
+	serviceMethod string
+	args          interface{}
+}
+
+// NewOrderedPusher starts an OrderedPusher sending to client.
+func NewOrderedPusher(client ClientConnector, opts PusherOptions) *OrderedPusher {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	p := &OrderedPusher{
+		client: client,
+		opts:   opts,
+		queue:  make(chan pushedCall, opts.QueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Push queues a call to serviceMethod, whose reply is discarded. It blocks
+// while the queue is full, until ctx is done.
+func (p *OrderedPusher) Push(ctx *context.Context, serviceMethod string, args interface{}) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPusherClosed
+	}
+	select {
+	case p.queue <- pushedCall{serviceMethod: serviceMethod, args: args}:
+		return nil
+	case <-p.stop:
+		return ErrPusherClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *OrderedPusher) run() {
+	defer close(p.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-p.done:
+		}
+	}()
+	for pc := range p.queue {
+		select {
+		case <-p.stop:
+			if p.opts.OnError != nil {
+				p.opts.OnError(pc.serviceMethod, pc.args, ErrPusherClosed)
+			}
+			continue
+		default:
+		}
+		invoke := func() error {
+			return p.client.Call(ctx, pc.serviceMethod, pc.args, nil)
+		}
+		var err error
+		if p.opts.Retry != nil {
+			err = p.opts.Retry.callMethod(ctx, pc.serviceMethod, pc.args, invoke)
+		} else {
+			err = invoke()
+		}
+		if err != nil {
+			debugln("rpc: ordered push of", pc.serviceMethod, "failed:", err)
+			if p.opts.OnError != nil {
+				p.opts.OnError(pc.serviceMethod, pc.args, err)
+			}
+		}
+	}
+}
+
+// Close stops accepting calls and waits for the queued ones to be sent.
+func (p *OrderedPusher) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
+
+// Abort is like Close but abandons the calls still queued, passing them to
+// OnError with ErrPusherClosed, and cancels the one being sent.
+func (p *OrderedPusher) Abort() {
+	// stopping first, the pushes waiting on the full queue give up
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	<-p.done
+}
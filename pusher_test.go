@@ -0,0 +1,133 @@
+package birpc
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Balances records the updates it receives, serving them slower than they
+// are pushed and failing the first attempt of some.
+type Balances struct {
+	mu      sync.Mutex
+	updates []int
+	fail    map[int]bool
+}
+
+func (b *Balances) Update(ctx *context.Context, value int) error {
+	time.Sleep(time.Millisecond)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail[value] {
+		delete(b.fail, value)
+		return errors.New("try again")
+	}
+	b.updates = append(b.updates, value)
+	return nil
+}
+
+func TestOrderedPusher(t *testing.T) {
+	balances := &Balances{fail: map[int]bool{3: true}}
+	server := NewBirpcServer()
+	server.Register(balances, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+
+	var failed []interface{}
+	p := NewOrderedPusher(client, PusherOptions{
+		QueueSize: 2,
+		Retry: &RetryPolicy{
+			MaxAttempts: 2,
+			Retryable:   func(err error) bool { return err.Error() == "try again" },
+		},
+		OnError: func(serviceMethod string, args interface{}, err error) {
+			failed = append(failed, args)
+		},
+	})
+	ctx := context.Background()
+	for i := 1; i <= 6; i++ {
+		if err := p.Push(ctx, "Balances.Update", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+	if err := p.Push(ctx, "Balances.Update", 7); err != ErrPusherClosed {
+		t.Errorf("expected %v, got %v", ErrPusherClosed, err)
+	}
+	if exp := []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(balances.updates, exp) {
+		t.Errorf("expected %v, got %v", exp, balances.updates)
+	}
+	if len(failed) != 0 {
+		t.Errorf("unexpected failures %v", failed)
+	}
+
+	p = NewOrderedPusher(client, PusherOptions{
+		QueueSize: 10,
+		OnError: func(serviceMethod string, args interface{}, err error) {
+			failed = append(failed, args)
+		},
+	})
+	for i := 10; i < 15; i++ {
+		p.Push(ctx, "Balances.Update", i)
+	}
+	p.Abort()
+	balances.mu.Lock()
+	delivered := len(balances.updates) - 6
+	balances.mu.Unlock()
+	if delivered+len(failed) < 5 {
+		t.Errorf("expected every call delivered or failed, got %d delivered and %v failed", delivered, failed)
+	}
+}
+
+func TestOrderedPusherAbortFull(t *testing.T) {
+	blocker := &Blocker{release: make(chan struct{})}
+	defer close(blocker.release)
+	server := NewBirpcServer()
+	server.Register(blocker, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+
+	var mu sync.Mutex
+	var failed []interface{}
+	p := NewOrderedPusher(client, PusherOptions{
+		QueueSize: 1,
+		OnError: func(serviceMethod string, args interface{}, err error) {
+			mu.Lock()
+			failed = append(failed, args)
+			mu.Unlock()
+		},
+	})
+	ctx := context.Background()
+	// the first call hangs, the second fills the queue
+	for i := 0; i < 2; i++ {
+		if err := p.Push(ctx, "Blocker.Hold", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pushed := make(chan error, 1)
+	go func() { pushed <- p.Push(ctx, "Blocker.Hold", 2) }()
+	time.Sleep(20 * time.Millisecond)
+
+	aborted := make(chan struct{})
+	go func() {
+		p.Abort()
+		close(aborted)
+	}()
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("Abort blocked by the push waiting on the full queue")
+	}
+	if err := <-pushed; err != ErrPusherClosed {
+		t.Errorf("expected %v, got %v", ErrPusherClosed, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 2 {
+		t.Errorf("expected the calls failed, got %v", failed)
+	}
+}
@@ -0,0 +1,105 @@
+package birpc
+
+import (
+	"io"
+	"net"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// QUICConn is the part of a QUIC connection carrying birpc, each of its
+// streams serving as a connection of its own, so that the calls of a
+// stream are not blocked by the packets lost on the others. The
+// connections of the QUIC libraries, such as quic-go, are adapted to it
+// by wrapping their streams in net.Conn, closing both directions of the
+// stream on Close.
+type QUICConn interface {
+	OpenStream(ctx *context.Context) (net.Conn, error)
+	AcceptStream(ctx *context.Context) (net.Conn, error)
+	Close() error
+}
+
+// QUICListener accepts the QUIC connections, see QUICConn.
+type QUICListener interface {
+	Accept(ctx *context.Context) (QUICConn, error)
+	Addr() net.Addr
+	Close() error
+}
+
+// ServeQUIC accepts the QUIC connections on lis and serves each of their
+// streams as a connection, see ServeConn. ServeQUIC blocks until lis
+// returns a non-nil error, like Accept.
+func (server *Server) ServeQUIC(lis QUICListener) error {
+	return serveQUIC(lis, func(stream net.Conn) { server.ServeConn(stream) })
+}
+
+// ServeQUIC is like Server.ServeQUIC for BirpcServer.
+func (s *BirpcServer) ServeQUIC(lis QUICListener) error {
+	return serveQUIC(lis, func(stream net.Conn) { s.ServeConn(stream) })
+}
+
+func serveQUIC(lis QUICListener, serve func(net.Conn)) error {
+	for {
+		conn, err := lis.Accept(context.Background())
+		if err != nil {
+			debugln("rpc.ServeQUIC: accept:", err.Error())
+			return err
+		}
+		go func() {
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go serve(stream)
+			}
+		}()
+	}
+}
+
+// NewQUICClient opens a stream on conn and returns a Client using it, the
+// stream being a logical connection. The streams of a QUICConn are cheap,
+// a Pool of such clients sparing the calls of each the losses of the
+// others.
+func NewQUICClient(ctx *context.Context, conn QUICConn) (*Client, error) {
+	stream, err := conn.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(stream), nil
+}
+
+// QUICCaller makes each call on a stream of its own, so that no call
+// waits for the packets lost by the others. It suits the calls which are
+// few or slow, each opening a stream.
+type QUICCaller struct {
+	conn     QUICConn
+	newCodec func(io.ReadWriteCloser) ClientCodec
+}
+
+// NewQUICCaller returns a QUICCaller on conn using the named codec, "gob"
+// if empty.
+func NewQUICCaller(conn QUICConn, codec string) (*QUICCaller, error) {
+	newCodec, err := getClientCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	return &QUICCaller{conn: conn, newCodec: newCodec}, nil
+}
+
+// Call invokes the named function on a new stream, closed once done.
+func (c *QUICCaller) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	stream, err := c.conn.OpenStream(ctx)
+	if err != nil {
+		return err
+	}
+	client := NewClientWithCodec(c.newCodec(stream))
+	defer client.Close()
+	return client.Call(ctx, serviceMethod, args, reply)
+}
+
+// Close closes the QUIC connection.
+func (c *QUICCaller) Close() error {
+	return c.conn.Close()
+}
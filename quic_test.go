@@ -0,0 +1,77 @@
+package birpc
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// muxQUIC adapts a Mux to QUICConn, standing for a QUIC connection.
+type muxQUIC struct{ *Mux }
+
+func (m muxQUIC) OpenStream(ctx *context.Context) (net.Conn, error) { return m.Mux.OpenStream("") }
+func (m muxQUIC) AcceptStream(ctx *context.Context) (net.Conn, error) {
+	return m.Mux.AcceptStream()
+}
+
+type chanQUICListener struct {
+	conns  chan QUICConn
+	closed chan struct{}
+}
+
+func (l *chanQUICListener) Accept(ctx *context.Context) (QUICConn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, ErrShutdown
+	}
+}
+
+func (l *chanQUICListener) Addr() net.Addr { return muxAddr{} }
+func (l *chanQUICListener) Close() error   { close(l.closed); return nil }
+
+func TestServeQUIC(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	lis := &chanQUICListener{conns: make(chan QUICConn, 1), closed: make(chan struct{})}
+	defer lis.Close()
+	go server.ServeQUIC(lis)
+	a, b := net.Pipe()
+	lis.conns <- muxQUIC{NewMux(b, false)}
+	conn := muxQUIC{NewMux(a, true)}
+
+	ctx := context.Background()
+	client, err := NewQUICClient(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Add", &Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("Add: %v %v", reply.C, err)
+	}
+
+	caller, err := NewQUICCaller(conn, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer caller.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reply := new(Reply)
+			if err := caller.Call(ctx, "Arith.Mul", &Args{i, 2}, reply); err != nil || reply.C != 2*i {
+				t.Errorf("Mul: %v %v", reply.C, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, err = NewQUICCaller(conn, "unknown"); err == nil {
+		t.Error("expected an unknown codec to be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package birpc
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a simple token bucket rate limiter. A zero rate means
+// no limit is enforced.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // maximum number of tokens
+	tokens float64
+	last   time.Time
+}
+
+// set updates the rate and burst of the bucket keeping the tokens already
+// accumulated, so reconfiguring does not reset the limiter.
+func (b *tokenBucket) set(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	if b.rate == 0 {
+		// start with a full bucket
+		b.tokens = float64(burst)
+		b.last = time.Now()
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// allow reports whether one more event may happen now.
+func (b *tokenBucket) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate == 0 {
+		return true
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// methodLimiters are the token buckets of the methods, see
+// MethodRateLimits.
+type methodLimiters struct {
+	mu      sync.RWMutex
+	buckets map[string]*tokenBucket
+}
+
+// set updates the buckets of the methods to limits, keeping the tokens of
+// the methods still limited.
+func (l *methodLimiters) set(limits map[string]RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buckets := make(map[string]*tokenBucket, len(limits))
+	for method, limit := range limits {
+		b := l.buckets[method]
+		if b == nil {
+			b = new(tokenBucket)
+		}
+		b.set(limit.Rate, limit.Burst)
+		buckets[method] = b
+	}
+	l.buckets = buckets
+}
+
+// allow reports whether one more call of serviceMethod may happen now.
+func (l *methodLimiters) allow(serviceMethod string) bool {
+	l.mu.RLock()
+	b := l.buckets[serviceMethod]
+	l.mu.RUnlock()
+	return b == nil || b.allow()
+}
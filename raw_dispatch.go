@@ -0,0 +1,47 @@
+package birpc
+
+import (
+	"github.com/cgrates/birpc/context"
+)
+
+// RawCodec encodes the arguments and the replies given to DispatchRaw.
+type RawCodec struct {
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+// GobRaw encodes the arguments and replies with gob, each value on its own
+// like RawReply.
+var GobRaw = RawCodec{Marshal: gobEncodeRaw, Unmarshal: gobUnmarshal}
+
+// DispatchRaw calls serviceMethod with the arguments encoded in args,
+// returning the encoded reply. It serves the calls of the projects
+// carrying the requests in their own protocol, without the header loop of
+// the codecs, see Framer. The errors are the ones of Dispatch.
+func (server *basicServer) DispatchRaw(ctx *context.Context, serviceMethod string, args []byte, codec RawCodec) (reply []byte, err error) {
+	err = server.Dispatch(ctx, nil, serviceMethod,
+		func(v interface{}) error {
+			return codec.Unmarshal(args, v)
+		},
+		func(v interface{}, callErr error) (err error) {
+			if callErr != nil {
+				return callErr
+			}
+			reply, err = codec.Marshal(v)
+			return
+		})
+	return
+}
+
+// ServeRaw dispatches req with DispatchRaw, answering with its reply or
+// its error.
+func (server *basicServer) ServeRaw(ctx *context.Context, req *RawRequest, codec RawCodec) *RawResponse {
+	resp := &RawResponse{Seq: req.Seq}
+	reply, err := server.DispatchRaw(ctx, req.ServiceMethod, req.Args, codec)
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Reply = reply
+	return resp
+}
@@ -0,0 +1,101 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestDispatchRaw(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+
+	args, _ := GobRaw.Marshal(&Args{7, 8})
+	data, err := server.DispatchRaw(context.Background(), "Arith.Add", args, GobRaw)
+	var reply Reply
+	if err != nil || GobRaw.Unmarshal(data, &reply) != nil || reply.C != 15 {
+		t.Errorf("unexpected reply %+v: %v", reply, err)
+	}
+	args, _ = GobRaw.Marshal(&Args{7, 0})
+	if _, err := server.DispatchRaw(context.Background(), "Arith.Div", args, GobRaw); err != ServerError("divide by zero") {
+		t.Errorf("expected the error of the method, got %v", err)
+	}
+	if _, err := server.DispatchRaw(context.Background(), "Arith.Missing", args, GobRaw); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+	if _, err := server.DispatchRaw(context.Background(), "Arith.Add", []byte("garbage"), GobRaw); err == nil {
+		t.Error("expected an error decoding the arguments")
+	}
+}
+
+func TestFramer(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	defer cli.Close()
+
+	// a protocol of its own, carrying the requests after a type byte
+	go func() {
+		defer srv.Close()
+		framer := NewFramer(srv, 1<<20)
+		for {
+			frame, err := framer.ReadFrame()
+			if err != nil {
+				return
+			}
+			if frame[0] != 'R' {
+				framer.WriteFrame([]byte("?"))
+				continue
+			}
+			var req RawRequest
+			if err := req.UnmarshalBinary(frame[1:]); err != nil {
+				return
+			}
+			data, _ := server.ServeRaw(context.Background(), &req, GobRaw).MarshalBinary()
+			framer.WriteFrame(append([]byte{'R'}, data...))
+		}
+	}()
+
+	framer := NewFramer(cli, 0)
+	if err := framer.WriteFrame([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := framer.ReadFrame(); err != nil || string(frame) != "?" {
+		t.Fatalf("unexpected frame %q: %v", frame, err)
+	}
+	for seq, args := range []Args{{6, 2}, {3, 0}} {
+		req := RawRequest{Seq: uint64(seq), ServiceMethod: "Arith.Div"}
+		req.Args, _ = GobRaw.Marshal(args)
+		data, _ := req.MarshalBinary()
+		if err := framer.WriteFrame(append([]byte{'R'}, data...)); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp RawResponse
+		if err := resp.UnmarshalBinary(frame[1:]); err != nil || resp.Seq != uint64(seq) {
+			t.Fatalf("unexpected response %+v: %v", resp, err)
+		}
+		var reply Reply
+		if args.B == 0 {
+			if resp.Error != "divide by zero" {
+				t.Errorf("expected the error of the method, got %+v", resp)
+			}
+		} else if err := GobRaw.Unmarshal(resp.Reply, &reply); err != nil || reply.C != 3 {
+			t.Errorf("unexpected reply %+v: %v", reply, err)
+		}
+	}
+
+	if err := new(RawRequest).UnmarshalBinary([]byte{1, 9, 'A'}); err != errShortFrame {
+		t.Errorf("expected a short frame, got %v", err)
+	}
+	a, b := net.Pipe()
+	defer a.Close()
+	go NewFramer(a, 0).WriteFrame([]byte("abc"))
+	if _, err := NewFramer(b, 2).ReadFrame(); err != ErrFrameTooLarge {
+		t.Errorf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
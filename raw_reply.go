@@ -0,0 +1,98 @@
+package birpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+)
+
+// errNoRawReply is returned when the codec of the client cannot capture
+// raw replies.
+var errNoRawReply = errors.New("rpc: the codec does not support RawReply")
+
+// RawReply captures a reply without decoding it, when given as the reply
+// of a call, for the dispatchers and caches forwarding the replies they do
+// not interpret. The reply can be decoded later with Decode, as many times
+// and into as many types as needed.
+//
+// The JSON-RPC codecs keep the JSON result as is. With gob the client asks
+// the server to encode the reply on its own, so Data can be decoded
+// without the type information sent earlier on the connection; the gob
+// servers predating RawReply fail such calls.
+type RawReply struct {
+	Format    string // "gob" or "json"
+	Data      []byte // the encoded reply
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+// Decode decodes the reply into v.
+func (r *RawReply) Decode(v interface{}) error {
+	if r.Unmarshal == nil {
+		return errors.New("rpc: empty RawReply")
+	}
+	return r.Unmarshal(r.Data, v)
+}
+
+// rawResponseReader is implemented by the codecs able to capture the body
+// of a response into a RawReply.
+type rawResponseReader interface {
+	ReadRawResponseBody(*RawReply) error
+}
+
+// rawReplyEncoder is implemented by the server codecs which need the
+// replies requested raw to be encoded on their own, see Request.Raw.
+type rawReplyEncoder interface {
+	EncodeRawReply(reply interface{}) ([]byte, error)
+}
+
+// readResponseBody reads the body of a response into reply, capturing it
+// if reply is a *RawReply.
+func readResponseBody(codec interface{ ReadResponseBody(interface{}) error }, reply interface{}) error {
+	raw, isRaw := reply.(*RawReply)
+	if !isRaw {
+		return codec.ReadResponseBody(reply)
+	}
+	if rr, ok := codec.(rawResponseReader); ok {
+		return rr.ReadRawResponseBody(raw)
+	}
+	if err := codec.ReadResponseBody(nil); err != nil {
+		return err
+	}
+	return errNoRawReply
+}
+
+func gobEncodeRaw(reply interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(reply); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gobUnmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// gobReadRaw reads a reply encoded by gobEncodeRaw into raw.
+func gobReadRaw(dec *gob.Decoder, raw *RawReply) error {
+	var data []byte
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+	*raw = RawReply{Format: "gob", Data: data, Unmarshal: gobUnmarshal}
+	return nil
+}
+
+// readCallReply reads the body of the response to call into its reply,
+// decoding it apart if it was requested standalone, see
+// WithStandaloneReply.
+func readCallReply(codec interface{ ReadResponseBody(interface{}) error }, call *Call) error {
+	if _, isRaw := call.Reply.(*RawReply); isRaw || !call.standalone || call.Reply == nil {
+		return readResponseBody(codec, call.Reply)
+	}
+	var raw RawReply
+	if err := readResponseBody(codec, &raw); err != nil {
+		return err
+	}
+	return raw.Decode(call.Reply)
+}
@@ -0,0 +1,86 @@
+package birpc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestRawReply(t *testing.T) {
+	server := NewServer()
+	server.Register(Accounts{})
+	bserver := NewBirpcServer()
+	bserver.Register(Accounts{})
+	ctx := context.Background()
+	exp := Account{
+		ID:      "1001",
+		Balance: 10,
+		History: []float64{1, 2, 3},
+		Owner:   &Owner{Name: "owner", Address: "address"},
+	}
+
+	for name, client := range map[string]ClientConnector{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		var raw RawReply
+		if err := client.Call(ctx, "Accounts.Get", "1001", &raw); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if raw.Format != "gob" || len(raw.Data) == 0 {
+			t.Fatalf("%s: unexpected raw reply %+v", name, raw)
+		}
+		var acc Account
+		if err := raw.Decode(&acc); err != nil || !reflect.DeepEqual(acc, exp) {
+			t.Errorf("%s: expected %+v, got %+v: %v", name, exp, acc, err)
+		}
+		var owner struct{ Owner Owner }
+		if err := raw.Decode(&owner); err != nil || owner.Owner != *exp.Owner {
+			t.Errorf("%s: unexpected owner %+v: %v", name, owner, err)
+		}
+
+		// the connection keeps working with typed replies
+		acc = Account{}
+		if err := client.Call(ctx, "Accounts.Get", "1001", &acc); err != nil || !reflect.DeepEqual(acc, exp) {
+			t.Errorf("%s: expected %+v, got %+v: %v", name, exp, acc, err)
+		}
+	}
+
+	var raw RawReply
+	if err := raw.Decode(new(Account)); err == nil {
+		t.Error("expected error decoding an empty RawReply")
+	}
+}
+
+func TestStandaloneReply(t *testing.T) {
+	server := NewServer()
+	server.Register(Accounts{})
+	bserver := NewBirpcServer()
+	bserver.Register(Accounts{})
+	ctx := WithStandaloneReply(context.Background())
+
+	for name, client := range map[string]ClientConnector{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		for i := 0; i < 2; i++ {
+			var acc Account
+			if err := client.Call(ctx, "Accounts.Get", "1001", &acc); err != nil || acc.ID != "1001" || acc.Owner == nil {
+				t.Errorf("%s: unexpected reply %+v: %v", name, acc, err)
+			}
+		}
+		var raw RawReply
+		if err := client.Call(ctx, "Accounts.Get", "1001", &raw); err != nil || raw.Format != "gob" {
+			t.Errorf("%s: unexpected raw reply %+v: %v", name, raw, err)
+		}
+		if err := client.Call(ctx, "Accounts.Get", "1001", nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		// the connection keeps working with the replies of the stream
+		var acc Account
+		if err := client.Call(context.Background(), "Accounts.Get", "1001", &acc); err != nil || acc.ID != "1001" {
+			t.Errorf("%s: unexpected reply %+v: %v", name, acc, err)
+		}
+	}
+}
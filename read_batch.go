@@ -0,0 +1,111 @@
+package birpc
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+const (
+	// readBufferSize is the size of the read buffer of the gob server
+	// codec, holding the requests pipelined by the clients.
+	readBufferSize = 64 << 10
+
+	// maxReadBatch is the most requests decoded before dispatching them,
+	// see ServeCodec.
+	maxReadBatch = 128
+)
+
+// bufferedRequest reports whether the codec holds a whole request read
+// from the connection, for the codecs implementing BufferedRequest() bool.
+// Such a request is decoded without waiting for the connection.
+func bufferedRequest(codec ServerCodec) bool {
+	c, ok := codec.(interface{ BufferedRequest() bool })
+	return ok && c.BufferedRequest()
+}
+
+// gobUint decodes the unsigned integer of gob at the start of buf,
+// returning its value and size, or a zero size if buf is too short.
+func gobUint(buf []byte) (uint64, int) {
+	if len(buf) == 0 {
+		return 0, 0
+	}
+	if buf[0] < 0x80 {
+		return uint64(buf[0]), 1
+	}
+	n := -int(int8(buf[0]))
+	if n > 8 || len(buf) <= n {
+		return 0, 0
+	}
+	var x uint64
+	for _, b := range buf[1 : n+1] {
+		x = x<<8 | uint64(b)
+	}
+	return x, n + 1
+}
+
+// batchedCall is a request decoded and waiting for the rest of its batch.
+type batchedCall struct {
+	service      *Service
+	mtype        *MethodType
+	req          *Request
+	argv, replyv reflect.Value
+}
+
+// PipelineStats describes how the requests pipelined by the clients were
+// read, see the PipelineStats method of Server. The requests read along
+// with others are decoded in batches, dispatched together.
+type PipelineStats struct {
+	// Batches is the number of batches of requests dispatched.
+	Batches uint64 `json:"batches"`
+	// Requests is the number of requests in the batches.
+	Requests uint64 `json:"requests"`
+	// Pipelined is the number of requests dispatched along with others.
+	Pipelined uint64 `json:"pipelined"`
+	// MaxDepth is the size of the largest batch.
+	MaxDepth uint64 `json:"max_depth"`
+}
+
+type pipelineStats struct {
+	batches   uint64
+	requests  uint64
+	pipelined uint64
+	maxDepth  uint64
+}
+
+// observe records a batch of n requests.
+func (s *pipelineStats) observe(n int) {
+	atomic.AddUint64(&s.batches, 1)
+	atomic.AddUint64(&s.requests, uint64(n))
+	if n > 1 {
+		atomic.AddUint64(&s.pipelined, uint64(n))
+	}
+	for {
+		max := atomic.LoadUint64(&s.maxDepth)
+		if uint64(n) <= max || atomic.CompareAndSwapUint64(&s.maxDepth, max, uint64(n)) {
+			return
+		}
+	}
+}
+
+// dispatch serves the calls of batch, returning it emptied.
+func (server *Server) dispatch(conn *serverConn, batch []batchedCall) []batchedCall {
+	server.pipeline.observe(len(batch))
+	for i, c := range batch {
+		conn.serve(server.basicServer, c.service, c.mtype, c.req, c.argv, c.replyv)
+		batch[i] = batchedCall{}
+	}
+	return batch[:0]
+}
+
+// PipelineStats returns the statistics of the requests read so far. The
+// codecs implementing BufferedRequest() bool, like the gob one, let the
+// server decode the requests already read before dispatching them, the
+// others dispatching each request alone.
+func (server *Server) PipelineStats() PipelineStats {
+	return PipelineStats{
+		Batches:   atomic.LoadUint64(&server.pipeline.batches),
+		Requests:  atomic.LoadUint64(&server.pipeline.requests),
+		Pipelined: atomic.LoadUint64(&server.pipeline.pipelined),
+		MaxDepth:  atomic.LoadUint64(&server.pipeline.maxDepth),
+	}
+}
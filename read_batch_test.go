@@ -0,0 +1,76 @@
+package birpc
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+type bufferCloser struct{ bytes.Buffer }
+
+func (*bufferCloser) Close() error { return nil }
+
+func TestReadBatch(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	cli, srv := net.Pipe()
+	defer cli.Close()
+	go server.ServeConn(srv)
+
+	// the requests are written at once, read by a single read of the server
+	var buf bufferCloser
+	enc := NewClientCodec(&buf)
+	const n = 5
+	for i := 0; i < n; i++ {
+		req := &Request{ServiceMethod: "Arith.Add", Seq: uint64(i)}
+		if err := enc.WriteRequest(req, Args{i, 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cli.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	dec := NewClientCodec(cli)
+	sum := 0
+	for i := 0; i < n; i++ {
+		var resp Response
+		var reply Reply
+		if err := dec.ReadResponseHeader(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.ReadResponseBody(&reply); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != "" || reply.C != int(resp.Seq)+1 {
+			t.Errorf("unexpected reply %d to request %d: %s", reply.C, resp.Seq, resp.Error)
+		}
+		sum += reply.C
+	}
+	if sum != 15 {
+		t.Errorf("expected the replies to sum up to 15, got %d", sum)
+	}
+	exp := PipelineStats{Batches: 1, Requests: n, Pipelined: n, MaxDepth: n}
+	if stats := server.PipelineStats(); stats != exp {
+		t.Errorf("expected %+v, got %+v", exp, stats)
+	}
+
+	// a lone request is dispatched alone
+	buf.Reset()
+	if err := enc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: n}, Args{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	var resp Response
+	if err := dec.ReadResponseHeader(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.ReadResponseBody(new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	exp = PipelineStats{Batches: 2, Requests: n + 1, Pipelined: n, MaxDepth: n}
+	if stats := server.PipelineStats(); stats != exp {
+		t.Errorf("expected %+v, got %+v", exp, stats)
+	}
+}
@@ -0,0 +1,58 @@
+package birpc
+
+import "sync"
+
+// ReadControl pauses the reading of the requests of a connection, giving
+// explicit flow control to the methods and to the subsystems limiting the
+// load: while paused, the calls being served go on but no new request is
+// read, the one arriving meanwhile waiting for the reads to resume. The
+// pauses nest, the reads resuming once each PauseReads is matched by
+// ResumeReads.
+//
+// On the connections of BirpcServer and BirpcClient the responses share
+// the reads with the requests, so they wait for the reads to resume too.
+type ReadControl struct {
+	mu     sync.Mutex
+	paused int
+	resume chan struct{} // closed when the reads resume
+}
+
+// PauseReads stops reading new requests.
+func (r *ReadControl) PauseReads() {
+	r.mu.Lock()
+	if r.paused == 0 {
+		r.resume = make(chan struct{})
+	}
+	r.paused++
+	r.mu.Unlock()
+}
+
+// ResumeReads ends a pause started by PauseReads.
+func (r *ReadControl) ResumeReads() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused == 0 {
+		return
+	}
+	if r.paused--; r.paused == 0 {
+		close(r.resume)
+	}
+}
+
+// Paused reports whether the reads are paused.
+func (r *ReadControl) Paused() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.paused != 0
+}
+
+// wait waits for the reads to resume.
+func (r *ReadControl) wait() {
+	r.mu.Lock()
+	resume := r.resume
+	paused := r.paused != 0
+	r.mu.Unlock()
+	if paused {
+		<-resume
+	}
+}
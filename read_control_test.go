@@ -0,0 +1,68 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Throttle struct {
+	reads chan *ReadControl
+}
+
+func (t *Throttle) Pause(ctx *context.Context, _ int, reply *int, info *CallInfo) error {
+	info.Reads.PauseReads()
+	t.reads <- info.Reads
+	return nil
+}
+
+func (t *Throttle) Echo(ctx *context.Context, n int, reply *int) error {
+	*reply = n
+	return nil
+}
+
+func TestReadControl(t *testing.T) {
+	throttle := &Throttle{reads: make(chan *ReadControl, 1)}
+	server := NewServer()
+	server.Register(throttle)
+	bserver := NewBirpcServer()
+	bserver.Register(throttle)
+
+	for name, client := range map[string]ClientConnector{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		var reply int
+		if err := client.Call(context.Background(), "Throttle.Pause", 0, &reply); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		reads := <-throttle.reads
+		reads.PauseReads() // nested
+		done := make(chan error, 1)
+		go func() { done <- client.Call(context.Background(), "Throttle.Echo", 7, &reply) }()
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-done:
+				t.Fatalf("%s: the call was served while the reads are paused: %v", name, err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if !reads.Paused() {
+				t.Errorf("%s: expected the reads to be paused", name)
+			}
+			reads.ResumeReads()
+		}
+		select {
+		case err := <-done:
+			if err != nil || reply != 7 {
+				t.Errorf("%s: unexpected reply %d: %v", name, reply, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: the reads did not resume", name)
+		}
+		reads.ResumeReads() // without pause, ignored
+		if reads.Paused() {
+			t.Errorf("%s: unexpected pause", name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package birpc
+
+import (
+	"reflect"
+)
+
+// Redacted replaces the string fields masked by Redact.
+const Redacted = "[REDACTED]"
+
+// redactedFields are the fields tagged `birpc:"redact"`, along with the
+// encrypted ones.
+var redactedFields = &taggedFields{match: func(f reflect.StructField) bool {
+	return hasTagOption(f, "redact") || encryptedFields.match(f)
+}}
+
+// Redact returns a copy of v fit for the logs, the captures and the dumps:
+// its fields tagged `birpc:"redact"`, or "encrypt", are masked, the
+// strings being replaced by Redacted and the other values zeroed, in the
+// nested structs as well. v itself is not changed. The diagnostics and the
+// debug logs of the package do not show the arguments and the replies; the
+// access logs, the traffic captures and the journals recording them are
+// expected to pass them through Redact.
+func Redact(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	red, _ := redactedFields.rewrite(reflect.ValueOf(v), func(f reflect.StructField, v reflect.Value) (reflect.Value, error) {
+		if v.Kind() == reflect.String && v.Len() != 0 {
+			return reflect.ValueOf(Redacted).Convert(v.Type()), nil
+		}
+		return reflect.Zero(v.Type()), nil
+	})
+	return red.Interface()
+}
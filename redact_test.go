@@ -0,0 +1,48 @@
+package birpc
+
+import (
+	"testing"
+)
+
+type Login struct {
+	User     string
+	Password string `birpc:"redact"`
+	PIN      int    `birpc:"redact"`
+	Card     *CallRecord
+	Tokens   map[string]LoginToken
+}
+
+type LoginToken struct {
+	Value string `birpc:"redact"`
+}
+
+func TestRedact(t *testing.T) {
+	login := &Login{
+		User:     "1001",
+		Password: "secret",
+		PIN:      1234,
+		Card:     &CallRecord{Caller: "+4912345", Account: "1001"},
+		Tokens:   map[string]LoginToken{"api": {Value: "t0k3n"}},
+	}
+	red := Redact(login).(*Login)
+	if red.User != "1001" || red.Password != Redacted || red.PIN != 0 ||
+		red.Card.Caller != Redacted || red.Card.Callee != "" || red.Card.Account != "1001" ||
+		red.Tokens["api"].Value != Redacted {
+		t.Errorf("unexpected redaction %+v", red)
+	}
+	if login.Password != "secret" || login.PIN != 1234 || login.Card.Caller != "+4912345" ||
+		login.Tokens["api"].Value != "t0k3n" {
+		t.Errorf("expected the original to be kept, got %+v", login)
+	}
+
+	// the values without tagged fields are returned as they are
+	if v := Redact([]string{"a"}); v.([]string)[0] != "a" {
+		t.Errorf("unexpected redaction %v", v)
+	}
+	if v := Redact([]interface{}{LoginToken{Value: "t0k3n"}}); v.([]interface{})[0].(LoginToken).Value != Redacted {
+		t.Errorf("unexpected redaction %v", v)
+	}
+	if Redact(nil) != nil {
+		t.Error("expected nil")
+	}
+}
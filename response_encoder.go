@@ -0,0 +1,78 @@
+package birpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ResponseEncoder is implemented by the server codecs able to encode each
+// response on its own, concurrently with the others. The server encodes
+// their responses before taking the lock serializing the writes of the
+// connection, so a large response does not delay the small ones while it
+// is being encoded: only writing the encoded bytes is serialized. The
+// JSON-RPC codecs implement it, the gob ones cannot since gob sends the
+// type definitions once per stream, making each message depend on the
+// ones written before it. With gob the replies are encoded on their own,
+// before taking the lock, for the calls asking for it with
+// WithStandaloneReply.
+type ResponseEncoder interface {
+	// EncodeResponse encodes the response with its body. It is called
+	// without holding the sending lock.
+	EncodeResponse(r *Response, body interface{}) ([]byte, error)
+	// WriteEncodedResponse writes a response encoded by EncodeResponse.
+	WriteEncodedResponse(data []byte) error
+}
+
+type standaloneReplyKey struct{}
+
+// WithStandaloneReply returns a copy of ctx asking the servers to encode
+// the replies of the calls made with it on their own, as for a RawReply,
+// which the gob servers do before taking the lock serializing the writes
+// of the connection. It suits the calls with large replies, which would
+// otherwise delay the other replies of the connection while encoded, at
+// the cost of sending the type definitions of the reply with each of
+// them. As with RawReply the replies are not checksummed, see
+// ChecksumReplies. The other codecs are not affected.
+func WithStandaloneReply(ctx *context.Context) *context.Context {
+	return context.WithValue(ctx, standaloneReplyKey{}, true)
+}
+
+// standaloneReply reports whether ctx asks for standalone replies.
+func standaloneReply(ctx *context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	standalone, _ := ctx.Value(standaloneReplyKey{}).(bool)
+	return standalone
+}
+
+// writeResponse writes resp with reply, encoding it before taking the
+// sending lock if codec is a ResponseEncoder. A reply which cannot be
+// encoded is replaced by an error, so the client is not left waiting. It
+// returns the time spent encoding, including the write for the other
+// codecs.
+func writeResponse(sending sync.Locker, codec writeServerCodec, resp *Response, reply interface{}) (encoding time.Duration, err error) {
+	enc, ok := codec.(ResponseEncoder)
+	if !ok {
+		sending.Lock()
+		defer sending.Unlock()
+		start := time.Now()
+		err = codec.WriteResponse(resp, reply)
+		return time.Since(start), err
+	}
+	start := time.Now()
+	data, err := enc.EncodeResponse(resp, reply)
+	if err != nil && resp.Error == "" {
+		resp.Error = "rpc: encoding reply: " + err.Error()
+		data, err = enc.EncodeResponse(resp, invalidRequest)
+	}
+	encoding = time.Since(start)
+	if err != nil {
+		return
+	}
+	sending.Lock()
+	defer sending.Unlock()
+	return encoding, enc.WriteEncodedResponse(data)
+}
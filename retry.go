@@ -0,0 +1,193 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+	"github.com/cgrates/birpc/internal/svc"
+)
+
+// RetryPolicy describes how failed calls are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, it doubles after every
+	// attempt up to MaxBackoff, if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Retryable decides whether a call failing with the error can be
+	// retried, IsConnectionError is used if nil.
+	Retryable func(error) bool
+
+	// Idempotent, if set, reports whether the method can be called again
+	// safely, the failed call having maybe reached the server, see
+	// IdempotentMethods. The calls to the other methods are retried only
+	// if their arguments carry an idempotency key, see Idempotent. All the
+	// calls are retried if nil.
+	Idempotent func(serviceMethod string) bool
+}
+
+// IsConnectionError reports whether err was caused by the connection
+// rather than returned by the called method.
+func IsConnectionError(err error) bool {
+	if err == ErrShutdown || err == ErrGoAway || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	var connErr *ConnError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsConnectionError(err)
+}
+
+// safe reports whether the call to serviceMethod with args can be retried.
+func (p *RetryPolicy) safe(serviceMethod string, args interface{}) bool {
+	if p.Idempotent == nil || p.Idempotent(serviceMethod) {
+		return true
+	}
+	a, ok := args.(Idempotent)
+	return ok && a.IdempotencyKey() != ""
+}
+
+// callMethod runs invoke, calling serviceMethod with args, following the
+// policy if the call can be retried safely, once otherwise.
+func (p *RetryPolicy) callMethod(ctx *context.Context, serviceMethod string, args interface{}, invoke func() error) error {
+	if !p.safe(serviceMethod, args) {
+		return invoke()
+	}
+	return p.call(ctx, invoke)
+}
+
+// call runs invoke until it succeeds, fails with an error which is not
+// retryable, the attempts are exhausted or ctx is done.
+func (p *RetryPolicy) call(ctx *context.Context, invoke func() error) (err error) {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		if err = invoke(); err == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+			return
+		}
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if backoff *= 2; p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+	}
+}
+
+// retryConn retries the failed calls of conn following policy.
+type retryConn struct {
+	ClientConn
+	policy RetryPolicy
+}
+
+func (c *retryConn) Call(ctx *context.Context, serviceMethod string, args, reply interface{}) error {
+	policy := &c.policy
+	if p := callRetryPolicy(ctx); p != nil {
+		policy = p
+	}
+	return policy.callMethod(ctx, serviceMethod, args, func() error {
+		return c.ClientConn.Call(ctx, serviceMethod, args, reply)
+	})
+}
+
+// RetryInterceptor returns the ClientInterceptor retrying the failed calls
+// following policy, or the one of their context, see WithRetryPolicy.
+func RetryInterceptor(policy RetryPolicy) ClientInterceptor {
+	return func(ctx *context.Context, serviceMethod string, args, reply interface{}, invoker Invoker) error {
+		p := &policy
+		if cp := callRetryPolicy(ctx); cp != nil {
+			p = cp
+		}
+		return p.callMethod(ctx, serviceMethod, args, func() error {
+			return invoker(ctx, serviceMethod, args, reply)
+		})
+	}
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a copy of ctx making the calls made with it
+// retried following policy instead of the policy of the client, see
+// ClientBuilder.WithRetry and RetryInterceptor. A policy of a single
+// attempt disables the retries.
+func WithRetryPolicy(ctx *context.Context, policy RetryPolicy) *context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, &policy)
+}
+
+func callRetryPolicy(ctx *context.Context) *RetryPolicy {
+	if ctx == nil {
+		return nil
+	}
+	p, _ := ctx.Value(retryPolicyKey{}).(*RetryPolicy)
+	return p
+}
+
+// IdempotentMethods marks the named methods, or all the methods of the
+// service if none is named, as safe to call again: the clients may retry
+// them after failures which leave unknown whether they ran, see
+// RetryPolicy.Idempotent. They are listed by the Describe method of the
+// server and returned to the clients by their IdempotentMethods method.
+func IdempotentMethods(methods ...string) RegisterOption {
+	return func(o *registerOptions) {
+		if o.idempotent == nil {
+			o.idempotent = make(map[string]bool)
+		}
+		if len(methods) == 0 {
+			o.idempotent[""] = true
+		}
+		for _, name := range methods {
+			o.idempotent[name] = true
+		}
+	}
+}
+
+// idempotentMethods returns the names of the idempotent methods of the
+// server, as "Service.Method", sorted.
+func (server *basicServer) idempotentMethods() (names []string) {
+	server.serviceMap.Range(func(_, value interface{}) bool {
+		s := value.(*Service)
+		for name, mtype := range s.Methods {
+			if mtype.idempotent {
+				names = append(names, s.Name+"."+name)
+			}
+		}
+		return true
+	})
+	sort.Strings(names)
+	return
+}
+
+// IdempotentMethods returns the methods marked idempotent on the server,
+// see IdempotentMethods, as "Service.Method". The servers predating the
+// marks have none.
+func (client *basicClient) IdempotentMethods(ctx *context.Context) ([]string, error) {
+	var names []string
+	err := client.Call(ctx, "_goRPC_.Idempotent", &svc.IdempotentArgs{}, &names)
+	if _, isServerErr := err.(ServerError); isServerErr &&
+		strings.HasSuffix(err.Error(), "can't find method _goRPC_.Idempotent") {
+		return nil, nil
+	}
+	return names, err
+}
@@ -0,0 +1,63 @@
+package birpc
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// RTTStats summarizes the round trip times measured by MeasureRTT.
+type RTTStats struct {
+	Samples int           `json:"samples"`
+	Min     time.Duration `json:"min"`
+	Max     time.Duration `json:"max"`
+	Mean    time.Duration `json:"mean"`
+	Median  time.Duration `json:"median"`
+	StdDev  time.Duration `json:"std_dev"`
+}
+
+// MeasureRTT calls the built-in echo method of the server samples times in
+// a row and returns the statistics of the round trip times. Unlike a
+// network ping, the measure includes the encoding, the queueing and the
+// dispatch of the calls by the server. The echo calls are not subject to
+// the limits of ServerConfig.
+func (client *basicClient) MeasureRTT(ctx *context.Context, samples int) (stats RTTStats, err error) {
+	if samples <= 0 {
+		return stats, errors.New("rpc: MeasureRTT needs at least one sample")
+	}
+	rtts := make([]time.Duration, samples)
+	for i := range rtts {
+		var reply []byte
+		start := time.Now()
+		if err = client.Call(ctx, "_goRPC_.Echo", []byte(nil), &reply); err != nil {
+			return
+		}
+		rtts[i] = time.Since(start)
+	}
+	return newRTTStats(rtts), nil
+}
+
+func newRTTStats(rtts []time.Duration) (stats RTTStats) {
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	stats.Samples = len(rtts)
+	stats.Min, stats.Max = rtts[0], rtts[len(rtts)-1]
+	stats.Median = rtts[len(rtts)/2]
+	if len(rtts)%2 == 0 {
+		stats.Median = (rtts[len(rtts)/2-1] + rtts[len(rtts)/2]) / 2
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		sum += float64(rtt)
+	}
+	mean := sum / float64(len(rtts))
+	var variance float64
+	for _, rtt := range rtts {
+		variance += (float64(rtt) - mean) * (float64(rtt) - mean)
+	}
+	stats.Mean = time.Duration(mean)
+	stats.StdDev = time.Duration(math.Sqrt(variance / float64(len(rtts))))
+	return
+}
@@ -0,0 +1,47 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestRTTStats(t *testing.T) {
+	exp := RTTStats{
+		Samples: 4,
+		Min:     time.Millisecond,
+		Max:     7 * time.Millisecond,
+		Mean:    4 * time.Millisecond,
+		Median:  4 * time.Millisecond,
+		StdDev:  2236067,
+	}
+	if rcv := newRTTStats([]time.Duration{7 * time.Millisecond, time.Millisecond, 5 * time.Millisecond, 3 * time.Millisecond}); rcv != exp {
+		t.Errorf("expected %+v, got %+v", exp, rcv)
+	}
+}
+
+func TestMeasureRTT(t *testing.T) {
+	server := NewServer()
+	// the echo calls are not subject to the limits
+	if err := server.ApplyConfig(ServerConfig{DenyMethods: []string{"*"}}); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+	stats, err := client.MeasureRTT(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Samples != 5 || stats.Min <= 0 || stats.Min > stats.Median || stats.Median > stats.Max {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err = client.MeasureRTT(context.Background(), 0); err == nil {
+		t.Error("expected error for no samples")
+	}
+
+	bc := NewBirpcClient(newBirpcPipe(t, NewBirpcServer()))
+	defer bc.Close()
+	if stats, err = bc.MeasureRTT(context.Background(), 2); err != nil || stats.Samples != 2 {
+		t.Errorf("birpc MeasureRTT: %+v %v", stats, err)
+	}
+}
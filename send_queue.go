@@ -0,0 +1,87 @@
+package birpc
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSendQueueFull is returned for the calls made while the send queue of
+// the client is full, see SendQueue.
+var ErrSendQueueFull = errors.New("rpc: send queue full")
+
+// ClientOption customizes a Client at creation.
+type ClientOption func(*basicClient)
+
+// SendQueue makes the client write the calls from a goroutine of its own,
+// so Go and Call never block on a slow connection: the calls wait in a
+// queue of up to size calls, and the ones made with the queue full fail
+// with ErrSendQueueFull. Call still waits for the reply, but returns as
+// soon as its context is done even if the request was not written yet.
+// Without SendQueue the calls are written by the goroutine making them.
+func SendQueue(size int) ClientOption {
+	return func(client *basicClient) {
+		client.sendq = make(chan *Call, size)
+	}
+}
+
+// SendQueueLen returns the number of calls waiting to be sent, always 0
+// without SendQueue.
+func (client *basicClient) SendQueueLen() int {
+	return len(client.sendq)
+}
+
+// enqueue hands call to the writing goroutine without blocking, or sends
+// it right away without SendQueue.
+func (client *basicClient) enqueue(call *Call) {
+	call.Enqueued = time.Now()
+	if client.sendq == nil {
+		client.send(call)
+		return
+	}
+	client.mutex.Lock()
+	if client.writerDone {
+		client.mutex.Unlock()
+		call.Error = ErrShutdown
+		call.done()
+		return
+	}
+	select {
+	case client.sendq <- call:
+		client.mutex.Unlock()
+	default:
+		client.mutex.Unlock()
+		call.Error = ErrSendQueueFull
+		call.done()
+	}
+}
+
+// writeLoop sends the queued calls until the client shuts down.
+func (client *basicClient) writeLoop() {
+	for {
+		select {
+		case call := <-client.sendq:
+			client.send(call)
+		case <-client.quit:
+			client.mutex.Lock()
+			client.writerDone = true
+			client.mutex.Unlock()
+			for {
+				select {
+				case call := <-client.sendq:
+					call.Error = ErrShutdown
+					call.done()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopWriter ends the writing goroutine, failing the queued calls. It is
+// called once the connection is no longer read.
+func (client *basicClient) stopWriter() {
+	if client.quit != nil {
+		client.quitOnce.Do(func() { close(client.quit) })
+	}
+}
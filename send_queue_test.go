@@ -0,0 +1,77 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestSendQueue(t *testing.T) {
+	c1, c2 := net.Pipe() // nobody reads c2, so the first write blocks
+	client := NewClient(c1, SendQueue(2))
+
+	start := time.Now()
+	var calls []*Call
+	for i := 0; i < 5; i++ {
+		calls = append(calls, client.Go("Arith.Add", &Args{i, i}, new(Reply), nil))
+	}
+	var full int
+	for _, call := range calls[3:] {
+		select {
+		case <-call.Done:
+			if call.Error == ErrSendQueueFull {
+				full++
+			}
+		default:
+		}
+	}
+	if full == 0 {
+		t.Errorf("expected the last calls to find the queue full")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := client.Call(ctx, "Arith.Add", &Args{1, 1}, new(Reply)); err != context.DeadlineExceeded && err != ErrSendQueueFull {
+		t.Errorf("expected the call to give up, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the calls blocked for %v", elapsed)
+	}
+	if n := client.SendQueueLen(); n == 0 {
+		t.Errorf("expected queued calls")
+	}
+
+	// the queued calls fail once the connection is gone
+	c2.Close()
+	for _, call := range calls[:2] {
+		select {
+		case <-call.Done:
+			if call.Error == nil {
+				t.Errorf("expected the queued call to fail")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("queued call not completed")
+		}
+	}
+	// a write failing on the closed pipe may complete the calls before the
+	// reading side notices
+	eventually(client.isShutdown)
+	if err := client.Call(context.Background(), "Arith.Add", &Args{1, 1}, new(Reply)); err != ErrShutdown {
+		t.Errorf("expected %v, got %v", ErrShutdown, err)
+	}
+
+	// regular calls through the queue
+	server := NewServer()
+	server.Register(new(Arith))
+	c1, c2 = net.Pipe()
+	go server.ServeConn(c2)
+	client = NewClient(c1, SendQueue(8))
+	defer client.Close()
+	for i := 0; i < 20; i++ {
+		reply := new(Reply)
+		if err := client.Call(context.Background(), "Arith.Add", &Args{i, 1}, reply); err != nil || reply.C != i+1 {
+			t.Errorf("Add: %v %v", reply.C, err)
+		}
+	}
+}
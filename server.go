@@ -46,6 +46,14 @@
 	sees as if created by errors.New.  If an error is returned, the reply parameter
 	will not be sent back to the client.
 
+	Command-style methods may omit the reply argument:
+
+		func (t *T) MethodName(ctx *context.Context, argType T1) error
+
+	the server then answers with an empty body and the caller passes a nil reply.
+	A method may take an extra trailing *CallInfo argument to learn about the call
+	being served, such as its deadline and the address of the peer.
+
 	The server may handle requests on a single connection by calling ServeConn.  More
 	typically it will create a network listener and call Accept or, for an HTTP
 	listener, HandleHTTP and http.Serve.
@@ -147,6 +155,7 @@ import (
 	"net/http"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/cgrates/birpc/context"
 	"github.com/cgrates/birpc/internal/svc"
@@ -161,28 +170,57 @@ const (
 // but documented here as an aid to debugging, such as when analyzing
 // network traffic.
 type Request struct {
-	ServiceMethod string   // format: "Service.Method"
-	Seq           uint64   // sequence number chosen by client
-	next          *Request // for free list in Server
+	ServiceMethod string        // format: "Service.Method"
+	Seq           uint64        // sequence number chosen by client
+	Depth         int           // number of calls the call is nested in
+	Fields        []string      // reply fields selected by the client, see WithFields
+	Raw           bool          // reply wanted as a RawReply
+	Item          bool          // an item of the upload of the call Seq, see Upload
+	End           bool          // ends the upload of the call Seq
+	Timeout       time.Duration // time left before the deadline of the call when sent, zero without deadline
+	Metadata      Metadata      // sent along with the call, see WithMetadata
+	deadline      time.Time     // of the call on the server, set from Timeout when read
+	read          time.Time     // when the request was read, for the SLOs
+	replyMetadata Metadata      // sent along with the reply, see SetReplyMetadata
+	decoding      time.Duration // of the arguments, measured for DebugFilter
+	debug         *debugCall    // nil unless matched by a DebugFilter
+	next          *Request      // for free list in Server
+}
+
+// setDeadline sets the deadline of the call from the Timeout of the
+// request, as it is read, and the time it is read at.
+func (req *Request) setDeadline() {
+	req.read = time.Now()
+	if req.Timeout != 0 {
+		req.deadline = req.read.Add(req.Timeout)
+	}
 }
 
 // Response is a header written before every RPC return. It is used internally
 // but documented here as an aid to debugging, such as when analyzing
 // network traffic.
 type Response struct {
-	Seq   uint64    // echoes that of the request
-	Error string    // error, if any.
-	next  *Response // for free list in Server
+	Seq        uint64    // echoes that of the request
+	Error      string    // error, if any.
+	Checksum   string    // checksum of the reply, see ChecksumReplies
+	More       bool      // an item of a streaming call, more follow, see Stream
+	Code       int       // code of Error, see WithErrorCode
+	Detail     bool      // the body holds the details of Error, see WithErrorDetail
+	DetailType string    // the name of the type of the detail, see RegisterErrorDetail
+	Metadata   Metadata  // sent along with the reply, see SetReplyMetadata
+	GoAway     bool      // no new requests on the connection, see Shutdown
+	next       *Response // for free list in Server
 }
 
 // Server represents an RPC Server.
 type Server struct {
 	*basicServer
+	cfg *Config // set by NewServerFromConfig
 }
 
-// NewServer returns a new Server.
-func NewServer() *Server {
-	return &Server{basicServer: newBasicServer()}
+// NewServer returns a new Server configured with the given options.
+func NewServer(opts ...ServerOption) *Server {
+	return &Server{basicServer: newBasicServer(opts...)}
 }
 
 // DefaultServer is the default instance of *Server.
@@ -195,22 +233,35 @@ var DefaultServer = NewServer()
 // connection. To use an alternate codec, use ServeCodec.
 // See NewClient's comment for information about concurrent access.
 func (server *Server) ServeConn(conn io.ReadWriteCloser) {
-	server.ServeCodec(NewServerCodec(conn))
+	server.ServeCodec(NewServerCodec(server.writeRetry.wrap(conn)))
 }
 
 // ServeCodec is like ServeConn but uses the specified codec to
 // decode requests and encode responses.
 func (server *Server) ServeCodec(codec ServerCodec) {
+	if !server.acquireConn() {
+		debugln("rpc: too many connections")
+		codec.Close()
+		return
+	}
+	defer server.releaseConn()
 	sending := new(sync.Mutex)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	pending := svc.NewPending(ctx)
 	wg := new(sync.WaitGroup)
+	conn := newServerConn(codec, sending, pending, wg)
+	// the connections only answer calls, idle once those are answered
+	conn.closeIdle = true
+	defer server.trackConn(conn)()
+	// The requests already read are decoded before dispatching them, the
+	// calls of a batch starting together.
+	var batch []batchedCall
 	for {
-		service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
+		service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec, conn)
 		if err != nil {
 			if err != io.EOF {
-				debugln("rpc:", err)
+				debugln(logPrefix("rpc", conn.connID())+":", err)
 			}
 			if !keepReading {
 				break
@@ -220,11 +271,20 @@ func (server *Server) ServeCodec(codec ServerCodec) {
 				server.sendResponse(sending, req, invalidRequest, codec, err.Error())
 				server.freeRequest(req)
 			}
-			continue
+		} else {
+			conn.reads.wait()
+			if service != nil { // not an item of an upload
+				batch = append(batch, batchedCall{service, mtype, req, argv, replyv})
+			}
+		}
+		if len(batch) > 0 && (len(batch) == maxReadBatch || !bufferedRequest(codec)) {
+			batch = server.dispatch(conn, batch)
 		}
-		wg.Add(1)
-		go service.call(server.basicServer, sending, pending, wg, mtype, req, argv, replyv, codec)
 	}
+	if len(batch) > 0 {
+		server.dispatch(conn, batch)
+	}
+	close(conn.closed)
 	// We've seen that there are no more requests.
 	// Wait for responses to be sent before closing codec.
 	wg.Wait()
@@ -245,7 +305,8 @@ func (server *Server) ServeRequest(codec ServerCodec) error {
 func (server *Server) ServeRequestContext(ctx *context.Context, codec ServerCodec) error {
 	sending := new(sync.Mutex)
 	pending := svc.NewPending(ctx)
-	service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec)
+	conn := newServerConn(codec, sending, pending, nil)
+	service, mtype, req, argv, replyv, keepReading, err := server.readRequest(codec, conn)
 	if err != nil {
 		if !keepReading {
 			return err
@@ -257,12 +318,18 @@ func (server *Server) ServeRequestContext(ctx *context.Context, codec ServerCode
 		}
 		return err
 	}
-	service.call(server.basicServer, sending, pending, nil, mtype, req, argv, replyv, codec)
+	if service == nil {
+		return nil // an item of an upload
+	}
+	service.call(server.basicServer, conn, mtype, req, argv, replyv)
 	return nil
 }
 
-func (server *Server) readRequest(codec ServerCodec) (service *Service, mtype *MethodType, req *Request, argv, replyv reflect.Value, keepReading bool, err error) {
+func (server *Server) readRequest(codec ServerCodec, conn *serverConn) (service *Service, mtype *MethodType, req *Request, argv, replyv reflect.Value, keepReading bool, err error) {
 	service, mtype, req, keepReading, err = server.readRequestHeader(codec)
+	if req != nil {
+		conn.readConnID(req)
+	}
 	if err != nil {
 		if !keepReading {
 			return
@@ -271,14 +338,33 @@ func (server *Server) readRequest(codec ServerCodec) (service *Service, mtype *M
 		codec.ReadRequestBody(nil)
 		return
 	}
+	if req.Item || req.End {
+		// nothing to call, the item is handed to its upload
+		conn.readUploadItem(codec, req)
+		server.freeRequest(req)
+		req = nil
+		return
+	}
+	if mtype.upload {
+		// the items follow the request
+		if err = codec.ReadRequestBody(nil); err == nil && conn.wg == nil {
+			err = errUploadServed
+		}
+		if err == nil {
+			argv, replyv = reflect.ValueOf(conn.openUpload(req.Seq)), getReplyv(mtype)
+		}
+		return
+	}
 
 	// Decode the argument value.
 	var argIsValue bool // if true, need to indirect before calling.
 	argv, argIsValue = getArgv(mtype)
 	// argv guaranteed to be a pointer now.
+	start := time.Now()
 	if err = codec.ReadRequestBody(argv.Interface()); err != nil {
 		return
 	}
+	server.observeDecode(service, req, start)
 	if argIsValue {
 		argv = argv.Elem()
 	}
@@ -302,32 +388,45 @@ func (server *Server) readRequestHeader(codec ServerCodec) (svc *Service, mtype
 	// We read the header successfully. If we see an error now,
 	// we can still recover and move on to the next request.
 	keepReading = true
+	if req.Item || req.End {
+		return // read by readRequest
+	}
+	req.setDeadline()
 	svc, mtype, err = server.getService(req)
 	return
 }
 
 // Accept accepts connections on the listener and serves requests
 // for each incoming connection. Accept blocks until the listener
-// returns a non-nil error. The caller typically invokes Accept in a
-// go statement.
+// returns a non-nil error, ErrServerClosed once the listener is closed
+// by Shutdown. The caller typically invokes Accept in a go statement.
 func (server *Server) Accept(lis net.Listener) error {
+	defer server.trackListener(lis)()
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
 			debugln("rpc.Serve: accept:", err.Error())
-			return err
+			return server.acceptError(err)
 		}
 		go server.ServeConn(conn)
 	}
 }
 
 // Register publishes the receiver's methods in the DefaultServer.
-func Register(rcvr interface{}) error { return DefaultServer.Register(rcvr) }
+func Register(rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.Register(rcvr, opts...)
+}
 
 // RegisterName is like Register but uses the provided name for the type
 // instead of the receiver's concrete type.
-func RegisterName(name string, rcvr interface{}) error {
-	return DefaultServer.RegisterName(name, rcvr)
+func RegisterName(name string, rcvr interface{}, opts ...RegisterOption) error {
+	return DefaultServer.RegisterName(name, rcvr, opts...)
+}
+
+// RegisterFuncs publishes the handlers of a struct of funcs in the
+// DefaultServer, see NewFuncService.
+func RegisterFuncs(name string, handlers interface{}, opts ...RegisterOption) error {
+	return DefaultServer.RegisterFuncs(name, handlers, opts...)
 }
 
 // A ServerCodec implements reading of RPC requests and writing of
@@ -0,0 +1,321 @@
+package birpc
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+var (
+	// ErrServerBusy is returned when the server has reached its maximum
+	// number of in-flight calls.
+	ErrServerBusy = errors.New("rpc: server busy")
+	// ErrRateLimited is returned when a call exceeds one of the configured
+	// rates, with CodeResourceExhausted.
+	ErrRateLimited error = &Error{Code: CodeResourceExhausted, Message: "rpc: rate limit exceeded"}
+	// ErrMethodBusy is returned when a method is served as many times at
+	// once as allowed by MethodConcurrency, with as many calls waiting, with
+	// CodeResourceExhausted.
+	ErrMethodBusy error = &Error{Code: CodeResourceExhausted, Message: "rpc: method busy"}
+	// ErrMethodNotAllowed is returned when the method is rejected by the
+	// configured method lists.
+	ErrMethodNotAllowed = errors.New("rpc: method not allowed")
+	// ErrCallTooDeep is returned when a call is nested in more calls than
+	// allowed, which usually reveals a cycle of calls between two peers.
+	ErrCallTooDeep = errors.New("rpc: maximum call depth exceeded")
+)
+
+// ServerConfig holds the tunables of a server which can be changed while
+// it is running, see ApplyConfig. The zero value imposes no limits.
+type ServerConfig struct {
+	// MaxConns is the maximum number of connections served at once.
+	// Connections over the limit are closed as soon as they are served.
+	MaxConns int `json:"max_conns,omitempty" yaml:"max_conns,omitempty"`
+
+	// MaxConcurrentCalls is the maximum number of method invocations
+	// running at once. Calls over the limit fail with ErrServerBusy.
+	MaxConcurrentCalls int `json:"max_concurrent_calls,omitempty" yaml:"max_concurrent_calls,omitempty"`
+
+	// MaxConcurrentCost is the maximum total cost of the method
+	// invocations running at once, each call costing the weight of its
+	// method in MethodCosts, 1 by default. Calls over the budget fail with
+	// ErrServerBusy, so that a few heavy calls take the budget of many
+	// cheap ones. A call costing more than the whole budget is only
+	// admitted while no other call runs.
+	MaxConcurrentCost int            `json:"max_concurrent_cost,omitempty" yaml:"max_concurrent_cost,omitempty"`
+	MethodCosts       map[string]int `json:"method_costs,omitempty" yaml:"method_costs,omitempty"`
+
+	// CallTimeout, if not zero, bounds the context given to every method.
+	CallTimeout time.Duration `json:"call_timeout,omitempty" yaml:"call_timeout,omitempty"`
+
+	// RateLimit is the number of calls per second accepted by the server.
+	// RateBurst is the number of calls allowed to exceed the rate at once,
+	// it defaults to RateLimit rounded up.
+	RateLimit float64 `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	RateBurst int     `json:"rate_burst,omitempty" yaml:"rate_burst,omitempty"`
+
+	// ConnRateLimit is the number of calls per second accepted from each
+	// connection, keeping a runaway client from taking the RateLimit of
+	// the others. ConnRateBurst defaults to ConnRateLimit rounded up.
+	ConnRateLimit float64 `json:"conn_rate_limit,omitempty" yaml:"conn_rate_limit,omitempty"`
+	ConnRateBurst int     `json:"conn_rate_burst,omitempty" yaml:"conn_rate_burst,omitempty"`
+
+	// MethodRateLimits are the numbers of calls per second accepted for
+	// the methods, by "Service.Method", from all the connections.
+	MethodRateLimits map[string]RateLimit `json:"method_rate_limits,omitempty" yaml:"method_rate_limits,omitempty"`
+
+	// MethodConcurrency caps the calls of the methods, by "Service.Method",
+	// served at once, so that the heavy ones like the bulk rerating leave
+	// the workers to the cheap ones. The calls over the cap wait in a
+	// queue, bounded by their deadline and the CallTimeout, or fail with
+	// ErrMethodBusy once it is full. The calls waiting keep their
+	// goroutine, or their worker with WorkerPool, so the queues are kept
+	// short.
+	MethodConcurrency map[string]ConcurrencyLimit `json:"method_concurrency,omitempty" yaml:"method_concurrency,omitempty"`
+
+	// MethodSLOs are the objectives of the methods, by "Service.Method",
+	// see SLOStatus and SLOAlerts. The calls rejected by the limits above
+	// are left out. Changing the SLO of a method resets its counts.
+	MethodSLOs map[string]SLO `json:"method_slos,omitempty" yaml:"method_slos,omitempty"`
+
+	// AllowMethods, if not empty, restricts the callable methods to the
+	// ones matching any of the patterns. DenyMethods rejects the methods
+	// matching any of its patterns and takes precedence over AllowMethods.
+	// The patterns use the path.Match syntax against "Service.Method".
+	AllowMethods []string `json:"allow_methods,omitempty" yaml:"allow_methods,omitempty"`
+	DenyMethods  []string `json:"deny_methods,omitempty" yaml:"deny_methods,omitempty"`
+
+	// MethodAliases maps legacy "Service.Method" names to the names the
+	// methods are registered with, so the clients using the old names keep
+	// working after a rename. The aliases are resolved before any other
+	// lookup and the method filters see the new name.
+	MethodAliases map[string]string `json:"method_aliases,omitempty" yaml:"method_aliases,omitempty"`
+
+	// MaxCallDepth is the maximum depth of the calls, see CallDepth.
+	// Deeper calls fail with ErrCallTooDeep, breaking the cycles where
+	// the peers keep calling each other back.
+	MaxCallDepth int `json:"max_call_depth,omitempty" yaml:"max_call_depth,omitempty"`
+}
+
+// RateLimit is the rate of the calls of a method, see MethodRateLimits.
+type RateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`                       // calls per second
+	Burst int     `json:"burst,omitempty" yaml:"burst,omitempty"` // defaults to Rate rounded up
+}
+
+// Validate checks the configuration for invalid values.
+func (cfg *ServerConfig) Validate() error {
+	if cfg.MaxConns < 0 || cfg.MaxConcurrentCalls < 0 || cfg.CallTimeout < 0 ||
+		cfg.RateLimit < 0 || cfg.RateBurst < 0 || cfg.MaxCallDepth < 0 || cfg.MaxConcurrentCost < 0 ||
+		cfg.ConnRateLimit < 0 || cfg.ConnRateBurst < 0 {
+		return errors.New("rpc: negative limit in server config")
+	}
+	for method, cost := range cfg.MethodCosts {
+		if !strings.Contains(method, ".") {
+			return errors.New("rpc: bad method cost " + method + ": names must be Service.Method")
+		}
+		if cost < 0 {
+			return errors.New("rpc: negative cost of method " + method)
+		}
+	}
+	for method, limit := range cfg.MethodRateLimits {
+		if !strings.Contains(method, ".") {
+			return errors.New("rpc: bad method rate limit " + method + ": names must be Service.Method")
+		}
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return errors.New("rpc: negative rate limit of method " + method)
+		}
+	}
+	for method, limit := range cfg.MethodConcurrency {
+		if !strings.Contains(method, ".") {
+			return errors.New("rpc: bad method concurrency " + method + ": names must be Service.Method")
+		}
+		if limit.Max <= 0 || limit.Queue < 0 {
+			return errors.New("rpc: bad concurrency limit of method " + method)
+		}
+	}
+	for method, slo := range cfg.MethodSLOs {
+		if !strings.Contains(method, ".") {
+			return errors.New("rpc: bad method SLO " + method + ": names must be Service.Method")
+		}
+		if slo.Objective <= 0 || slo.Objective >= 1 || slo.Latency < 0 || slo.Window < 0 || slo.AlertBurnRate < 0 {
+			return errors.New("rpc: bad SLO of method " + method)
+		}
+	}
+	for _, patterns := range [][]string{cfg.AllowMethods, cfg.DenyMethods} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return errors.New("rpc: bad method pattern " + p + ": " + err.Error())
+			}
+		}
+	}
+	for from, to := range cfg.MethodAliases {
+		if !strings.Contains(from, ".") || !strings.Contains(to, ".") {
+			return errors.New("rpc: bad method alias " + from + " -> " + to + ": names must be Service.Method")
+		}
+		if _, chained := cfg.MethodAliases[to]; chained {
+			return errors.New("rpc: method alias " + from + " -> " + to + " points to another alias")
+		}
+	}
+	return nil
+}
+
+func (cfg *ServerConfig) clone() *ServerConfig {
+	c := *cfg
+	c.AllowMethods = append([]string(nil), cfg.AllowMethods...)
+	c.DenyMethods = append([]string(nil), cfg.DenyMethods...)
+	if cfg.MethodAliases != nil {
+		c.MethodAliases = make(map[string]string, len(cfg.MethodAliases))
+		for from, to := range cfg.MethodAliases {
+			c.MethodAliases[from] = to
+		}
+	}
+	if cfg.MethodCosts != nil {
+		c.MethodCosts = make(map[string]int, len(cfg.MethodCosts))
+		for method, cost := range cfg.MethodCosts {
+			c.MethodCosts[method] = cost
+		}
+	}
+	if cfg.MethodRateLimits != nil {
+		c.MethodRateLimits = make(map[string]RateLimit, len(cfg.MethodRateLimits))
+		for method, limit := range cfg.MethodRateLimits {
+			c.MethodRateLimits[method] = limit
+		}
+	}
+	if cfg.MethodConcurrency != nil {
+		c.MethodConcurrency = make(map[string]ConcurrencyLimit, len(cfg.MethodConcurrency))
+		for method, limit := range cfg.MethodConcurrency {
+			c.MethodConcurrency[method] = limit
+		}
+	}
+	if cfg.MethodSLOs != nil {
+		c.MethodSLOs = make(map[string]SLO, len(cfg.MethodSLOs))
+		for method, slo := range cfg.MethodSLOs {
+			c.MethodSLOs[method] = slo
+		}
+	}
+	return &c
+}
+
+func matchAny(patterns []string, serviceMethod string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *ServerConfig) methodAllowed(serviceMethod string) bool {
+	if matchAny(cfg.DenyMethods, serviceMethod) {
+		return false
+	}
+	return len(cfg.AllowMethods) == 0 || matchAny(cfg.AllowMethods, serviceMethod)
+}
+
+// ApplyConfig atomically replaces the tunables of the server. It can be
+// called at any time; listeners and connections are left untouched and
+// the calls already running are not affected by the new limits.
+func (server *basicServer) ApplyConfig(cfg ServerConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	server.limiter.set(cfg.RateLimit, cfg.RateBurst)
+	server.methodLimiters.set(cfg.MethodRateLimits)
+	server.methodConcurrency.set(cfg.MethodConcurrency)
+	server.slos.set(cfg.MethodSLOs)
+	server.config.Store(cfg.clone())
+	return nil
+}
+
+// Config returns a copy of the configuration currently in use.
+func (server *basicServer) Config() ServerConfig {
+	return *server.getConfig().clone()
+}
+
+func (server *basicServer) getConfig() *ServerConfig {
+	return server.config.Load().(*ServerConfig)
+}
+
+// acquireConn reserves a connection slot, it reports false if the server
+// is already serving MaxConns connections.
+func (server *basicServer) acquireConn() bool {
+	n := atomic.AddInt64(&server.conns, 1)
+	if max := server.getConfig().MaxConns; max > 0 && n > int64(max) {
+		atomic.AddInt64(&server.conns, -1)
+		return false
+	}
+	return true
+}
+
+func (server *basicServer) releaseConn() {
+	atomic.AddInt64(&server.conns, -1)
+}
+
+// methodCost returns the cost of the calls of serviceMethod.
+func (cfg *ServerConfig) methodCost(serviceMethod string) int64 {
+	if cost, has := cfg.MethodCosts[serviceMethod]; has {
+		return int64(cost)
+	}
+	return 1
+}
+
+// admit checks the call against the current configuration and reserves
+// an in-flight slot for it, waiting while ctx lasts for a slot of its
+// method if queued by MethodConcurrency. If no error is returned, release
+// must be called once the call is done.
+func (server *basicServer) admit(ctx *context.Context, cfg *ServerConfig, conn *serverConn, req *Request) (release func(), err error) {
+	if !cfg.methodAllowed(req.ServiceMethod) {
+		return nil, ErrMethodNotAllowed
+	}
+	if cfg.MaxCallDepth > 0 && req.Depth > cfg.MaxCallDepth {
+		debugf("rpc: call of %s at depth %d exceeds the maximum call depth\n", req.ServiceMethod, req.Depth)
+		return nil, ErrCallTooDeep
+	}
+	if cfg.RateLimit != 0 && !server.limiter.allow() {
+		return nil, ErrRateLimited
+	}
+	if len(cfg.MethodRateLimits) != 0 && !server.methodLimiters.allow(req.ServiceMethod) {
+		return nil, ErrRateLimited
+	}
+	if cfg.ConnRateLimit != 0 {
+		conn.limiter.set(cfg.ConnRateLimit, cfg.ConnRateBurst)
+		if !conn.limiter.allow() {
+			return nil, ErrRateLimited
+		}
+	}
+	// the calls queued for their method wait before taking the slots of
+	// the server, leaving them to the calls of the other methods
+	releaseMethod := func() {}
+	if len(cfg.MethodConcurrency) != 0 {
+		if releaseMethod, err = server.methodConcurrency.acquire(ctx, req.ServiceMethod); err != nil {
+			return nil, err
+		}
+	}
+	n := atomic.AddInt64(&server.inflight, 1)
+	if cfg.MaxConcurrentCalls > 0 && n > int64(cfg.MaxConcurrentCalls) {
+		atomic.AddInt64(&server.inflight, -1)
+		releaseMethod()
+		return nil, ErrServerBusy
+	}
+	cost := cfg.methodCost(req.ServiceMethod)
+	release = func() {
+		server.release(cost)
+		releaseMethod()
+	}
+	total := atomic.AddInt64(&server.cost, cost)
+	if cfg.MaxConcurrentCost > 0 && total > int64(cfg.MaxConcurrentCost) && total != cost {
+		release()
+		return nil, ErrServerBusy
+	}
+	return release, nil
+}
+
+func (server *basicServer) release(cost int64) {
+	atomic.AddInt64(&server.inflight, -1)
+	atomic.AddInt64(&server.cost, -cost)
+}
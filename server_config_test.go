@@ -0,0 +1,303 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func newPipeClient(t *testing.T, server *Server) *Client {
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	client := NewClient(c1)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// newBirpcPipe serves one end of a pipe with server and returns the other.
+func newBirpcPipe(t *testing.T, server *BirpcServer) net.Conn {
+	c1, c2 := net.Pipe()
+	go server.ServeConn(c2)
+	t.Cleanup(func() { c1.Close() })
+	return c1
+}
+
+// eventually polls cond for up to a second, reporting whether it held.
+func eventually(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestApplyConfig(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	args := &Args{7, 8}
+	reply := new(Reply)
+
+	if err := server.ApplyConfig(ServerConfig{DenyMethods: []string{"Arith.M*"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "Arith.Mul", args, reply); err == nil || err.Error() != ErrMethodNotAllowed.Error() {
+		t.Errorf("expected %q, got %v", ErrMethodNotAllowed, err)
+	}
+	if err := client.Call(ctx, "Arith.Add", args, reply); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+
+	// reload on the same connection
+	if err := server.ApplyConfig(ServerConfig{AllowMethods: []string{"Arith.Mul"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(ctx, "Arith.Mul", args, reply); err != nil {
+		t.Errorf("Mul: %v", err)
+	}
+	if err := client.Call(ctx, "Arith.Add", args, reply); err == nil || err.Error() != ErrMethodNotAllowed.Error() {
+		t.Errorf("expected %q, got %v", ErrMethodNotAllowed, err)
+	}
+
+	if err := server.ApplyConfig(ServerConfig{AllowMethods: []string{"["}}); err == nil {
+		t.Error("expected error for bad pattern")
+	}
+	if cfg := server.Config(); len(cfg.AllowMethods) != 1 || cfg.AllowMethods[0] != "Arith.Mul" {
+		t.Errorf("failed config changed the server: %+v", cfg)
+	}
+}
+
+func TestApplyConfigLimits(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	args := &Args{100, 0}
+	reply := new(Reply)
+
+	server.ApplyConfig(ServerConfig{MaxConcurrentCalls: 1})
+	slow := client.Go("Arith.SleepMilli", args, reply, nil)
+	time.Sleep(20 * time.Millisecond)
+	if err := client.Call(ctx, "Arith.Add", args, reply); err == nil || err.Error() != ErrServerBusy.Error() {
+		t.Errorf("expected %q, got %v", ErrServerBusy, err)
+	}
+	<-slow.Done
+
+	server.ApplyConfig(ServerConfig{RateLimit: 1, RateBurst: 1})
+	if err := client.Call(ctx, "Arith.Add", args, reply); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+	if err := client.Call(ctx, "Arith.Add", args, reply); err == nil || err.Error() != ErrRateLimited.Error() {
+		t.Errorf("expected %q, got %v", ErrRateLimited, err)
+	}
+
+	server.ApplyConfig(ServerConfig{CallTimeout: 10 * time.Millisecond})
+	svc := &Context{started: make(chan struct{}), done: make(chan struct{})}
+	server.RegisterName("Timeout", svc)
+	if err := client.Call(ctx, "Timeout.Wait", "", new(int)); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+	select {
+	case <-svc.done:
+	case <-time.After(time.Second):
+		t.Error("call not timed out by the server")
+	}
+}
+
+func TestApplyConfigRateLimits(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	agent, other := newPipeClient(t, server), newPipeClient(t, server)
+	ctx := context.Background()
+	args := &Args{7, 8}
+	reply := new(Reply)
+
+	server.ApplyConfig(ServerConfig{ConnRateLimit: 1, ConnRateBurst: 2})
+	for i := 0; i < 2; i++ {
+		if err := agent.Call(ctx, "Arith.Add", args, reply); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	err := agent.Call(ctx, "Arith.Add", args, reply)
+	if err == nil || err.Error() != ErrRateLimited.Error() || ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expected %q, got %v", ErrRateLimited, err)
+	}
+	// the other connections keep their own rate
+	if err = other.Call(ctx, "Arith.Add", args, reply); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+
+	server.ApplyConfig(ServerConfig{MethodRateLimits: map[string]RateLimit{"Arith.Mul": {Rate: 1}}})
+	if err = agent.Call(ctx, "Arith.Mul", args, reply); err != nil {
+		t.Errorf("Mul: %v", err)
+	}
+	if err = other.Call(ctx, "Arith.Mul", args, reply); ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expected the method to be limited on all the connections, got %v", err)
+	}
+	if err = other.Call(ctx, "Arith.Add", args, reply); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+	if err = server.ApplyConfig(ServerConfig{MethodRateLimits: map[string]RateLimit{"Mul": {Rate: 1}}}); err == nil {
+		t.Error("expected the method name to be rejected")
+	}
+}
+
+func TestMethodCosts(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	args := &Args{7, 8}
+	reply := new(Reply)
+	waitCost := func(cost int64) {
+		t.Helper()
+		if !eventually(func() bool { return server.Diagnostics().Cost == cost }) {
+			t.Fatalf("expected the cost %d, got %d", cost, server.Diagnostics().Cost)
+		}
+	}
+
+	server.ApplyConfig(ServerConfig{
+		MaxConcurrentCost: 10,
+		MethodCosts:       map[string]int{"Blocker.Hold": 8, "Arith.Mul": 5},
+	})
+	hold := client.Go("Blocker.Hold", 0, nil, nil)
+	waitCost(8)
+	if err := client.Call(ctx, "Arith.Add", args, reply); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+	if err := client.Call(ctx, "Arith.Mul", args, reply); err == nil || err.Error() != ErrServerBusy.Error() {
+		t.Errorf("expected %q, got %v", ErrServerBusy, err)
+	}
+	blocker.release <- struct{}{}
+	<-hold.Done
+	waitCost(0)
+
+	// the calls over the whole budget run alone
+	server.ApplyConfig(ServerConfig{
+		MaxConcurrentCost: 10,
+		MethodCosts:       map[string]int{"Blocker.Hold": 20},
+	})
+	hold = client.Go("Blocker.Hold", 0, nil, nil)
+	waitCost(20)
+	if err := client.Call(ctx, "Arith.Add", args, reply); err == nil || err.Error() != ErrServerBusy.Error() {
+		t.Errorf("expected %q, got %v", ErrServerBusy, err)
+	}
+	close(blocker.release)
+	if <-hold.Done; hold.Error != nil {
+		t.Errorf("Hold: %v", hold.Error)
+	}
+
+	for _, cfg := range []ServerConfig{
+		{MaxConcurrentCost: -1},
+		{MethodCosts: map[string]int{"Arith.Add": -1}},
+		{MethodCosts: map[string]int{"Add": 1}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+}
+
+func TestMethodConcurrency(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	waitQueued := func(n int) {
+		t.Helper()
+		queued := func() bool {
+			s := server.methodConcurrency.slots["Blocker.Hold"]
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return len(s.waiting) == n
+		}
+		if !eventually(queued) {
+			t.Fatalf("expected %d calls queued", n)
+		}
+	}
+
+	server.ApplyConfig(ServerConfig{
+		MaxConcurrentCalls: 2,
+		MethodConcurrency:  map[string]ConcurrencyLimit{"Blocker.Hold": {Max: 1, Queue: 1}},
+	})
+	first := client.Go("Blocker.Hold", 0, nil, nil)
+	if !eventually(func() bool { return server.Diagnostics().Inflight == 1 }) {
+		t.Fatal("expected the call to be served")
+	}
+	second := client.Go("Blocker.Hold", 1, nil, nil)
+	waitQueued(1)
+	if err := client.Call(ctx, "Blocker.Hold", 2, nil); err == nil || err.Error() != ErrMethodBusy.Error() ||
+		ErrorCode(err) != CodeResourceExhausted {
+		t.Errorf("expected %q, got %v", ErrMethodBusy, err)
+	}
+	// the calls queued leave the slots of the server to the other methods
+	if err := client.Call(ctx, "Arith.Add", &Args{7, 8}, new(Reply)); err != nil {
+		t.Errorf("Add: %v", err)
+	}
+	blocker.release <- struct{}{}
+	if <-first.Done; first.Error != nil {
+		t.Errorf("Hold: %v", first.Error)
+	}
+	waitQueued(0)
+
+	// the calls stop waiting once their deadline passes
+	dctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := client.Call(dctx, "Blocker.Hold", 3, nil); err == nil {
+		t.Error("expected the queued call to time out")
+	}
+	waitQueued(0)
+	blocker.release <- struct{}{}
+	if <-second.Done; second.Error != nil {
+		t.Errorf("Hold: %v", second.Error)
+	}
+
+	for _, cfg := range []ServerConfig{
+		{MethodConcurrency: map[string]ConcurrencyLimit{"Blocker.Hold": {}}},
+		{MethodConcurrency: map[string]ConcurrencyLimit{"Blocker.Hold": {Max: 1, Queue: -1}}},
+		{MethodConcurrency: map[string]ConcurrencyLimit{"Hold": {Max: 1}}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+}
+
+func TestMethodAliases(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	if err := server.ApplyConfig(ServerConfig{
+		MethodAliases: map[string]string{"Arith.Sum": "Arith.Add", "Calc.Mul": "Arith.Mul"},
+		DenyMethods:   []string{"Arith.Mul"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reply := new(Reply)
+	if err := client.Call(ctx, "Arith.Sum", Args{7, 8}, reply); err != nil || reply.C != 15 {
+		t.Errorf("Sum: %v %v", reply.C, err)
+	}
+	if err := client.Call(ctx, "Calc.Mul", &Args{7, 8}, reply); err == nil || err.Error() != ErrMethodNotAllowed.Error() {
+		t.Errorf("expected %q, got %v", ErrMethodNotAllowed, err)
+	}
+
+	for _, aliases := range []map[string]string{
+		{"Sum": "Arith.Add"},
+		{"Arith.Sum": "Add"},
+		{"Arith.Sum": "Arith.Plus", "Arith.Plus": "Arith.Add"},
+	} {
+		if err := server.ApplyConfig(ServerConfig{MethodAliases: aliases}); err == nil {
+			t.Errorf("expected error for aliases %v", aliases)
+		}
+	}
+}
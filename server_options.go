@@ -0,0 +1,165 @@
+package birpc
+
+import "time"
+
+// ServerOption customizes a Server, a BirpcServer or the serving side of a
+// BirpcClient at creation.
+type ServerOption func(*basicServer)
+
+// CaseInsensitiveMethods makes the server resolve the service and method
+// names of the requests ignoring case and surrounding whitespace, which
+// helps with hand-written clients. Exact matches are still preferred and
+// the request is served under the registered name, so the method filters
+// of ServerConfig see the canonical name. The services and methods whose
+// names differ only by case fail the registration.
+func CaseInsensitiveMethods() ServerOption {
+	return func(server *basicServer) {
+		server.foldNames = true
+	}
+}
+
+// SerialRequests makes the server serve the requests of a connection one
+// at a time, in the order they arrive, instead of concurrently. The nested
+// calls, the ones a peer makes while serving a call (see CallDepth), are
+// still served right away: the call they are nested in may be waiting for
+// them, as when a client blocked in Call is called back by the server.
+func SerialRequests() ServerOption {
+	return func(server *basicServer) {
+		server.serial = true
+	}
+}
+
+// DeadlineBuckets sets the bucket bounds of the histogram of the time
+// left to the calls, see DeadlineStats.
+func DeadlineBuckets(bounds ...time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.deadlines.remaining = NewHistogram(bounds...)
+	}
+}
+
+// RegisterOption customizes the registration of a service.
+type RegisterOption func(*registerOptions)
+
+type registerOptions struct {
+	lenient bool // skip the unsuitable methods without logging
+	strict  bool // fail the registration on unsuitable methods
+
+	report  *[]RejectedMethod
+	noReply bool // accept the methods without reply
+	okReply bool // answer OK to the methods without reply
+	docs    map[string]MethodDoc
+
+	checksums  map[string]bool // methods replying with a checksum, "" for all
+	idempotent map[string]bool // methods safe to call again, "" for all
+
+	logf func(format string, v ...interface{}) // logs the rejected methods, debugf if nil
+}
+
+// LenientMethods silently skips the exported methods of unsuitable type
+// instead of logging them, for receivers which mix Rpc methods with other
+// exported methods.
+func LenientMethods() RegisterOption {
+	return func(o *registerOptions) {
+		o.lenient, o.strict = true, false
+	}
+}
+
+// StrictMethods fails the registration if any exported method has an
+// unsuitable type, listing all the offending methods in the error.
+func StrictMethods() RegisterOption {
+	return func(o *registerOptions) {
+		o.strict, o.lenient = true, false
+	}
+}
+
+// checkRejected reports the rejected methods of service sname according
+// to the registration mode.
+func (o *registerOptions) checkRejected(sname string, rejected []RejectedMethod) error {
+	if o.report != nil {
+		*o.report = append(*o.report, rejected...)
+	}
+	switch {
+	case len(rejected) == 0 || o.lenient:
+	case o.strict:
+		return &RegistrationError{Service: sname, Rejected: rejected}
+	default:
+		logf := o.logf
+		if logf == nil {
+			logf = debugf
+		}
+		for _, r := range rejected {
+			logf("rpc.Register: method %s\n", r)
+		}
+	}
+	return nil
+}
+
+// ReportRejected appends to report the methods rejected by the
+// registration, whatever the registration mode.
+func ReportRejected(report *[]RejectedMethod) RegisterOption {
+	return func(o *registerOptions) {
+		o.report = report
+	}
+}
+
+// OKReply is the conventional reply of the methods which only report
+// success.
+const OKReply = "OK"
+
+// NoReplyMethods accepts the methods without reply parameter, for the
+// command-style endpoints whose reply would carry nothing:
+//
+//	func (t *T) Reset(ctx *context.Context, args *Args) error
+//
+// The server answers them with an empty reply once they return. Without
+// the option they are rejected as any other unsuitable method.
+func NoReplyMethods() RegisterOption {
+	return func(o *registerOptions) {
+		o.noReply = true
+	}
+}
+
+// OKReplies registers the methods without reply parameter as taking a
+// *string reply which is set to OKReply when they succeed, so they stay
+// compatible with the clients expecting the legacy signature:
+//
+//	func (t *T) Set(ctx *context.Context, args *Args) error
+//
+// is called by those clients as
+//
+//	var reply string
+//	client.Call(ctx, "T.Set", args, &reply) // reply == "OK"
+//
+// OKReplies implies NoReplyMethods.
+func OKReplies() RegisterOption {
+	return func(o *registerOptions) {
+		o.noReply, o.okReply = true, true
+	}
+}
+
+// MethodDocs documents the methods of the service, by method name. They
+// take precedence over the ones returned by a Describer receiver.
+func MethodDocs(docs map[string]MethodDoc) RegisterOption {
+	return func(o *registerOptions) {
+		o.docs = docs
+	}
+}
+
+// setupMethods applies the options to the methods of a new service
+// built out of rcvr.
+func (o *registerOptions) setupMethods(rcvr interface{}, methods map[string]*MethodType) {
+	for name, mtype := range methods {
+		if o.okReply && mtype.ReplyType == nil {
+			mtype.ReplyType = typeOfStringPtr
+			mtype.okReply = true
+		}
+		mtype.checksum = o.checksums[""] || o.checksums[name]
+		mtype.idempotent = o.idempotent[""] || o.idempotent[name]
+		mtype.stream = mtype.ReplyType == typeOfStream
+		mtype.upload = mtype.ArgType == typeOfUpload
+	}
+	if d, ok := rcvr.(Describer); ok {
+		setMethodDocs(methods, d.DescribeMethods())
+	}
+	setMethodDocs(methods, o.docs)
+}
@@ -0,0 +1,176 @@
+package birpc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestCaseInsensitiveMethods(t *testing.T) {
+	server := NewServer(CaseInsensitiveMethods())
+	server.Register(new(Arith))
+	if err := server.ApplyConfig(ServerConfig{DenyMethods: []string{"Arith.Mul"}}); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	for _, method := range []string{"Arith.Add", "arith.add", " ARITH.Add\t", "Arith . add"} {
+		reply := new(Reply)
+		if err := client.Call(ctx, method, Args{7, 8}, reply); err != nil || reply.C != 15 {
+			t.Errorf("%q: %v %v", method, reply.C, err)
+		}
+	}
+	if err := client.Call(ctx, "arith.MUL", &Args{7, 8}, new(Reply)); err == nil || err.Error() != ErrMethodNotAllowed.Error() {
+		t.Errorf("expected %q, got %v", ErrMethodNotAllowed, err)
+	}
+	if err := client.Call(ctx, "arith.Sub", Args{7, 8}, new(Reply)); err == nil || err.Error() != "rpc: can't find method arith.Sub" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	client = newPipeClient(t, NewServer())
+	if err := client.Call(ctx, "arith.add", Args{7, 8}, new(Reply)); err == nil {
+		t.Error("expected case-sensitive lookup by default")
+	}
+}
+
+func TestCaseInsensitiveCollisions(t *testing.T) {
+	server := NewServer(CaseInsensitiveMethods())
+	if err := server.Register(new(Arith)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("ARITH", new(Arith)); err == nil || err.Error() != "rpc: service ARITH differs only by case from Arith" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	add := func(*context.Context, Args, *Reply) error { return nil }
+	err := server.RegisterFuncs("Funcs", struct {
+		Add func(*context.Context, Args, *Reply) error
+		ADD func(*context.Context, Args, *Reply) error
+	}{add, add})
+	if err == nil || err.Error() != "rpc: methods ADD and Add of service Funcs differ only by case" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := NewServer().RegisterName("ARITH", new(Arith)); err != nil {
+		t.Errorf("expected the names checked only with CaseInsensitiveMethods, got %v", err)
+	}
+}
+
+// MixedMethods has Rpc methods and helpers which are not.
+type MixedMethods int
+
+func (t *MixedMethods) Add(ctx *context.Context, args Args, reply *Reply) error {
+	reply.C = args.A + args.B
+	return nil
+}
+
+func (t *MixedMethods) Helper(a, b int) int { return a + b }
+
+func (t *MixedMethods) NoCtx(args, other *Args, reply *Reply) error { return nil }
+
+func TestRegisterArityModes(t *testing.T) {
+	for _, opt := range []RegisterOption{nil, LenientMethods()} {
+		var report []RejectedMethod
+		var logged []string
+		opts := []RegisterOption{ReportRejected(&report), logRejected(&logged)}
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+		server := NewServer()
+		if err := server.Register(new(MixedMethods), opts...); err != nil {
+			t.Error(err)
+		}
+		if len(report) != 2 ||
+			report[0].String() != "Helper: has 2 input parameters; needs 3 or 4" ||
+			report[1].String() != "NoCtx: first argument type is *birpc.Args, must be *context.Context" {
+			t.Errorf("unexpected rejected methods %q", report)
+		}
+		if opt != nil && len(logged) != 0 {
+			t.Errorf("expected no log in lenient mode, got %q", logged)
+		} else if opt == nil && (len(logged) != 2 ||
+			logged[0] != "rpc.Register: method Helper: has 2 input parameters; needs 3 or 4\n") {
+			t.Errorf("unexpected log %q", logged)
+		}
+		reply := new(Reply)
+		if err := newPipeClient(t, server).Call(context.Background(), "MixedMethods.Add", Args{7, 8}, reply); err != nil || reply.C != 15 {
+			t.Errorf("expected Add registered, got %v %v", reply.C, err)
+		}
+	}
+
+	err := NewServer().Register(new(MixedMethods), StrictMethods())
+	if err == nil || !strings.Contains(err.Error(), "Helper: ") || !strings.Contains(err.Error(), "; NoCtx: ") {
+		t.Errorf("expected error listing Helper and NoCtx, got %v", err)
+	}
+}
+
+// logRejected appends to logged what the registration logs.
+func logRejected(logged *[]string) RegisterOption {
+	return func(o *registerOptions) {
+		o.logf = func(format string, v ...interface{}) {
+			*logged = append(*logged, fmt.Sprintf(format, v...))
+		}
+	}
+}
+
+func TestRejectedMethodsReport(t *testing.T) {
+	expRejected := []RejectedMethod{
+		{Name: "Helper", Reason: RejectNumIn, Got: "2", Want: "3 or 4"},
+		{Name: "NoCtx", Reason: RejectContext, Got: "*birpc.Args", Want: "*context.Context"},
+	}
+	var report []RejectedMethod
+	if err := NewServer().Register(new(MixedMethods), LenientMethods(), ReportRejected(&report)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, expRejected) {
+		t.Errorf("expected report %+v, got %+v", expRejected, report)
+	}
+
+	err := NewServer().Register(new(MixedMethods), StrictMethods())
+	regErr, is := err.(*RegistrationError)
+	if !is {
+		t.Fatalf("expected *RegistrationError, got %T", err)
+	}
+	if regErr.Service != "MixedMethods" || !reflect.DeepEqual(regErr.Rejected, expRejected) {
+		t.Errorf("unexpected registration error %+v", regErr)
+	}
+
+	s, err := NewService(new(ReplyNotPointer), "", false, LenientMethods())
+	if err == nil {
+		t.Fatalf("expected error for a service without suitable methods, got %+v", s)
+	}
+	if s, err = NewFuncService("Funcs", struct {
+		Add func(*context.Context, Args, *Reply) error
+		Bad func(*context.Context, Args, Reply) int
+	}{
+		Add: func(*context.Context, Args, *Reply) error { return nil },
+		Bad: func(*context.Context, Args, Reply) int { return 0 },
+	}, LenientMethods()); err != nil {
+		t.Fatal(err)
+	}
+	exp := []RejectedMethod{{Name: "Bad", Reason: RejectReplyNotPointer, Got: "birpc.Reply", Want: "*birpc.Reply"}}
+	if !reflect.DeepEqual(s.Rejected, exp) {
+		t.Errorf("expected %+v, got %+v", exp, s.Rejected)
+	}
+}
+
+func TestFuncServiceRejected(t *testing.T) {
+	handlers := struct {
+		Add func(*context.Context, Args, *Reply) error
+		Bad func(*context.Context, Args, Reply) int
+	}{
+		Add: func(*context.Context, Args, *Reply) error { return nil },
+		Bad: func(*context.Context, Args, Reply) int { return 0 },
+	}
+	s, err := NewFuncService("Funcs", handlers)
+	if err != nil {
+		t.Fatalf("expected the unsuitable handlers skipped by default, got %v", err)
+	}
+	if _, has := s.Methods["Add"]; !has || len(s.Methods) != 1 {
+		t.Errorf("expected only Add registered, got %v", s.Methods)
+	}
+	if _, err = NewFuncService("Funcs", handlers, StrictMethods()); err == nil || !strings.Contains(err.Error(), "Bad: ") {
+		t.Errorf("expected error listing Bad, got %v", err)
+	}
+}
@@ -8,8 +8,9 @@ import (
 	"errors"
 	"go/token"
 	"reflect"
+	"strconv"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/cgrates/birpc/context"
 	"github.com/cgrates/birpc/internal/svc"
@@ -19,9 +20,17 @@ import (
 // because Typeof takes an empty interface value. This is annoying.
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
 var typeOfCtx = reflect.TypeOf((*context.Context)(nil))
+var typeOfStringPtr = reflect.TypeOf((*string)(nil))
+var typeOfDescriber = reflect.TypeOf((*Describer)(nil)).Elem()
 
-// NewService creates a new service
-func NewService(rcvr interface{}, name string, useName bool) (s *Service, err error) {
+// NewService creates a new service. By default the exported methods of
+// unsuitable type are skipped and logged when DebugLog is set, see
+// LenientMethods and StrictMethods for the alternatives.
+func NewService(rcvr interface{}, name string, useName bool, opts ...RegisterOption) (s *Service, err error) {
+	var o registerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	s = new(Service)
 	s.typ = reflect.TypeOf(rcvr)
 	s.rcvr = reflect.ValueOf(rcvr)
@@ -38,13 +47,17 @@ func NewService(rcvr interface{}, name string, useName bool) (s *Service, err er
 	s.Name = sname
 
 	// Install the methods
-	s.Methods = suitableMethods(s.typ, true)
+	s.Methods, s.Rejected = suitableMethods(s.typ, o.noReply)
+	if err = o.checkRejected(sname, s.Rejected); err != nil {
+		return nil, err
+	}
+	o.setupMethods(rcvr, s.Methods)
 
 	if len(s.Methods) == 0 {
 		var str string
 
 		// To help the user, see if a pointer receiver would work.
-		method := suitableMethods(reflect.PtrTo(s.typ), false)
+		method, _ := suitableMethods(reflect.PtrTo(s.typ), o.noReply)
 		if len(method) != 0 {
 			str = "rpc.Register: type " + sname + " has no exported methods of suitable type (hint: pass a pointer to value of that type)"
 		} else {
@@ -56,8 +69,8 @@ func NewService(rcvr interface{}, name string, useName bool) (s *Service, err er
 }
 
 // NewServiceWithMethodsRename creates a new service and renames the functions on the services using the f
-func NewServiceWithMethodsRename(rcvr interface{}, name string, useName bool, f func(oldFn string) (newFn string)) (s *Service, err error) {
-	s, err = NewService(rcvr, name, useName)
+func NewServiceWithMethodsRename(rcvr interface{}, name string, useName bool, f func(oldFn string) (newFn string), opts ...RegisterOption) (s *Service, err error) {
+	s, err = NewService(rcvr, name, useName, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +81,47 @@ func NewServiceWithMethodsRename(rcvr interface{}, name string, useName bool, f
 type MethodType struct {
 	Method    reflect.Method
 	ArgType   reflect.Type
-	ReplyType reflect.Type
+	ReplyType reflect.Type // nil for the methods without reply
+
+	fn         reflect.Value // handler func of services built by NewFuncService
+	withInfo   bool          // takes a trailing *CallInfo
+	okReply    bool          // reply-less method answering OKReply, see OKReplies
+	checksum   bool          // replies sent with a checksum, see ChecksumReplies
+	idempotent bool          // safe to call again, see IdempotentMethods
+	stream     bool          // replies with a Stream
+	upload     bool          // takes an Upload
+
+	Doc MethodDoc // documentation, see MethodDocs and Describer
+}
+
+// call invokes the method on rcvr and returns its error. The info is
+// passed only to the methods taking it.
+func (m *MethodType) call(rcvr, ctx, argv, replyv reflect.Value, info *CallInfo) error {
+	in := make([]reflect.Value, 0, 5)
+	if !m.fn.IsValid() {
+		in = append(in, rcvr)
+	}
+	in = append(in, ctx, argv)
+	if m.ReplyType != nil && !m.okReply {
+		in = append(in, replyv)
+	}
+	if m.withInfo {
+		in = append(in, reflect.ValueOf(info))
+	}
+	var returnValues []reflect.Value
+	if m.fn.IsValid() {
+		returnValues = m.fn.Call(in)
+	} else {
+		returnValues = m.Method.Func.Call(in)
+	}
+	// The return value for the method is an error.
+	err, _ := returnValues[0].Interface().(error)
+	if err == nil && m.okReply && replyv.IsValid() {
+		if reply, ok := replyv.Interface().(*string); ok && reply != nil {
+			*reply = OKReply
+		}
+	}
+	return err
 }
 
 type Service struct {
@@ -76,31 +129,204 @@ type Service struct {
 	rcvr    reflect.Value          // receiver of methods for the service
 	typ     reflect.Type           // type of the receiver
 	Methods map[string]*MethodType // registered methods
+
+	// Rejected lists the exported methods which were not registered
+	// because of their type.
+	Rejected []RejectedMethod
 }
 
-func (s *Service) call(server *basicServer, sending *sync.Mutex, pending *svc.Pending, wg *sync.WaitGroup, mtype *MethodType, req *Request, argv, replyv reflect.Value, codec writeServerCodec) {
-	if wg != nil {
-		defer wg.Done()
+func (s *Service) call(server *basicServer, conn *serverConn, mtype *MethodType, req *Request, argv, replyv reflect.Value) {
+	if conn.wg != nil {
+		defer conn.callDone()
+	}
+	if mtype.upload {
+		defer conn.closeUpload(req.Seq)
 	}
 	// _goRPC_ service calls require internal state.
 	if s.Name == "_goRPC_" {
 		switch v := argv.Interface().(type) {
 		case *svc.CancelArgs:
-			v.SetPending(pending)
+			v.SetPending(conn.pending)
+		case *svc.HelloArgs:
+			v.SetRecorder(conn.setConnID)
+		case *svc.CapabilitiesArgs:
+			v.SetCapabilities(server.capabilities())
+		case *svc.IdempotentArgs:
+			v.SetMethods(server.idempotentMethods())
+		case *svc.HandoffArgs:
+			v.SetWait(func(ctx *context.Context, maxWait time.Duration) (string, string, error) {
+				return server.awaitHandoff(ctx, conn, maxWait)
+			})
+		case *svc.ResumeArgs:
+			v.SetResume(func(token string) error { return server.resume(conn, token) })
+		case *svc.BlobArgs:
+			v.SetStore(func(data []byte) (string, error) {
+				return conn.blobs.put(data, server.blobCacheSize)
+			})
+		}
+	}
+	ctx := conn.pending.Start(req.Seq, req.ServiceMethod, req.Metadata[RequestIDMetadata], req.deadline)
+	defer conn.pending.Cancel(req.Seq)
+	ctx = context.WithValue(ctx, callDepthKey{}, req.Depth)
+	var icall *idempotentCall
+	var replyMD *replyMetadata
+	if s.Name != "_goRPC_" {
+		server.countCall(conn)
+		ctx, replyMD = serveMetadata(ctx, req)
+		if !req.deadline.IsZero() && !time.Now().Before(req.deadline) {
+			// the caller gave up on the call while it was queued
+			server.deadlines.expire()
+			server.sendResponse(conn.sending, req, invalidRequest, conn.codec, context.DeadlineExceeded.Error())
+			server.freeRequest(req)
+			return
+		}
+		cfg := server.getConfig()
+		if cfg.CallTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cfg.CallTimeout)
+			defer cancel()
+		}
+		release, err := server.admit(ctx, cfg, conn, req)
+		if err != nil {
+			server.sendResponse(conn.sending, req, newErrorExtras(conn.codec, err), conn.codec, err.Error())
+			server.freeRequest(req)
+			return
 		}
+		defer release()
+		if server.dedup != nil {
+			if sq, ok := argv.Interface().(Sequenced); ok && !server.dedup.accept(sq.MessageSequence()) {
+				// answer the duplicates with an empty reply
+				server.sendResponse(conn.sending, req, replyValue(replyv), conn.codec, "")
+				server.freeRequest(req)
+				return
+			}
+		}
+		if server.idempotency != nil {
+			if ik, ok := argv.Interface().(Idempotent); ok && ik.IdempotencyKey() != "" {
+				var first bool
+				if icall, first = server.idempotency.begin(newIdempotencyKey(conn, ik.IdempotencyKey())); !first {
+					s.repeatIdempotent(server, conn, req, ctx, icall)
+					return
+				}
+			}
+		}
+		server.deadlines.start(req.deadline)
+	}
+	var info *CallInfo
+	if mtype.withInfo {
+		info = &CallInfo{
+			ServiceMethod: req.ServiceMethod,
+			Seq:           req.Seq,
+			Depth:         req.Depth,
+			Fields:        req.Fields,
+			Peer:          conn.peer,
+			Conn:          conn.connID(),
+			Reads:         &conn.reads,
+			TLS:           peerTLS(conn.codec),
+			Session:       &conn.session,
+			pending:       conn.pending,
+			blobs:         &conn.blobs,
+			deltas:        &conn.deltas,
+			deltaSize:     server.deltaSize,
+		}
+		info.Deadline, _ = ctx.Deadline()
 	}
-	ctx := pending.Start(req.Seq)
-	defer pending.Cancel(req.Seq)
-	function := mtype.Method.Func
 	// Invoke the method, providing a new value for the reply.
-	returnValues := function.Call([]reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv})
-	// The return value for the method is an error.
-	errInter := returnValues[0].Interface()
 	errmsg := ""
-	if errInter != nil {
-		errmsg = errInter.(error).Error()
+	var extras *errorExtras // of the error, see WithErrorCode
+	if server.fieldKeys != nil && s.Name != "_goRPC_" && !mtype.upload {
+		dec, err := cryptFields(argv, decryptField(server.fieldKeys))
+		if err != nil {
+			errmsg = err.Error()
+		}
+		argv = dec
+	}
+	if mtype.stream {
+		replyv.Interface().(*Stream).start(server, conn, req, ctx)
+	}
+	if mtype.upload {
+		argv.Interface().(*Upload).ctx = ctx
+	}
+	server.debugStart(s, conn, req, argv)
+	start := time.Now()
+	if errmsg == "" { // unless the arguments could not be decrypted
+		err := server.protect(conn, req.ServiceMethod, func() error {
+			if s.Name == "_goRPC_" {
+				return mtype.call(s.rcvr, reflect.ValueOf(ctx), argv, replyv, info)
+			}
+			return server.profile(ctx, req, func(ctx *context.Context) error {
+				if len(server.interceptors) != 0 {
+					return server.intercept(ctx, req.ServiceMethod, argv, func(ctx *context.Context, argv reflect.Value) error {
+						return mtype.call(s.rcvr, reflect.ValueOf(ctx), argv, replyv, info)
+					})
+				}
+				return mtype.call(s.rcvr, reflect.ValueOf(ctx), argv, replyv, info)
+			})
+		})
+		if err != nil {
+			errmsg = err.Error()
+			extras = newErrorExtras(conn.codec, err)
+		}
+	}
+	if mtype.stream {
+		// the items were sent already, the stream ends with an empty reply
+		replyv.Interface().(*Stream).close()
+		replyv = reflect.Value{}
+	}
+	handle := time.Since(start)
+	server.observeHandle(req, handle)
+	if req.debug != nil {
+		req.debug.handle = handle
+	}
+	if server.fieldKeys != nil && s.Name != "_goRPC_" && errmsg == "" && replyv.IsValid() {
+		enc, err := cryptFields(replyv, encryptField(server.fieldKeys))
+		if err != nil {
+			errmsg = err.Error()
+		}
+		replyv = enc
+	}
+	if s.Name != "_goRPC_" {
+		server.deadlines.finish(req.deadline)
+	}
+	if icall != nil {
+		server.idempotency.finish(icall, replyValue(replyv), errmsg)
+	}
+	reply := replyValue(replyv)
+	if len(req.Fields) != 0 && replyv.IsValid() && errmsg == "" {
+		reply = maskReply(replyv, req.Fields)
+	}
+	if enc, ok := conn.codec.(rawReplyEncoder); ok && req.Raw && errmsg == "" {
+		var err error
+		if reply, err = enc.EncodeRawReply(reply); err != nil {
+			errmsg = "rpc: encoding raw reply: " + err.Error()
+		}
+	}
+	var checksum string
+	if mtype.checksum && errmsg == "" && !req.Raw {
+		checksum = ReplyChecksum(reply)
+	}
+	if extras != nil {
+		reply = extras
+	}
+	if replyMD != nil {
+		req.replyMetadata = replyMD.metadata()
+	}
+	server.sendChecksummedResponse(conn.sending, req, reply, conn.codec, errmsg, checksum)
+	if s.Name != "_goRPC_" && !req.read.IsZero() {
+		server.slos.observe(req.ServiceMethod, req.read, sloBadCall(errmsg, extras))
+	}
+	server.freeRequest(req)
+}
+
+// repeatIdempotent answers a repeated idempotent call with the reply of
+// the first one, once known.
+func (s *Service) repeatIdempotent(server *basicServer, conn *serverConn, req *Request, ctx *context.Context, icall *idempotentCall) {
+	select {
+	case <-icall.done:
+		server.sendResponse(conn.sending, req, icall.reply, conn.codec, icall.errmsg)
+	case <-ctx.Done():
+		server.sendResponse(conn.sending, req, invalidRequest, conn.codec, ctx.Err().Error())
 	}
-	server.sendResponse(sending, req, replyv.Interface(), codec, errmsg)
 	server.freeRequest(req)
 }
 
@@ -114,72 +340,93 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 	return token.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
-// suitableMethods returns suitable Rpc methods of typ, it will report
-// error using log if reportErr is true.
-func suitableMethods(typ reflect.Type, reportErr bool) map[string]*MethodType {
-	methods := make(map[string]*MethodType)
+// suitableMethods returns suitable Rpc methods of typ together with the
+// exported methods which were rejected.
+func suitableMethods(typ reflect.Type, noReply bool) (methods map[string]*MethodType, rejected []RejectedMethod) {
+	methods = make(map[string]*MethodType)
 	for m := 0; m < typ.NumMethod(); m++ {
 		method := typ.Method(m)
-		mtype := method.Type
 		mname := method.Name
 		// Method must be exported.
 		if method.PkgPath != "" {
 			continue
 		}
-		// Method needs four ins: receiver, ctx, *args, *reply.
-		if mtype.NumIn() != 4 {
-			if reportErr {
-				debugf("rpc.Register: method %q has %d input parameters; needs exactly three\n", mname, mtype.NumIn())
-			}
+		// The documentation hook is not an Rpc method.
+		if mname == "DescribeMethods" && typ.Implements(typeOfDescriber) {
 			continue
 		}
-		// First arg must be context.Context
-		if ctxType := mtype.In(1); ctxType != typeOfCtx {
-			if reportErr {
-				debugf("rpc.Register: return type of method %q is %q, must be error\n", mname, ctxType)
-			}
-			continue
-		}
-		// Second arg need not be a pointer.
-		argType := mtype.In(2)
-		if !isExportedOrBuiltinType(argType) {
-			if reportErr {
-				debugf("rpc.Register: argument type of method %q is not exported: %q\n", mname, argType)
-			}
+		argType, replyType, withInfo, rej := suitableSignature(method.Type, 1, noReply)
+		if rej.Reason != "" {
+			rej.Name = mname
+			rejected = append(rejected, rej)
 			continue
 		}
+		methods[mname] = &MethodType{Method: method, ArgType: argType, ReplyType: replyType, withInfo: withInfo}
+	}
+	return
+}
+
+// suitableSignature checks that the function type mtype has the
+// signature of an Rpc method, after skipping the first skip inputs
+// (the receiver for methods), and returns its argument and reply types
+// and whether it takes a trailing *CallInfo. The methods without reply
+// are suitable only if noReply. If the signature is not suitable rej
+// describes why, without Name.
+func suitableSignature(mtype reflect.Type, skip int, noReply bool) (argType, replyType reflect.Type, withInfo bool, rej RejectedMethod) {
+	// Method needs three ins after the skipped ones: ctx, *args, *reply,
+	// or two for the methods without reply, optionally followed by
+	// *CallInfo.
+	n := mtype.NumIn() - skip
+	if n >= 3 && (n == 4 || noReply) && mtype.In(skip+n-1) == typeOfCallInfo {
+		withInfo = true
+		n--
+	}
+	switch {
+	case n == 3, n == 2 && noReply:
+	case n == 4:
+		rej = RejectedMethod{Reason: RejectTrailing, Got: mtype.In(skip + 3).String(), Want: typeOfCallInfo.String()}
+		return
+	case noReply:
+		rej = RejectedMethod{Reason: RejectNumIn, Got: strconv.Itoa(mtype.NumIn() - skip), Want: "2 to 4"}
+		return
+	default:
+		rej = RejectedMethod{Reason: RejectNumIn, Got: strconv.Itoa(mtype.NumIn() - skip), Want: "3 or 4"}
+		return
+	}
+	// First arg must be context.Context
+	if ctxType := mtype.In(skip); ctxType != typeOfCtx {
+		rej = RejectedMethod{Reason: RejectContext, Got: ctxType.String(), Want: typeOfCtx.String()}
+		return
+	}
+	// Second arg need not be a pointer.
+	argType = mtype.In(skip + 1)
+	if !isExportedOrBuiltinType(argType) {
+		rej = RejectedMethod{Reason: RejectArgNotExported, Got: argType.String()}
+		return
+	}
+	if n == 3 {
 		// Third arg must be a pointer.
-		replyType := mtype.In(3)
+		replyType = mtype.In(skip + 2)
 		if replyType.Kind() != reflect.Ptr {
-			if reportErr {
-				debugf("rpc.Register: reply type of method %q is not a pointer: %q\n", mname, replyType)
-			}
-			continue
+			rej = RejectedMethod{Reason: RejectReplyNotPointer, Got: replyType.String(), Want: reflect.PtrTo(replyType).String()}
+			return
 		}
 		// Reply type must be exported.
 		if !isExportedOrBuiltinType(replyType) {
-			if reportErr {
-				debugf("rpc.Register: reply type of method %q is not exported: %q\n", mname, replyType)
-			}
-			continue
+			rej = RejectedMethod{Reason: RejectReplyNotExported, Got: replyType.String()}
+			return
 		}
-		// Method needs one out.
-		if mtype.NumOut() != 1 {
-			if reportErr {
-				debugf("rpc.Register: method %q has %d output parameters; needs exactly one\n", mname, mtype.NumOut())
-			}
-			continue
-		}
-		// The return type of the method must be error.
-		if returnType := mtype.Out(0); returnType != typeOfError {
-			if reportErr {
-				debugf("rpc.Register: return type of method %q is %q, must be error\n", mname, returnType)
-			}
-			continue
-		}
-		methods[mname] = &MethodType{Method: method, ArgType: argType, ReplyType: replyType}
 	}
-	return methods
+	// Method needs one out.
+	if mtype.NumOut() != 1 {
+		rej = RejectedMethod{Reason: RejectNumOut, Got: strconv.Itoa(mtype.NumOut()), Want: "1"}
+		return
+	}
+	// The return type of the method must be error.
+	if returnType := mtype.Out(0); returnType != typeOfError {
+		rej = RejectedMethod{Reason: RejectReturnType, Got: returnType.String(), Want: typeOfError.String()}
+	}
+	return
 }
 
 func (s *Service) Call(ctx *context.Context, serviceMethod string, args, rply interface{}) (err error) {
@@ -197,12 +444,10 @@ func (s *Service) Call(ctx *context.Context, serviceMethod string, args, rply in
 	if mtype == nil {
 		return errors.New("rpc: can't find method " + serviceMethod)
 	}
-	function := mtype.Method.Func
+	info := &CallInfo{ServiceMethod: serviceMethod}
+	info.Deadline, _ = ctx.Deadline()
 	// Invoke the method, providing a new value for the reply.
-	returnValues := function.Call([]reflect.Value{s.rcvr, reflect.ValueOf(ctx), reflect.ValueOf(args), reflect.ValueOf(rply)})
-	// The return value for the method is an error.
-	err, _ = returnValues[0].Interface().(error)
-	return
+	return mtype.call(s.rcvr, reflect.ValueOf(ctx), reflect.ValueOf(args), reflect.ValueOf(rply), info)
 }
 
 func getArgv(mtype *MethodType) (argv reflect.Value, argIsValue bool) {
@@ -215,7 +460,19 @@ func getArgv(mtype *MethodType) (argv reflect.Value, argIsValue bool) {
 	return
 }
 
+// replyValue returns the value to send as reply, ackReply for the methods
+// without reply and the streaming ones.
+func replyValue(replyv reflect.Value) interface{} {
+	if !replyv.IsValid() || replyv.Type() == typeOfStream {
+		return ackReply
+	}
+	return replyv.Interface()
+}
+
 func getReplyv(mtype *MethodType) (replyv reflect.Value) {
+	if mtype.ReplyType == nil {
+		return
+	}
 	replyv = reflect.New(mtype.ReplyType.Elem())
 
 	switch mtype.ReplyType.Elem().Kind() {
@@ -0,0 +1,66 @@
+package birpc
+
+import "strings"
+
+// RejectReason identifies why a method was not registered.
+type RejectReason string
+
+// The reasons a method can be rejected for.
+const (
+	RejectNumIn            RejectReason = "num_in"             // wrong number of parameters
+	RejectContext          RejectReason = "context"            // first parameter is not *context.Context
+	RejectArgNotExported   RejectReason = "arg_not_exported"   // argument type is not exported
+	RejectReplyNotPointer  RejectReason = "reply_not_pointer"  // reply type is not a pointer
+	RejectReplyNotExported RejectReason = "reply_not_exported" // reply type is not exported
+	RejectTrailing         RejectReason = "trailing"           // extra parameter is not *CallInfo
+	RejectNumOut           RejectReason = "num_out"            // wrong number of results
+	RejectReturnType       RejectReason = "return_type"        // result is not error
+)
+
+// RejectedMethod describes an exported method, or a func service
+// handler, left out of a service because of its type.
+type RejectedMethod struct {
+	Name   string       `json:"name"`
+	Reason RejectReason `json:"reason"`
+	// Got is the offending type or count, Want what was expected
+	// instead; Want is empty when there is no single expected value.
+	Got  string `json:"got"`
+	Want string `json:"want,omitempty"`
+}
+
+func (r RejectedMethod) String() string {
+	switch r.Reason {
+	case RejectNumIn:
+		return r.Name + ": has " + r.Got + " input parameters; needs " + r.Want
+	case RejectContext:
+		return r.Name + ": first argument type is " + r.Got + ", must be " + r.Want
+	case RejectArgNotExported:
+		return r.Name + ": argument type is not exported: " + r.Got
+	case RejectReplyNotPointer:
+		return r.Name + ": reply type is not a pointer: " + r.Got
+	case RejectReplyNotExported:
+		return r.Name + ": reply type is not exported: " + r.Got
+	case RejectTrailing:
+		return r.Name + ": trailing parameter type is " + r.Got + ", must be " + r.Want
+	case RejectNumOut:
+		return r.Name + ": has " + r.Got + " output parameters; needs exactly " + r.Want
+	case RejectReturnType:
+		return r.Name + ": return type is " + r.Got + ", must be " + r.Want
+	}
+	return r.Name + ": " + string(r.Reason)
+}
+
+// RegistrationError is returned by the strict registrations, see
+// StrictMethods, when some methods have an unsuitable type.
+type RegistrationError struct {
+	Service  string
+	Rejected []RejectedMethod
+}
+
+func (e *RegistrationError) Error() string {
+	methods := make([]string, len(e.Rejected))
+	for i, r := range e.Rejected {
+		methods[i] = r.String()
+	}
+	return "rpc.Register: type " + e.Service + " has methods of unsuitable type: " + strings.Join(methods, "; ")
+}
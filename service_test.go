@@ -0,0 +1,120 @@
+package birpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Commands struct {
+	done chan int
+}
+
+func (c *Commands) Reset(ctx *context.Context, args *Args) error {
+	if args.A < 0 {
+		return errors.New("negative")
+	}
+	c.done <- args.A
+	return nil
+}
+
+func (c *Commands) ResetInfo(ctx *context.Context, args Args, info *CallInfo) error {
+	c.done <- int(info.Seq)
+	return nil
+}
+
+func TestReplylessMethods(t *testing.T) {
+	cmds := &Commands{done: make(chan int, 1)}
+	server := NewServer()
+	err := server.Register(cmds, StrictMethods())
+	if err == nil || !strings.Contains(err.Error(), "Reset: has 2 input parameters; needs 3 or 4") {
+		t.Errorf("expected the methods without reply rejected by default, got %v", err)
+	}
+	if err = server.Register(cmds, NoReplyMethods(), StrictMethods()); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	if err := client.Call(ctx, "Commands.Reset", &Args{A: 3}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if a := <-cmds.done; a != 3 {
+		t.Errorf("expected 3, got %d", a)
+	}
+	reply := &Reply{C: 5}
+	if err := client.Call(ctx, "Commands.Reset", &Args{A: 4}, reply); err != nil {
+		t.Fatal(err)
+	}
+	if <-cmds.done; reply.C != 5 {
+		t.Errorf("expected the reply to be left untouched, got %+v", reply)
+	}
+	if err := client.Call(ctx, "Commands.Reset", &Args{A: -1}, nil); err == nil || err.Error() != "negative" {
+		t.Errorf("expected error negative, got %v", err)
+	}
+	if err := client.Call(ctx, "Commands.ResetInfo", Args{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if seq := <-cmds.done; seq == 0 {
+		t.Error("expected the call info")
+	}
+
+	srv, err := NewService(cmds, "", false, NoReplyMethods())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srv.Methods["Reset"].ReplyType != nil {
+		t.Errorf("unexpected reply type %v", srv.Methods["Reset"].ReplyType)
+	}
+	if err = srv.Call(ctx, "Commands.Reset", &Args{A: 6}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if a := <-cmds.done; a != 6 {
+		t.Errorf("expected 6, got %d", a)
+	}
+}
+
+func TestOKReplies(t *testing.T) {
+	cmds := &Commands{done: make(chan int, 1)}
+	server := NewServer()
+	if err := server.Register(cmds, OKReplies()); err != nil {
+		t.Fatal(err)
+	}
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+
+	var reply string
+	if err := client.Call(ctx, "Commands.Reset", &Args{A: 3}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if <-cmds.done; reply != OKReply {
+		t.Errorf("expected %q, got %q", OKReply, reply)
+	}
+	reply = ""
+	if err := client.Call(ctx, "Commands.Reset", &Args{A: -1}, &reply); err == nil || err.Error() != "negative" {
+		t.Errorf("expected error negative, got %v", err)
+	}
+	if reply != "" {
+		t.Errorf("expected no reply on error, got %q", reply)
+	}
+	if err := client.Call(ctx, "Commands.ResetInfo", Args{}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if <-cmds.done; reply != OKReply {
+		t.Errorf("expected %q, got %q", OKReply, reply)
+	}
+
+	srv, err := NewFuncService("Funcs", struct {
+		Set func(*context.Context, *Args) error
+	}{cmds.Reset}, OKReplies())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply = ""
+	if err = srv.Call(ctx, "Funcs.Set", &Args{A: 1}, &reply); err != nil || reply != OKReply {
+		t.Errorf("direct Set: %q %v", reply, err)
+	}
+	<-cmds.done
+}
@@ -0,0 +1,243 @@
+package birpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// The version skew tests replay the frames recorded by the releases, in
+// testdata/skew/<release>, against the current code: the requests of the
+// old clients to the current server and the responses of the old servers
+// to the current client. A release records its frames with
+//
+//	go test -run TestVersionSkew -skew.record <release>
+//
+// The harness sticks to the API of the first release so that it records
+// the frames of any of them.
+var skewRecord = flag.String("skew.record", "", "record the frames of the version skew tests as this release")
+
+const (
+	skewRequests  = "gob_requests.golden"
+	skewResponses = "gob_responses.golden"
+)
+
+// skewCall is a call of the version skew tests, reply holding the expected
+// reply unless err is set.
+type skewCall struct {
+	method string
+	args   interface{}
+	reply  interface{}
+	err    string
+}
+
+var skewCalls = []skewCall{
+	{method: "Arith.Add", args: Args{7, 8}, reply: &Reply{15}},
+	{method: "Arith.Mul", args: &Args{7, 8}, reply: &Reply{56}},
+	{method: "Arith.Div", args: Args{7, 0}, reply: new(Reply), err: "divide by zero"},
+	{method: "Arith.String", args: &Args{7, 8}, reply: stringPtr("7+8=15")},
+	{method: "Arith.Missing", args: Args{}, reply: new(Reply), err: "rpc: can't find method Arith.Missing"},
+	{method: "Arith.Add", args: Args{-1, 1}, reply: &Reply{0}},
+}
+
+func stringPtr(s string) *string { return &s }
+
+// skewRequest and skewResponse are the headers of the first release, as
+// the old peers decode them.
+type skewRequest struct {
+	ServiceMethod string
+	Seq           uint64
+}
+
+type skewResponse struct {
+	Seq   uint64
+	Error string
+}
+
+// recorder records the bytes written to the connection.
+type recorder struct {
+	net.Conn
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	r.buf.Write(b)
+	r.mu.Unlock()
+	return r.Conn.Write(b)
+}
+
+func (r *recorder) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.buf.Bytes()...)
+}
+
+func recordSkew(t *testing.T, dir string) {
+	server := NewServer()
+	server.Register(new(Arith))
+	c1, c2 := net.Pipe()
+	cli, srv := &recorder{Conn: c1}, &recorder{Conn: c2}
+	go server.ServeConn(srv)
+	client := NewClient(cli)
+	defer client.Close()
+	for _, c := range skewCalls {
+		client.Call(context.Background(), c.method, c.args, reflect.New(reflect.TypeOf(c.reply).Elem()).Interface())
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, skewRequests), cli.bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, skewResponses), srv.bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	root := filepath.Join("testdata", "skew")
+	if *skewRecord != "" {
+		recordSkew(t, filepath.Join(root, *skewRecord))
+	}
+	releases, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range releases {
+		dir := filepath.Join(root, rel.Name())
+		t.Run(rel.Name()+"/old-client", func(t *testing.T) { testOldClient(t, dir) })
+		t.Run(rel.Name()+"/old-server", func(t *testing.T) { testOldServer(t, dir) })
+	}
+}
+
+// testOldClient sends the recorded requests to the current server and
+// decodes its responses as the old client would.
+func testOldClient(t *testing.T, dir string) {
+	requests, err := ioutil.ReadFile(filepath.Join(dir, skewRequests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sequence numbers of the calls
+	seqs := make(map[uint64]int)
+	dec := gob.NewDecoder(bytes.NewReader(requests))
+	for i, c := range skewCalls {
+		var req skewRequest
+		if err = dec.Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.ServiceMethod != c.method {
+			t.Fatalf("expected request %d to call %s, got %s", i, c.method, req.ServiceMethod)
+		}
+		seqs[req.Seq] = i
+		if err = dec.Decode(reflect.New(reflect.TypeOf(c.args)).Interface()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := NewServer()
+	server.Register(new(Arith))
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go server.ServeConn(c2)
+	go c1.Write(requests)
+	c1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	dec = gob.NewDecoder(c1)
+	for range skewCalls {
+		var resp skewResponse
+		if err = dec.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		i, has := seqs[resp.Seq]
+		if !has {
+			t.Fatalf("unexpected response %+v", resp)
+		}
+		c := skewCalls[i]
+		if resp.Error != "" || c.err != "" {
+			if resp.Error != c.err {
+				t.Errorf("%s: expected error %q, got %q", c.method, c.err, resp.Error)
+			}
+			dec.Decode(new(struct{})) // the placeholder body
+			continue
+		}
+		reply := reflect.New(reflect.TypeOf(c.reply).Elem()).Interface()
+		if err = dec.Decode(reply); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(reply, c.reply) {
+			t.Errorf("%s: expected %v, got %v", c.method, c.reply, reply)
+		}
+	}
+}
+
+// testOldServer makes the calls with the current client, checking its
+// requests as the old server would decode them and answering them with
+// the recorded responses.
+func testOldServer(t *testing.T, dir string) {
+	responses, err := ioutil.ReadFile(filepath.Join(dir, skewResponses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := net.Pipe()
+	client := NewClient(c1)
+	defer client.Close()
+	served := make(chan error, 1)
+	go func() {
+		dec := gob.NewDecoder(c2)
+		for i, c := range skewCalls {
+			var req skewRequest
+			if err := dec.Decode(&req); err != nil {
+				served <- err
+				return
+			}
+			args := reflect.New(reflect.TypeOf(c.args))
+			if err := dec.Decode(args.Interface()); err != nil {
+				served <- err
+				return
+			}
+			if req.ServiceMethod != c.method || !reflect.DeepEqual(args.Elem().Interface(), c.args) {
+				t.Errorf("expected request %d to call %s with %v, got %s with %v",
+					i, c.method, c.args, req.ServiceMethod, args.Elem().Interface())
+			}
+		}
+		_, err := c2.Write(responses)
+		served <- err
+	}()
+
+	calls := make([]*Call, len(skewCalls))
+	for i, c := range skewCalls {
+		reply := reflect.New(reflect.TypeOf(c.reply).Elem()).Interface()
+		calls[i] = client.Go(c.method, c.args, reply, nil)
+	}
+	if err = <-served; err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	for i, c := range skewCalls {
+		select {
+		case <-calls[i].Done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no reply", c.method)
+		}
+		if calls[i].Error != nil || c.err != "" {
+			if calls[i].Error == nil || calls[i].Error.Error() != c.err {
+				t.Errorf("%s: expected error %q, got %v", c.method, c.err, calls[i].Error)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(calls[i].Reply, c.reply) {
+			t.Errorf("%s: expected %v, got %v", c.method, c.reply, calls[i].Reply)
+		}
+	}
+}
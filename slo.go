@@ -0,0 +1,214 @@
+package birpc
+
+import (
+	"sync"
+	"time"
+)
+
+// SLO is the objective of a method, see MethodSLOs: the fraction of its
+// calls answered in time and without error over a rolling window.
+type SLO struct {
+	// Objective is the fraction of the calls which must be good, like
+	// 0.999, leaving the rest as the error budget.
+	Objective float64 `json:"objective" yaml:"objective"`
+	// Latency, unless zero, is the time from reading a call to answering
+	// it after which the call is bad.
+	Latency time.Duration `json:"latency,omitempty" yaml:"latency,omitempty"`
+	// Window is the time over which the calls are counted, an hour by
+	// default.
+	Window time.Duration `json:"window,omitempty" yaml:"window,omitempty"`
+	// AlertBurnRate is the burn rate over both the window and its last
+	// twelfth above which the SLO is violated, 14.4 by default: the rate
+	// spending 2% of the budget of 30 days in an hour.
+	AlertBurnRate float64 `json:"alert_burn_rate,omitempty" yaml:"alert_burn_rate,omitempty"`
+}
+
+// window returns the Window of the SLO, defaulted.
+func (slo SLO) window() time.Duration {
+	if slo.Window <= 0 {
+		return time.Hour
+	}
+	return slo.Window
+}
+
+// alertBurnRate returns the AlertBurnRate of the SLO, defaulted.
+func (slo SLO) alertBurnRate() float64 {
+	if slo.AlertBurnRate <= 0 {
+		return 14.4
+	}
+	return slo.AlertBurnRate
+}
+
+// SLOStatus is the compliance of a method with its SLO.
+type SLOStatus struct {
+	SLO        SLO     `json:"slo"`
+	Calls      uint64  `json:"calls"`      // answered during the window
+	Bad        uint64  `json:"bad"`        // too slow or failed
+	Compliance float64 `json:"compliance"` // fraction of the good calls, 1 without calls
+	// BurnRate is the pace the error budget is spent at over the window, 1
+	// spending it exactly by the end of the window. ShortBurnRate is the
+	// one over the last twelfth of the window.
+	BurnRate      float64 `json:"burn_rate"`
+	ShortBurnRate float64 `json:"short_burn_rate"`
+	Violated      bool    `json:"violated"` // both burn rates are above the AlertBurnRate
+}
+
+// SLOAlerts makes the server call onViolation when the SLO of a method
+// starts being violated, with the method and its status. It is called
+// once per violation, on the goroutine of the call found violating it,
+// the violation ending once the burn rates fall back.
+func SLOAlerts(onViolation func(serviceMethod string, status SLOStatus)) ServerOption {
+	return func(server *basicServer) {
+		server.slos.onViolation = onViolation
+	}
+}
+
+// SLOStatus returns the status of the methods with an SLO, by method name,
+// see MethodSLOs.
+func (server *basicServer) SLOStatus() map[string]SLOStatus {
+	server.slos.mu.RLock()
+	defer server.slos.mu.RUnlock()
+	statuses := make(map[string]SLOStatus, len(server.slos.trackers))
+	now := time.Now()
+	for method, t := range server.slos.trackers {
+		t.mu.Lock()
+		statuses[method] = t.status(now)
+		t.mu.Unlock()
+	}
+	return statuses
+}
+
+// sloBuckets is the number of buckets the calls of the window are counted
+// in, a multiple of 12 for the short window.
+const sloBuckets = 60
+
+// sloTrackers track the SLOs of the methods.
+type sloTrackers struct {
+	mu          sync.RWMutex
+	trackers    map[string]*sloTracker
+	onViolation func(serviceMethod string, status SLOStatus)
+}
+
+// sloTracker counts the calls of a method in the buckets of its window.
+type sloTracker struct {
+	mu       sync.Mutex
+	slo      SLO
+	width    int64 // of the buckets, in nanoseconds
+	buckets  [sloBuckets]sloBucket
+	violated bool
+}
+
+type sloBucket struct {
+	n          int64 // index of the bucket since the epoch
+	calls, bad uint64
+}
+
+// set updates the trackers to slos, resetting the ones of the methods
+// whose SLO changed.
+func (s *sloTrackers) set(slos map[string]SLO) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trackers := make(map[string]*sloTracker, len(slos))
+	for method, slo := range slos {
+		if t := s.trackers[method]; t != nil && t.slo == slo {
+			trackers[method] = t
+			continue
+		}
+		t := &sloTracker{slo: slo, width: int64(slo.window() / sloBuckets)}
+		if t.width == 0 {
+			t.width = 1
+		}
+		trackers[method] = t
+	}
+	s.trackers = trackers
+}
+
+// observe counts the call of serviceMethod read at read, calling
+// onViolation if the SLO starts being violated.
+func (s *sloTrackers) observe(serviceMethod string, read time.Time, bad bool) {
+	s.mu.RLock()
+	t := s.trackers[serviceMethod]
+	s.mu.RUnlock()
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	if t.slo.Latency > 0 && now.Sub(read) > t.slo.Latency {
+		bad = true
+	}
+	n := now.UnixNano() / t.width
+	b := &t.buckets[n%sloBuckets]
+	if b.n != n {
+		*b = sloBucket{n: n}
+	}
+	b.calls++
+	if bad {
+		b.bad++
+	}
+	status := t.status(now)
+	started := status.Violated && !t.violated
+	t.violated = status.Violated
+	t.mu.Unlock()
+	if started && s.onViolation != nil {
+		s.onViolation(serviceMethod, status)
+	}
+}
+
+// status returns the status of the SLO at now, with t.mu held.
+func (t *sloTracker) status(now time.Time) SLOStatus {
+	n := now.UnixNano() / t.width
+	var calls, bad, shortCalls, shortBad uint64
+	for _, b := range t.buckets {
+		if b.n <= n-sloBuckets || b.n > n {
+			continue
+		}
+		calls += b.calls
+		bad += b.bad
+		if b.n > n-sloBuckets/12 {
+			shortCalls += b.calls
+			shortBad += b.bad
+		}
+	}
+	status := SLOStatus{
+		SLO:           t.slo,
+		Calls:         calls,
+		Bad:           bad,
+		Compliance:    1,
+		BurnRate:      t.burnRate(calls, bad),
+		ShortBurnRate: t.burnRate(shortCalls, shortBad),
+	}
+	if calls != 0 {
+		status.Compliance = 1 - float64(bad)/float64(calls)
+	}
+	alert := t.slo.alertBurnRate()
+	status.Violated = status.BurnRate > alert && status.ShortBurnRate > alert
+	return status
+}
+
+// burnRate returns the pace the error budget is spent at by bad calls out
+// of calls.
+func (t *sloTracker) burnRate(calls, bad uint64) float64 {
+	if calls == 0 {
+		return 0
+	}
+	return float64(bad) / float64(calls) / (1 - t.slo.Objective)
+}
+
+// sloBadCall reports whether the error errmsg of a call, with its extras,
+// counts against the SLO of its method: the errors but the ones of the
+// callers, like CodeInvalidArgument or CodeNotFound.
+func sloBadCall(errmsg string, extras *errorExtras) bool {
+	if errmsg == "" {
+		return false
+	}
+	if extras == nil {
+		return true
+	}
+	switch extras.code {
+	case CodeCanceled, CodeInvalidArgument, CodeNotFound, CodeAlreadyExists, CodePermissionDenied,
+		CodeFailedPrecondition, CodeOutOfRange, CodeUnauthenticated:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package birpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestMethodSLOs(t *testing.T) {
+	alerts := make(chan SLOStatus, 2)
+	server := NewServer(SLOAlerts(func(serviceMethod string, status SLOStatus) {
+		if serviceMethod == "Arith.SleepMilli" {
+			alerts <- status
+		}
+	}))
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	reply := new(Reply)
+	// the calls are counted once answered
+	waitStatus := func(method string, calls uint64) SLOStatus {
+		t.Helper()
+		var status SLOStatus
+		if !eventually(func() bool {
+			status = server.SLOStatus()[method]
+			return status.Calls == calls
+		}) {
+			t.Fatalf("expected %d calls of %s, got %+v", calls, method, status)
+		}
+		return status
+	}
+	if err := server.ApplyConfig(ServerConfig{MethodSLOs: map[string]SLO{
+		"Arith.SleepMilli": {Objective: 0.9, Latency: 20 * time.Millisecond, Window: time.Minute, AlertBurnRate: 2.5},
+		"Arith.Div":        {Objective: 0.99},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ms := range []int{0, 0, 0, 0, 40} {
+		if err := client.Call(ctx, "Arith.SleepMilli", &Args{A: ms}, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := waitStatus("Arith.SleepMilli", 5)
+	if status.Bad != 1 || status.Compliance != 0.8 || status.Violated {
+		t.Errorf("unexpected status %+v", status)
+	}
+	select {
+	case status = <-alerts:
+		t.Errorf("unexpected alert %+v", status)
+	default:
+	}
+	// the burn rate of 3.3 violates the SLO, alerting once
+	for i := 0; i < 2; i++ {
+		if err := client.Call(ctx, "Arith.SleepMilli", &Args{A: 40}, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case status = <-alerts:
+	case <-time.After(time.Second):
+		t.Fatalf("expected an alert, got %+v", server.SLOStatus())
+	}
+	if status.Calls != 6 || status.Bad != 2 || !status.Violated || status.ShortBurnRate < 3 {
+		t.Errorf("unexpected alert %+v", status)
+	}
+	waitStatus("Arith.SleepMilli", 7)
+	select {
+	case status = <-alerts:
+		t.Errorf("expected a single alert, got %+v", status)
+	default:
+	}
+
+	// the errors of the methods are bad, the ones of the callers not
+	if err := client.Call(ctx, "Arith.Div", Args{7, 0}, reply); err == nil {
+		t.Fatal("expected the division by zero to fail")
+	}
+	if status = waitStatus("Arith.Div", 1); status.Bad != 1 || status.BurnRate < 99 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if sloBadCall("not found", &errorExtras{code: CodeNotFound}) || !sloBadCall("internal", &errorExtras{code: CodeInternal}) ||
+		!sloBadCall("detailed", &errorExtras{detail: "none"}) || sloBadCall("", nil) {
+		t.Error("unexpected bad calls")
+	}
+
+	for _, cfg := range []ServerConfig{
+		{MethodSLOs: map[string]SLO{"Arith.Div": {}}},
+		{MethodSLOs: map[string]SLO{"Arith.Div": {Objective: 1}}},
+		{MethodSLOs: map[string]SLO{"Arith.Div": {Objective: 0.9, Window: -time.Second}}},
+		{MethodSLOs: map[string]SLO{"Div": {Objective: 0.9}}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg)
+		}
+	}
+}
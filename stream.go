@@ -0,0 +1,173 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// ErrStreamClosed is returned by Stream.Send once the method returned.
+var ErrStreamClosed = errors.New("rpc: stream closed")
+
+var typeOfStream = reflect.TypeOf((*Stream)(nil))
+
+// Stream is the reply of the streaming methods, which send a sequence of
+// replies to the caller of a single request:
+//
+//	func (t *T) Export(ctx *context.Context, args *Args, stream *birpc.Stream) error
+//
+// Each value given to Send reaches the client as an item of its
+// ClientStream, in order, and the stream ends when the method returns,
+// with its error if any. The clients call them with CallStream, and the
+// methods also taking an Upload with OpenDuplex.
+type Stream struct {
+	mu     sync.Mutex
+	server *basicServer
+	conn   *serverConn
+	req    *Request
+	ctx    *context.Context
+	closed bool
+}
+
+func (s *Stream) start(server *basicServer, conn *serverConn, req *Request, ctx *context.Context) {
+	s.server, s.conn, s.req, s.ctx = server, conn, req, ctx
+}
+
+// Send sends v to the client. It fails once the call is canceled, with
+// the error of its context, or after the method returned.
+func (s *Stream) Send(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	resp := s.server.getResponse()
+	resp.Seq = s.req.Seq
+	resp.More = true
+	_, err := writeResponse(s.conn.sending, s.conn.codec, resp, v)
+	s.server.freeResponse(resp)
+	return err
+}
+
+// close makes the next Sends fail, once the method returned.
+func (s *Stream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+}
+
+// callStream holds the items received for a streaming call until they
+// are taken by its ClientStream.
+type callStream struct {
+	newItem func() interface{}
+	items   chan interface{}
+	quit    chan struct{} // closed when the ClientStream is abandoned
+	once    sync.Once
+}
+
+func newCallStream(newItem func() interface{}) *callStream {
+	return &callStream{
+		newItem: newItem,
+		items:   make(chan interface{}, streamBuffer),
+		quit:    make(chan struct{}),
+	}
+}
+
+// streamBuffer is the number of items buffered by a ClientStream. Once it
+// is full, reading the connection waits for the items to be taken.
+const streamBuffer = 16
+
+// ClientStream receives the items sent by a streaming method, see Stream.
+type ClientStream struct {
+	client *basicClient
+	call   *Call
+	ctx    *context.Context
+	err    error // set once the call is done
+	closed bool  // no more items are taken after Close
+}
+
+// CallStream calls the streaming method serviceMethod, whose items are
+// decoded into the values returned by newItem. The items must be taken
+// with Recv: the connection is not read while the stream holds more than
+// a few of them. Canceling ctx cancels the call.
+func (client *basicClient) CallStream(ctx *context.Context, serviceMethod string, args interface{}, newItem func() interface{}) *ClientStream {
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Done:          make(chan *Call, 2), // 2 for this call and cancel
+		depth:         nextCallDepth(ctx),
+		ctx:           ctx,
+		stream:        newCallStream(newItem),
+	}
+	client.enqueue(call)
+	return &ClientStream{client: client, call: call, ctx: ctx}
+}
+
+// Recv returns the next item of the stream. Once all the items are
+// received it returns io.EOF, or the error the call failed with.
+func (s *ClientStream) Recv() (interface{}, error) {
+	if s.closed {
+		return nil, s.err
+	}
+	if s.err != nil {
+		select {
+		case item := <-s.call.stream.items:
+			return item, nil
+		default:
+			return nil, s.err
+		}
+	}
+	select {
+	case item := <-s.call.stream.items:
+		return item, nil
+	case call := <-s.call.Done:
+		if s.err = call.Error; s.err == nil {
+			s.err = io.EOF
+		}
+		return s.Recv()
+	case <-s.ctx.Done():
+		s.err = s.ctx.Err()
+		s.closed = true
+		s.client.abandon(s.call)
+		return nil, s.err
+	}
+}
+
+// Close abandons the stream, canceling the call on the server if it is
+// still running.
+func (s *ClientStream) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.err == nil {
+		s.err = context.Canceled
+		s.client.abandon(s.call)
+	}
+}
+
+// readStreamItem reads the body of resp, an item of a streaming call, and
+// hands it to the call.
+func (client *basicClient) readStreamItem(codec interface{ ReadResponseBody(interface{}) error }, resp *Response) error {
+	client.mutex.Lock()
+	call := client.pending[resp.Seq]
+	client.mutex.Unlock()
+	if call == nil || call.stream == nil {
+		return codec.ReadResponseBody(nil)
+	}
+	item := call.stream.newItem()
+	if err := codec.ReadResponseBody(item); err != nil {
+		return err
+	}
+	select {
+	case call.stream.items <- item:
+	case <-call.stream.quit:
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package birpc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type CDRExport struct {
+	stopped chan error // receives the error of the canceled exports
+}
+
+func (e *CDRExport) Export(ctx *context.Context, n int, stream *Stream) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(&CDR{ID: fmt.Sprint(i), Cost: float64(i)}); err != nil {
+			return err
+		}
+	}
+	if n < 0 {
+		return errors.New("negative count")
+	}
+	return nil
+}
+
+func (e *CDRExport) Endless(ctx *context.Context, _ int, stream *Stream) error {
+	for {
+		if err := stream.Send(&CDR{}); err != nil {
+			e.stopped <- err
+			return err
+		}
+	}
+}
+
+func newCDR() interface{} { return new(CDR) }
+
+func TestStream(t *testing.T) {
+	server := NewServer()
+	server.Register(&CDRExport{})
+	bserver := NewBirpcServer()
+	bserver.Register(&CDRExport{})
+
+	for name, client := range map[string]interface {
+		CallStream(*context.Context, string, interface{}, func() interface{}) *ClientStream
+	}{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		stream := client.CallStream(context.Background(), "CDRExport.Export", 40, newCDR)
+		var ids []string
+		for {
+			item, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			ids = append(ids, item.(*CDR).ID)
+		}
+		if len(ids) != 40 || ids[0] != "0" || ids[39] != "39" {
+			t.Errorf("%s: unexpected items %v", name, ids)
+		}
+
+		stream = client.CallStream(context.Background(), "CDRExport.Export", -1, newCDR)
+		if _, err := stream.Recv(); err == nil || err.Error() != "negative count" {
+			t.Errorf("%s: expected the error of the method, got %v", name, err)
+		}
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	export := &CDRExport{stopped: make(chan error, 1)}
+	server := NewServer()
+	server.Register(export)
+	client := newPipeClient(t, server)
+
+	stream := client.CallStream(context.Background(), "CDRExport.Endless", 0, newCDR)
+	for i := 0; i < 3; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stream.Close()
+	select {
+	case err := <-export.stopped:
+		if err != context.Canceled {
+			t.Errorf("expected the stream to be canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the method kept streaming after Close")
+	}
+	if _, err := stream.Recv(); err != context.Canceled {
+		t.Errorf("expected Canceled after Close, got %v", err)
+	}
+	// the connection is still usable
+	stream = client.CallStream(context.Background(), "CDRExport.Export", 2, newCDR)
+	for i := 0; i < 2; i++ {
+		if _, err := stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package birpc
+
+import (
+	"sync"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// SubscriptionMux merges the subscriptions the local components make to
+// the same topic of a server into a single one, fanning out locally what
+// the server pushes. The server sees one subscription per topic however
+// many components subscribe, and pushes every message once.
+//
+// The server is expected to provide a method subscribing the connection
+// to a topic and one ending the subscription, both called with the topic
+// as argument and without reply, see NoReplyMethods. The client side
+// method receiving the pushed messages hands them to Deliver.
+type SubscriptionMux struct {
+	client      ClientConnector
+	subscribe   string
+	unsubscribe string
+
+	mu     sync.Mutex
+	lastID uint64
+	topics map[string]*muxTopic
+}
+
+type muxTopic struct {
+	refs     int // subscribers, including the ones being added or removed
+	handlers map[uint64]func(msg interface{})
+
+	op         sync.Mutex // serializes the calls to the server
+	subscribed bool       // protected by op
+}
+
+// NewSubscriptionMux returns a SubscriptionMux subscribing through client
+// with the subscribeMethod and unsubscribeMethod of the server.
+func NewSubscriptionMux(client ClientConnector, subscribeMethod, unsubscribeMethod string) *SubscriptionMux {
+	return &SubscriptionMux{
+		client:      client,
+		subscribe:   subscribeMethod,
+		unsubscribe: unsubscribeMethod,
+		topics:      make(map[string]*muxTopic),
+	}
+}
+
+// Subscribe calls handler with the messages delivered for topic until the
+// returned cancel function is called. Only the first subscriber of a
+// topic subscribes on the server, and only the last one leaving
+// unsubscribes; the others return without calling the server.
+func (m *SubscriptionMux) Subscribe(ctx *context.Context, topic string, handler func(msg interface{})) (cancel func(*context.Context) error, err error) {
+	m.mu.Lock()
+	t, has := m.topics[topic]
+	if !has {
+		t = &muxTopic{handlers: make(map[uint64]func(interface{}))}
+		m.topics[topic] = t
+	}
+	t.refs++
+	m.mu.Unlock()
+
+	t.op.Lock()
+	defer t.op.Unlock()
+	if !t.subscribed {
+		if err = m.client.Call(ctx, m.subscribe, topic, nil); err != nil {
+			m.release(topic, t)
+			return
+		}
+		t.subscribed = true
+	}
+	m.mu.Lock()
+	m.lastID++
+	id := m.lastID
+	t.handlers[id] = handler
+	m.mu.Unlock()
+
+	var once sync.Once
+	return func(ctx *context.Context) (err error) {
+		once.Do(func() { err = m.cancel(ctx, topic, t, id) })
+		return
+	}, nil
+}
+
+func (m *SubscriptionMux) cancel(ctx *context.Context, topic string, t *muxTopic, id uint64) (err error) {
+	m.mu.Lock()
+	delete(t.handlers, id)
+	m.mu.Unlock()
+
+	t.op.Lock()
+	defer t.op.Unlock()
+	m.mu.Lock()
+	last := t.refs == 1
+	m.mu.Unlock()
+	if last && t.subscribed {
+		// the server may keep pushing if the call fails, but nobody
+		// listens anymore
+		t.subscribed = false
+		err = m.client.Call(ctx, m.unsubscribe, topic, nil)
+	}
+	m.release(topic, t)
+	return
+}
+
+// release drops a reference to t, forgetting the topic with the last one.
+func (m *SubscriptionMux) release(topic string, t *muxTopic) {
+	m.mu.Lock()
+	if t.refs--; t.refs == 0 && m.topics[topic] == t {
+		delete(m.topics, topic)
+	}
+	m.mu.Unlock()
+}
+
+// Deliver hands msg to the subscribers of topic, returning how many there
+// were.
+func (m *SubscriptionMux) Deliver(topic string, msg interface{}) int {
+	m.mu.Lock()
+	var handlers []func(interface{})
+	if t, has := m.topics[topic]; has {
+		handlers = make([]func(interface{}), 0, len(t.handlers))
+		for _, h := range t.handlers {
+			handlers = append(handlers, h)
+		}
+	}
+	m.mu.Unlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+	return len(handlers)
+}
+
+// Subscribers returns the number of local subscribers of topic.
+func (m *SubscriptionMux) Subscribers(topic string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t, has := m.topics[topic]; has {
+		return len(t.handlers)
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package birpc
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Feed counts the subscriptions of its clients and pushes to them.
+type Feed struct {
+	mu      sync.Mutex
+	subs    map[string]int
+	calls   int
+	clients map[string]ClientConnector
+}
+
+func (f *Feed) Subscribe(ctx *context.Context, topic string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.subs[topic]++
+	f.clients[topic] = ctx.Client
+	return nil
+}
+
+func (f *Feed) Unsubscribe(ctx *context.Context, topic string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.subs[topic]--
+	return nil
+}
+
+func (f *Feed) Publish(ctx *context.Context, args *Args) error {
+	f.mu.Lock()
+	client := f.clients["sums"]
+	f.mu.Unlock()
+	return client.Call(ctx, "Receiver.Push", args, nil)
+}
+
+type Receiver struct {
+	mux *SubscriptionMux
+}
+
+func (r *Receiver) Push(ctx *context.Context, args *Args) error {
+	r.mux.Deliver("sums", args.A+args.B)
+	return nil
+}
+
+func TestSubscriptionMux(t *testing.T) {
+	feed := &Feed{subs: make(map[string]int), clients: make(map[string]ClientConnector)}
+	server := NewBirpcServer()
+	server.Register(feed, NoReplyMethods())
+	client := NewBirpcClient(newBirpcPipe(t, server))
+	defer client.Close()
+	mux := NewSubscriptionMux(client, "Feed.Subscribe", "Feed.Unsubscribe")
+	client.Register(&Receiver{mux: mux}, NoReplyMethods())
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	received := make([]int, 3)
+	var cancels []func(*context.Context) error
+	var wg sync.WaitGroup
+	for i := range received {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cancel, err := mux.Subscribe(ctx, "sums", func(msg interface{}) {
+				mu.Lock()
+				received[i] += msg.(int)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			cancels = append(cancels, cancel)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	if feed.subs["sums"] != 1 || feed.calls != 1 || mux.Subscribers("sums") != 3 {
+		t.Fatalf("expected one subscription on the server for 3 local ones, got %v after %d calls", feed.subs, feed.calls)
+	}
+	if err := client.Call(ctx, "Feed.Publish", &Args{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	for _, r := range received {
+		if r != 3 {
+			t.Errorf("expected every subscriber to receive the push once, got %v", received)
+		}
+	}
+	mu.Unlock()
+
+	for i, cancel := range cancels {
+		if err := cancel(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if subscribed := feed.subs["sums"]; subscribed != 1 && i < 2 {
+			t.Errorf("expected the subscription to stay with %d local ones", 2-i)
+		}
+	}
+	cancels[0](ctx) // cancelling twice does nothing
+	if feed.subs["sums"] != 0 || feed.calls != 2 || mux.Subscribers("sums") != 0 {
+		t.Errorf("expected the last one leaving to unsubscribe, got %v after %d calls", feed.subs, feed.calls)
+	}
+	if n := mux.Deliver("sums", 1); n != 0 {
+		t.Errorf("expected no subscribers left, got %d", n)
+	}
+
+	// a failed subscription leaves nothing behind
+	if _, err := mux.Subscribe(ctx, "sums", nil); err != nil {
+		t.Fatal(err)
+	}
+	bad := NewSubscriptionMux(client, "Feed.Missing", "Feed.Unsubscribe")
+	if _, err := bad.Subscribe(ctx, "sums", func(interface{}) {}); err == nil || bad.Subscribers("sums") != 0 {
+		t.Errorf("expected the subscription to fail, got %v", err)
+	}
+}
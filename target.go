@@ -0,0 +1,246 @@
+package birpc
+
+import (
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// Target describes how to reach a server. It is usually obtained by
+// parsing a target URI with ParseTarget.
+type Target struct {
+	Network string // network passed to the dialer
+	Address string // address passed to the dialer
+	Codec   string // name of a registered codec, "gob" if empty
+
+	// Negotiate declares the codec to the server in a preamble, see
+	// WritePreamble.
+	Negotiate bool
+
+	// Compression, if not nil, compresses the payloads, see Compression.
+	// The listener of the server must be configured alike.
+	Compression *Compression
+
+	// Timeout bounds the dial, including the TLS and HTTP handshakes.
+	Timeout time.Duration
+
+	// TLSConfig, if not nil, enables TLS on the connection.
+	TLSConfig *tls.Config
+
+	// HTTPPath, if set, connects through HTTP CONNECT on that path.
+	HTTPPath string
+
+	// Resolver, if not nil, resolves the host name of the TCP targets
+	// instead of net.DefaultResolver.
+	Resolver *net.Resolver
+}
+
+// ParseTarget parses a target URI of the form
+//
+//	scheme://host:port?codec=json&timeout=2s
+//	unix:///path/to/socket.sock
+//
+// The schemes are "birpc" (or "tcp") for plain TCP, "birpc+tls" (or
+// "tls") for TCP with TLS, "birpc+http" (or "http") for HTTP CONNECT and
+// "unix" for unix sockets. The HTTP path defaults to DefaultRPCPath. A
+// target without scheme is a TCP address. The query parameters are:
+//
+//	codec       name of a registered codec, gob by default
+//	timeout     dial timeout, e.g. "2s"
+//	servername  server name used to verify the TLS certificate
+//	negotiate   "true" to declare the codec to the server, see WritePreamble
+//	compress    name of a registered compressor, see Compression
+//	threshold   size of the smallest payload compressed, in bytes
+func ParseTarget(target string) (*Target, error) {
+	if !strings.Contains(target, "://") {
+		return &Target{Network: "tcp", Address: target}, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	t := new(Target)
+	switch u.Scheme {
+	case "birpc", "tcp":
+		t.Network, t.Address = "tcp", u.Host
+	case "birpc+tls", "tls":
+		t.Network, t.Address = "tcp", u.Host
+		t.TLSConfig = &tls.Config{ServerName: u.Hostname()}
+	case "birpc+http", "http":
+		t.Network, t.Address = "tcp", u.Host
+		t.HTTPPath = u.Path
+		if t.HTTPPath == "" {
+			t.HTTPPath = DefaultRPCPath
+		}
+	case "unix":
+		t.Network, t.Address = "unix", u.Host+u.Path
+	default:
+		return nil, errors.New("rpc: unsupported target scheme " + u.Scheme)
+	}
+	if t.Address == "" {
+		return nil, errors.New("rpc: target without address: " + target)
+	}
+	q := u.Query()
+	t.Codec = q.Get("codec")
+	if timeout := q.Get("timeout"); timeout != "" {
+		if t.Timeout, err = time.ParseDuration(timeout); err != nil {
+			return nil, errors.New("rpc: invalid target timeout: " + err.Error())
+		}
+	}
+	if negotiate := q.Get("negotiate"); negotiate != "" {
+		if t.Negotiate, err = strconv.ParseBool(negotiate); err != nil {
+			return nil, errors.New("rpc: invalid target negotiate: " + err.Error())
+		}
+	}
+	if compress := q.Get("compress"); compress != "" {
+		if _, err = getCompressor(compress); err != nil {
+			return nil, err
+		}
+		t.Compression = &Compression{Algorithm: compress}
+		if threshold := q.Get("threshold"); threshold != "" {
+			if t.Compression.Threshold, err = strconv.Atoi(threshold); err != nil {
+				return nil, errors.New("rpc: invalid target threshold: " + err.Error())
+			}
+		}
+	}
+	if serverName := q.Get("servername"); serverName != "" {
+		if t.TLSConfig == nil {
+			return nil, errors.New("rpc: servername requires a TLS target")
+		}
+		t.TLSConfig.ServerName = serverName
+	}
+	return t, nil
+}
+
+// DialConn connects to the target, completing the TLS and HTTP handshakes,
+// writing the preamble and enabling the compression if needed, and returns
+// the connection ready for a codec.
+func (t *Target) DialConn(ctx *context.Context) (conn net.Conn, err error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	if conn, err = t.dial(ctx); err != nil {
+		return
+	}
+	if deadline, has := ctx.Deadline(); has {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	if t.TLSConfig != nil {
+		tlsConn := tls.Client(conn, t.TLSConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if t.HTTPPath != "" {
+		if err = httpConnect(conn, t.HTTPPath); err != nil {
+			conn.Close()
+			return nil, &net.OpError{Op: "dial-http", Net: t.Network + " " + t.Address, Err: err}
+		}
+	}
+	if t.Negotiate {
+		if err = WritePreamble(conn, t.Codec); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if t.Compression != nil {
+		var compressed net.Conn
+		if compressed, err = t.Compression.Conn(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = compressed
+	}
+	return
+}
+
+// dial connects to the address of the target. The host name is resolved
+// at each dial, no address being kept, so the connections dialed again
+// after their recycling or failure follow the changes of DNS, like the
+// ones of the Kubernetes services. The addresses are tried in random
+// order, spreading the connections over them.
+func (t *Target) dial(ctx *context.Context) (net.Conn, error) {
+	var d net.Dialer
+	host, port, err := net.SplitHostPort(t.Address)
+	if t.Network != "tcp" || err != nil || host == "" || net.ParseIP(host) != nil {
+		return d.DialContext(ctx, t.Network, t.Address)
+	}
+	resolver := t.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("rpc: no addresses for target " + t.Address)
+	}
+	var conn net.Conn
+	for _, i := range rand.Perm(len(addrs)) {
+		if conn, err = d.DialContext(ctx, t.Network, net.JoinHostPort(addrs[i], port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// Dial connects to the target and returns a Client using its codec.
+func (t *Target) Dial(ctx *context.Context) (*Client, error) {
+	newCodec, err := getClientCodec(t.Codec)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.DialConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithCodec(newCodec(conn)), nil
+}
+
+// DialBirpc connects to the target and returns a BirpcClient using its
+// codec. HTTP targets are not supported by BirpcServer.
+func (t *Target) DialBirpc(ctx *context.Context) (*BirpcClient, error) {
+	if t.HTTPPath != "" {
+		return nil, errors.New("birpc: HTTP targets are not supported")
+	}
+	newCodec, err := getBirpcCodec(t.Codec)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.DialConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewBirpcClientWithCodec(newCodec(conn)), nil
+}
+
+// DialTarget parses the target URI, see ParseTarget, and connects to it.
+func DialTarget(ctx *context.Context, target string) (*Client, error) {
+	t, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dial(ctx)
+}
+
+// DialBirpcTarget is like DialTarget but returns a BirpcClient.
+func DialBirpcTarget(ctx *context.Context, target string) (*BirpcClient, error) {
+	t, err := ParseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return t.DialBirpc(ctx)
+}
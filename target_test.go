@@ -0,0 +1,189 @@
+package birpc
+
+import (
+	stdcontext "context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestParseTarget(t *testing.T) {
+	for target, exp := range map[string]Target{
+		"127.0.0.1:2012":                           {Network: "tcp", Address: "127.0.0.1:2012"},
+		"birpc://localhost:2012?codec=json":        {Network: "tcp", Address: "localhost:2012", Codec: "json"},
+		"tcp://localhost:2012?timeout=2s":          {Network: "tcp", Address: "localhost:2012", Timeout: 2 * time.Second},
+		"birpc+http://localhost:2080":              {Network: "tcp", Address: "localhost:2080", HTTPPath: DefaultRPCPath},
+		"http://localhost:2080/jsonrpc?codec=json": {Network: "tcp", Address: "localhost:2080", HTTPPath: "/jsonrpc", Codec: "json"},
+		"unix:///var/run/birpc.sock":               {Network: "unix", Address: "/var/run/birpc.sock"},
+		"unix://relative.sock":                     {Network: "unix", Address: "relative.sock"},
+		"birpc://localhost:2012?negotiate=true":    {Network: "tcp", Address: "localhost:2012", Negotiate: true},
+	} {
+		rcv, err := ParseTarget(target)
+		if err != nil {
+			t.Errorf("%s: %v", target, err)
+			continue
+		}
+		if *rcv != exp {
+			t.Errorf("%s: expected %+v, got %+v", target, exp, *rcv)
+		}
+	}
+
+	rcv, err := ParseTarget("birpc+tls://rater.local:2013?servername=rater&timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rcv.TLSConfig == nil || rcv.TLSConfig.ServerName != "rater" || rcv.Address != "rater.local:2013" || rcv.Timeout != time.Second {
+		t.Errorf("unexpected TLS target: %+v", rcv)
+	}
+
+	for _, target := range []string{
+		"ftp://localhost:21",
+		"birpc://",
+		"birpc://localhost:2012?timeout=soon",
+		"birpc://localhost:2012?servername=x",
+		"birpc://localhost:2012?negotiate=maybe",
+	} {
+		if _, err := ParseTarget(target); err == nil {
+			t.Errorf("%s: expected error", target)
+		}
+	}
+}
+
+func TestDialTarget(t *testing.T) {
+	once.Do(startServer)
+	ctx := context.Background()
+	args := &Args{7, 8}
+
+	client, err := DialTarget(ctx, "birpc+http://"+httpServerAddr+"?timeout=1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Add", args, reply); err != nil || reply.C != 15 {
+		t.Errorf("Add over HTTP: %v %v", reply.C, err)
+	}
+	client.Close()
+
+	sock := filepath.Join(t.TempDir(), "birpc.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(sock)
+	defer l.Close()
+	go Accept(l)
+	if client, err = DialTarget(ctx, "unix://"+sock); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reply = new(Reply)
+	if err = client.Call(ctx, "Arith.Mul", args, reply); err != nil || reply.C != 56 {
+		t.Errorf("Mul over unix socket: %v %v", reply.C, err)
+	}
+
+	if _, err = DialTarget(ctx, "birpc://"+serverAddr+"?codec=xml"); err == nil {
+		t.Error("expected error for unknown codec")
+	}
+}
+
+// fakeDNS answers the A queries over the connections of its Resolver
+// with the current IP, and the other ones with no records.
+type fakeDNS struct {
+	mu sync.Mutex
+	ip net.IP
+}
+
+func (f *fakeDNS) setIP(ip string) {
+	f.mu.Lock()
+	f.ip = net.ParseIP(ip).To4()
+	f.mu.Unlock()
+}
+
+func (f *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{PreferGo: true, Dial: func(_ stdcontext.Context, _, _ string) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go f.serve(c2)
+		return c1, nil
+	}}
+}
+
+// serve answers the queries of conn, framed as over TCP.
+func (f *fakeDNS) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		query := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		end := 12 // the question follows the header
+		for query[end] != 0 {
+			end += int(query[end]) + 1
+		}
+		question := query[12 : end+5]
+		resp := append([]byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}, question...)
+		if binary.BigEndian.Uint16(question[len(question)-4:]) == 1 { // A
+			f.mu.Lock()
+			resp[7] = 1
+			resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4)
+			resp = append(resp, f.ip...)
+			f.mu.Unlock()
+		}
+		binary.BigEndian.PutUint16(size[:], uint16(len(resp)))
+		if _, err := conn.Write(append(size[:], resp...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestDialResolvesAgain(t *testing.T) {
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	port := strconv.Itoa(l1.Addr().(*net.TCPAddr).Port)
+	l2, err := net.Listen("tcp", "127.0.0.2:"+port)
+	if err != nil {
+		t.Skip("cannot listen on a second loopback address:", err)
+	}
+	defer l2.Close()
+	accepted := make(chan string, 2)
+	for _, l := range []net.Listener{l1, l2} {
+		go func(l net.Listener) {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- l.Addr().String()
+				conn.Close()
+			}
+		}(l)
+	}
+
+	dns := new(fakeDNS)
+	target := &Target{Network: "tcp", Address: "rater.test:" + port, Resolver: dns.resolver()}
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2"} {
+		dns.setIP(ip)
+		conn, err := target.DialConn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if addr := <-accepted; addr != ip+":"+port {
+			t.Errorf("expected to connect to %s, got %s", ip, addr)
+		}
+	}
+}
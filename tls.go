@@ -0,0 +1,154 @@
+package birpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+)
+
+// VerifyClientCerts makes the TLS listeners of the server, see ServeTLS,
+// verify the certificates presented by the clients against cas. The
+// clients presenting none are served as well, see RequireClientCerts.
+func VerifyClientCerts(cas *x509.CertPool) ServerOption {
+	return func(server *basicServer) {
+		server.clientCAs = cas
+		server.clientAuth = tls.VerifyClientCertIfGiven
+	}
+}
+
+// RequireClientCerts is like VerifyClientCerts but rejects the clients
+// without a valid certificate.
+func RequireClientCerts(cas *x509.CertPool) ServerOption {
+	return func(server *basicServer) {
+		server.clientCAs = cas
+		server.clientAuth = tls.RequireAndVerifyClientCert
+	}
+}
+
+// tlsConfig returns a copy of config verifying the client certificates as
+// set by the server options.
+func (server *basicServer) tlsConfig(config *tls.Config) *tls.Config {
+	config = config.Clone()
+	if server.clientCAs != nil {
+		config.ClientCAs = server.clientCAs
+		config.ClientAuth = server.clientAuth
+	}
+	return config
+}
+
+// loadTLSConfig returns the config serving the certificate in certFile,
+// along with its intermediates, and its key in keyFile.
+func loadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// ServeTLS accepts the connections on lis and serves them over TLS with
+// config, verifying the client certificates as set by VerifyClientCerts
+// or RequireClientCerts. The methods find the state of the connections in
+// CallInfo.TLS. ServeTLS blocks like Accept.
+func (server *Server) ServeTLS(lis net.Listener, config *tls.Config) error {
+	return server.Accept(tls.NewListener(lis, server.tlsConfig(config)))
+}
+
+// ListenAndServeTLS listens on the network address and serves the
+// connections over TLS with the certificate in certFile and its key in
+// keyFile, see ServeTLS.
+func (server *Server) ListenAndServeTLS(network, address, certFile, keyFile string) error {
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	return server.ServeTLS(lis, config)
+}
+
+// ServeTLS is like Server.ServeTLS for BirpcServer.
+func (s *BirpcServer) ServeTLS(lis net.Listener, config *tls.Config) error {
+	return s.Accept(tls.NewListener(lis, s.tlsConfig(config)))
+}
+
+// ListenAndServeTLS is like Server.ListenAndServeTLS for BirpcServer.
+func (s *BirpcServer) ListenAndServeTLS(network, address, certFile, keyFile string) error {
+	config, err := loadTLSConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	defer lis.Close()
+	return s.ServeTLS(lis, config)
+}
+
+// DialTLS connects to an RPC server over TLS at the specified network
+// address. The client certificates are set in config.
+func DialTLS(network, address string, config *tls.Config) (*Client, error) {
+	conn, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// DialBirpcTLS is like DialTLS but returns a BirpcClient.
+func DialBirpcTLS(network, address string, config *tls.Config, opts ...ServerOption) (*BirpcClient, error) {
+	conn, err := tls.Dial(network, address, config)
+	if err != nil {
+		return nil, err
+	}
+	return NewBirpcClient(conn, opts...), nil
+}
+
+// PeerCertificate returns the certificate of the peer verified by the
+// TLS handshake, nil if the connection does not use TLS or the peer did
+// not present a certificate verified.
+func (info *CallInfo) PeerCertificate() *x509.Certificate {
+	if info.TLS == nil || len(info.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return info.TLS.VerifiedChains[0][0]
+}
+
+// peerTLS returns the TLS state of the connection of a codec implementing
+// TLSConnectionState() *tls.ConnectionState, or nil.
+func peerTLS(codec interface{}) *tls.ConnectionState {
+	if c, ok := codec.(interface{ TLSConnectionState() *tls.ConnectionState }); ok {
+		return c.TLSConnectionState()
+	}
+	return nil
+}
+
+// connWrapper is implemented by the connections wrapping another one.
+type connWrapper interface {
+	unwrapConn() net.Conn
+}
+
+// ConnTLSState returns the state of conn if it is a TLS connection done
+// with its handshake, or wraps one, for the codecs implementing
+// TLSConnectionState.
+func ConnTLSState(conn io.Closer) *tls.ConnectionState {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			state := c.ConnectionState()
+			if !state.HandshakeComplete {
+				return nil
+			}
+			return &state
+		case connWrapper:
+			conn = c.unwrapConn()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package birpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// testCert issues a certificate for name signed by parent, self-signed if
+// parent is nil.
+func testCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+type CertName struct{}
+
+func (CertName) Name(ctx *context.Context, args int, reply *string, info *CallInfo) error {
+	if cert := info.PeerCertificate(); cert != nil {
+		*reply = cert.Subject.CommonName
+	}
+	return nil
+}
+
+func TestServeTLS(t *testing.T) {
+	ca := testCert(t, "ca", nil)
+	serverCert := testCert(t, "server", &ca)
+	clientCert := testCert(t, "client-a", &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := NewServer(RequireClientCerts(pool))
+	server.Register(CertName{})
+	l, addr := listenTCP()
+	defer l.Close()
+	go server.ServeTLS(l, &tls.Config{Certificates: []tls.Certificate{serverCert}})
+
+	ctx := context.Background()
+	client, err := DialTLS("tcp", addr, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	var name string
+	if err = client.Call(ctx, "CertName.Name", 0, &name); err != nil || name != "client-a" {
+		t.Errorf("expected the identity client-a, got %q: %v", name, err)
+	}
+
+	// the clients without certificate are rejected
+	anonymous, err := DialTLS("tcp", addr, &tls.Config{RootCAs: pool})
+	if err == nil {
+		defer anonymous.Close()
+		err = anonymous.Call(ctx, "CertName.Name", 0, &name)
+	}
+	if err == nil {
+		t.Error("expected the client without certificate to be rejected")
+	}
+}
+
+func TestVerifyClientCertsBirpc(t *testing.T) {
+	ca := testCert(t, "ca", nil)
+	serverCert := testCert(t, "server", &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	server := NewBirpcServer(VerifyClientCerts(pool))
+	server.Register(CertName{})
+	l, addr := listenTCP()
+	defer l.Close()
+	go server.ServeTLS(l, &tls.Config{Certificates: []tls.Certificate{serverCert}})
+
+	// the clients without certificate are served without identity
+	client, err := DialBirpcTLS("tcp", addr, &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	name := "unset"
+	if err = client.Call(context.Background(), "CertName.Name", 0, &name); err != nil || name != "" {
+		t.Errorf("expected no identity, got %q: %v", name, err)
+	}
+}
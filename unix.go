@@ -0,0 +1,142 @@
+package birpc
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// UnixSocketConfig sets the permissions of the socket file created by
+// ListenUnix, letting the co-located agents connect without TCP.
+type UnixSocketConfig struct {
+	// Mode holds the octal permissions of the file, like "0660", those
+	// left by the umask if empty.
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Owner and Group are the names or the IDs of the user and of the
+	// group owning the file, unchanged if empty.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+}
+
+// Validate checks the permissions for errors, without looking the owner
+// and the group up.
+func (sock *UnixSocketConfig) Validate() error {
+	_, err := sock.mode()
+	return err
+}
+
+func (sock *UnixSocketConfig) mode() (os.FileMode, error) {
+	if sock.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(sock.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.New("rpc: invalid socket mode " + sock.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ids returns the IDs of the owner and of the group, -1 for those unset.
+func (sock *UnixSocketConfig) ids() (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if sock.Owner != "" {
+		if uid, err = strconv.Atoi(sock.Owner); err != nil {
+			var u *user.User
+			if u, err = user.Lookup(sock.Owner); err != nil {
+				return
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return
+			}
+		}
+	}
+	if sock.Group != "" {
+		if gid, err = strconv.Atoi(sock.Group); err != nil {
+			var g *user.Group
+			if g, err = user.LookupGroup(sock.Group); err != nil {
+				return
+			}
+			gid, err = strconv.Atoi(g.Gid)
+		}
+	}
+	return
+}
+
+// ListenUnix listens on the unix socket at path, applying the permissions
+// of sock, if not nil, to the socket file. A file left at path by a
+// process which is gone is removed first. The file is removed when the
+// listener is closed.
+func ListenUnix(path string, sock *UnixSocketConfig) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if sock != nil {
+		if err = sock.apply(path); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// apply sets the permissions of the socket file at path.
+func (sock *UnixSocketConfig) apply(path string) error {
+	mode, err := sock.mode()
+	if err != nil {
+		return err
+	}
+	uid, gid, err := sock.ids()
+	if err != nil {
+		return err
+	}
+	if uid != -1 || gid != -1 {
+		if err = os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	if mode != 0 {
+		return os.Chmod(path, mode)
+	}
+	return nil
+}
+
+// removeStaleSocket removes the socket file at path unless a process is
+// listening on it. The other files are left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return errors.New("rpc: " + path + " exists and is not a socket")
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return errors.New("rpc: " + path + " is in use")
+	}
+	return os.Remove(path)
+}
+
+// DialUnix connects to an RPC server on the unix socket at path.
+func DialUnix(path string) (*Client, error) {
+	return Dial("unix", path)
+}
+
+// DialBirpcUnix is like DialUnix but returns a BirpcClient.
+func DialBirpcUnix(path string, opts ...ServerOption) (*BirpcClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewBirpcClient(conn, opts...), nil
+}
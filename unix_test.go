@@ -0,0 +1,75 @@
+package birpc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "birpc.sock")
+	l, err := ListenUnix(path, &UnixSocketConfig{Mode: "0600", Group: strconv.Itoa(os.Getgid())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("expected the socket mode 0600, got %v: %v", fi.Mode().Perm(), err)
+	}
+	if _, err = ListenUnix(path, nil); err == nil {
+		t.Error("expected the socket in use to be kept")
+	}
+
+	server := NewServer()
+	server.Register(new(Arith))
+	go server.Accept(l)
+	client, err := DialUnix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := new(Reply)
+	if err = client.Call(context.Background(), "Arith.Add", Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("expected 3, got %d: %v", reply.C, err)
+	}
+	client.Close()
+	l.Close()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the socket to be removed, got %v", err)
+	}
+
+	// the sockets left behind are replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	if l, err = ListenUnix(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// the other files are not
+	if err = ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ListenUnix(path, nil); err == nil {
+		t.Error("expected the regular file to be kept")
+	}
+}
+
+func TestValidateUnixSocket(t *testing.T) {
+	for _, lc := range []ListenerConfig{
+		{Address: "127.0.0.1:2012", Socket: &UnixSocketConfig{Mode: "0660"}},
+		{Network: "unix", Address: "/tmp/birpc.sock", Socket: &UnixSocketConfig{Mode: "0999"}},
+	} {
+		cfg := Config{Listeners: []ListenerConfig{lc}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", lc)
+		}
+	}
+}
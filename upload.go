@@ -0,0 +1,207 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+var typeOfUpload = reflect.TypeOf((*Upload)(nil))
+
+// errUploadServed is returned for the uploads sent to ServeRequest, which
+// reads a single message.
+var errUploadServed = errors.New("rpc: uploads need a served connection")
+
+// Upload is the argument of the methods consuming a sequence of items sent
+// by the caller of a single request:
+//
+//	func (t *T) Load(ctx *context.Context, upload *birpc.Upload, reply *T2) error
+//
+// The method takes the items with Recv, in the order they were sent, and
+// replies once it returns. The clients send them with OpenUpload, and
+// with OpenDuplex to the methods also replying with a Stream.
+//
+// The connection is not read while an item waits for the method to take
+// it, so the methods should take the items as they come.
+type Upload struct {
+	ctx  *context.Context
+	dest chan interface{} // values given to Recv, taken by the reading goroutine
+	res  chan error       // result of decoding into the value taken from dest
+	end  chan struct{}    // closed when the client ended the upload
+	done chan struct{}    // closed when the method returned
+	eof  bool
+}
+
+// Recv decodes the next item into v, which must be a pointer. It returns
+// io.EOF once the client ended the upload, or the error of the context of
+// the call once it is canceled.
+func (u *Upload) Recv(v interface{}) error {
+	if u.eof {
+		return io.EOF
+	}
+	select {
+	case u.dest <- v:
+		return <-u.res
+	case <-u.end:
+		u.eof = true
+		return io.EOF
+	case <-u.ctx.Done():
+		return u.ctx.Err()
+	}
+}
+
+// openUpload returns the Upload of the call of seq, whose items are read
+// by readUploadItem.
+func (conn *serverConn) openUpload(seq uint64) *Upload {
+	u := &Upload{
+		dest: make(chan interface{}),
+		res:  make(chan error),
+		end:  make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	conn.uploadsMu.Lock()
+	if conn.uploads == nil {
+		conn.uploads = make(map[uint64]*Upload)
+	}
+	conn.uploads[seq] = u
+	conn.uploadsMu.Unlock()
+	return u
+}
+
+// closeUpload releases the Upload of the call of seq once the method
+// returned, discarding the items that follow.
+func (conn *serverConn) closeUpload(seq uint64) {
+	conn.uploadsMu.Lock()
+	u := conn.uploads[seq]
+	delete(conn.uploads, seq)
+	conn.uploadsMu.Unlock()
+	if u != nil {
+		close(u.done)
+	}
+}
+
+// readUploadItem reads the body of req, an item or the end of an upload,
+// handing it to the method taking the items. The items of the uploads
+// which are no longer consumed are discarded.
+func (conn *serverConn) readUploadItem(codec interface{ ReadRequestBody(interface{}) error }, req *Request) {
+	conn.uploadsMu.Lock()
+	u := conn.uploads[req.Seq]
+	if req.End {
+		delete(conn.uploads, req.Seq)
+	}
+	conn.uploadsMu.Unlock()
+	if u == nil || req.End {
+		codec.ReadRequestBody(nil)
+		if u != nil {
+			close(u.end)
+		}
+		return
+	}
+	select {
+	case v := <-u.dest:
+		u.res <- codec.ReadRequestBody(v)
+	case <-u.done:
+		codec.ReadRequestBody(nil)
+	}
+}
+
+// UploadConnector is a ClientConnector which can send uploads, such as
+// Client and BirpcClient.
+type UploadConnector interface {
+	ClientConnector
+	OpenUpload(ctx *context.Context, serviceMethod string, reply interface{}) *ClientUpload
+}
+
+// ClientUpload sends the items of an upload, see Upload.
+type ClientUpload struct {
+	client *basicClient
+	call   *Call
+	ctx    *context.Context
+	ended  bool
+}
+
+// OpenUpload calls the method serviceMethod taking an Upload, returning
+// the ClientUpload sending its items. The reply is decoded into reply
+// once the upload is ended with CloseAndRecv, which also returns the
+// errors of the call. Canceling ctx cancels the call.
+//
+// The request is written right away, ahead of the calls waiting in the
+// SendQueue.
+func (client *basicClient) OpenUpload(ctx *context.Context, serviceMethod string, reply interface{}) *ClientUpload {
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          ackReply,
+		Reply:         reply,
+		Done:          make(chan *Call, 2), // 2 for this call and cancel
+		depth:         nextCallDepth(ctx),
+		ctx:           ctx,
+		Enqueued:      time.Now(),
+	}
+	client.send(call)
+	return &ClientUpload{client: client, call: call, ctx: ctx}
+}
+
+// isPending reports whether call waits for its response.
+func (client *basicClient) isPending(call *Call) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return call.seq != 0 && client.pending[call.seq] == call
+}
+
+// Send sends the item v. It fails with ErrStreamClosed once the method
+// returned, whose reply or error is given by CloseAndRecv.
+func (u *ClientUpload) Send(v interface{}) error {
+	if err := u.ctx.Err(); err != nil {
+		return err
+	}
+	if u.ended || !u.client.isPending(u.call) {
+		return ErrStreamClosed
+	}
+	return u.client.writeUploadItem(u.call, false, v)
+}
+
+// CloseAndRecv ends the upload and waits for the reply of the method.
+func (u *ClientUpload) CloseAndRecv() error {
+	if err := u.ctx.Err(); err != nil {
+		u.client.abandon(u.call)
+		return err
+	}
+	if err := u.end(); err != nil {
+		return err
+	}
+	select {
+	case call := <-u.call.Done:
+		return call.Error
+	case <-u.ctx.Done():
+		u.client.abandon(u.call)
+		return u.ctx.Err()
+	}
+}
+
+// end ends the items sent, unless the method returned already.
+func (u *ClientUpload) end() error {
+	if u.ended || !u.client.isPending(u.call) {
+		return nil
+	}
+	u.ended = true
+	return u.client.writeUploadItem(u.call, true, ackReply)
+}
+
+// writeUploadItem writes an item of the upload of call, or its end.
+func (client *basicClient) writeUploadItem(call *Call, end bool, v interface{}) error {
+	client.reqMutex.Lock()
+	defer client.reqMutex.Unlock()
+	if client.isShutdown() {
+		return ErrShutdown
+	}
+	req := Request{
+		ServiceMethod: call.ServiceMethod,
+		Seq:           call.seq,
+		Item:          !end,
+		End:           end,
+	}
+	return client.wc.WriteRequest(&req, v)
+}
@@ -0,0 +1,95 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type RatingRate struct {
+	Prefix string
+	Price  float64
+}
+
+type RatingLoader struct{}
+
+// Load sums the prices of the rates, failing on the ones without prefix.
+func (RatingLoader) Load(ctx *context.Context, upload *Upload, total *float64) error {
+	for {
+		var rate RatingRate
+		if err := upload.Recv(&rate); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if rate.Prefix == "" {
+			return errors.New("missing prefix")
+		}
+		*total += rate.Price
+	}
+}
+
+func TestUpload(t *testing.T) {
+	server := NewServer()
+	server.Register(RatingLoader{})
+	bserver := NewBirpcServer()
+	bserver.Register(RatingLoader{})
+
+	for name, client := range map[string]UploadConnector{
+		"Client":      newPipeClient(t, server),
+		"BirpcClient": NewBirpcClient(newBirpcPipe(t, bserver)),
+	} {
+		for i := 0; i < 2; i++ {
+			var total float64
+			upload := client.OpenUpload(context.Background(), "RatingLoader.Load", &total)
+			for j := 0; j < 100; j++ {
+				if err := upload.Send(&RatingRate{Prefix: "49", Price: 0.5}); err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+			}
+			if err := upload.CloseAndRecv(); err != nil || total != 50 {
+				t.Errorf("%s: unexpected total %v: %v", name, total, err)
+			}
+		}
+
+		// the method ends the upload early
+		var total float64
+		upload := client.OpenUpload(context.Background(), "RatingLoader.Load", &total)
+		upload.Send(&RatingRate{Prefix: "49", Price: 1})
+		upload.Send(&RatingRate{})
+		for j := 0; j < 10; j++ {
+			upload.Send(&RatingRate{Prefix: "49", Price: 1})
+		}
+		if err := upload.CloseAndRecv(); err == nil || err.Error() != "missing prefix" {
+			t.Errorf("%s: expected the error of the method, got %v", name, err)
+		}
+
+		// the connection is still usable
+		upload = client.OpenUpload(context.Background(), "RatingLoader.Load", &total)
+		if err := upload.CloseAndRecv(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestUploadCancel(t *testing.T) {
+	server := NewServer()
+	server.Register(RatingLoader{})
+	client := newPipeClient(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var total float64
+	upload := client.OpenUpload(ctx, "RatingLoader.Load", &total)
+	if err := upload.Send(&RatingRate{Prefix: "49", Price: 1}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := upload.Send(&RatingRate{Prefix: "49", Price: 1}); err != context.Canceled {
+		t.Errorf("expected Canceled, got %v", err)
+	}
+	if err := upload.CloseAndRecv(); err != context.Canceled {
+		t.Errorf("expected Canceled, got %v", err)
+	}
+}
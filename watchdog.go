@@ -0,0 +1,97 @@
+package birpc
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+)
+
+// StallReport describes a stall detected by StallWatchdog.
+type StallReport struct {
+	Since      time.Time // last response written, or oldest pending call started
+	Pending    int       // calls pending on all the connections
+	Goroutines []byte    // goroutine profile captured at detection, in text form
+}
+
+// StallWatchdog makes the server watch for stalls of its dispatch: when
+// calls are pending but no response was written for the duration after,
+// onStall is called with the goroutines of the process, catching a stuck
+// write or codec without waiting for the clients to complain. It is called
+// once per stall, a response being written ends the stall. The watchdog
+// stops on Shutdown. StallWatchdog panics if after is not positive.
+func StallWatchdog(after time.Duration, onStall func(StallReport)) ServerOption {
+	if after <= 0 {
+		panic("rpc: StallWatchdog needs a positive duration")
+	}
+	return func(server *basicServer) {
+		server.watchdog = &watchdog{after: after, onStall: onStall}
+		go server.watch()
+	}
+}
+
+type watchdog struct {
+	lastWrite int64 // UnixNano of the last response written, first to be aligned
+	after     time.Duration
+	onStall   func(StallReport)
+	stalled   int32 // a stall is in progress, see LivenessHandler
+}
+
+// responseWritten records a response written for the watchdog, if any.
+func (server *basicServer) responseWritten() {
+	if wd := server.watchdog; wd != nil {
+		atomic.StoreInt64(&wd.lastWrite, time.Now().UnixNano())
+	}
+}
+
+// watch checks for stalls a few times per period of the watchdog, until
+// Shutdown.
+func (server *basicServer) watch() {
+	wd := server.watchdog
+	period := wd.after / 4
+	if period <= 0 {
+		period = wd.after
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	var reported time.Time // since of the stall reported last
+	for {
+		var now time.Time
+		select {
+		case now = <-ticker.C:
+		case <-server.stopped:
+			return
+		}
+		var pending int
+		var oldest time.Time
+		server.connSet.Range(func(key, _ interface{}) bool {
+			for _, call := range key.(*serverConn).pending.Calls() {
+				pending++
+				if oldest.IsZero() || call.Started.Before(oldest) {
+					oldest = call.Started
+				}
+			}
+			return true
+		})
+		if pending == 0 {
+			atomic.StoreInt32(&wd.stalled, 0)
+			continue
+		}
+		since := time.Unix(0, atomic.LoadInt64(&wd.lastWrite))
+		if oldest.After(since) {
+			since = oldest
+		}
+		if now.Sub(since) < wd.after {
+			atomic.StoreInt32(&wd.stalled, 0)
+			continue
+		}
+		atomic.StoreInt32(&wd.stalled, 1)
+		if !reported.Before(since) {
+			continue
+		}
+		reported = since
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		wd.onStall(StallReport{Since: since, Pending: pending, Goroutines: buf.Bytes()})
+	}
+}
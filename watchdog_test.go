@@ -0,0 +1,66 @@
+package birpc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestStallWatchdog(t *testing.T) {
+	reports := make(chan StallReport, 10)
+	server := NewServer(StallWatchdog(20*time.Millisecond, func(r StallReport) { reports <- r }))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	client := newPipeClient(t, server)
+
+	call := client.Go("Blocker.Hold", 1, nil, nil)
+	select {
+	case r := <-reports:
+		if r.Pending != 1 || time.Since(r.Since) < 20*time.Millisecond {
+			t.Errorf("unexpected report %+v", r)
+		}
+		if !bytes.Contains(r.Goroutines, []byte("Blocker).Hold")) {
+			t.Errorf("expected the stuck call in the goroutines:\n%s", r.Goroutines)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stall not detected")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if len(reports) != 0 {
+		t.Errorf("expected the stall reported once, got %d more reports", len(reports))
+	}
+
+	close(blocker.release)
+	<-call.Done
+	time.Sleep(60 * time.Millisecond)
+	if len(reports) != 0 {
+		t.Errorf("unexpected reports without pending calls")
+	}
+}
+
+func TestStallWatchdogShutdown(t *testing.T) {
+	before := serverGoroutines("watch")
+	server := NewServer(StallWatchdog(time.Nanosecond, func(StallReport) {}))
+	if !eventually(func() bool { return serverGoroutines("watch") == before+1 }) {
+		t.Fatal("expected the watchdog running")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return serverGoroutines("watch") == before }) {
+		t.Fatal("expected the watchdog stopped on Shutdown")
+	}
+}
+
+func TestStallWatchdogBadDuration(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected StallWatchdog(0) to panic")
+		}
+	}()
+	StallWatchdog(0, func(StallReport) {})
+}
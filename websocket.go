@@ -0,0 +1,342 @@
+package birpc
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// websocketGUID is appended to the keys of the WebSocket handshakes, see
+// RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// The opcodes of the WebSocket frames.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+var errWebsocketFrame = errors.New("rpc: invalid websocket frame")
+
+// UpgradeWebsocket answers the WebSocket handshake of r and returns the
+// connection, ready for a codec. Each write to the connection is sent as
+// a text message, the messages received being read as a stream. The
+// Origin of the request is not checked, which is left to the caller.
+func UpgradeWebsocket(w http.ResponseWriter, r *http.Request) (net.Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerHas(r.Header, "Connection", "upgrade") ||
+		!headerHas(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errors.New("rpc: not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("rpc: unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("rpc: missing websocket key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("rpc: response cannot be hijacked")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	_, err = io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: "+websocketAccept(key)+"\r\n\r\n")
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocketConn{Conn: conn, br: brw.Reader}, nil
+}
+
+// DialWebsocketConn connects to the WebSocket endpoint at rawurl, of
+// scheme "ws" or "wss", sending header along with the handshake, and
+// returns the connection like UpgradeWebsocket.
+func DialWebsocketConn(ctx *context.Context, rawurl string, header http.Header) (net.Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "wss":
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+	default:
+		return nil, errors.New("rpc: unsupported websocket scheme " + u.Scheme)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, has := ctx.Deadline(); has {
+		conn.SetDeadline(deadline)
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err = tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	wsConn, err := websocketHandshake(conn, u, header)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return wsConn, nil
+}
+
+// websocketHandshake sends the opening handshake of the client on conn.
+func websocketHandshake(conn net.Conn, u *url.URL, header http.Header) (net.Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, errors.New("rpc: unexpected websocket handshake response: " + resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, errors.New("rpc: invalid websocket handshake accept")
+	}
+	return &websocketConn{Conn: conn, br: br, client: true}, nil
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerHas reports whether the comma separated values of the header name
+// contain token.
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// websocketConn carries a stream over the messages of a WebSocket
+// connection.
+type websocketConn struct {
+	net.Conn
+	br     *bufio.Reader
+	client bool // masks the frames written, and expects unmasked ones
+
+	// the frame being read, used by the reading goroutine
+	remaining uint64
+	mask      [4]byte
+	masked    bool
+	pos       int
+
+	wmu    sync.Mutex
+	closed bool // a close frame was sent
+}
+
+func (c *websocketConn) unwrapConn() net.Conn { return c.Conn }
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	if c.masked {
+		for i := range p[:n] {
+			p[i] ^= c.mask[(c.pos+i)%4]
+		}
+	}
+	c.pos += n
+	c.remaining -= uint64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readHeader reads the header of the next frame, answering the control
+// frames.
+func (c *websocketConn) readHeader() error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return err
+	}
+	fin, opcode := hdr[0]&0x80 != 0, hdr[0]&0x0f
+	c.masked = hdr[1]&0x80 != 0
+	if c.masked == c.client || hdr[0]&0x70 != 0 {
+		// the clients mask their frames and the servers do not
+		return errWebsocketFrame
+	}
+	size := uint64(hdr[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if c.masked {
+		if _, err := io.ReadFull(c.br, c.mask[:]); err != nil {
+			return err
+		}
+	}
+	c.pos, c.remaining = 0, size
+	switch opcode {
+	case wsContinuation, wsText, wsBinary:
+		return nil
+	case wsClose, wsPing, wsPong:
+		if !fin || size > 125 {
+			return errWebsocketFrame
+		}
+	default:
+		return errWebsocketFrame
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return err
+	}
+	c.remaining = 0
+	if c.masked {
+		for i := range payload {
+			payload[i] ^= c.mask[i%4]
+		}
+	}
+	switch opcode {
+	case wsClose:
+		c.writeFrame(wsClose, payload)
+		return io.EOF
+	case wsPing:
+		return c.writeFrame(wsPong, payload)
+	}
+	return nil
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame writes payload as a single frame.
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 2, 14+len(payload))
+	frame[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = append(frame, byte(n>>8), byte(n))
+	default:
+		frame[1] = 127
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, ext[:]...)
+	}
+	if c.client {
+		frame[1] |= 0x80
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	if opcode == wsClose {
+		c.closed = true
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame before closing the connection.
+func (c *websocketConn) Close() error {
+	c.writeFrame(wsClose, []byte{0x03, 0xe8}) // normal closure
+	return c.Conn.Close()
+}
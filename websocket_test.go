@@ -0,0 +1,54 @@
+package birpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestWebsocket(t *testing.T) {
+	server := NewServer()
+	server.Register(new(Arith))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := UpgradeWebsocket(w, r)
+		if err != nil {
+			return
+		}
+		server.ServeConn(conn)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	conn, err := DialWebsocketConn(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/rpc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(conn)
+	defer client.Close()
+	reply := new(Reply)
+	if err = client.Call(ctx, "Arith.Add", &Args{1, 2}, reply); err != nil || reply.C != 3 {
+		t.Errorf("Add: %v %v", reply.C, err)
+	}
+
+	// the pings are answered between the messages
+	if err = conn.(*websocketConn).writeFrame(wsPing, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	large := "7" + strings.Repeat(" ", 100000)
+	if err = client.Call(ctx, "Arith.Scan", large, reply); err != nil || reply.C != 7 {
+		t.Errorf("Scan: %v %v", reply.C, err)
+	}
+
+	// plain HTTP requests are refused
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
@@ -0,0 +1,225 @@
+// Package wiretest catches the accidental changes of the wire formats of
+// the codecs by comparing their encodings of representative calls with
+// golden files. The downstream packages check their own codecs and types
+// alike:
+//
+//	var update = flag.Bool("update", false, "update the golden files")
+//
+//	func TestWireFormat(t *testing.T) {
+//		codec := wiretest.Codec{Name: "json", NewClientCodec: jsonrpc.NewClientCodec, NewServerCodec: jsonrpc.NewServerCodec}
+//		if err := wiretest.Check("testdata", codec, wiretest.Fixtures(), *update); err != nil {
+//			t.Error(err)
+//		}
+//	}
+//
+// The golden files are written by the first check, and by the checks
+// asked to update them.
+package wiretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/cgrates/birpc"
+)
+
+// Codec is a pair of client and server codecs sharing a wire format.
+type Codec struct {
+	Name           string // names the directory of the golden files
+	NewClientCodec func(io.ReadWriteCloser) birpc.ClientCodec
+	NewServerCodec func(io.ReadWriteCloser) birpc.ServerCodec
+}
+
+// Fixture is a representative call: its request, and its response
+// carrying either Reply or Error. The metadata are best kept to a key, as
+// some encodings of the maps are not ordered.
+type Fixture struct {
+	Name          string // names the golden files
+	ServiceMethod string
+	Args          interface{}
+	Reply         interface{} // a value, not a pointer
+	Error         string
+	Metadata      birpc.Metadata // sent along with the request
+	ReplyMetadata birpc.Metadata // sent along with the response
+}
+
+// Account, AccountArgs and DebitArgs are the types of the calls of
+// Fixtures.
+type Account struct {
+	Tenant   string
+	ID       string
+	Balance  float64
+	Units    int64
+	Tags     []string
+	Disabled bool
+}
+
+type AccountArgs struct {
+	Tenant string
+	ID     string
+}
+
+type DebitArgs struct {
+	AccountArgs
+	Amount float64
+}
+
+// Fixtures returns the calls covering the common shapes: a struct reply,
+// an error, scalar arguments and reply, and metadata.
+func Fixtures() []Fixture {
+	return []Fixture{
+		{
+			Name:          "struct_reply",
+			ServiceMethod: "Accounts.Get",
+			Args:          AccountArgs{Tenant: "cgrates.org", ID: "1001"},
+			Reply: Account{Tenant: "cgrates.org", ID: "1001", Balance: 10.5, Units: 3600,
+				Tags: []string{"prepaid", "voice"}},
+		},
+		{
+			Name:          "error",
+			ServiceMethod: "Accounts.Debit",
+			Args:          DebitArgs{AccountArgs: AccountArgs{Tenant: "cgrates.org", ID: "1001"}, Amount: 12.5},
+			Error:         "insufficient balance",
+		},
+		{
+			Name:          "scalar",
+			ServiceMethod: "Accounts.Status",
+			Args:          "1001",
+			Reply:         "active",
+		},
+		{
+			Name:          "metadata",
+			ServiceMethod: "Accounts.Get",
+			Args:          AccountArgs{Tenant: "cgrates.org", ID: "1001"},
+			Reply:         Account{Tenant: "cgrates.org", ID: "1001"},
+			Metadata:      birpc.Metadata{"trace_id": "4bf92f3577b34da6"},
+			ReplyMetadata: birpc.Metadata{"served_by": "node1"},
+		},
+	}
+}
+
+// Exchange holds the encodings of the request and of the response of a
+// call.
+type Exchange struct {
+	Request  []byte
+	Response []byte
+}
+
+// bufConn is a connection reading from r and writing to w.
+type bufConn struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (c bufConn) Read(p []byte) (int, error)  { return c.r.Read(p) }
+func (c bufConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+func (c bufConn) Close() error                { return nil }
+
+// Encode encodes the call of f with the codecs of c, the request by the
+// client codec and the response by the server codec, checking that the
+// other side decodes them back.
+func Encode(c Codec, f Fixture) (ex Exchange, err error) {
+	var reqBuf, respBuf bytes.Buffer
+	client := c.NewClientCodec(bufConn{r: &respBuf, w: &reqBuf})
+	server := c.NewServerCodec(bufConn{r: &reqBuf, w: &respBuf})
+	defer client.Close()
+	defer server.Close()
+
+	if err = client.WriteRequest(&birpc.Request{ServiceMethod: f.ServiceMethod, Seq: 1, Metadata: f.Metadata}, f.Args); err != nil {
+		return ex, fmt.Errorf("writing the request: %v", err)
+	}
+	ex.Request = append([]byte(nil), reqBuf.Bytes()...)
+	var req birpc.Request
+	if err = server.ReadRequestHeader(&req); err != nil {
+		return ex, fmt.Errorf("reading the request: %v", err)
+	}
+	args := reflect.New(reflect.TypeOf(f.Args))
+	if err = server.ReadRequestBody(args.Interface()); err != nil {
+		return ex, fmt.Errorf("reading the arguments: %v", err)
+	}
+	if req.ServiceMethod != f.ServiceMethod || !reflect.DeepEqual(args.Elem().Interface(), f.Args) ||
+		!sameMetadata(req.Metadata, f.Metadata) {
+		return ex, fmt.Errorf("request decoded as %s %+v %v", req.ServiceMethod, args.Elem().Interface(), req.Metadata)
+	}
+
+	body := f.Reply
+	if f.Error != "" {
+		body = struct{}{}
+	}
+	if err = server.WriteResponse(&birpc.Response{Seq: req.Seq, Error: f.Error, Metadata: f.ReplyMetadata}, body); err != nil {
+		return ex, fmt.Errorf("writing the response: %v", err)
+	}
+	ex.Response = append([]byte(nil), respBuf.Bytes()...)
+	var resp birpc.Response
+	if err = client.ReadResponseHeader(&resp); err != nil {
+		return ex, fmt.Errorf("reading the response: %v", err)
+	}
+	if resp.Seq != 1 || resp.Error != f.Error || !sameMetadata(resp.Metadata, f.ReplyMetadata) {
+		return ex, fmt.Errorf("response decoded as %+v", resp)
+	}
+	if f.Error != "" {
+		return ex, client.ReadResponseBody(nil)
+	}
+	reply := reflect.New(reflect.TypeOf(f.Reply))
+	if err = client.ReadResponseBody(reply.Interface()); err != nil {
+		return ex, fmt.Errorf("reading the reply: %v", err)
+	}
+	if !reflect.DeepEqual(reply.Elem().Interface(), f.Reply) {
+		return ex, fmt.Errorf("reply decoded as %+v", reply.Elem().Interface())
+	}
+	return ex, nil
+}
+
+// sameMetadata reports whether the metadata decoded are the ones sent, nil
+// and empty alike.
+func sameMetadata(decoded, sent birpc.Metadata) bool {
+	return len(decoded) == len(sent) && (len(sent) == 0 || reflect.DeepEqual(decoded, sent))
+}
+
+// Check compares the encodings of fixtures by c with the golden files in
+// dir/<codec name>, <fixture>.request and <fixture>.response, writing the
+// files which are missing, or all of them if update is set. The error
+// lists the fixtures whose encodings changed.
+func Check(dir string, c Codec, fixtures []Fixture, update bool) error {
+	dir = filepath.Join(dir, c.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var changed []string
+	for _, f := range fixtures {
+		ex, err := Encode(c, f)
+		if err != nil {
+			return fmt.Errorf("wiretest: %s %s: %v", c.Name, f.Name, err)
+		}
+		for _, golden := range []struct {
+			ext  string
+			data []byte
+		}{{".request", ex.Request}, {".response", ex.Response}} {
+			path := filepath.Join(dir, f.Name+golden.ext)
+			want, err := ioutil.ReadFile(path)
+			if update || os.IsNotExist(err) {
+				if err = ioutil.WriteFile(path, golden.data, 0644); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(want, golden.data) {
+				changed = append(changed, f.Name+golden.ext)
+			}
+		}
+	}
+	if len(changed) != 0 {
+		return errors.New("wiretest: the " + c.Name + " wire format changed: " + strings.Join(changed, ", "))
+	}
+	return nil
+}
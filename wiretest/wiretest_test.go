@@ -0,0 +1,54 @@
+package wiretest
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cgrates/birpc"
+	"github.com/cgrates/birpc/jsonrpc"
+	"github.com/cgrates/birpc/jsonrpc2"
+	"github.com/cgrates/birpc/msgpackrpc"
+	"github.com/cgrates/birpc/protorpc"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var codecs = []Codec{
+	{Name: "gob", NewClientCodec: birpc.NewClientCodec, NewServerCodec: birpc.NewServerCodec},
+	{Name: "json", NewClientCodec: jsonrpc.NewClientCodec, NewServerCodec: jsonrpc.NewServerCodec},
+	{Name: "jsonrpc2", NewClientCodec: jsonrpc2.NewClientCodec, NewServerCodec: jsonrpc2.NewServerCodec},
+	{Name: "msgpack", NewClientCodec: msgpackrpc.NewClientCodec, NewServerCodec: msgpackrpc.NewServerCodec},
+	{Name: "proto", NewClientCodec: protorpc.NewClientCodec, NewServerCodec: protorpc.NewServerCodec},
+}
+
+func TestWireFormats(t *testing.T) {
+	for _, c := range codecs {
+		if err := Check("testdata", c, Fixtures(), *update); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestCheckChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wiretest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fixtures := Fixtures()
+	if err = Check(dir, codecs[0], fixtures, false); err != nil {
+		t.Fatal(err)
+	}
+	fixtures[0].Reply = Account{ID: "1002"}
+	if err = Check(dir, codecs[0], fixtures, false); err == nil ||
+		!strings.HasSuffix(err.Error(), "changed: struct_reply.response") {
+		t.Errorf("expected the response to change, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "gob", "scalar.request")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,292 @@
+package birpc
+
+import (
+	"container/heap"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WorkerPool makes the server run the calls on a pool of up to workers
+// goroutines instead of a goroutine per call, queueing up to queueSize
+// calls while all the workers are busy. The calls which do not fit in the
+// queue fail with ErrServerBusy, so a flood of calls cannot pile up
+// goroutines. The pool is shared by all the connections of the server and
+// its workers exit when idle. It is most useful on a BirpcClient, bounding
+// the work the server can push to it.
+//
+// With a queueSize of 0 the calls only run if a worker is free, failing
+// otherwise. WorkerPool panics if workers is not positive or queueSize is
+// negative.
+//
+// The nested calls (see CallDepth) bypass the pool since the call they are
+// nested in may hold the last worker while waiting for them. With
+// SerialRequests the pool is not used.
+func WorkerPool(workers, queueSize int) ServerOption {
+	if workers < 1 {
+		panic("rpc: WorkerPool needs at least one worker")
+	}
+	if queueSize < 0 {
+		panic("rpc: negative WorkerPool queue size")
+	}
+	return func(server *basicServer) {
+		server.pool = &workerPool{
+			max:   int64(workers),
+			queue: make(chan func(), queueSize),
+		}
+		server.orderPool()
+	}
+}
+
+// orderPool replaces the queue of the pool as required by the options
+// ordering the calls, which apply before or after WorkerPool.
+func (server *basicServer) orderPool() {
+	if server.pool == nil {
+		return
+	}
+	size := cap(server.pool.queue)
+	switch {
+	case server.fair:
+		server.pool.ordered = &fairQueue{size: size, conns: make(map[*serverConn]*fairConn)}
+	case server.edf:
+		server.pool.ordered = &edfQueue{size: size}
+	}
+}
+
+// EarliestDeadlineFirst makes the WorkerPool run the queued calls by
+// deadline, propagated by the client, carried by the arguments (see
+// Deadlined) or set by the CallTimeout, the calls without one last. With
+// FairQueueing the order applies to the calls of each connection.
+func EarliestDeadlineFirst() ServerOption {
+	return func(server *basicServer) {
+		server.edf = true
+		server.orderPool()
+	}
+}
+
+// Deadlined is implemented by the arguments carrying the deadline of the
+// call as propagated by the caller, ordering the calls queued with
+// EarliestDeadlineFirst. The zero time means no deadline.
+type Deadlined interface {
+	CallDeadline() time.Time
+}
+
+// queueDeadline returns the deadline ordering the call req with the
+// arguments argv in the queue of the pool, zero without EarliestDeadlineFirst.
+func (server *basicServer) queueDeadline(req *Request, argv reflect.Value) time.Time {
+	if !server.edf {
+		return time.Time{}
+	}
+	if !req.deadline.IsZero() {
+		return req.deadline
+	}
+	if d, ok := argv.Interface().(Deadlined); ok {
+		if deadline := d.CallDeadline(); !deadline.IsZero() {
+			return deadline
+		}
+	}
+	if timeout := server.getConfig().CallTimeout; timeout > 0 {
+		return time.Now().Add(timeout)
+	}
+	return time.Time{}
+}
+
+// WorkerPoolStats describes the state of the worker pool of a server.
+type WorkerPoolStats struct {
+	Workers  int    // running workers
+	Busy     int    // workers running a call
+	Queued   int    // calls waiting for a worker
+	Served   uint64 // calls run by the pool
+	Rejected uint64 // calls rejected with the queue full
+}
+
+// WorkerPoolStats returns the statistics of the worker pool, zero if the
+// server has none.
+func (server *basicServer) WorkerPoolStats() (s WorkerPoolStats) {
+	p := server.pool
+	if p == nil {
+		return
+	}
+	return WorkerPoolStats{
+		Workers:  int(atomic.LoadInt64(&p.workers)),
+		Busy:     int(atomic.LoadInt64(&p.busy)),
+		Queued:   p.queued(),
+		Served:   atomic.LoadUint64(&p.served),
+		Rejected: atomic.LoadUint64(&p.rejected),
+	}
+}
+
+type workerPool struct {
+	// the atomic counters lead, keeping them 64-bit aligned on 386 and ARM
+	workers  int64
+	busy     int64
+	served   uint64
+	rejected uint64
+
+	max   int64
+	queue chan func()
+	// ordered replaces queue with EarliestDeadlineFirst or FairQueueing
+	ordered callQueue
+}
+
+// callQueue orders the calls queued in the pool.
+type callQueue interface {
+	push(f func(), deadline time.Time, conn *serverConn) bool // false if full
+	pop() func()                                              // nil if empty
+	len() int
+}
+
+// submit runs f, the call read from conn, on a free worker, or else
+// queues it, reporting false if the queue is full. deadline only matters
+// with EarliestDeadlineFirst.
+func (p *workerPool) submit(f func(), deadline time.Time, conn *serverConn) bool {
+	if p.queued() == 0 && p.addWorker() {
+		go p.work(f)
+		return true
+	}
+	if p.ordered != nil {
+		if !p.ordered.push(f, deadline, conn) {
+			atomic.AddUint64(&p.rejected, 1)
+			return false
+		}
+	} else {
+		select {
+		case p.queue <- f:
+		default:
+			atomic.AddUint64(&p.rejected, 1)
+			return false
+		}
+	}
+	// a worker may have left since
+	if p.addWorker() {
+		go p.work(nil)
+	}
+	return true
+}
+
+// addWorker reserves a worker slot, reporting false if all are taken.
+func (p *workerPool) addWorker() bool {
+	for {
+		n := atomic.LoadInt64(&p.workers)
+		if n >= p.max {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&p.workers, n, n+1) {
+			return true
+		}
+	}
+}
+
+// work runs f, unless nil, then the queued calls until none is left.
+func (p *workerPool) work(f func()) {
+	for {
+		if f == nil {
+			f = p.next()
+		}
+		if f != nil {
+			atomic.AddInt64(&p.busy, 1)
+			f()
+			atomic.AddInt64(&p.busy, -1)
+			atomic.AddUint64(&p.served, 1)
+			f = nil
+			continue
+		}
+		atomic.AddInt64(&p.workers, -1)
+		// a call queued while leaving may have found no free slot
+		if p.queued() == 0 || !p.addWorker() {
+			return
+		}
+	}
+}
+
+// next dequeues the next call to run, nil if there is none.
+func (p *workerPool) next() func() {
+	if p.ordered != nil {
+		return p.ordered.pop()
+	}
+	select {
+	case f := <-p.queue:
+		return f
+	default:
+		return nil
+	}
+}
+
+func (p *workerPool) queued() int {
+	if p.ordered != nil {
+		return p.ordered.len()
+	}
+	return len(p.queue)
+}
+
+// edfQueue queues the calls of the pool by earliest deadline.
+type edfQueue struct {
+	mu    sync.Mutex
+	size  int
+	calls edfCalls
+	seq   uint64 // breaks the ties in the order of the pushes
+}
+
+type edfCall struct {
+	f        func()
+	deadline time.Time
+	seq      uint64
+}
+
+func (q *edfQueue) push(f func(), deadline time.Time, conn *serverConn) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.calls) >= q.size {
+		return false
+	}
+	q.seq++
+	heap.Push(&q.calls, edfCall{f: f, deadline: deadline, seq: q.seq})
+	return true
+}
+
+func (q *edfQueue) pop() func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.calls) == 0 {
+		return nil
+	}
+	return heap.Pop(&q.calls).(edfCall).f
+}
+
+func (q *edfQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.calls)
+}
+
+// edfCalls is a heap of calls, the earliest deadline first and the calls
+// without deadline last.
+type edfCalls []edfCall
+
+func (h edfCalls) Len() int { return len(h) }
+
+func (h edfCalls) Less(i, j int) bool {
+	di, dj := h[i].deadline, h[j].deadline
+	switch {
+	case di.Equal(dj):
+		return h[i].seq < h[j].seq
+	case di.IsZero():
+		return false
+	case dj.IsZero():
+		return true
+	}
+	return di.Before(dj)
+}
+
+func (h edfCalls) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *edfCalls) Push(x interface{}) { *h = append(*h, x.(edfCall)) }
+
+func (h *edfCalls) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = edfCall{}
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,165 @@
+package birpc
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+type Blocker struct {
+	release chan struct{}
+}
+
+func (b *Blocker) Hold(ctx *context.Context, i int) error {
+	<-b.release
+	return nil
+}
+
+// Flooder pushes calls to the client calling it.
+type Flooder struct{}
+
+func (Flooder) Flood(ctx *context.Context, n int) error {
+	client := ctx.Client.(*BirpcClient)
+	for i := 0; i < n; i++ {
+		client.Notify("Blocker.Hold", i)
+	}
+	return nil
+}
+
+// waitStats waits for the worker pool stats returned by stats to satisfy
+// cond.
+func waitStats(t *testing.T, stats func() WorkerPoolStats, cond func(WorkerPoolStats) bool) {
+	t.Helper()
+	if !eventually(func() bool { return cond(stats()) }) {
+		t.Fatalf("unexpected worker pool stats %+v", stats())
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	server := NewBirpcServer()
+	server.Register(Flooder{}, NoReplyMethods())
+	server.Register(new(Chain), NoReplyMethods())
+	blocker := &Blocker{release: make(chan struct{})}
+	client := NewBirpcClient(newBirpcPipe(t, server), WorkerPool(2, 3))
+	defer client.Close()
+	client.Register(blocker, NoReplyMethods())
+	client.Register(new(Chain), NoReplyMethods())
+
+	if err := client.Call(context.Background(), "Flooder.Flood", 10, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, client.WorkerPoolStats, func(s WorkerPoolStats) bool {
+		return s.Workers == 2 && s.Busy == 2 && s.Queued == 3 && s.Rejected == 5
+	})
+	// the nested calls are served with all the workers busy
+	var depth int
+	if err := client.Call(context.Background(), "Chain.Next", 3, &depth); err != nil || depth != 3 {
+		t.Errorf("expected depth 3, got %d: %v", depth, err)
+	}
+	close(blocker.release)
+	waitStats(t, client.WorkerPoolStats, func(s WorkerPoolStats) bool {
+		return s.Workers == 0 && s.Served == 5
+	})
+	if s := NewServer().WorkerPoolStats(); s != (WorkerPoolStats{}) {
+		t.Errorf("expected no stats without pool, got %+v", s)
+	}
+}
+
+func TestWorkerPoolWithoutQueue(t *testing.T) {
+	server := NewServer(WorkerPool(2, 0))
+	blocker := &Blocker{release: make(chan struct{})}
+	server.Register(blocker, NoReplyMethods())
+	client := newPipeClient(t, server)
+	ctx := context.Background()
+	done := make(chan *Call, 2)
+	for i := 0; i < 2; i++ {
+		client.Go("Blocker.Hold", i, nil, done)
+	}
+	waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Busy == 2 })
+	if err := client.Call(ctx, "Blocker.Hold", 2, nil); err == nil || err.Error() != ErrServerBusy.Error() {
+		t.Errorf("expected %q, got %v", ErrServerBusy, err)
+	}
+	close(blocker.release)
+	for i := 0; i < 2; i++ {
+		if call := <-done; call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	}
+	// the calls run once a worker is free
+	waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Workers == 0 })
+	if err := client.Call(ctx, "Blocker.Hold", 3, nil); err != nil {
+		t.Error(err)
+	}
+	waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Served == 3 && s.Rejected == 1 })
+}
+
+func TestWorkerPoolBadSize(t *testing.T) {
+	for _, size := range [][2]int{{0, 1}, {1, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected WorkerPool%v to panic", size)
+				}
+			}()
+			WorkerPool(size[0], size[1])
+		}()
+	}
+}
+
+type DeadlineArgs struct {
+	N        int
+	Deadline time.Time
+}
+
+func (a DeadlineArgs) CallDeadline() time.Time { return a.Deadline }
+
+// Recorder records the order of its calls, the first one waiting for
+// release.
+type Recorder struct {
+	release chan struct{}
+	mu      sync.Mutex
+	order   []int
+}
+
+func (r *Recorder) Record(ctx *context.Context, args DeadlineArgs, reply *int) error {
+	if args.N == 0 {
+		<-r.release
+	}
+	r.mu.Lock()
+	r.order = append(r.order, args.N)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestEarliestDeadlineFirst(t *testing.T) {
+	// the options apply in any order
+	server := NewServer(EarliestDeadlineFirst(), WorkerPool(1, 4))
+	rec := &Recorder{release: make(chan struct{})}
+	server.Register(rec)
+	client := newPipeClient(t, server)
+	done := make(chan *Call, 5)
+	client.Go("Recorder.Record", DeadlineArgs{N: 0}, new(int), done)
+	waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Busy == 1 })
+	now := time.Now()
+	for _, args := range []DeadlineArgs{
+		{N: 1, Deadline: now.Add(3 * time.Second)},
+		{N: 2, Deadline: now.Add(time.Second)},
+		{N: 3},
+		{N: 4, Deadline: now.Add(2 * time.Second)},
+	} {
+		client.Go("Recorder.Record", args, new(int), done)
+	}
+	waitStats(t, server.WorkerPoolStats, func(s WorkerPoolStats) bool { return s.Queued == 4 })
+	close(rec.release)
+	for i := 0; i < 5; i++ {
+		if call := <-done; call.Error != nil {
+			t.Fatal(call.Error)
+		}
+	}
+	if want := []int{0, 2, 4, 1, 3}; !reflect.DeepEqual(rec.order, want) {
+		t.Errorf("expected the order %v, got %v", want, rec.order)
+	}
+}
@@ -0,0 +1,76 @@
+package birpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// errNoWriteDeadline is returned by the codecs whose connection does not
+// support write deadlines.
+var errNoWriteDeadline = errors.New("rpc: connection does not support write deadlines")
+
+// writeDeadliner is implemented by the codecs able to bound their writes,
+// usually by delegating to a net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// setWriteDeadline sets the write deadline of rwc if supported.
+func setWriteDeadline(rwc interface{}, t time.Time) error {
+	if wd, ok := rwc.(writeDeadliner); ok {
+		return wd.SetWriteDeadline(t)
+	}
+	return errNoWriteDeadline
+}
+
+// writeInterrupted reports whether a write guarded by ctx may have failed
+// because of it. The write deadline can expire before ctx is marked done.
+func writeInterrupted(ctx *context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	d, has := ctx.Deadline()
+	return has && !time.Now().Before(d)
+}
+
+// aLongTimeAgo is a deadline interrupting the pending writes at once.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// guardWrite bounds the write of a request by ctx, for the codecs
+// supporting write deadlines: the deadline of ctx becomes the write
+// deadline and cancelling ctx interrupts the write. The returned function
+// ends the guard and must be called once the write is over; it is nil if
+// the write is not guarded.
+func (client *basicClient) guardWrite(ctx *context.Context) (end func()) {
+	if ctx == nil || ctx.Done() == nil {
+		return nil
+	}
+	wd, ok := client.wc.(writeDeadliner)
+	if !ok {
+		return nil
+	}
+	if d, has := ctx.Deadline(); has {
+		if wd.SetWriteDeadline(d) != nil {
+			return nil
+		}
+	}
+	stop, exited := make(chan struct{}), make(chan struct{})
+	var interrupted int32
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&interrupted, 1)
+			wd.SetWriteDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+		<-exited
+		wd.SetWriteDeadline(time.Time{})
+	}
+}
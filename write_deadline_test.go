@@ -0,0 +1,57 @@
+package birpc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+func TestWriteDeadline(t *testing.T) {
+	for name, cancelAfter := range map[string]time.Duration{
+		"deadline": 0,
+		"cancel":   20 * time.Millisecond,
+	} {
+		c1, c2 := net.Pipe() // nobody reads c2, so every write blocks
+		defer c2.Close()
+		client := NewClient(c1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if cancelAfter != 0 {
+			ctx, cancel = context.WithCancel(context.Background())
+			time.AfterFunc(cancelAfter, cancel)
+		}
+		start := time.Now()
+		err := client.Call(ctx, "Arith.Add", &Args{1, 2}, new(Reply))
+		exp := context.DeadlineExceeded
+		if cancelAfter != 0 {
+			exp = context.Canceled
+		}
+		cancel()
+		if err != exp {
+			t.Errorf("%s: expected %v, got %v", name, exp, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: the call took %v", name, elapsed)
+		}
+		// the stream is broken, so the connection is closed
+		if err = client.Call(context.Background(), "Arith.Add", &Args{1, 2}, new(Reply)); err == nil {
+			t.Errorf("%s: expected the connection to be closed", name)
+		}
+	}
+
+	// the deadline does not outlive the call
+	server := NewServer()
+	server.Register(new(Arith))
+	client := newPipeClient(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := client.Call(ctx, "Arith.Add", &Args{1, 2}, new(Reply)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := client.Call(context.Background(), "Arith.Add", &Args{1, 2}, new(Reply)); err != nil {
+		t.Errorf("expected the write deadline to be cleared, got %v", err)
+	}
+}
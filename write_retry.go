@@ -0,0 +1,95 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"time"
+)
+
+// WriteRetries makes the server retry, up to attempts times and waiting
+// backoff in between, the writes failing with a transient error on the
+// connections it serves with ServeConn, instead of failing the response
+// and leaving the connection with a message cut short, see RetryWrites. With ServeCodec wrap the
+// connection given to the codec with RetryWrites instead.
+func WriteRetries(attempts int, backoff time.Duration) ServerOption {
+	return func(server *basicServer) {
+		server.writeRetry = &writeRetry{attempts: attempts, backoff: backoff}
+	}
+}
+
+// RetryWrites returns conn with its writes retried up to attempts times,
+// waiting backoff in between, when they fail with a transient error:
+// EAGAIN, a temporary network error other than a timeout, or a short
+// write. The retries resume after the bytes already written, so the
+// stream is kept intact. A net.Conn stays a net.Conn.
+func RetryWrites(conn io.ReadWriteCloser, attempts int, backoff time.Duration) io.ReadWriteCloser {
+	return (&writeRetry{attempts: attempts, backoff: backoff}).wrap(conn)
+}
+
+type writeRetry struct {
+	attempts int
+	backoff  time.Duration
+}
+
+func (r *writeRetry) wrap(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	if r == nil {
+		return conn
+	}
+	if nc, ok := conn.(net.Conn); ok {
+		return &retryWriteNetConn{Conn: nc, retry: r}
+	}
+	return &retryWriteConn{ReadWriteCloser: conn, retry: r}
+}
+
+// write writes p to w, retrying on the transient errors.
+func (r *writeRetry) write(w io.Writer, p []byte) (n int, err error) {
+	for attempt := 0; ; attempt++ {
+		var m int
+		m, err = w.Write(p[n:])
+		if n += m; n == len(p) {
+			return n, err
+		}
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+		if attempt >= r.attempts || !isTransientWriteError(err) {
+			return
+		}
+		debugln("rpc: retrying write after:", err)
+		if r.backoff > 0 {
+			time.Sleep(r.backoff)
+		}
+	}
+}
+
+// isTransientWriteError reports whether a write failing with err may
+// succeed if tried again.
+func isTransientWriteError(err error) bool {
+	if err == io.ErrShortWrite || errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Temporary() && !netErr.Timeout()
+}
+
+type retryWriteConn struct {
+	io.ReadWriteCloser
+	retry *writeRetry
+}
+
+func (c *retryWriteConn) Write(p []byte) (int, error) {
+	return c.retry.write(c.ReadWriteCloser, p)
+}
+
+type retryWriteNetConn struct {
+	net.Conn
+	retry *writeRetry
+}
+
+func (c *retryWriteNetConn) Write(p []byte) (int, error) {
+	return c.retry.write(c.Conn, p)
+}
+
+func (c *retryWriteNetConn) unwrapConn() net.Conn { return c.Conn }
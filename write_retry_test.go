@@ -0,0 +1,74 @@
+package birpc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cgrates/birpc/context"
+)
+
+// flakyConn fails every other write with err, after writing half of it.
+type flakyConn struct {
+	net.Conn
+	err    error
+	writes int
+}
+
+func (c *flakyConn) Write(p []byte) (int, error) {
+	if c.writes++; c.writes%2 == 1 && len(p) > 1 {
+		n, _ := c.Conn.Write(p[:len(p)/2])
+		return n, c.err
+	}
+	return c.Conn.Write(p)
+}
+
+func TestWriteRetries(t *testing.T) {
+	server := NewServer(WriteRetries(1, 0))
+	server.Register(new(Arith))
+	c1, c2 := net.Pipe()
+	go server.ServeConn(&flakyConn{Conn: c2, err: syscall.EAGAIN})
+	client := NewClient(c1)
+	defer client.Close()
+	for i := 0; i < 10; i++ {
+		reply := new(Reply)
+		if err := client.Call(context.Background(), "Arith.Add", &Args{i, 1}, reply); err != nil || reply.C != i+1 {
+			t.Fatalf("unexpected reply %+v: %v", reply, err)
+		}
+	}
+
+	// without retries the response is cut short
+	server = NewServer()
+	server.Register(new(Arith))
+	c1, c2 = net.Pipe()
+	go server.ServeConn(&flakyConn{Conn: c2, err: syscall.EAGAIN})
+	client = NewClient(c1)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.Call(ctx, "Arith.Add", &Args{1, 1}, new(Reply)); err == nil {
+		t.Error("expected the call to fail")
+	}
+}
+
+func TestRetryWrites(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	go io.Copy(io.Discard, c1)
+	flaky := &flakyConn{Conn: c2, err: errors.New("broken")}
+	conn := RetryWrites(flaky, 3, 0)
+	if _, ok := conn.(net.Conn); !ok {
+		t.Error("expected a net.Conn")
+	}
+	if n, err := conn.Write([]byte("0123")); err == nil || n != 2 || flaky.writes != 1 {
+		t.Errorf("expected no retry of a permanent error, wrote %d in %d writes: %v", n, flaky.writes, err)
+	}
+
+	flaky.err = io.ErrShortWrite
+	if n, err := conn.Write([]byte("0123")); err != nil || n != 4 {
+		t.Errorf("unexpected write of %d bytes: %v", n, err)
+	}
+}